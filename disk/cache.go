@@ -0,0 +1,652 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package disk 基于本地目录的缓存，适合放不进内存、也不值得放进 Redis 的冷数据
+//
+// 数据按照日志结构追加写入到一个个数据文件里面，内存中只保存 key 到记录位置的索引以及过期时间，
+// 所以读取一个 key 只需要一次磁盘读。覆盖和删除都是追加新的记录，旧的记录由压缩回收。
+// 启动的时候按照从旧到新的顺序扫描所有的数据文件重建索引，最新的数据文件末尾写到一半的记录会被截断，
+// 其它位置的记录损坏会让 Open 返回 ErrCorrupted
+package disk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/snapshot"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+var _ ecache.Cache = (*Cache)(nil)
+
+var (
+	ErrKeyTooLong = fmt.Errorf("ecache: key 的长度不能超过 %d 字节", maxKeyLen)
+	ErrClosed     = errors.New("ecache: 缓存已经关闭")
+
+	errOnlyListCanLPush = errors.New("ecache: 只有 list 类型的数据，才能执行 LPush")
+	errOnlyListCanLPop  = errors.New("ecache: 只有 list 类型的数据，才能执行 LPop")
+	errOnlySetCanSAdd   = errors.New("ecache: 只有 set 类型的数据，才能执行 SAdd")
+	errOnlySetCanSRem   = errors.New("ecache: 只有 set 类型的数据，才能执行 SRem")
+	errOnlyNumCanIncrBy = errors.New("ecache: 只有数字类型的数据，才能执行 IncrBy")
+	errOnlyNumCanDecrBy = errors.New("ecache: 只有数字类型的数据，才能执行 DecrBy")
+)
+
+// indexEntry 一个 key 最新的记录所在的位置
+type indexEntry struct {
+	segment   uint32
+	offset    int64
+	size      uint32
+	expiresAt int64
+}
+
+func (e indexEntry) expired(now int64) bool {
+	return e.expiresAt != 0 && now >= e.expiresAt
+}
+
+// Cache 基于本地目录的缓存
+// 列表和集合整体保存在一条记录里面，每次修改都会重写整个值，所以不适合很大的集合
+// Get 列表和集合的时候返回 []any
+type Cache struct {
+	lock     sync.RWMutex
+	dir      string
+	index    map[string]indexEntry
+	segments map[uint32]*segment
+	active   *segment
+	codec    valueCodec
+	// buf 和 valueBuf 编码记录的时候复用，受 lock 保护
+	buf      []byte
+	valueBuf []byte
+
+	segmentSize     int64
+	syncWrites      bool
+	compactRatio    float64
+	compactInterval time.Duration
+	done            chan struct{}
+	closeOnce       sync.Once
+	// closed Close 之后为 true，受 lock 保护，之后的读写和压缩都返回 ErrClosed
+	closed bool
+}
+
+// WithSegmentSize 单个数据文件的大小上限，写满之后切换到新的数据文件，默认 64MB
+func WithSegmentSize(size int64) option.Option[Cache] {
+	return func(c *Cache) {
+		c.segmentSize = size
+	}
+}
+
+// WithSyncWrites 每次写入之后都调用 fsync，默认只在切换数据文件和关闭的时候调用
+func WithSyncWrites(sync bool) option.Option[Cache] {
+	return func(c *Cache) {
+		c.syncWrites = sync
+	}
+}
+
+// WithCodec 设置编码值使用的 Codec，默认是 snapshot.GobCodec
+// string、[]byte、int64 和 float64 不经过 Codec
+func WithCodec(codec snapshot.Codec) option.Option[Cache] {
+	return func(c *Cache) {
+		c.codec.codec = codec
+	}
+}
+
+// WithCompactRatio 可以回收的空间超过数据文件的 ratio 之后才会压缩这个数据文件，默认 0.5
+func WithCompactRatio(ratio float64) option.Option[Cache] {
+	return func(c *Cache) {
+		c.compactRatio = ratio
+	}
+}
+
+// WithCompactInterval 自动压缩的间隔，默认一分钟，0 表示只能手动调用 Compact
+func WithCompactInterval(interval time.Duration) option.Option[Cache] {
+	return func(c *Cache) {
+		c.compactInterval = interval
+	}
+}
+
+// Open 打开 dir 里面的数据，dir 不存在的时候会被创建
+// 同一个目录同时只能被一个 Cache 打开
+func Open(dir string, opts ...option.Option[Cache]) (*Cache, error) {
+	c := &Cache{
+		dir:             dir,
+		index:           make(map[string]indexEntry),
+		segments:        make(map[uint32]*segment),
+		segmentSize:     64 << 20,
+		compactRatio:    0.5,
+		compactInterval: time.Minute,
+		done:            make(chan struct{}),
+	}
+	option.Apply(c, opts...)
+	if c.codec.codec == nil {
+		c.codec.codec = snapshot.GobCodec{}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := c.recover(); err != nil {
+		c.closeFiles()
+		return nil, err
+	}
+	if c.compactInterval > 0 {
+		go c.compactCycle()
+	}
+	return c, nil
+}
+
+// recover 按照从旧到新的顺序扫描数据文件重建索引
+func (c *Cache) recover() error {
+	ids, err := listSegments(c.dir)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		seg, err := openSegment(c.dir, id)
+		if err != nil {
+			return err
+		}
+		c.segments[id] = seg
+		// 只有最新的数据文件会在写入的时候崩溃，之前的数据文件切换的时候已经 fsync 过
+		valid, err := seg.scan(i == len(ids)-1, func(offset int64, h recordHeader, key, _ []byte) error {
+			c.apply(seg, string(key), h.kind, indexEntry{
+				segment: id, offset: offset, size: uint32(h.size()), expiresAt: h.expiresAt,
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = seg.file.Truncate(valid); err != nil {
+			return err
+		}
+		seg.size = valid
+		c.active = seg
+	}
+	if c.active == nil {
+		seg, err := openSegment(c.dir, 1)
+		if err != nil {
+			return err
+		}
+		c.segments[seg.id] = seg
+		c.active = seg
+	}
+	return nil
+}
+
+// apply 用 seg 里面的一条记录更新索引
+func (c *Cache) apply(seg *segment, key string, k kind, ent indexEntry) {
+	if old, ok := c.index[key]; ok {
+		c.segments[old.segment].garbage += int64(old.size)
+	}
+	if k == kindTombstone {
+		// 删除标记只在恢复的时候有用
+		seg.garbage += int64(ent.size)
+		delete(c.index, key)
+		return
+	}
+	c.index[key] = ent
+}
+
+// write 追加一条记录并且更新索引【调用该方法必须先获得写锁】
+func (c *Cache) write(key string, k kind, expiresAt int64, value []byte) error {
+	if c.closed {
+		return ErrClosed
+	}
+	if len(key) > maxKeyLen {
+		return ErrKeyTooLong
+	}
+	c.buf = encodeRecord(c.buf[:0], key, k, expiresAt, value)
+	if c.active.size > 0 && c.active.size+int64(len(c.buf)) > c.segmentSize {
+		if err := c.rotate(); err != nil {
+			return err
+		}
+	}
+	offset := c.active.size
+	if err := c.active.write(c.buf); err != nil {
+		return err
+	}
+	if c.syncWrites {
+		if err := c.active.file.Sync(); err != nil {
+			return err
+		}
+	}
+	c.apply(c.active, key, k, indexEntry{
+		segment: c.active.id, offset: offset, size: uint32(len(c.buf)), expiresAt: expiresAt,
+	})
+	return nil
+}
+
+// writeValue 编码 val 之后写入
+func (c *Cache) writeValue(key string, val any, expiresAt int64) error {
+	var (
+		k   kind
+		err error
+	)
+	c.valueBuf, k, err = c.codec.encode(c.valueBuf[:0], val)
+	if err != nil {
+		return err
+	}
+	return c.write(key, k, expiresAt, c.valueBuf)
+}
+
+// writeElems 写入列表或者集合
+func (c *Cache) writeElems(key string, k kind, elems []any, expiresAt int64) error {
+	var err error
+	c.valueBuf, err = c.codec.encodeElems(c.valueBuf[:0], elems)
+	if err != nil {
+		return err
+	}
+	return c.write(key, k, expiresAt, c.valueBuf)
+}
+
+func (c *Cache) delete(key string) error {
+	return c.write(key, kindTombstone, 0, nil)
+}
+
+// rotate 切换到新的数据文件
+func (c *Cache) rotate() error {
+	if err := c.active.file.Sync(); err != nil {
+		return err
+	}
+	seg, err := openSegment(c.dir, c.active.id+1)
+	if err != nil {
+		return err
+	}
+	c.segments[seg.id] = seg
+	c.active = seg
+	return nil
+}
+
+// load 读取没有过期的 key【调用该方法必须先获得锁】
+func (c *Cache) load(key string) (any, kind, indexEntry, error) {
+	if c.closed {
+		return nil, kindTombstone, indexEntry{}, ErrClosed
+	}
+	ent, ok := c.index[key]
+	if !ok || ent.expired(time.Now().UnixNano()) {
+		return nil, kindTombstone, indexEntry{}, errs.ErrKeyNotExist
+	}
+	h, value, err := c.segments[ent.segment].read(ent.offset, ent.size)
+	if err != nil {
+		return nil, kindTombstone, ent, err
+	}
+	val, err := c.codec.decode(h.kind, value)
+	return val, h.kind, ent, err
+}
+
+func expiresAtOf(expiration time.Duration) int64 {
+	if expiration == 0 {
+		return 0
+	}
+	return time.Now().Add(expiration).UnixNano()
+}
+
+func (c *Cache) Set(_ context.Context, key string, val any, expiration time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.writeValue(key, val, expiresAtOf(expiration))
+}
+
+func (c *Cache) SetNX(_ context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return false, ErrClosed
+	}
+	if ent, ok := c.index[key]; ok && !ent.expired(time.Now().UnixNano()) {
+		return false, nil
+	}
+	if err := c.writeValue(key, val, expiresAtOf(expiration)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *Cache) Get(_ context.Context, key string) (val ecache.Value) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	val.Val, _, _, val.Err = c.load(key)
+	return
+}
+
+// GetSet 和 Redis 的 GETSET 一样，新的值永不过期
+func (c *Cache) GetSet(_ context.Context, key string, val string) (result ecache.Value) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result.Val, _, _, result.Err = c.load(key)
+	if result.Err != nil && !errors.Is(result.Err, errs.ErrKeyNotExist) {
+		return
+	}
+	if err := c.write(key, kindString, 0, []byte(val)); err != nil {
+		result.Err = err
+	}
+	return
+}
+
+func (c *Cache) Delete(ctx context.Context, key ...string) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return 0, ErrClosed
+	}
+	var n int64
+	now := time.Now().UnixNano()
+	for _, k := range key {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		ent, ok := c.index[k]
+		if !ok {
+			continue
+		}
+		// 过期的 key 也要写删除标记，否则恢复的时候更早的记录可能会复活
+		if err := c.delete(k); err != nil {
+			return n, err
+		}
+		if !ent.expired(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// LPush 把 val 依次插入到列表的头部，返回列表的长度
+func (c *Cache) LPush(_ context.Context, key string, val ...any) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, k, ent, err := c.load(key)
+	if err != nil && !errors.Is(err, errs.ErrKeyNotExist) {
+		return 0, err
+	}
+	var elems []any
+	if err == nil {
+		if k != kindList {
+			return 0, errOnlyListCanLPush
+		}
+		elems = old.([]any)
+	}
+	res := make([]any, 0, len(val)+len(elems))
+	for i := len(val) - 1; i >= 0; i-- {
+		res = append(res, val[i])
+	}
+	res = append(res, elems...)
+	if err = c.writeElems(key, kindList, res, ent.expiresAt); err != nil {
+		return 0, err
+	}
+	return int64(len(res)), nil
+}
+
+// LPop 移除并返回列表的第一个元素，列表为空之后 key 也会被删除
+func (c *Cache) LPop(_ context.Context, key string) (res ecache.Value) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, k, ent, err := c.load(key)
+	if err != nil {
+		res.Err = err
+		return
+	}
+	if k != kindList {
+		res.Err = errOnlyListCanLPop
+		return
+	}
+	elems := old.([]any)
+	res.Val = elems[0]
+	if len(elems) == 1 {
+		res.Err = c.delete(key)
+		return
+	}
+	res.Err = c.writeElems(key, kindList, elems[1:], ent.expiresAt)
+	return
+}
+
+// SAdd 返回新加入集合的元素数量
+func (c *Cache) SAdd(_ context.Context, key string, members ...any) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, k, ent, err := c.load(key)
+	if err != nil && !errors.Is(err, errs.ErrKeyNotExist) {
+		return 0, err
+	}
+	var elems []any
+	if err == nil {
+		if k != kindSet {
+			return 0, errOnlySetCanSAdd
+		}
+		elems = old.([]any)
+	}
+	exist := make(map[any]struct{}, len(elems)+len(members))
+	for _, elem := range elems {
+		exist[elem] = struct{}{}
+	}
+	var n int64
+	for _, member := range members {
+		if _, ok := exist[member]; !ok {
+			exist[member] = struct{}{}
+			elems = append(elems, member)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, c.writeElems(key, kindSet, elems, ent.expiresAt)
+}
+
+// SRem 返回从集合中删除的元素数量，集合为空之后 key 也会被删除
+func (c *Cache) SRem(_ context.Context, key string, members ...any) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, k, ent, err := c.load(key)
+	if err != nil {
+		return 0, err
+	}
+	if k != kindSet {
+		return 0, errOnlySetCanSRem
+	}
+	removed := make(map[any]struct{}, len(members))
+	for _, member := range members {
+		removed[member] = struct{}{}
+	}
+	elems := old.([]any)
+	res := elems[:0]
+	for _, elem := range elems {
+		if _, ok := removed[elem]; !ok {
+			res = append(res, elem)
+		}
+	}
+	n := int64(len(elems) - len(res))
+	switch {
+	case len(res) == 0:
+		err = c.delete(key)
+	case n > 0:
+		err = c.writeElems(key, kindSet, res, ent.expiresAt)
+	}
+	return n, err
+}
+
+func (c *Cache) IncrBy(_ context.Context, key string, value int64) (int64, error) {
+	return c.incrBy(key, value, errOnlyNumCanIncrBy)
+}
+
+func (c *Cache) DecrBy(_ context.Context, key string, value int64) (int64, error) {
+	return c.incrBy(key, -value, errOnlyNumCanDecrBy)
+}
+
+// incrBy 自增之后保留原本的有效期
+func (c *Cache) incrBy(key string, value int64, typeErr error) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, _, ent, err := c.load(key)
+	if err != nil && !errors.Is(err, errs.ErrKeyNotExist) {
+		return 0, err
+	}
+	if err == nil {
+		num, ok := old.(int64)
+		if !ok {
+			return 0, typeErr
+		}
+		value += num
+	}
+	return value, c.writeValue(key, value, ent.expiresAt)
+}
+
+// IncrByFloat 原本的值是 int64 的时候会被转换为 float64
+func (c *Cache) IncrByFloat(_ context.Context, key string, value float64) (float64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, _, ent, err := c.load(key)
+	if err != nil && !errors.Is(err, errs.ErrKeyNotExist) {
+		return 0, err
+	}
+	if err == nil {
+		switch num := old.(type) {
+		case float64:
+			value += num
+		case int64:
+			value += float64(num)
+		default:
+			return 0, errOnlyNumCanIncrBy
+		}
+	}
+	return value, c.writeValue(key, value, ent.expiresAt)
+}
+
+func (c *Cache) compactCycle() {
+	ticker := time.NewTicker(c.compactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 压缩失败的时候数据文件保持原样，下一次再试
+			_ = c.Compact()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Compact 压缩可以回收的空间超过 compactRatio 的数据文件，正在写入的数据文件不会被压缩
+// 每次只在写锁里面压缩一个数据文件，把其中仍然有效的记录复制到正在写入的数据文件之后删除它
+func (c *Cache) Compact() error {
+	for _, id := range c.compactCandidates() {
+		c.lock.Lock()
+		err := c.compactSegment(id)
+		c.lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactCandidates 按照从旧到新的顺序返回需要压缩的数据文件
+func (c *Cache) compactCandidates() []uint32 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	reclaimable := make(map[uint32]int64, len(c.segments))
+	for id, seg := range c.segments {
+		reclaimable[id] = seg.garbage
+	}
+	now := time.Now().UnixNano()
+	for _, ent := range c.index {
+		if ent.expired(now) {
+			reclaimable[ent.segment] += int64(ent.size)
+		}
+	}
+	var ids []uint32
+	for id, seg := range c.segments {
+		if seg != c.active && seg.size > 0 && float64(reclaimable[id]) >= float64(seg.size)*c.compactRatio {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// compactSegment 压缩一个数据文件【调用该方法必须先获得写锁】
+// 更早的数据文件里面可能还有同一个 key 的旧记录，所以只有压缩最旧的数据文件的时候才能丢掉删除标记
+// Compact 在两个数据文件之间会释放锁，所以这里要检查期间有没有被 Close
+func (c *Cache) compactSegment(id uint32) error {
+	if c.closed {
+		return ErrClosed
+	}
+	seg, ok := c.segments[id]
+	if !ok || seg == c.active {
+		return nil
+	}
+	oldest := true
+	for other := range c.segments {
+		if other < id {
+			oldest = false
+			break
+		}
+	}
+	now := time.Now().UnixNano()
+	_, err := seg.scan(false, func(offset int64, h recordHeader, rawKey, value []byte) error {
+		key := string(rawKey)
+		ent, ok := c.index[key]
+		live := ok && ent.segment == id && ent.offset == offset
+		switch {
+		case live && !ent.expired(now):
+			return c.write(key, h.kind, h.expiresAt, value)
+		case live && oldest:
+			delete(c.index, key)
+		case live:
+			return c.delete(key)
+		case !ok && h.kind == kindTombstone && !oldest:
+			return c.delete(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = c.active.file.Sync(); err != nil {
+		return err
+	}
+	_ = seg.file.Close()
+	delete(c.segments, id)
+	return os.Remove(segmentPath(c.dir, id))
+}
+
+// Close 停止自动压缩，把数据刷到磁盘上并且关闭所有的数据文件，之后的操作都会返回 ErrClosed
+func (c *Cache) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.closed = true
+		err = c.active.file.Sync()
+		if closeErr := c.closeFiles(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+func (c *Cache) closeFiles() error {
+	var err error
+	for _, seg := range c.segments {
+		if closeErr := seg.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,360 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disk
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStruct struct {
+	Name string
+}
+
+func init() {
+	gob.Register(testStruct{})
+}
+
+func openCache(t *testing.T, dir string) *Cache {
+	c, err := Open(dir, WithCompactInterval(0), WithSegmentSize(256))
+	require.NoError(t, err)
+	return c
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c := openCache(t, dir)
+
+	require.NoError(t, c.Set(ctx, "string", "value", 0))
+	require.NoError(t, c.Set(ctx, "bytes", []byte("value"), time.Minute))
+	require.NoError(t, c.Set(ctx, "struct", testStruct{Name: "name"}, 0))
+	require.NoError(t, c.Set(ctx, "expired", "value", time.Millisecond))
+	assert.Equal(t, "value", c.Get(ctx, "string").Val)
+	assert.Equal(t, []byte("value"), c.Get(ctx, "bytes").Val)
+	assert.Equal(t, testStruct{Name: "name"}, c.Get(ctx, "struct").Val)
+	assert.Equal(t, ErrKeyTooLong, c.Set(ctx, strings.Repeat("k", maxKeyLen+1), "value", 0))
+
+	ok, err := c.SetNX(ctx, "string", "other", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "expired").Err)
+	ok, err = c.SetNX(ctx, "expired", "again", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	res := c.GetSet(ctx, "string", "new")
+	require.NoError(t, res.Err)
+	assert.Equal(t, "value", res.Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.GetSet(ctx, "getset", "value").Err)
+	assert.Equal(t, "value", c.Get(ctx, "getset").Val)
+
+	n, err := c.Delete(ctx, "getset", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "getset").Err)
+	require.NoError(t, c.Close())
+}
+
+func TestCache_Close(t *testing.T) {
+	ctx := context.Background()
+	c := openCache(t, t.TempDir())
+	require.NoError(t, c.Set(ctx, "key", "value", 0))
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+
+	assert.Equal(t, ErrClosed, c.Set(ctx, "key", "value", 0))
+	assert.Equal(t, ErrClosed, c.Get(ctx, "key").Err)
+	_, err := c.SetNX(ctx, "key", "value", 0)
+	assert.Equal(t, ErrClosed, err)
+	_, err = c.Delete(ctx, "key")
+	assert.Equal(t, ErrClosed, err)
+	_, err = c.LPush(ctx, "list", "a")
+	assert.Equal(t, ErrClosed, err)
+	_, err = c.IncrBy(ctx, "num", 1)
+	assert.Equal(t, ErrClosed, err)
+}
+
+// TestCache_compactAfterClose Compact 选出数据文件之后 Close，不能再访问已经关闭的文件
+func TestCache_compactAfterClose(t *testing.T) {
+	ctx := context.Background()
+	c := openCache(t, t.TempDir())
+	for i := 0; i < 20; i++ {
+		require.NoError(t, c.Set(ctx, "key", int64(i), 0))
+	}
+	ids := c.compactCandidates()
+	require.NotEmpty(t, ids)
+	require.NoError(t, c.Close())
+	c.lock.Lock()
+	err := c.compactSegment(ids[0])
+	c.lock.Unlock()
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, c.Compact())
+}
+
+func TestCache_collections(t *testing.T) {
+	ctx := context.Background()
+	c := openCache(t, t.TempDir())
+	defer c.Close()
+
+	n, err := c.LPush(ctx, "list", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = c.LPush(ctx, "list", int64(1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, []any{int64(1), "b", "a"}, c.Get(ctx, "list").Val)
+	assert.Equal(t, int64(1), c.LPop(ctx, "list").Val)
+	assert.Equal(t, "b", c.LPop(ctx, "list").Val)
+	assert.Equal(t, "a", c.LPop(ctx, "list").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.LPop(ctx, "list").Err)
+
+	n, err = c.SAdd(ctx, "set", "a", "b", "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = c.SAdd(ctx, "set", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = c.SRem(ctx, "set", "a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = c.SRem(ctx, "set", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = c.SRem(ctx, "set", "b")
+	assert.Equal(t, errs.ErrKeyNotExist, err)
+
+	num, err := c.IncrBy(ctx, "int", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), num)
+	num, err = c.DecrBy(ctx, "int", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-2), num)
+	f, err := c.IncrByFloat(ctx, "int", 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, -1.5, f)
+
+	// 类型不匹配
+	require.NoError(t, c.Set(ctx, "string", "value", 0))
+	_, err = c.LPush(ctx, "string", "a")
+	assert.Equal(t, errOnlyListCanLPush, err)
+	assert.Equal(t, errOnlyListCanLPop, c.LPop(ctx, "string").Err)
+	_, err = c.SAdd(ctx, "string", "a")
+	assert.Equal(t, errOnlySetCanSAdd, err)
+	_, err = c.SRem(ctx, "string", "a")
+	assert.Equal(t, errOnlySetCanSRem, err)
+	_, err = c.IncrBy(ctx, "string", 1)
+	assert.Equal(t, errOnlyNumCanIncrBy, err)
+	_, err = c.DecrBy(ctx, "string", 1)
+	assert.Equal(t, errOnlyNumCanDecrBy, err)
+	_, err = c.IncrByFloat(ctx, "string", 1)
+	assert.Equal(t, errOnlyNumCanIncrBy, err)
+}
+
+func TestCache_keepTTL(t *testing.T) {
+	ctx := context.Background()
+	c := openCache(t, t.TempDir())
+	defer c.Close()
+
+	require.NoError(t, c.Set(ctx, "int", int64(1), 5*time.Millisecond))
+	_, err := c.IncrBy(ctx, "int", 1)
+	require.NoError(t, err)
+	time.Sleep(6 * time.Millisecond)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "int").Err)
+	// 过期之后重新创建的 key 永不过期
+	num, err := c.IncrBy(ctx, "int", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), num)
+	time.Sleep(6 * time.Millisecond)
+	assert.NoError(t, c.Get(ctx, "int").Err)
+}
+
+func TestCache_recover(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c := openCache(t, dir)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, c.Set(ctx, "key", int64(i), 0))
+	}
+	require.NoError(t, c.Set(ctx, "deleted", "value", 0))
+	_, err := c.Delete(ctx, "deleted")
+	require.NoError(t, err)
+	_, err = c.SAdd(ctx, "set", "a", "b")
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+	ids, err := listSegments(dir)
+	require.NoError(t, err)
+	assert.Greater(t, len(ids), 1)
+
+	// 模拟写入一半的时候崩溃
+	last := segmentPath(dir, ids[len(ids)-1])
+	info, err := os.Stat(last)
+	require.NoError(t, err)
+	f, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	torn := encodeRecord(nil, "torn", kindString, 0, []byte("value"))
+	_, err = f.Write(torn[:headerSize+3])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c = openCache(t, dir)
+	defer c.Close()
+	assert.Equal(t, int64(19), c.Get(ctx, "key").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "deleted").Err)
+	assert.ElementsMatch(t, []any{"a", "b"}, c.Get(ctx, "set").Val)
+	truncated, err := os.Stat(last)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+	require.NoError(t, c.Set(ctx, "after", "value", 0))
+	assert.Equal(t, "value", c.Get(ctx, "after").Val)
+}
+
+func TestCache_corrupted(t *testing.T) {
+	testCases := []struct {
+		name string
+		// segment 损坏第几个数据文件，负数从最新的开始数
+		segment int
+	}{
+		{name: "old segment", segment: 0},
+		{name: "middle of active segment", segment: -1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			c := openCache(t, dir)
+			for i := 0; i < 20; i++ {
+				require.NoError(t, c.Set(ctx, "key", int64(i), 0))
+			}
+			require.NoError(t, c.Close())
+			ids, err := listSegments(dir)
+			require.NoError(t, err)
+			require.Greater(t, len(ids), 1)
+			idx := tc.segment
+			if idx < 0 {
+				idx += len(ids)
+			}
+
+			// 损坏第一条记录的值，后面还有完整的记录
+			f, err := os.OpenFile(segmentPath(dir, ids[idx]), os.O_RDWR, 0o644)
+			require.NoError(t, err)
+			_, err = f.WriteAt([]byte{0xff}, headerSize+3)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			_, err = Open(dir, WithCompactInterval(0), WithSegmentSize(256))
+			assert.ErrorIs(t, err, ErrCorrupted)
+		})
+	}
+}
+
+func TestCache_Compact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c := openCache(t, dir)
+	// 同一个 key 被反复覆盖，旧的数据文件几乎都是垃圾
+	require.NoError(t, c.Set(ctx, "forever", "value", 0))
+	for i := 0; i < 50; i++ {
+		require.NoError(t, c.Set(ctx, "key", int64(i), 0))
+	}
+	require.NoError(t, c.Set(ctx, "ttl", "value", time.Millisecond))
+	require.NoError(t, c.Set(ctx, "deleted", "old", 0))
+	_, err := c.Delete(ctx, "deleted")
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.Set(ctx, "padding", int64(i), 0))
+	}
+	time.Sleep(2 * time.Millisecond)
+	before, err := listSegments(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Compact())
+	after, err := listSegments(dir)
+	require.NoError(t, err)
+	assert.Less(t, len(after), len(before))
+	assert.Equal(t, "value", c.Get(ctx, "forever").Val)
+	assert.Equal(t, int64(49), c.Get(ctx, "key").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "ttl").Err)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "deleted").Err)
+	require.NoError(t, c.Close())
+
+	// 压缩之后恢复的数据和压缩之前一致，删除的 key 不会复活
+	c = openCache(t, dir)
+	defer c.Close()
+	assert.Equal(t, "value", c.Get(ctx, "forever").Val)
+	assert.Equal(t, int64(49), c.Get(ctx, "key").Val)
+	assert.Equal(t, int64(9), c.Get(ctx, "padding").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "ttl").Err)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "deleted").Err)
+}
+
+func TestCache_compactKeepsTombstones(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c := openCache(t, dir)
+	// 第一个数据文件里面是 key 的旧值，之后的数据文件里面是删除标记和大量垃圾
+	require.NoError(t, c.Set(ctx, "key", strings.Repeat("v", 200), 0))
+	require.NoError(t, c.Set(ctx, "first", strings.Repeat("v", 200), 0))
+	_, err := c.Delete(ctx, "key")
+	require.NoError(t, err)
+	for i := 0; i < 30; i++ {
+		require.NoError(t, c.Set(ctx, "garbage", int64(i), 0))
+	}
+
+	c.lock.Lock()
+	ids := make([]uint32, 0, len(c.segments))
+	for id := range c.segments {
+		if c.segments[id] != c.active && id != 1 {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		require.NoError(t, c.compactSegment(id))
+	}
+	c.lock.Unlock()
+	require.NoError(t, c.Close())
+
+	c = openCache(t, dir)
+	defer c.Close()
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key").Err)
+	assert.Equal(t, int64(29), c.Get(ctx, "garbage").Val)
+}
+
+func TestCache_autoCompact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c, err := Open(dir, WithSegmentSize(256), WithCompactInterval(10*time.Millisecond), WithSyncWrites(true))
+	require.NoError(t, err)
+	defer c.Close()
+	for i := 0; i < 50; i++ {
+		require.NoError(t, c.Set(ctx, "key", int64(i), 0))
+	}
+	before, err := listSegments(dir)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		after, err := listSegments(dir)
+		return err == nil && len(after) < len(before)
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(49), c.Get(ctx, "key").Val)
+}
@@ -0,0 +1,221 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 每一条记录的格式是：
+//
+//	crc32 uint32 | expiresAt int64 | kind uint8 | keyLen uint16 | valueLen uint32 | key | value
+//
+// crc32 覆盖 expiresAt 开始的所有内容，expiresAt 是过期时间的 Unix 纳秒，0 表示永不过期
+const (
+	headerSize    = 19
+	segmentSuffix = ".seg"
+	maxKeyLen     = 1<<16 - 1
+)
+
+// ErrCorrupted 数据文件损坏。只有最新的数据文件末尾的记录损坏才是写入的时候崩溃留下的，可以安全地截断
+var ErrCorrupted = errors.New("ecache: 数据文件损坏")
+
+func corrupted(id uint32, offset int64) error {
+	return fmt.Errorf("%w，数据文件 %d 位置 %d", ErrCorrupted, id, offset)
+}
+
+// recordHeader 记录的头部
+type recordHeader struct {
+	expiresAt int64
+	kind      kind
+	keyLen    int
+	valueLen  int
+}
+
+func (h recordHeader) size() int64 {
+	return int64(headerSize + h.keyLen + h.valueLen)
+}
+
+// encodeRecord 把一条记录编码到 buf 后面
+func encodeRecord(buf []byte, key string, k kind, expiresAt int64, value []byte) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, headerSize)...)
+	hdr := buf[start:]
+	binary.LittleEndian.PutUint64(hdr[4:12], uint64(expiresAt))
+	hdr[12] = byte(k)
+	binary.LittleEndian.PutUint16(hdr[13:15], uint16(len(key)))
+	binary.LittleEndian.PutUint32(hdr[15:19], uint32(len(value)))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	binary.LittleEndian.PutUint32(buf[start:start+4], crc32.ChecksumIEEE(buf[start+4:]))
+	return buf
+}
+
+// decodeRecord 校验并且解析一条完整的记录
+func decodeRecord(data []byte) (recordHeader, []byte, []byte, error) {
+	var h recordHeader
+	if len(data) < headerSize {
+		return h, nil, nil, ErrCorrupted
+	}
+	h.expiresAt = int64(binary.LittleEndian.Uint64(data[4:12]))
+	h.kind = kind(data[12])
+	h.keyLen = int(binary.LittleEndian.Uint16(data[13:15]))
+	h.valueLen = int(binary.LittleEndian.Uint32(data[15:19]))
+	if int64(len(data)) != h.size() {
+		return h, nil, nil, ErrCorrupted
+	}
+	if crc32.ChecksumIEEE(data[4:]) != binary.LittleEndian.Uint32(data[0:4]) {
+		return h, nil, nil, ErrCorrupted
+	}
+	key := data[headerSize : headerSize+h.keyLen]
+	return h, key, data[headerSize+h.keyLen:], nil
+}
+
+// segment 一个数据文件，只有最新的一个可以写入
+type segment struct {
+	id   uint32
+	file *os.File
+	// size 文件中有效内容的长度
+	size int64
+	// garbage 已经被覆盖、删除的记录以及删除标记占用的字节数
+	garbage int64
+}
+
+func segmentPath(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("%09d%s", id, segmentSuffix))
+}
+
+// listSegments 按照从旧到新的顺序返回目录里面所有数据文件的编号
+func listSegments(dir string) ([]uint32, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint32, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+	// os.ReadDir 按照文件名排序，文件名是补零的编号，所以已经是有序的
+	return ids, nil
+}
+
+func openSegment(dir string, id uint32) (*segment, error) {
+	f, err := os.OpenFile(segmentPath(dir, id), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &segment{id: id, file: f}, nil
+}
+
+// scan 从头读取所有的记录并且交给 fn，返回最后一条完整记录结束的位置，fn 返回错误的时候直接返回这个错误
+// tail 为 true 的时候最后一条记录不完整或者校验失败是写入的时候崩溃留下的，停在它前面，由调用者截断；
+// 其它的损坏都返回 ErrCorrupted，不能把后面的记录一起丢掉
+// 记录的长度不会超过文件剩下的内容，所以每次分配的内存不会超过文件的大小
+func (s *segment) scan(tail bool, fn func(offset int64, h recordHeader, key, value []byte) error) (int64, error) {
+	info, err := s.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if _, err = s.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(s.file)
+	var (
+		offset int64
+		buf    []byte
+	)
+	// torn 最后一条记录损坏的时候返回的结果
+	torn := func() (int64, error) {
+		if tail {
+			return offset, nil
+		}
+		return offset, corrupted(s.id, offset)
+	}
+	for {
+		hdr, err := r.Peek(headerSize)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return offset, err
+			}
+			if len(hdr) == 0 {
+				return offset, nil
+			}
+			return torn()
+		}
+		keyLen := int(binary.LittleEndian.Uint16(hdr[13:15]))
+		valueLen := int(binary.LittleEndian.Uint32(hdr[15:19]))
+		size := headerSize + keyLen + valueLen
+		end := offset + int64(size)
+		if end > info.Size() {
+			// 超出文件末尾的记录是写到一半的，valueLen 也可能已经损坏，不要按照它分配内存
+			return torn()
+		}
+		if cap(buf) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return offset, err
+		}
+		h, key, value, err := decodeRecord(buf)
+		if err != nil {
+			if end == info.Size() {
+				return torn()
+			}
+			return offset, corrupted(s.id, offset)
+		}
+		if err = fn(offset, h, key, value); err != nil {
+			return offset, err
+		}
+		offset = end
+	}
+}
+
+// read 读取 offset 开始的一条记录
+func (s *segment) read(offset int64, size uint32) (recordHeader, []byte, error) {
+	buf := make([]byte, size)
+	if _, err := s.file.ReadAt(buf, offset); err != nil {
+		return recordHeader{}, nil, err
+	}
+	h, _, value, err := decodeRecord(buf)
+	return h, value, err
+}
+
+// write 追加一条记录，写入失败的时候截掉写了一半的内容，避免恢复的时候丢掉之后的记录
+func (s *segment) write(data []byte) error {
+	if _, err := s.file.WriteAt(data, s.size); err != nil {
+		_ = s.file.Truncate(s.size)
+		return err
+	}
+	s.size += int64(len(data))
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disk
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/ecodeclub/ecache/memory/snapshot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	data := encodeRecord(nil, "key", kindString, 123, []byte("value"))
+	h, key, value, err := decodeRecord(data)
+	require.NoError(t, err)
+	assert.Equal(t, "key", string(key))
+	assert.Equal(t, "value", string(value))
+	assert.Equal(t, kindString, h.kind)
+	assert.Equal(t, int64(123), h.expiresAt)
+	assert.Equal(t, int64(len(data)), h.size())
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "short", data: data[:headerSize-1]},
+		{name: "truncated", data: data[:len(data)-1]},
+		{
+			name: "checksum",
+			data: func() []byte {
+				res := append([]byte(nil), data...)
+				res[len(res)-1] = 'x'
+				return res
+			}(),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, err := decodeRecord(tc.data)
+			assert.Equal(t, ErrCorrupted, err)
+		})
+	}
+}
+
+func TestSegment_scan(t *testing.T) {
+	first := encodeRecord(nil, "key", kindString, 0, []byte("value"))
+	second := encodeRecord(nil, "second", kindString, 0, []byte("value"))
+	// badChecksum 校验失败的记录
+	badChecksum := func(data []byte) []byte {
+		res := append([]byte(nil), data...)
+		res[len(res)-1] ^= 0xff
+		return res
+	}
+	// valueLen 损坏成了一个很大的值，不能按照它分配内存
+	tooLong := append([]byte(nil), second...)
+	binary.LittleEndian.PutUint32(tooLong[15:19], math.MaxUint32)
+
+	testCases := []struct {
+		name      string
+		records   [][]byte
+		tail      bool
+		wantValid int64
+		wantKeys  []string
+		wantErr   error
+	}{
+		{
+			name:      "complete",
+			records:   [][]byte{first, second},
+			wantValid: int64(len(first) + len(second)),
+			wantKeys:  []string{"key", "second"},
+		},
+		{
+			name:      "partial header at tail",
+			records:   [][]byte{first, second[:headerSize-1]},
+			tail:      true,
+			wantValid: int64(len(first)),
+			wantKeys:  []string{"key"},
+		},
+		{
+			name:      "length beyond file at tail",
+			records:   [][]byte{first, tooLong},
+			tail:      true,
+			wantValid: int64(len(first)),
+			wantKeys:  []string{"key"},
+		},
+		{
+			name:      "checksum at tail",
+			records:   [][]byte{first, badChecksum(second)},
+			tail:      true,
+			wantValid: int64(len(first)),
+			wantKeys:  []string{"key"},
+		},
+		{
+			name:      "length beyond file without tail",
+			records:   [][]byte{first, tooLong},
+			wantValid: int64(len(first)),
+			wantKeys:  []string{"key"},
+			wantErr:   ErrCorrupted,
+		},
+		{
+			name:      "checksum without tail",
+			records:   [][]byte{first, badChecksum(second)},
+			wantValid: int64(len(first)),
+			wantKeys:  []string{"key"},
+			wantErr:   ErrCorrupted,
+		},
+		{
+			// 后面还有完整的记录，说明不是写入的时候崩溃留下的
+			name:      "checksum before last record",
+			records:   [][]byte{badChecksum(first), second},
+			tail:      true,
+			wantValid: 0,
+			wantErr:   ErrCorrupted,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seg, err := openSegment(t.TempDir(), 1)
+			require.NoError(t, err)
+			defer seg.file.Close()
+			for _, data := range tc.records {
+				require.NoError(t, seg.write(data))
+			}
+			var keys []string
+			valid, err := seg.scan(tc.tail, func(_ int64, _ recordHeader, key, _ []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantValid, valid)
+			assert.Equal(t, tc.wantKeys, keys)
+		})
+	}
+}
+
+func TestValueCodec(t *testing.T) {
+	c := valueCodec{codec: snapshot.GobCodec{}}
+	testCases := []struct {
+		val  any
+		kind kind
+	}{
+		{val: "value", kind: kindString},
+		{val: []byte("value"), kind: kindBytes},
+		{val: int64(-3), kind: kindInt},
+		{val: 1.5, kind: kindFloat},
+		{val: testStruct{Name: "name"}, kind: kindValue},
+	}
+	for _, tc := range testCases {
+		data, k, err := c.encode(nil, tc.val)
+		require.NoError(t, err)
+		assert.Equal(t, tc.kind, k)
+		val, err := c.decode(k, data)
+		require.NoError(t, err)
+		assert.Equal(t, tc.val, val)
+	}
+
+	elems := []any{"a", int64(1), 2.5, []byte("b"), testStruct{Name: "name"}}
+	data, err := c.encodeElems(nil, elems)
+	require.NoError(t, err)
+	val, err := c.decode(kindList, data)
+	require.NoError(t, err)
+	assert.Equal(t, elems, val)
+	_, err = c.decode(kindSet, data[:len(data)-1])
+	assert.Error(t, err)
+	_, err = c.decode(kind(100), data)
+	assert.Equal(t, ErrCorrupted, err)
+}
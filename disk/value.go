@@ -0,0 +1,132 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disk
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/ecodeclub/ecache/memory/snapshot"
+)
+
+// kind 记录里面值的类型
+type kind uint8
+
+const (
+	// kindTombstone 删除标记，没有值
+	kindTombstone kind = iota
+	kindString
+	kindBytes
+	kindInt
+	kindFloat
+	// kindValue 交给 Codec 编码的值
+	kindValue
+	kindList
+	kindSet
+)
+
+// valueCodec 编码值，string、[]byte、int64 和 float64 直接编码，其余的交给 Codec
+type valueCodec struct {
+	codec snapshot.Codec
+}
+
+func (c valueCodec) encode(buf []byte, val any) ([]byte, kind, error) {
+	switch v := val.(type) {
+	case string:
+		return append(buf, v...), kindString, nil
+	case []byte:
+		return append(buf, v...), kindBytes, nil
+	case int64:
+		return binary.AppendVarint(buf, v), kindInt, nil
+	case float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v)), kindFloat, nil
+	default:
+		data, err := c.codec.Marshal(val)
+		return append(buf, data...), kindValue, err
+	}
+}
+
+// encodeElems 编码列表和集合的元素，每个元素是 kind、uvarint 长度和内容
+func (c valueCodec) encodeElems(buf []byte, elems []any) ([]byte, error) {
+	buf = binary.AppendUvarint(buf, uint64(len(elems)))
+	var elem []byte
+	for _, val := range elems {
+		var (
+			k   kind
+			err error
+		)
+		elem, k, err = c.encode(elem[:0], val)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, byte(k))
+		buf = binary.AppendUvarint(buf, uint64(len(elem)))
+		buf = append(buf, elem...)
+	}
+	return buf, nil
+}
+
+func (c valueCodec) decode(k kind, data []byte) (any, error) {
+	switch k {
+	case kindString:
+		return string(data), nil
+	case kindBytes:
+		return append([]byte(nil), data...), nil
+	case kindInt:
+		v, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, ErrCorrupted
+		}
+		return v, nil
+	case kindFloat:
+		if len(data) != 8 {
+			return nil, ErrCorrupted
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	case kindValue:
+		return c.codec.Unmarshal(data)
+	case kindList, kindSet:
+		return c.decodeElems(data)
+	default:
+		return nil, ErrCorrupted
+	}
+}
+
+func (c valueCodec) decodeElems(data []byte) ([]any, error) {
+	n, l := binary.Uvarint(data)
+	if l <= 0 || n > uint64(len(data)) {
+		return nil, ErrCorrupted
+	}
+	data = data[l:]
+	elems := make([]any, 0, n)
+	for i := uint64(0); i < n; i++ {
+		if len(data) < 1 {
+			return nil, ErrCorrupted
+		}
+		k := kind(data[0])
+		size, l := binary.Uvarint(data[1:])
+		if l <= 0 || size > uint64(len(data)-1-l) {
+			return nil, ErrCorrupted
+		}
+		start := 1 + l
+		elem, err := c.decode(k, data[start:start+int(size)])
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		data = data[start+int(size):]
+	}
+	return elems, nil
+}
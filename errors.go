@@ -13,3 +13,10 @@
 // limitations under the License.
 
 package ecache
+
+import "github.com/ecodeclub/ecache/internal/errs"
+
+var (
+	// ErrNotSupported 缓存的实现不支持这个操作，或者不支持这种类型的值
+	ErrNotSupported = errs.ErrNotSupported
+)
@@ -0,0 +1,58 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashring
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Rendezvous 带权重的 rendezvous 哈希（最高随机权重），返回 nodes 中负责 key 的下标，nodes 为空的时候返回 -1
+// 每个结点对 key 打分，得分最高的结点负责这个 key，所以删除结点只会影响这个结点负责的 key。
+// 不需要虚拟结点，但是每次查找的开销和结点的数量成正比
+func Rendezvous(key string, nodes []string, weights []int) int {
+	res, best := -1, math.Inf(-1)
+	for i, node := range nodes {
+		weight := 1
+		if i < len(weights) {
+			weight = weights[i]
+		}
+		if weight <= 0 {
+			continue
+		}
+		// 把哈希值映射到 (0, 1) 区间，得分是 weight / -ln(u)
+		u := (float64(hash64(node, key)>>11) + 0.5) / (1 << 53)
+		score := float64(weight) / -math.Log(u)
+		if score > best {
+			res, best = i, score
+		}
+	}
+	return res
+}
+
+func hash64(node, key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(node))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	// fnv 的低位分布不够均匀，用 splitmix64 的最后一步打散
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
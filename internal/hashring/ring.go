@@ -0,0 +1,118 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hashring 实现一致性哈希和 rendezvous 哈希，供需要把 key 分配到多个结点上的缓存复用
+package hashring
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// Ring 带权重的一致性哈希环，每个结点在环上有 replicas * weight 个虚拟结点
+// 增加或者删除一个结点只会影响这个结点负责的那部分 key，调用方负责保证并发安全
+type Ring struct {
+	replicas int
+	weights  map[string]int
+	hashes   []uint32
+	// owners 和 hashes 一一对应，是虚拟结点所属的结点
+	owners []string
+}
+
+func New(replicas int) *Ring {
+	if replicas < 1 {
+		replicas = 1
+	}
+	return &Ring{
+		replicas: replicas,
+		weights:  make(map[string]int),
+	}
+}
+
+// Set 加入结点或者修改结点的权重，weight 小于等于 0 的时候删除结点
+func (r *Ring) Set(node string, weight int) {
+	if weight <= 0 {
+		r.Remove(node)
+		return
+	}
+	r.weights[node] = weight
+	r.rebuild()
+}
+
+func (r *Ring) Remove(node string) {
+	if _, ok := r.weights[node]; !ok {
+		return
+	}
+	delete(r.weights, node)
+	r.rebuild()
+}
+
+// Nodes 按照名字排序的所有结点
+func (r *Ring) Nodes() []string {
+	res := make([]string, 0, len(r.weights))
+	for node := range r.weights {
+		res = append(res, node)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (r *Ring) Len() int {
+	return len(r.weights)
+}
+
+// rebuild 重新生成整个环，哈希值相同的虚拟结点按照结点的名字排序，保证结果和加入的顺序无关
+func (r *Ring) rebuild() {
+	type vnode struct {
+		hash  uint32
+		owner string
+	}
+	var vnodes []vnode
+	for node, weight := range r.weights {
+		for i := 0; i < r.replicas*weight; i++ {
+			vnodes = append(vnodes, vnode{
+				hash:  crc32.ChecksumIEEE([]byte(node + "-" + strconv.Itoa(i))),
+				owner: node,
+			})
+		}
+	}
+	sort.Slice(vnodes, func(i, j int) bool {
+		if vnodes[i].hash != vnodes[j].hash {
+			return vnodes[i].hash < vnodes[j].hash
+		}
+		return vnodes[i].owner < vnodes[j].owner
+	})
+	r.hashes = make([]uint32, len(vnodes))
+	r.owners = make([]string, len(vnodes))
+	for i, vn := range vnodes {
+		r.hashes[i] = vn.hash
+		r.owners[i] = vn.owner
+	}
+}
+
+// Get 返回负责 key 的结点：环上顺时针方向的第一个虚拟结点，环为空的时候返回 false
+func (r *Ring) Get(key string) (string, bool) {
+	if len(r.hashes) == 0 {
+		return "", false
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[i], true
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashring
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const keys = 10000
+
+// distribute 统计每个结点负责的 key 的数量
+func distribute(pick func(key string) string) map[string]int {
+	res := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		res[pick("key"+strconv.Itoa(i))]++
+	}
+	return res
+}
+
+// moved 统计两种分配方式下负责的结点不同的 key，以及它们在 after 里面属于哪个结点
+func moved(before, after func(key string) string) map[string]int {
+	res := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		key := "key" + strconv.Itoa(i)
+		if b, a := before(key), after(key); b != a {
+			res[a]++
+		}
+	}
+	return res
+}
+
+func ringPick(r *Ring) func(key string) string {
+	return func(key string) string {
+		node, _ := r.Get(key)
+		return node
+	}
+}
+
+func TestRing(t *testing.T) {
+	r := New(160)
+	_, ok := r.Get("key")
+	assert.False(t, ok)
+
+	r.Set("a", 1)
+	r.Set("b", 1)
+	r.Set("c", 2)
+	assert.Equal(t, []string{"a", "b", "c"}, r.Nodes())
+	counts := distribute(ringPick(r))
+	assert.InDelta(t, keys/4, counts["a"], keys/10)
+	assert.InDelta(t, keys/4, counts["b"], keys/10)
+	assert.InDelta(t, keys/2, counts["c"], keys/10)
+
+	// 加入的顺序不影响结果
+	other := New(160)
+	other.Set("c", 2)
+	other.Set("b", 1)
+	other.Set("a", 1)
+	assert.Empty(t, moved(ringPick(r), ringPick(other)))
+
+	// 增加结点之后，移动的 key 都移动到了新的结点上
+	before := New(160)
+	before.Set("a", 1)
+	before.Set("b", 1)
+	before.Set("c", 2)
+	r.Set("d", 1)
+	m := moved(ringPick(before), ringPick(r))
+	assert.Len(t, m, 1)
+	assert.InDelta(t, keys/5, m["d"], keys/10)
+
+	// 删除结点之后，只有这个结点负责的 key 会移动
+	r.Remove("d")
+	assert.Empty(t, moved(ringPick(before), ringPick(r)))
+	r.Set("c", 0)
+	assert.Equal(t, 2, r.Len())
+	assert.NotContains(t, distribute(ringPick(r)), "c")
+}
+
+func TestRendezvous(t *testing.T) {
+	assert.Equal(t, -1, Rendezvous("key", nil, nil))
+
+	nodes := []string{"a", "b", "c"}
+	pick := func(nodes []string, weights []int) func(key string) string {
+		return func(key string) string {
+			return nodes[Rendezvous(key, nodes, weights)]
+		}
+	}
+	counts := distribute(pick(nodes, []int{1, 1, 2}))
+	assert.InDelta(t, keys/4, counts["a"], keys/20)
+	assert.InDelta(t, keys/4, counts["b"], keys/20)
+	assert.InDelta(t, keys/2, counts["c"], keys/20)
+
+	// 增加结点之后，移动的 key 都移动到了新的结点上
+	m := moved(pick(nodes, nil), pick(append(nodes, "d"), nil))
+	assert.Len(t, m, 1)
+	assert.InDelta(t, keys/4, m["d"], keys/20)
+
+	// 权重为 0 的结点不负责任何 key
+	assert.NotContains(t, distribute(pick(nodes, []int{1, 0, 1})), "b")
+}
@@ -0,0 +1,428 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memcache 基于 memcached 的文本协议实现 ecache.Cache
+package memcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/internal/hashring"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+var (
+	ErrClosed     = errors.New("ecache: memcache 缓存已经关闭")
+	ErrInvalidKey = errors.New("ecache: memcache 的 key 不能为空，不能超过 250 字节，也不能包含空白和控制字符")
+	// ErrNotNumber 对不是数字的值执行 IncrByFloat
+	ErrNotNumber = errors.New("ecache: 只有数字类型的数据，才能执行 IncrByFloat")
+	// ErrOverflow IncrBy 和 DecrBy 的结果超出了 int64 的范围
+	ErrOverflow = errors.New("ecache: 自增的结果超出了 int64 的范围")
+)
+
+var _ ecache.Cache = (*Cache)(nil)
+
+// 用 flags 记录值原本的类型，Get 的时候还原
+const (
+	flagString uint32 = iota
+	flagBytes
+	flagInt
+	flagFloat
+)
+
+const (
+	maxKeyLen = 250
+	// maxRelativeExptime 超过 30 天的有效期会被 memcached 当作 unix 时间戳
+	maxRelativeExptime = 30 * 24 * 60 * 60
+)
+
+// Cache 用一致性哈希把 key 分配到多台 memcached 上
+//
+// memcached 的有效期精确到秒，不足一秒的部分向上取整。
+// memcached 没有列表和集合，对应的操作返回 errs.ErrNotSupported
+type Cache struct {
+	pools map[string]*pool
+	ring  *hashring.Ring
+
+	timeout     time.Duration
+	dialTimeout time.Duration
+	maxIdle     int
+	replicas    int
+}
+
+// NewCache servers 是 host:port 或者 unix socket 的路径
+func NewCache(servers []string, opts ...option.Option[Cache]) *Cache {
+	if len(servers) == 0 {
+		panic("ecache: memcache 至少需要一台服务器")
+	}
+	res := &Cache{
+		timeout:     time.Second,
+		dialTimeout: time.Second,
+		maxIdle:     2,
+		replicas:    160,
+	}
+	option.Apply(res, opts...)
+	res.pools = make(map[string]*pool, len(servers))
+	res.ring = hashring.New(res.replicas)
+	for _, server := range servers {
+		res.pools[server] = newPool(server, res.dialTimeout, res.maxIdle)
+		res.ring.Set(server, 1)
+	}
+	return res
+}
+
+// WithTimeout 单次操作的超时时间，ctx 的超时时间更短的时候以 ctx 为准，默认一秒
+func WithTimeout(timeout time.Duration) option.Option[Cache] {
+	return func(c *Cache) {
+		c.timeout = timeout
+	}
+}
+
+// WithDialTimeout 建立连接的超时时间，默认一秒
+func WithDialTimeout(timeout time.Duration) option.Option[Cache] {
+	return func(c *Cache) {
+		c.dialTimeout = timeout
+	}
+}
+
+// WithMaxIdleConns 每台服务器最多保留的空闲连接数，默认是 2
+func WithMaxIdleConns(n int) option.Option[Cache] {
+	return func(c *Cache) {
+		c.maxIdle = n
+	}
+}
+
+// WithReplicas 每台服务器在一致性哈希环上的虚拟结点数，默认是 160
+func WithReplicas(n int) option.Option[Cache] {
+	return func(c *Cache) {
+		c.replicas = n
+	}
+}
+
+// do 从 key 所在服务器的连接池里面拿一个连接执行 fn
+func (c *Cache) do(ctx context.Context, key string, fn func(cn *conn) error) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	server, _ := c.ring.Get(key)
+	p := c.pools[server]
+	cn, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err = cn.setDeadline(deadline); err == nil {
+		err = fn(cn)
+	}
+	p.put(cn, err)
+	return err
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLen {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// exptime 把有效期转换为 memcached 的 exptime
+func exptime(expiration time.Duration) int64 {
+	if expiration <= 0 {
+		return 0
+	}
+	seconds := int64((expiration + time.Second - 1) / time.Second)
+	if seconds > maxRelativeExptime {
+		return time.Now().Add(expiration).Unix()
+	}
+	return seconds
+}
+
+// encode 只支持字符串、[]byte 和数字
+func encode(key string, val any) (item, error) {
+	it := item{key: key}
+	switch v := val.(type) {
+	case string:
+		it.value, it.flags = []byte(v), flagString
+	case []byte:
+		it.value, it.flags = v, flagBytes
+	case int:
+		it.value, it.flags = strconv.AppendInt(nil, int64(v), 10), flagInt
+	case int32:
+		it.value, it.flags = strconv.AppendInt(nil, int64(v), 10), flagInt
+	case int64:
+		it.value, it.flags = strconv.AppendInt(nil, v, 10), flagInt
+	case uint32:
+		it.value, it.flags = strconv.AppendUint(nil, uint64(v), 10), flagInt
+	case uint64:
+		it.value, it.flags = strconv.AppendUint(nil, v, 10), flagInt
+	case float32:
+		it.value, it.flags = strconv.AppendFloat(nil, float64(v), 'f', -1, 32), flagFloat
+	case float64:
+		it.value, it.flags = strconv.AppendFloat(nil, v, 'f', -1, 64), flagFloat
+	default:
+		return it, fmt.Errorf("%w: memcache 不能保存 %T 类型的值", errs.ErrNotSupported, val)
+	}
+	return it, nil
+}
+
+// decode 按照 flags 还原值的类型，超出 int64 范围的计数器和无法识别的 flags 按照字符串返回
+func decode(it item) any {
+	switch it.flags {
+	case flagBytes:
+		return it.value
+	case flagInt:
+		if n, err := strconv.ParseInt(string(it.value), 10, 64); err == nil {
+			return n
+		}
+	case flagFloat:
+		if f, err := strconv.ParseFloat(string(it.value), 64); err == nil {
+			return f
+		}
+	}
+	return string(it.value)
+}
+
+func (c *Cache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
+	it, err := encode(key, val)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, key, func(cn *conn) error {
+		return cn.store("set", it, exptime(expiration))
+	})
+}
+
+func (c *Cache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	it, err := encode(key, val)
+	if err != nil {
+		return false, err
+	}
+	err = c.do(ctx, key, func(cn *conn) error {
+		return cn.store("add", it, exptime(expiration))
+	})
+	if errors.Is(err, errNotStored) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *Cache) Get(ctx context.Context, key string) (val ecache.Value) {
+	var items []item
+	val.Err = c.do(ctx, key, func(cn *conn) (err error) {
+		items, err = cn.get("get", []string{key})
+		return
+	})
+	if val.Err != nil {
+		return
+	}
+	if len(items) == 0 {
+		val.Err = errs.ErrKeyNotExist
+		return
+	}
+	val.Val = decode(items[0])
+	return
+}
+
+// GetSet 用 gets 和 cas 实现，新的值永不过期
+func (c *Cache) GetSet(ctx context.Context, key string, val string) (result ecache.Value) {
+	it := item{key: key, value: []byte(val), flags: flagString}
+	result.Err = c.do(ctx, key, func(cn *conn) error {
+		for ctx.Err() == nil {
+			items, err := cn.get("gets", []string{key})
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				err = cn.store("add", it, 0)
+				if err == nil {
+					return errs.ErrKeyNotExist
+				}
+			} else {
+				it.cas = items[0].cas
+				err = cn.store("cas", it, 0)
+				if err == nil {
+					result.Val = decode(items[0])
+					return nil
+				}
+			}
+			// 其它客户端同时修改了这个 key，重试
+			if !errors.Is(err, errNotStored) && !errors.Is(err, errExists) && !errors.Is(err, errNotFound) {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+	return
+}
+
+func (c *Cache) Delete(ctx context.Context, key ...string) (int64, error) {
+	var n int64
+	for _, k := range key {
+		err := c.do(ctx, k, func(cn *conn) error {
+			return cn.delete(k)
+		})
+		switch {
+		case err == nil:
+			n++
+		case !errors.Is(err, errNotFound):
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Touch 修改 key 的有效期，key 不存在的时候返回 false
+func (c *Cache) Touch(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	err := c.do(ctx, key, func(cn *conn) error {
+		return cn.touch(key, exptime(expiration))
+	})
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *Cache) LPush(_ context.Context, _ string, _ ...any) (int64, error) {
+	return 0, errs.ErrNotSupported
+}
+
+func (c *Cache) LPop(_ context.Context, _ string) (val ecache.Value) {
+	val.Err = errs.ErrNotSupported
+	return
+}
+
+func (c *Cache) SAdd(_ context.Context, _ string, _ ...any) (int64, error) {
+	return 0, errs.ErrNotSupported
+}
+
+func (c *Cache) SRem(_ context.Context, _ string, _ ...any) (int64, error) {
+	return 0, errs.ErrNotSupported
+}
+
+// IncrBy 和 memcached 的 incr 一样，结果按照无符号整数计算，value 为负数的时候等同于 DecrBy
+// 结果超过 math.MaxInt64 的时候返回 ErrOverflow，但是 memcached 里面的值已经修改了
+func (c *Cache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	if value < 0 {
+		return c.incr(ctx, "decr", key, negate(value), 0)
+	}
+	return c.incr(ctx, "incr", key, uint64(value), value)
+}
+
+// DecrBy 和 memcached 的 decr 一样，结果不会小于 0，这一点和其它的 ecache.Cache 不同：
+// 减到负数的时候结果是 0，key 不存在的时候也是从 0 开始
+// value 为 math.MinInt64 的时候结果一定超出 int64，直接返回 ErrOverflow
+func (c *Cache) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
+	if value == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	if value < 0 {
+		return c.incr(ctx, "incr", key, uint64(-value), -value)
+	}
+	return c.incr(ctx, "decr", key, uint64(value), 0)
+}
+
+// negate 返回负数 value 的绝对值，math.MinInt64 的绝对值超出了 int64 但是没有超出 uint64
+func negate(value int64) uint64 {
+	return uint64(-(value + 1)) + 1
+}
+
+// incr key 不存在的时候用 add 写入 initial，永不过期
+func (c *Cache) incr(ctx context.Context, cmd string, key string, delta uint64, initial int64) (int64, error) {
+	var res int64
+	err := c.do(ctx, key, func(cn *conn) error {
+		for ctx.Err() == nil {
+			n, err := cn.incr(cmd, key, delta)
+			if err == nil {
+				if n > math.MaxInt64 {
+					return ErrOverflow
+				}
+				res = int64(n)
+				return nil
+			}
+			if !errors.Is(err, errNotFound) {
+				return err
+			}
+			it, _ := encode(key, initial)
+			err = cn.store("add", it, 0)
+			if err == nil {
+				res = initial
+				return nil
+			}
+			// 其它客户端同时创建了这个 key，重试
+			if !errors.Is(err, errNotStored) {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+	return res, err
+}
+
+// IncrByFloat 用 gets 和 cas 实现，结果永不过期
+func (c *Cache) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
+	var res float64
+	err := c.do(ctx, key, func(cn *conn) error {
+		for ctx.Err() == nil {
+			items, err := cn.get("gets", []string{key})
+			if err != nil {
+				return err
+			}
+			cmd, num := "add", 0.0
+			it := item{key: key, flags: flagFloat}
+			if len(items) > 0 {
+				num, err = strconv.ParseFloat(string(items[0].value), 64)
+				if err != nil {
+					return ErrNotNumber
+				}
+				cmd, it.cas = "cas", items[0].cas
+			}
+			num += value
+			it.value = strconv.AppendFloat(nil, num, 'f', -1, 64)
+			err = cn.store(cmd, it, 0)
+			if err == nil {
+				res = num
+				return nil
+			}
+			// 其它客户端同时修改了这个 key，重试
+			if !errors.Is(err, errNotStored) && !errors.Is(err, errExists) && !errors.Is(err, errNotFound) {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+	return res, err
+}
+
+// Close 关闭所有空闲的连接，正在使用的连接归还的时候关闭
+func (c *Cache) Close() error {
+	for _, p := range c.pools {
+		p.close()
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(t *testing.T) (*Cache, *fakeServer) {
+	s := newFakeServer(t)
+	c := NewCache([]string{s.addr()})
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c, s
+}
+
+// put 绕过客户端直接修改服务器上的值
+func (s *fakeServer) put(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextCAS++
+	s.items[key] = fakeItem{value: []byte(value), cas: s.nextCAS}
+}
+
+func TestCache_SetGet(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  any
+		want any
+	}{
+		{name: "string", val: "value", want: "value"},
+		{name: "bytes", val: []byte("value"), want: []byte("value")},
+		{name: "int", val: 12, want: int64(12)},
+		{name: "int64", val: int64(-12), want: int64(-12)},
+		{name: "float", val: 1.5, want: 1.5},
+	}
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, c.Set(ctx, tc.name, tc.val, time.Minute))
+			val := c.Get(ctx, tc.name)
+			require.NoError(t, val.Err)
+			assert.Equal(t, tc.want, val.Val)
+		})
+	}
+	assert.ErrorIs(t, c.Set(ctx, "struct", struct{}{}, 0), errs.ErrNotSupported)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "missing").Err)
+}
+
+func TestCache_expiration(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "key", "value", 1500*time.Millisecond))
+	s.advance(time.Second)
+	assert.NoError(t, c.Get(ctx, "key").Err)
+	// 不足一秒的部分向上取整
+	s.advance(time.Second)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key").Err)
+
+	// 超过 30 天的有效期使用时间戳
+	assert.Equal(t, int64(3600), exptime(time.Hour))
+	assert.Equal(t, int64(0), exptime(0))
+	assert.InDelta(t, time.Now().Add(31*24*time.Hour).Unix(), exptime(31*24*time.Hour), 1)
+}
+
+func TestCache_SetNX(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	ok, err := c.SetNX(ctx, "key", "value", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.SetNX(ctx, "key", "other", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "value", c.Get(ctx, "key").Val)
+}
+
+func TestCache_GetSet(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	val := c.GetSet(ctx, "key", "first")
+	assert.Equal(t, errs.ErrKeyNotExist, val.Err)
+	val = c.GetSet(ctx, "key", "second")
+	require.NoError(t, val.Err)
+	assert.Equal(t, "first", val.Val)
+
+	// 第一次 cas 之前被其它客户端修改，重试之后拿到修改之后的值
+	var once sync.Once
+	s.casHook = func(key string) {
+		once.Do(func() {
+			s.put(key, "concurrent")
+		})
+	}
+	val = c.GetSet(ctx, "key", "third")
+	require.NoError(t, val.Err)
+	assert.Equal(t, "concurrent", val.Val)
+	assert.Equal(t, "third", c.Get(ctx, "key").Val)
+}
+
+func TestCache_Delete(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "a", "value", time.Minute))
+	require.NoError(t, c.Set(ctx, "b", "value", time.Minute))
+	n, err := c.Delete(ctx, "a", "b", "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "a").Err)
+}
+
+func TestCache_Touch(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "key", "value", time.Second))
+	ok, err := c.Touch(ctx, "key", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	s.advance(2 * time.Second)
+	assert.NoError(t, c.Get(ctx, "key").Err)
+
+	ok, err = c.Touch(ctx, "missing", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCache_IncrBy(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	n, err := c.IncrBy(ctx, "num", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = c.IncrBy(ctx, "num", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = c.IncrBy(ctx, "num", -1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.Equal(t, int64(4), c.Get(ctx, "num").Val)
+
+	n, err = c.DecrBy(ctx, "num", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	// 和 memcached 一样不会小于 0
+	n, err = c.DecrBy(ctx, "num", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = c.DecrBy(ctx, "missing", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = c.DecrBy(ctx, "neg", -2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// math.MinInt64 的绝对值没有超出 uint64，IncrBy 按照 decr 处理
+	n, err = c.IncrBy(ctx, "neg", math.MinInt64)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	_, err = c.DecrBy(ctx, "overflow", math.MinInt64)
+	assert.Equal(t, ErrOverflow, err)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "overflow").Err)
+	n, err = c.IncrBy(ctx, "overflow", math.MaxInt64)
+	require.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), n)
+	_, err = c.IncrBy(ctx, "overflow", 1)
+	assert.Equal(t, ErrOverflow, err)
+
+	// 用字符串保存的数字也可以自增，类型保持不变
+	require.NoError(t, c.Set(ctx, "str", "10", 0))
+	n, err = c.IncrBy(ctx, "str", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+	assert.Equal(t, "11", c.Get(ctx, "str").Val)
+
+	require.NoError(t, c.Set(ctx, "key", "value", 0))
+	_, err = c.IncrBy(ctx, "key", 1)
+	var re replyError
+	assert.True(t, errors.As(err, &re))
+}
+
+func TestCache_IncrByFloat(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	f, err := c.IncrByFloat(ctx, "num", 1.5)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, f)
+	require.NoError(t, c.Set(ctx, "int", 2, 0))
+	f, err = c.IncrByFloat(ctx, "int", 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+	assert.Equal(t, 2.5, c.Get(ctx, "int").Val)
+
+	var once sync.Once
+	s.casHook = func(key string) {
+		once.Do(func() {
+			s.put(key, "10")
+		})
+	}
+	f, err = c.IncrByFloat(ctx, "int", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 11.0, f)
+
+	require.NoError(t, c.Set(ctx, "key", "value", 0))
+	_, err = c.IncrByFloat(ctx, "key", 1)
+	assert.Equal(t, ErrNotNumber, err)
+}
+
+func TestCache_notSupported(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	_, err := c.LPush(ctx, "key", "a")
+	assert.Equal(t, errs.ErrNotSupported, err)
+	assert.Equal(t, errs.ErrNotSupported, c.LPop(ctx, "key").Err)
+	_, err = c.SAdd(ctx, "key", "a")
+	assert.Equal(t, errs.ErrNotSupported, err)
+	_, err = c.SRem(ctx, "key", "a")
+	assert.Equal(t, errs.ErrNotSupported, err)
+}
+
+func TestCache_invalidKey(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	for _, key := range []string{"", "a b", "a\r\n", string(make([]byte, 251))} {
+		assert.Equal(t, ErrInvalidKey, c.Set(ctx, key, "value", 0))
+	}
+}
+
+func TestCache_pool(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.Set(ctx, "key", "value", 0))
+		// 服务器返回错误之后连接还可以继续使用
+		_, err := c.IncrBy(ctx, "key", 1)
+		require.Error(t, err)
+	}
+	s.mu.Lock()
+	assert.Equal(t, 1, s.accepted)
+	s.mu.Unlock()
+
+	require.NoError(t, c.Close())
+	assert.Equal(t, ErrClosed, c.Set(ctx, "key", "value", 0))
+}
+
+func TestCache_servers(t *testing.T) {
+	s1, s2 := newFakeServer(t), newFakeServer(t)
+	c := NewCache([]string{s1.addr(), s2.addr()})
+	defer c.Close()
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, c.Set(ctx, "key"+strconv.Itoa(i), i, 0))
+	}
+	assert.Equal(t, 100, s1.len()+s2.len())
+	assert.Greater(t, s1.len(), 20)
+	assert.Greater(t, s2.len(), 20)
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, int64(i), c.Get(ctx, "key"+strconv.Itoa(i)).Val)
+	}
+}
+
+func TestCache_unavailable(t *testing.T) {
+	s := newFakeServer(t)
+	addr := s.addr()
+	require.NoError(t, s.ln.Close())
+	c := NewCache([]string{addr}, WithDialTimeout(100*time.Millisecond))
+	assert.Error(t, c.Set(context.Background(), "key", "value", 0))
+}
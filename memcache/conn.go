@@ -0,0 +1,223 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	// errNotStored add 和 cas 的条件不满足
+	errNotStored = errors.New("ecache: memcache NOT_STORED")
+	// errExists cas 的时候值已经被修改过
+	errExists = errors.New("ecache: memcache EXISTS")
+	// errNotFound key 不存在
+	errNotFound = errors.New("ecache: memcache NOT_FOUND")
+)
+
+// replyError 服务器返回的 ERROR、CLIENT_ERROR 和 SERVER_ERROR
+// 这些错误不会破坏连接的状态，连接还可以继续使用
+type replyError string
+
+func (e replyError) Error() string {
+	return "ecache: memcache " + string(e)
+}
+
+// resumable 出现 err 之后连接是否还可以放回连接池
+func resumable(err error) bool {
+	var re replyError
+	return err == nil || errors.Is(err, errNotStored) || errors.Is(err, errExists) ||
+		errors.Is(err, errNotFound) || errors.As(err, &re)
+}
+
+// item 服务器上保存的一个值
+type item struct {
+	key   string
+	value []byte
+	flags uint32
+	cas   uint64
+}
+
+// conn 一个到 memcached 的文本协议连接，同一时间只能被一个 goroutine 使用
+type conn struct {
+	nc net.Conn
+	rw *bufio.ReadWriter
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{
+		nc: nc,
+		rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
+	}
+}
+
+func (c *conn) setDeadline(deadline time.Time) error {
+	return c.nc.SetDeadline(deadline)
+}
+
+// get 执行 get 或者 gets，没有命中的 key 不会出现在结果里面
+func (c *conn) get(cmd string, keys []string) ([]item, error) {
+	c.rw.WriteString(cmd)
+	for _, key := range keys {
+		c.rw.WriteByte(' ')
+		c.rw.WriteString(key)
+	}
+	c.rw.WriteString("\r\n")
+	if err := c.rw.Flush(); err != nil {
+		return nil, err
+	}
+	var res []item
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(line, []byte("END")) {
+			return res, nil
+		}
+		if err = parseReply(line); err != nil {
+			return nil, err
+		}
+		it, err := c.readItem(line)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, it)
+	}
+}
+
+// readItem 解析 VALUE <key> <flags> <bytes> [<cas>] 以及后面的数据
+func (c *conn) readItem(line []byte) (item, error) {
+	fields := bytes.Fields(line)
+	if len(fields) < 4 || len(fields) > 5 || !bytes.Equal(fields[0], []byte("VALUE")) {
+		return item{}, fmt.Errorf("ecache: memcache 无法解析的回复 %q", line)
+	}
+	flags, err1 := strconv.ParseUint(string(fields[2]), 10, 32)
+	size, err2 := strconv.Atoi(string(fields[3]))
+	if err1 != nil || err2 != nil || size < 0 {
+		return item{}, fmt.Errorf("ecache: memcache 无法解析的回复 %q", line)
+	}
+	it := item{key: string(fields[1]), flags: uint32(flags)}
+	if len(fields) == 5 {
+		if it.cas, err1 = strconv.ParseUint(string(fields[4]), 10, 64); err1 != nil {
+			return item{}, fmt.Errorf("ecache: memcache 无法解析的回复 %q", line)
+		}
+	}
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(c.rw, buf); err != nil {
+		return item{}, err
+	}
+	if !bytes.HasSuffix(buf, []byte("\r\n")) {
+		return item{}, fmt.Errorf("ecache: memcache 数据没有以 \\r\\n 结尾")
+	}
+	it.value = buf[:size]
+	return it, nil
+}
+
+// store 执行 set、add 和 cas，只有 cas 会用到 it.cas
+func (c *conn) store(cmd string, it item, exptime int64) error {
+	if cmd == "cas" {
+		fmt.Fprintf(c.rw, "cas %s %d %d %d %d\r\n", it.key, it.flags, exptime, len(it.value), it.cas)
+	} else {
+		fmt.Fprintf(c.rw, "%s %s %d %d %d\r\n", cmd, it.key, it.flags, exptime, len(it.value))
+	}
+	c.rw.Write(it.value)
+	c.rw.WriteString("\r\n")
+	return c.simple("STORED")
+}
+
+func (c *conn) delete(key string) error {
+	fmt.Fprintf(c.rw, "delete %s\r\n", key)
+	return c.simple("DELETED")
+}
+
+func (c *conn) touch(key string, exptime int64) error {
+	fmt.Fprintf(c.rw, "touch %s %d\r\n", key, exptime)
+	return c.simple("TOUCHED")
+}
+
+// incr cmd 是 incr 或者 decr，返回修改之后的值
+func (c *conn) incr(cmd string, key string, delta uint64) (uint64, error) {
+	fmt.Fprintf(c.rw, "%s %s %d\r\n", cmd, key, delta)
+	if err := c.rw.Flush(); err != nil {
+		return 0, err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return 0, err
+	}
+	if err = parseReply(line); err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(string(line), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ecache: memcache 无法解析的回复 %q", line)
+	}
+	return n, nil
+}
+
+// simple 发送请求并且读取一行回复，回复是 ok 的时候返回 nil
+func (c *conn) simple(ok string) error {
+	if err := c.rw.Flush(); err != nil {
+		return err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if string(line) == ok {
+		return nil
+	}
+	if err = parseReply(line); err != nil {
+		return err
+	}
+	return fmt.Errorf("ecache: memcache 无法解析的回复 %q", line)
+}
+
+// parseReply 把表示失败的回复转换为错误，其它的回复返回 nil
+func parseReply(line []byte) error {
+	switch {
+	case bytes.Equal(line, []byte("NOT_STORED")):
+		return errNotStored
+	case bytes.Equal(line, []byte("EXISTS")):
+		return errExists
+	case bytes.Equal(line, []byte("NOT_FOUND")):
+		return errNotFound
+	case bytes.Equal(line, []byte("ERROR")),
+		bytes.HasPrefix(line, []byte("CLIENT_ERROR ")),
+		bytes.HasPrefix(line, []byte("SERVER_ERROR ")):
+		return replyError(line)
+	}
+	return nil
+}
+
+func (c *conn) readLine() ([]byte, error) {
+	line, err := c.rw.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+}
+
+func (c *conn) close() error {
+	return c.nc.Close()
+}
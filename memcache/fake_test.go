@@ -0,0 +1,247 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeItem struct {
+	value    []byte
+	flags    uint32
+	cas      uint64
+	deadline time.Time
+}
+
+// fakeServer 进程内的 memcached，只实现了测试需要的命令
+type fakeServer struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	items   map[string]fakeItem
+	nextCAS uint64
+	now     time.Time
+	// accepted 建立过的连接数
+	accepted int
+	// casHook 在处理 cas 之前调用，用来模拟并发修改
+	casHook func(key string)
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, items: make(map[string]fakeItem), now: time.Now()}
+	go s.serve()
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+// advance 让服务器的时钟前进 d
+func (s *fakeServer) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+func (s *fakeServer) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.accepted++
+		s.mu.Unlock()
+		go s.serveConn(nc)
+	}
+}
+
+func (s *fakeServer) serveConn(nc net.Conn) {
+	defer nc.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			rw.WriteString("ERROR\r\n")
+		} else if err = s.handle(rw, fields); err != nil {
+			return
+		}
+		if err = rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) get(key string) (fakeItem, bool) {
+	it, ok := s.items[key]
+	if ok && !it.deadline.IsZero() && !s.now.Before(it.deadline) {
+		delete(s.items, key)
+		return it, false
+	}
+	return it, ok
+}
+
+func (s *fakeServer) deadline(exptime int64) time.Time {
+	switch {
+	case exptime == 0:
+		return time.Time{}
+	case exptime > maxRelativeExptime:
+		return time.Unix(exptime, 0)
+	default:
+		return s.now.Add(time.Duration(exptime) * time.Second)
+	}
+}
+
+func (s *fakeServer) handle(rw *bufio.ReadWriter, fields []string) error {
+	switch fields[0] {
+	case "set", "add", "cas":
+		return s.store(rw, fields)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch fields[0] {
+	case "get", "gets":
+		for _, key := range fields[1:] {
+			it, ok := s.get(key)
+			if !ok {
+				continue
+			}
+			if fields[0] == "gets" {
+				fmt.Fprintf(rw, "VALUE %s %d %d %d\r\n%s\r\n", key, it.flags, len(it.value), it.cas, it.value)
+			} else {
+				fmt.Fprintf(rw, "VALUE %s %d %d\r\n%s\r\n", key, it.flags, len(it.value), it.value)
+			}
+		}
+		rw.WriteString("END\r\n")
+	case "delete":
+		if _, ok := s.get(fields[1]); !ok {
+			rw.WriteString("NOT_FOUND\r\n")
+			return nil
+		}
+		delete(s.items, fields[1])
+		rw.WriteString("DELETED\r\n")
+	case "touch":
+		it, ok := s.get(fields[1])
+		if !ok {
+			rw.WriteString("NOT_FOUND\r\n")
+			return nil
+		}
+		exp, _ := strconv.ParseInt(fields[2], 10, 64)
+		it.deadline = s.deadline(exp)
+		s.items[fields[1]] = it
+		rw.WriteString("TOUCHED\r\n")
+	case "incr", "decr":
+		it, ok := s.get(fields[1])
+		if !ok {
+			rw.WriteString("NOT_FOUND\r\n")
+			return nil
+		}
+		n, err := strconv.ParseUint(string(it.value), 10, 64)
+		if err != nil {
+			rw.WriteString("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+			return nil
+		}
+		delta, _ := strconv.ParseUint(fields[2], 10, 64)
+		switch {
+		case fields[0] == "incr":
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+		it.value = strconv.AppendUint(nil, n, 10)
+		s.nextCAS++
+		it.cas = s.nextCAS
+		s.items[fields[1]] = it
+		fmt.Fprintf(rw, "%d\r\n", n)
+	default:
+		rw.WriteString("ERROR\r\n")
+	}
+	return nil
+}
+
+// store 处理 set <key> <flags> <exptime> <bytes> [<cas>]
+func (s *fakeServer) store(rw *bufio.ReadWriter, fields []string) error {
+	if len(fields) < 5 {
+		rw.WriteString("ERROR\r\n")
+		return nil
+	}
+	flags, _ := strconv.ParseUint(fields[2], 10, 32)
+	exp, _ := strconv.ParseInt(fields[3], 10, 64)
+	size, _ := strconv.Atoi(fields[4])
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(rw, buf); err != nil {
+		return err
+	}
+	key := fields[1]
+	if fields[0] == "cas" && s.casHook != nil {
+		s.casHook(key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, exists := s.get(key)
+	switch fields[0] {
+	case "add":
+		if exists {
+			rw.WriteString("NOT_STORED\r\n")
+			return nil
+		}
+	case "cas":
+		if !exists {
+			rw.WriteString("NOT_FOUND\r\n")
+			return nil
+		}
+		if strconv.FormatUint(old.cas, 10) != fields[5] {
+			rw.WriteString("EXISTS\r\n")
+			return nil
+		}
+	}
+	s.nextCAS++
+	s.items[key] = fakeItem{
+		value:    buf[:size],
+		flags:    uint32(flags),
+		cas:      s.nextCAS,
+		deadline: s.deadline(exp),
+	}
+	rw.WriteString("STORED\r\n")
+	return nil
+}
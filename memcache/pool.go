@@ -0,0 +1,96 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// pool 一台服务器的连接池，只缓存空闲的连接，不限制连接的总数
+type pool struct {
+	addr    string
+	dialer  net.Dialer
+	maxIdle int
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+func newPool(addr string, dialTimeout time.Duration, maxIdle int) *pool {
+	return &pool{
+		addr:    addr,
+		dialer:  net.Dialer{Timeout: dialTimeout},
+		maxIdle: maxIdle,
+	}
+}
+
+// get 优先复用空闲的连接，最近放回去的连接最先被复用
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.mu.Unlock()
+	nc, err := p.dialer.DialContext(ctx, network(p.addr), p.addr)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(nc), nil
+}
+
+// put 归还连接，err 表示连接的状态已经不确定的时候直接关闭
+func (p *pool) put(c *conn, err error) {
+	if !resumable(err) {
+		_ = c.close()
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.idle) >= p.maxIdle {
+		_ = c.close()
+		return
+	}
+	p.idle = append(p.idle, c)
+}
+
+func (p *pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, c := range p.idle {
+		_ = c.close()
+	}
+	p.idle = nil
+}
+
+// network 以 / 开头的地址是 unix socket
+func network(addr string) string {
+	if len(addr) > 0 && addr[0] == '/' {
+		return "unix"
+	}
+	return "tcp"
+}
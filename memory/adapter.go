@@ -0,0 +1,196 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/internal/datatype"
+	"github.com/ecodeclub/ekit"
+	"github.com/ecodeclub/ekit/list"
+	"github.com/ecodeclub/ekit/set"
+)
+
+var (
+	_ ecache.Cache     = (*Adapter[any])(nil)
+	_ datatype.Storage = adapterStorage[any]{}
+)
+
+// Adapter 把 key 为 string 的 Cache 包装成 ecache.Cache
+// 写入的值必须能够赋值给 V，否则返回 ecache.ErrNotSupported，
+// 所以列表和集合只有在 V 为 any 的时候可用，IncrBy 之类的方法要求 V 能够保存 int64 或者 float64
+type Adapter[V any] struct {
+	cache *Cache[string, V]
+}
+
+func NewAdapter[V any](cache *Cache[string, V]) *Adapter[V] {
+	return &Adapter[V]{cache: cache}
+}
+
+// Close 关闭被包装的 Cache，停止它的过期清理
+func (a *Adapter[V]) Close() error {
+	return a.cache.Close()
+}
+
+// adapterStorage 在 Cache 的锁里面使用，调用方负责保证写入的值都能赋值给 V
+type adapterStorage[V any] struct {
+	cache *Cache[string, V]
+}
+
+func (s adapterStorage[V]) Get(key string) (any, bool) {
+	return s.cache.get(key)
+}
+
+func (s adapterStorage[V]) Set(key string, val any, expiration time.Duration) {
+	v, _ := val.(V)
+	s.cache.set(key, v, expiration)
+}
+
+func (s adapterStorage[V]) Update(key string, val any) {
+	v, _ := val.(V)
+	s.cache.update(key, v)
+}
+
+func (s adapterStorage[V]) Delete(key string) bool {
+	return s.cache.delete(key)
+}
+
+// convert 检查 val 能不能赋值给 V，nil 转换为 V 的零值
+func convert[V any](val any) (V, error) {
+	v, ok := val.(V)
+	if !ok && val != nil {
+		return v, fmt.Errorf("%w: 值的类型 %T", errs.ErrNotSupported, val)
+	}
+	return v, nil
+}
+
+// lockStorage 检查 sample 的类型之后加锁，返回可以交给 datatype 的 Storage
+func (a *Adapter[V]) lockStorage(sample any) (adapterStorage[V], error) {
+	if _, err := convert[V](sample); err != nil {
+		return adapterStorage[V]{}, err
+	}
+	a.cache.lock.Lock()
+	return adapterStorage[V]{cache: a.cache}, nil
+}
+
+func (a *Adapter[V]) Set(_ context.Context, key string, val any, expiration time.Duration) error {
+	v, err := convert[V](val)
+	if err != nil {
+		return err
+	}
+	a.cache.Set(key, v, expiration)
+	return nil
+}
+
+func (a *Adapter[V]) SetNX(_ context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	s, err := a.lockStorage(val)
+	if err != nil {
+		return false, err
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.SetNX(s, key, val, expiration), nil
+}
+
+func (a *Adapter[V]) Get(_ context.Context, key string) (val ecache.Value) {
+	v, ok := a.cache.Get(key)
+	if !ok {
+		val.Err = errs.ErrKeyNotExist
+		return
+	}
+	val.Val = v
+	return
+}
+
+func (a *Adapter[V]) GetSet(_ context.Context, key string, val string) ecache.Value {
+	s, err := a.lockStorage(val)
+	if err != nil {
+		return ecache.Value{AnyValue: ekit.AnyValue{Err: err}}
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.GetSet(s, key, val)
+}
+
+func (a *Adapter[V]) Delete(ctx context.Context, key ...string) (int64, error) {
+	a.cache.lock.Lock()
+	defer a.cache.lock.Unlock()
+	return datatype.Delete(ctx, adapterStorage[V]{cache: a.cache}, key...)
+}
+
+func (a *Adapter[V]) LPush(_ context.Context, key string, val ...any) (int64, error) {
+	s, err := a.lockStorage((*list.LinkedList[any])(nil))
+	if err != nil {
+		return 0, err
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.LPush(s, key, val...)
+}
+
+func (a *Adapter[V]) LPop(_ context.Context, key string) ecache.Value {
+	s, err := a.lockStorage((*list.LinkedList[any])(nil))
+	if err != nil {
+		return ecache.Value{AnyValue: ekit.AnyValue{Err: err}}
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.LPop(s, key)
+}
+
+func (a *Adapter[V]) SAdd(_ context.Context, key string, members ...any) (int64, error) {
+	s, err := a.lockStorage((*set.MapSet[any])(nil))
+	if err != nil {
+		return 0, err
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.SAdd(s, key, members...)
+}
+
+func (a *Adapter[V]) SRem(_ context.Context, key string, members ...any) (int64, error) {
+	s, err := a.lockStorage((*set.MapSet[any])(nil))
+	if err != nil {
+		return 0, err
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.SRem(s, key, members...)
+}
+
+func (a *Adapter[V]) IncrBy(_ context.Context, key string, value int64) (int64, error) {
+	s, err := a.lockStorage(value)
+	if err != nil {
+		return 0, err
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.IncrBy(s, key, value)
+}
+
+func (a *Adapter[V]) DecrBy(_ context.Context, key string, value int64) (int64, error) {
+	s, err := a.lockStorage(value)
+	if err != nil {
+		return 0, err
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.DecrBy(s, key, value)
+}
+
+func (a *Adapter[V]) IncrByFloat(_ context.Context, key string, value float64) (float64, error) {
+	s, err := a.lockStorage(value)
+	if err != nil {
+		return 0, err
+	}
+	defer a.cache.lock.Unlock()
+	return datatype.IncrByFloat(s, key, value)
+}
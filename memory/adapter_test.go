@@ -0,0 +1,157 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdapter(t *testing.T) {
+	ctx := context.Background()
+	a := NewAdapter(NewCache[string, any](100))
+	defer a.Close()
+
+	require.NoError(t, a.Set(ctx, "key1", "value1", time.Minute))
+	val, err := a.Get(ctx, "key1").String()
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+	assert.Equal(t, errs.ErrKeyNotExist, a.Get(ctx, "missing").Err)
+
+	ok, err := a.SetNX(ctx, "key1", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = a.SetNX(ctx, "key2", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	old, err := a.GetSet(ctx, "key1", "value3").String()
+	require.NoError(t, err)
+	assert.Equal(t, "value1", old)
+
+	n, err := a.Delete(ctx, "key1", "key2", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = a.LPush(ctx, "list", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	front, err := a.LPop(ctx, "list").Int()
+	require.NoError(t, err)
+	assert.Equal(t, 2, front)
+
+	n, err = a.SAdd(ctx, "set", "a", "b", "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = a.SRem(ctx, "set", "a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	num, err := a.IncrBy(ctx, "num", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), num)
+	num, err = a.DecrBy(ctx, "num", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), num)
+	f, err := a.IncrByFloat(ctx, "num", 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+
+	// nil 作为值的零值保存
+	require.NoError(t, a.Set(ctx, "nil", nil, time.Minute))
+	v := a.Get(ctx, "nil")
+	require.NoError(t, v.Err)
+	assert.Nil(t, v.Val)
+	n, err = a.LPush(ctx, "nil list", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	elem := a.LPop(ctx, "nil list")
+	require.NoError(t, elem.Err)
+	assert.Nil(t, elem.Val)
+}
+
+func TestAdapter_notSupported(t *testing.T) {
+	ctx := context.Background()
+	a := NewAdapter(NewCache[string, int64](100))
+	defer a.Close()
+
+	num, err := a.IncrBy(ctx, "num", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), num)
+	val, err := a.Get(ctx, "num").Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), val)
+
+	testCases := []struct {
+		name string
+		op   func() error
+	}{
+		{
+			name: "Set",
+			op: func() error {
+				return a.Set(ctx, "key", "value", 0)
+			},
+		},
+		{
+			name: "SetNX",
+			op: func() error {
+				_, err := a.SetNX(ctx, "key", "value", 0)
+				return err
+			},
+		},
+		{
+			name: "GetSet",
+			op: func() error {
+				return a.GetSet(ctx, "num", "value").Err
+			},
+		},
+		{
+			name: "LPush",
+			op: func() error {
+				_, err := a.LPush(ctx, "list", 1)
+				return err
+			},
+		},
+		{
+			name: "SAdd",
+			op: func() error {
+				_, err := a.SAdd(ctx, "set", 1)
+				return err
+			},
+		},
+		{
+			name: "IncrByFloat",
+			op: func() error {
+				_, err := a.IncrByFloat(ctx, "num", 0.5)
+				return err
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.True(t, errors.Is(tc.op(), errs.ErrNotSupported))
+		})
+	}
+	// 失败的操作不会修改原本的值
+	val, err = a.Get(ctx, "num").Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), val)
+}
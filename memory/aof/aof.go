@@ -0,0 +1,524 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package aof 为内存缓存提供追加写的操作日志，让缓存在进程崩溃之后也能恢复
+//
+// 目录里面保存一份快照和快照之后的操作日志，文件名带着代数：snapshot-<gen> 和 aof-<gen>.log。
+// 压缩的时候先创建新一代的空日志，再写入新一代的快照，最后删除旧的文件，
+// 所以任何时候崩溃，启动的时候都能找到一份完整的快照和与之对应的日志
+package aof
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/snapshot"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+var _ ecache.Cache = (*Cache)(nil)
+
+var ErrClosed = errors.New("ecache: 缓存已经关闭")
+
+// Backend 支持快照的内存缓存，例如 lru.Cache 和 priority.RBTreePriorityCache
+type Backend interface {
+	ecache.Cache
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader) error
+}
+
+// deadlineBackend 可以读取 key 的过期时间的 Backend，lru.Cache 和 priority.RBTreePriorityCache 都实现了
+// GetSet 是否保留原本的有效期由 Backend 决定，所以写入之后要读出真实的过期时间记录到日志里面
+type deadlineBackend interface {
+	Deadline(ctx context.Context, key string) (time.Time, bool)
+}
+
+// SyncPolicy 写入日志之后什么时候调用 fsync
+type SyncPolicy uint8
+
+const (
+	// SyncEverySecond 每秒调用一次，机器宕机最多丢失一秒的数据
+	SyncEverySecond SyncPolicy = iota
+	// SyncAlways 每次写入都调用，最安全也最慢
+	SyncAlways
+	// SyncNever 交给操作系统决定，进程崩溃不会丢数据，机器宕机可能会
+	SyncNever
+)
+
+const (
+	snapshotPrefix = "snapshot-"
+	logPrefix      = "aof-"
+	logSuffix      = ".log"
+	tmpSuffix      = ".tmp"
+)
+
+// Cache 在 Backend 的基础上记录所有的写操作
+// 写操作串行执行，先修改 Backend 再写日志，日志写入失败的时候返回错误，但是内存里面的修改不会回滚
+type Cache struct {
+	// lock 保证日志的顺序和 Backend 执行的顺序一致
+	lock    sync.Mutex
+	backend Backend
+	dir     string
+	gen     uint64
+	file    *os.File
+	size    int64
+	enc     encoder
+	dirty   bool
+	closed  bool
+
+	syncPolicy       SyncPolicy
+	codec            snapshot.Codec
+	compactThreshold int64
+	compacting       atomic.Bool
+	done             chan struct{}
+}
+
+// WithSyncPolicy 设置 fsync 的策略，默认是 SyncEverySecond
+func WithSyncPolicy(policy SyncPolicy) option.Option[Cache] {
+	return func(c *Cache) {
+		c.syncPolicy = policy
+	}
+}
+
+// WithCodec 设置日志和快照编码值使用的 Codec，默认是 snapshot.GobCodec，需要和 Backend 的 Codec 一致
+func WithCodec(codec snapshot.Codec) option.Option[Cache] {
+	return func(c *Cache) {
+		c.codec = codec
+	}
+}
+
+// WithCompactThreshold 日志超过 threshold 字节之后在后台压缩成快照，默认 64MB，0 表示只能手动调用 Compact
+func WithCompactThreshold(threshold int64) option.Option[Cache] {
+	return func(c *Cache) {
+		c.compactThreshold = threshold
+	}
+}
+
+// Open 从 dir 里面的快照和日志恢复 backend，之后的写操作都会记录到 dir 里面
+// 日志末尾不完整的记录是写入的时候崩溃留下的，会被截断；日志中间的记录损坏的时候返回 ErrCorrupted
+func Open(dir string, backend Backend, opts ...option.Option[Cache]) (*Cache, error) {
+	c := &Cache{
+		backend:          backend,
+		dir:              dir,
+		compactThreshold: 64 << 20,
+		done:             make(chan struct{}),
+	}
+	option.Apply(c, opts...)
+	if c.codec == nil {
+		c.codec = snapshot.GobCodec{}
+	}
+	c.enc.codec = c.codec
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	if c.syncPolicy == SyncEverySecond {
+		go c.syncCycle()
+	}
+	return c, nil
+}
+
+// load 找到最新的快照，恢复快照并且重放对应的日志，然后删除其它代的文件
+func (c *Cache) load() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, snapshotPrefix) || strings.HasSuffix(name, tmpSuffix) {
+			continue
+		}
+		gen, err := strconv.ParseUint(strings.TrimPrefix(name, snapshotPrefix), 10, 64)
+		if err == nil && gen > c.gen {
+			c.gen = gen
+		}
+	}
+	if c.gen > 0 {
+		if err = c.restore(c.snapshotPath(c.gen)); err != nil {
+			return err
+		}
+	}
+	if err = c.replay(); err != nil {
+		return err
+	}
+	// 没有完成的压缩留下的文件
+	for _, entry := range entries {
+		name := entry.Name()
+		if name != filepath.Base(c.snapshotPath(c.gen)) && name != filepath.Base(c.logPath(c.gen)) &&
+			(strings.HasPrefix(name, snapshotPrefix) || strings.HasPrefix(name, logPrefix)) {
+			_ = os.Remove(filepath.Join(c.dir, name))
+		}
+	}
+	return nil
+}
+
+func (c *Cache) restore(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.backend.Restore(f)
+}
+
+// replay 重放日志，截断末尾不完整的记录，然后打开日志用于追加
+func (c *Cache) replay() error {
+	f, err := os.OpenFile(c.logPath(c.gen), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	offset, err := readRecords(f, c.codec, func(r record) error {
+		// 记录的时候操作是成功的，重放失败只可能是因为 key 在这期间过期了，忽略就可以
+		_ = apply(ctx, c.backend, r)
+		return nil
+	})
+	if err == nil {
+		err = f.Truncate(offset)
+	}
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	c.file = f
+	c.size = offset
+	return nil
+}
+
+func (c *Cache) snapshotPath(gen uint64) string {
+	return filepath.Join(c.dir, snapshotPrefix+strconv.FormatUint(gen, 10))
+}
+
+func (c *Cache) logPath(gen uint64) string {
+	return filepath.Join(c.dir, logPrefix+strconv.FormatUint(gen, 10)+logSuffix)
+}
+
+func (c *Cache) syncCycle() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.lock.Lock()
+			if c.dirty && !c.closed {
+				if c.file.Sync() == nil {
+					c.dirty = false
+				}
+			}
+			c.lock.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// append 写入一条记录【调用该方法必须先获得锁】
+func (c *Cache) append(r record) error {
+	data, err := c.enc.encode(r)
+	if err != nil {
+		return err
+	}
+	n, err := c.file.Write(data)
+	c.size += int64(n)
+	if err != nil {
+		return err
+	}
+	switch c.syncPolicy {
+	case SyncAlways:
+		if err = c.file.Sync(); err != nil {
+			return err
+		}
+	case SyncEverySecond:
+		c.dirty = true
+	}
+	if c.compactThreshold > 0 && c.size >= c.compactThreshold && c.compacting.CompareAndSwap(false, true) {
+		go func() {
+			defer c.compacting.Store(false)
+			// 压缩失败的时候旧的快照和日志都还在，下一次超过阈值的时候再试
+			_ = c.Compact()
+		}()
+	}
+	return nil
+}
+
+// Compact 把 Backend 当前的数据写成新一代的快照，然后丢弃旧的快照和日志
+// 压缩期间写操作会被阻塞，读操作不受影响
+func (c *Cache) Compact() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	gen := c.gen + 1
+	logFile, err := os.OpenFile(c.logPath(gen), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = c.writeSnapshot(gen); err != nil {
+		_ = logFile.Close()
+		_ = os.Remove(c.logPath(gen))
+		return err
+	}
+	syncDir(c.dir)
+	_ = c.file.Close()
+	_ = os.Remove(c.logPath(c.gen))
+	_ = os.Remove(c.snapshotPath(c.gen))
+	c.file, c.gen, c.size, c.dirty = logFile, gen, 0, false
+	return nil
+}
+
+func (c *Cache) writeSnapshot(gen uint64) error {
+	tmp := c.snapshotPath(gen) + tmpSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = c.backend.Snapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, c.snapshotPath(gen))
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// Close 把日志刷到磁盘上并且关闭，不会关闭 Backend
+func (c *Cache) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	err := c.file.Sync()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// write 在锁里面执行 fn，fn 返回需要记录的操作
+func (c *Cache) write(fn func() ([]record, error)) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	records, err := fn()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err = c.append(r); err != nil {
+			return fmt.Errorf("ecache: 写入操作日志失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Cache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
+	return c.write(func() ([]record, error) {
+		if err := c.backend.Set(ctx, key, val, expiration); err != nil {
+			return nil, err
+		}
+		return []record{setRecord(key, val, expiration)}, nil
+	})
+}
+
+func setRecord(key string, val any, expiration time.Duration) record {
+	r := record{op: opSet, key: key, values: []any{val}}
+	if expiration != 0 {
+		r.expiresAt = time.Now().Add(expiration)
+	}
+	return r
+}
+
+func (c *Cache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	var ok bool
+	err := c.write(func() ([]record, error) {
+		var err error
+		ok, err = c.backend.SetNX(ctx, key, val, expiration)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return []record{setRecord(key, val, expiration)}, nil
+	})
+	return ok, err
+}
+
+// Get 读操作不记录日志，也不需要加锁
+func (c *Cache) Get(ctx context.Context, key string) ecache.Value {
+	return c.backend.Get(ctx, key)
+}
+
+func (c *Cache) GetSet(ctx context.Context, key string, val string) (result ecache.Value) {
+	err := c.write(func() ([]record, error) {
+		result = c.backend.GetSet(ctx, key, val)
+		if result.Err != nil && !errors.Is(result.Err, errs.ErrKeyNotExist) {
+			return nil, nil
+		}
+		return []record{c.getSetRecord(ctx, key, val)}, nil
+	})
+	if err != nil {
+		result.Err = err
+	}
+	return
+}
+
+// getSetRecord 读出 GetSet 之后 key 真实的过期时间，Backend 不支持的时候当作永不过期
+func (c *Cache) getSetRecord(ctx context.Context, key string, val string) record {
+	backend, ok := c.backend.(deadlineBackend)
+	if !ok {
+		return setRecord(key, val, 0)
+	}
+	deadline, ok := backend.Deadline(ctx, key)
+	if !ok {
+		// 保留的有效期已经过了，写入的值也已经过期
+		return record{op: opDelete, key: key}
+	}
+	return record{op: opSet, key: key, values: []any{val}, expiresAt: deadline}
+}
+
+func (c *Cache) Delete(ctx context.Context, key ...string) (int64, error) {
+	var n int64
+	err := c.write(func() ([]record, error) {
+		var err error
+		n, err = c.backend.Delete(ctx, key...)
+		// 出错的时候部分 key 可能已经被删除了，全部记录下来，重放的时候删除不存在的 key 没有影响
+		records := make([]record, 0, len(key))
+		for _, k := range key {
+			records = append(records, record{op: opDelete, key: k})
+		}
+		return records, err
+	})
+	return n, err
+}
+
+func (c *Cache) LPush(ctx context.Context, key string, val ...any) (int64, error) {
+	var n int64
+	err := c.write(func() ([]record, error) {
+		var err error
+		n, err = c.backend.LPush(ctx, key, val...)
+		if err != nil {
+			return nil, err
+		}
+		return []record{{op: opLPush, key: key, values: val}}, nil
+	})
+	return n, err
+}
+
+func (c *Cache) LPop(ctx context.Context, key string) (result ecache.Value) {
+	err := c.write(func() ([]record, error) {
+		result = c.backend.LPop(ctx, key)
+		if result.Err != nil {
+			return nil, nil
+		}
+		return []record{{op: opLPop, key: key}}, nil
+	})
+	if err != nil {
+		result.Err = err
+	}
+	return
+}
+
+func (c *Cache) SAdd(ctx context.Context, key string, members ...any) (int64, error) {
+	var n int64
+	err := c.write(func() ([]record, error) {
+		var err error
+		n, err = c.backend.SAdd(ctx, key, members...)
+		if err != nil {
+			return nil, err
+		}
+		return []record{{op: opSAdd, key: key, values: members}}, nil
+	})
+	return n, err
+}
+
+func (c *Cache) SRem(ctx context.Context, key string, members ...any) (int64, error) {
+	var n int64
+	err := c.write(func() ([]record, error) {
+		var err error
+		n, err = c.backend.SRem(ctx, key, members...)
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		return []record{{op: opSRem, key: key, values: members}}, nil
+	})
+	return n, err
+}
+
+func (c *Cache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	var res int64
+	err := c.write(func() ([]record, error) {
+		var err error
+		res, err = c.backend.IncrBy(ctx, key, value)
+		if err != nil {
+			return nil, err
+		}
+		return []record{{op: opIncrBy, key: key, delta: value}}, nil
+	})
+	return res, err
+}
+
+// DecrBy 记录成 IncrBy 负数
+func (c *Cache) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
+	var res int64
+	err := c.write(func() ([]record, error) {
+		var err error
+		res, err = c.backend.DecrBy(ctx, key, value)
+		if err != nil {
+			return nil, err
+		}
+		return []record{{op: opIncrBy, key: key, delta: -value}}, nil
+	})
+	return res, err
+}
+
+func (c *Cache) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
+	var res float64
+	err := c.write(func() ([]record, error) {
+		var err error
+		res, err = c.backend.IncrByFloat(ctx, key, value)
+		if err != nil {
+			return nil, err
+		}
+		return []record{{op: opIncrByFloat, key: key, fdelta: value}}, nil
+	})
+	return res, err
+}
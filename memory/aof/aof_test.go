@@ -0,0 +1,258 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aof
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/priority"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackend(t *testing.T) Backend {
+	backend, err := priority.NewRBTreePriorityCache()
+	require.NoError(t, err)
+	return backend
+}
+
+// writeOps 执行一组写操作，checkOps 检查它们的结果
+func writeOps(t *testing.T, c *Cache) {
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "key1", "value1", 0))
+	require.NoError(t, c.Set(ctx, "key2", []byte("value2"), time.Minute))
+	require.NoError(t, c.Set(ctx, "expired", "value", time.Millisecond))
+	ok, err := c.SetNX(ctx, "key1", "value", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.SetNX(ctx, "nx", 12, 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, errs.ErrKeyNotExist, c.GetSet(ctx, "getset", "value").Err)
+	require.NoError(t, c.Set(ctx, "deleted", "value", 0))
+	n, err := c.Delete(ctx, "deleted", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = c.SAdd(ctx, "set", "a", "b", "c")
+	require.NoError(t, err)
+	_, err = c.SRem(ctx, "set", "b", "d")
+	require.NoError(t, err)
+	_, err = c.LPush(ctx, "list", "a", "b")
+	require.NoError(t, err)
+	require.NoError(t, c.LPop(ctx, "list").Err)
+	_, err = c.IncrBy(ctx, "int", 5)
+	require.NoError(t, err)
+	_, err = c.DecrBy(ctx, "int", 2)
+	require.NoError(t, err)
+	_, err = c.IncrByFloat(ctx, "float", 1.5)
+	require.NoError(t, err)
+	// 失败的操作不会被记录
+	_, err = c.IncrBy(ctx, "key1", 1)
+	assert.Error(t, err)
+}
+
+func checkOps(t *testing.T, c *Cache) {
+	ctx := context.Background()
+	assert.Equal(t, "value1", c.Get(ctx, "key1").Val)
+	assert.Equal(t, []byte("value2"), c.Get(ctx, "key2").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "expired").Err)
+	assert.Equal(t, 12, c.Get(ctx, "nx").Val)
+	assert.Equal(t, "value", c.Get(ctx, "getset").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "deleted").Err)
+	n, err := c.SRem(ctx, "set", "a", "b", "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	num, err := c.IncrBy(ctx, "int", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), num)
+	f, err := c.IncrByFloat(ctx, "float", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, f)
+	// 列表只剩下一个元素
+	require.NoError(t, c.LPop(ctx, "list").Err)
+	assert.Equal(t, errs.ErrKeyNotExist, c.LPop(ctx, "list").Err)
+}
+
+func TestCache_replay(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy SyncPolicy
+	}{
+		{name: "every second", policy: SyncEverySecond},
+		{name: "always", policy: SyncAlways},
+		{name: "never", policy: SyncNever},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			c, err := Open(dir, newBackend(t), WithSyncPolicy(tc.policy))
+			require.NoError(t, err)
+			writeOps(t, c)
+			require.NoError(t, c.Close())
+			assert.Equal(t, ErrClosed, c.Set(context.Background(), "key", "value", 0))
+			time.Sleep(2 * time.Millisecond)
+
+			c, err = Open(dir, newBackend(t), WithSyncPolicy(tc.policy))
+			require.NoError(t, err)
+			defer c.Close()
+			checkOps(t, c)
+		})
+	}
+}
+
+func TestCache_GetSet(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	c, err := Open(dir, newBackend(t))
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "minute", "value", time.Minute))
+	assert.Equal(t, "value", c.GetSet(ctx, "minute", "new").Val)
+	require.NoError(t, c.Set(ctx, "expired", "value", time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	c.GetSet(ctx, "expired", "new")
+	assert.Equal(t, errs.ErrKeyNotExist, c.GetSet(ctx, "forever", "value").Err)
+	require.NoError(t, c.Close())
+
+	// GetSet 保留原本的有效期，重放之后也一样
+	backend, err := priority.NewRBTreePriorityCache()
+	require.NoError(t, err)
+	c, err = Open(dir, backend)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, "new", c.Get(ctx, "minute").Val)
+	deadline, ok := backend.Deadline(ctx, "minute")
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "expired").Err)
+	deadline, ok = backend.Deadline(ctx, "forever")
+	require.True(t, ok)
+	assert.True(t, deadline.IsZero())
+}
+
+func TestCache_truncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir, newBackend(t))
+	require.NoError(t, err)
+	writeOps(t, c)
+	require.NoError(t, c.Close())
+
+	// 模拟写入一半的时候崩溃
+	path := filepath.Join(dir, "aof-0.log")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{100, 0, 0, 0, 1, 2, 3, 4, 1})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	time.Sleep(2 * time.Millisecond)
+
+	c, err = Open(dir, newBackend(t))
+	require.NoError(t, err)
+	// 不完整的记录被截断了
+	truncated, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+	checkOps(t, c)
+	require.NoError(t, c.Close())
+
+	// 截断之后的写入可以正常重放
+	c, err = Open(dir, newBackend(t))
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.IncrBy(context.Background(), "int", 0)
+	require.NoError(t, err)
+}
+
+func TestCache_corruptedLog(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir, newBackend(t))
+	require.NoError(t, err)
+	writeOps(t, c)
+	require.NoError(t, c.Close())
+
+	// 第一条记录的内容被破坏，后面还有完整的记录，不能当作崩溃留下的记录截断
+	path := filepath.Join(dir, "aof-0.log")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[headerSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = Open(dir, newBackend(t))
+	assert.ErrorIs(t, err, ErrCorrupted)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size())
+}
+
+func TestCache_Compact(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	c, err := Open(dir, newBackend(t), WithCompactThreshold(0))
+	require.NoError(t, err)
+	writeOps(t, c)
+	require.NoError(t, c.Compact())
+	assert.FileExists(t, filepath.Join(dir, "snapshot-1"))
+	assert.NoFileExists(t, filepath.Join(dir, "aof-0.log"))
+	info, err := os.Stat(filepath.Join(dir, "aof-1.log"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	// 压缩之后的写入记录在新的日志里面
+	require.NoError(t, c.Set(ctx, "after", "value", 0))
+	require.NoError(t, c.Close())
+	assert.Equal(t, ErrClosed, c.Compact())
+	time.Sleep(2 * time.Millisecond)
+
+	// 模拟压缩到一半的时候崩溃留下的文件
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "aof-2.log"), []byte("garbage"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot-2.tmp"), []byte("garbage"), 0o644))
+
+	c, err = Open(dir, newBackend(t))
+	require.NoError(t, err)
+	defer c.Close()
+	checkOps(t, c)
+	assert.Equal(t, "value", c.Get(ctx, "after").Val)
+	assert.NoFileExists(t, filepath.Join(dir, "aof-2.log"))
+	assert.NoFileExists(t, filepath.Join(dir, "snapshot-2.tmp"))
+}
+
+func TestCache_compactThreshold(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	c, err := Open(dir, newBackend(t), WithCompactThreshold(100))
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		_, err = c.IncrBy(ctx, "int", 1)
+		require.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "snapshot-1"))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, c.Close())
+
+	c, err = Open(dir, newBackend(t))
+	require.NoError(t, err)
+	defer c.Close()
+	num, err := c.IncrBy(ctx, "int", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), num)
+}
@@ -0,0 +1,388 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aof
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/ecodeclub/ecache/memory/snapshot"
+)
+
+// 日志由一条一条的记录组成，每一条记录的格式是：
+//
+//	length uint32 | crc32 uint32 | op uint8 | key | 操作的参数
+//
+// length 和 crc32 都是针对 op 开始的内容，字符串是 uvarint 长度加内容
+const headerSize = 8
+
+// maxRecordSize 一条记录 op 开始的内容最多占用的字节数，读取的时候超过这个长度说明 length 已经损坏
+const maxRecordSize = 64 << 20
+
+type opType uint8
+
+const (
+	opSet opType = iota + 1
+	opDelete
+	opLPush
+	opLPop
+	opSAdd
+	opSRem
+	opIncrBy
+	opIncrByFloat
+)
+
+var (
+	// ErrCorrupted 日志中间的记录损坏，只有末尾的记录损坏才是写入的时候崩溃留下的，可以安全地截断
+	ErrCorrupted = errors.New("ecache: 操作日志损坏")
+	// ErrRecordTooLarge 一条记录超过了 maxRecordSize
+	ErrRecordTooLarge = errors.New("ecache: 操作日志的记录太大")
+)
+
+// record 一条操作日志
+type record struct {
+	op  opType
+	key string
+	// expiresAt opSet 的过期时间，零值表示永不过期
+	expiresAt time.Time
+	// values opSet 的值，或者 opLPush、opSAdd、opSRem 的元素
+	values []any
+	delta  int64
+	fdelta float64
+}
+
+// encoder 把记录编码到复用的缓冲区里面
+type encoder struct {
+	buf   []byte
+	codec snapshot.Codec
+}
+
+func (e *encoder) encode(r record) ([]byte, error) {
+	e.buf = append(e.buf[:0], make([]byte, headerSize)...)
+	e.buf = append(e.buf, byte(r.op))
+	e.appendString(r.key)
+	var err error
+	switch r.op {
+	case opSet:
+		var expiresAt int64
+		if !r.expiresAt.IsZero() {
+			expiresAt = r.expiresAt.UnixNano()
+		}
+		e.buf = binary.AppendVarint(e.buf, expiresAt)
+		err = e.appendValue(r.values[0])
+	case opLPush, opSAdd, opSRem:
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(r.values)))
+		for _, val := range r.values {
+			if err = e.appendValue(val); err != nil {
+				break
+			}
+		}
+	case opIncrBy:
+		e.buf = binary.AppendVarint(e.buf, r.delta)
+	case opIncrByFloat:
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(r.fdelta))
+	}
+	if err != nil {
+		return nil, err
+	}
+	payload := e.buf[headerSize:]
+	if len(payload) > maxRecordSize {
+		return nil, ErrRecordTooLarge
+	}
+	binary.LittleEndian.PutUint32(e.buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(e.buf[4:8], crc32.ChecksumIEEE(payload))
+	return e.buf, nil
+}
+
+func (e *encoder) appendString(s string) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// appendValue string、[]byte、int64 和 float64 直接编码，其余的交给 codec
+func (e *encoder) appendValue(val any) error {
+	kind := snapshot.KindOf(val)
+	e.buf = append(e.buf, byte(kind))
+	switch v := val.(type) {
+	case string:
+		e.appendString(v)
+	case []byte:
+		e.appendString(string(v))
+	case int64:
+		e.buf = binary.AppendVarint(e.buf, v)
+	case float64:
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+	default:
+		data, err := e.codec.Marshal(val)
+		if err != nil {
+			return err
+		}
+		e.appendString(string(data))
+	}
+	return nil
+}
+
+// decoder 从一条记录的内容里面解码
+type decoder struct {
+	data  []byte
+	codec snapshot.Codec
+}
+
+func (d *decoder) decode() (record, error) {
+	var r record
+	op, err := d.byte()
+	if err != nil {
+		return r, err
+	}
+	r.op = opType(op)
+	if r.key, err = d.string(); err != nil {
+		return r, err
+	}
+	switch r.op {
+	case opSet:
+		expiresAt, err := d.varint()
+		if err != nil {
+			return r, err
+		}
+		if expiresAt != 0 {
+			r.expiresAt = time.Unix(0, expiresAt)
+		}
+		val, err := d.value()
+		if err != nil {
+			return r, err
+		}
+		r.values = []any{val}
+	case opLPush, opSAdd, opSRem:
+		n, err := d.uvarint()
+		if err != nil {
+			return r, err
+		}
+		if n > uint64(len(d.data)) {
+			return r, ErrCorrupted
+		}
+		r.values = make([]any, 0, n)
+		for i := uint64(0); i < n; i++ {
+			val, err := d.value()
+			if err != nil {
+				return r, err
+			}
+			r.values = append(r.values, val)
+		}
+	case opIncrBy:
+		r.delta, err = d.varint()
+	case opIncrByFloat:
+		var bits uint64
+		bits, err = d.uint64()
+		r.fdelta = math.Float64frombits(bits)
+	case opDelete, opLPop:
+	default:
+		return r, ErrCorrupted
+	}
+	return r, err
+}
+
+func (d *decoder) value() (any, error) {
+	kind, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch snapshot.Kind(kind) {
+	case snapshot.KindString:
+		return d.string()
+	case snapshot.KindBytes:
+		s, err := d.string()
+		return []byte(s), err
+	case snapshot.KindInt:
+		return d.varint()
+	case snapshot.KindFloat:
+		bits, err := d.uint64()
+		return math.Float64frombits(bits), err
+	case snapshot.KindValue:
+		data, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		return d.codec.Unmarshal([]byte(data))
+	default:
+		return nil, ErrCorrupted
+	}
+}
+
+func (d *decoder) byte() (byte, error) {
+	if len(d.data) < 1 {
+		return 0, ErrCorrupted
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b, nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(len(d.data)) {
+		return "", ErrCorrupted
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s, nil
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		return 0, ErrCorrupted
+	}
+	d.data = d.data[n:]
+	return v, nil
+}
+
+func (d *decoder) varint() (int64, error) {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		return 0, ErrCorrupted
+	}
+	d.data = d.data[n:]
+	return v, nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	if len(d.data) < 8 {
+		return 0, ErrCorrupted
+	}
+	v := binary.LittleEndian.Uint64(d.data)
+	d.data = d.data[8:]
+	return v, nil
+}
+
+// readRecords 依次读取日志里面的记录并且交给 fn，返回最后一条完整记录结束的位置
+// 进程在写入的过程中崩溃只会在末尾留下不完整或者校验失败的记录，读到这样的记录就停下来，
+// 由调用方把它截断；校验失败的记录后面还有内容说明日志本身损坏了，返回 ErrCorrupted
+func readRecords(r io.Reader, codec snapshot.Codec, fn func(record) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var offset int64
+	header := make([]byte, headerSize)
+	var payload []byte
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, err
+		}
+		length := binary.LittleEndian.Uint32(header[0:4])
+		if length > maxRecordSize {
+			// 不分配内存，跳过 length 个字节看看是不是已经到了末尾
+			if _, err := io.CopyN(io.Discard, br, int64(length)); err != nil {
+				if errors.Is(err, io.EOF) {
+					return offset, nil
+				}
+				return offset, err
+			}
+			return offset, corrupted(offset)
+		}
+		if cap(payload) < int(length) {
+			payload = make([]byte, length)
+		}
+		payload = payload[:length]
+		if _, err := io.ReadFull(br, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, err
+		}
+		var (
+			rec record
+			err error
+		)
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+			err = ErrCorrupted
+		} else {
+			d := decoder{data: payload, codec: codec}
+			rec, err = d.decode()
+		}
+		if err != nil {
+			_, peekErr := br.Peek(1)
+			if errors.Is(peekErr, io.EOF) {
+				return offset, nil
+			}
+			if peekErr != nil {
+				return offset, peekErr
+			}
+			return offset, corrupted(offset)
+		}
+		if err = fn(rec); err != nil {
+			return offset, err
+		}
+		offset += int64(headerSize) + int64(length)
+	}
+}
+
+// corrupted 返回 offset 开始的记录损坏的错误
+func corrupted(offset int64) error {
+	return fmt.Errorf("%w，位置 %d", ErrCorrupted, offset)
+}
+
+// apply 在 backend 上重放一条记录
+func apply(ctx context.Context, backend Backend, r record) error {
+	var err error
+	switch r.op {
+	case opSet:
+		if r.expiresAt.IsZero() {
+			return backend.Set(ctx, r.key, r.values[0], 0)
+		}
+		expiration := time.Until(r.expiresAt)
+		if expiration <= 0 {
+			_, err = backend.Delete(ctx, r.key)
+			return err
+		}
+		return backend.Set(ctx, r.key, r.values[0], expiration)
+	case opDelete:
+		_, err = backend.Delete(ctx, r.key)
+	case opLPush:
+		_, err = backend.LPush(ctx, r.key, r.values...)
+	case opLPop:
+		err = backend.LPop(ctx, r.key).Err
+	case opSAdd:
+		_, err = backend.SAdd(ctx, r.key, r.values...)
+	case opSRem:
+		_, err = backend.SRem(ctx, r.key, r.values...)
+	case opIncrBy:
+		_, err = backend.IncrBy(ctx, r.key, r.delta)
+	case opIncrByFloat:
+		_, err = backend.IncrByFloat(ctx, r.key, r.fdelta)
+	}
+	return err
+}
+
+// syncDir 让目录里面的创建和重命名持久化，有些平台不支持对目录调用 Sync，这种情况下忽略错误
+func syncDir(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = f.Sync()
+	_ = f.Close()
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/memory/snapshot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	expiresAt := time.Unix(0, time.Now().UnixNano())
+	records := []record{
+		{op: opSet, key: "string", values: []any{"value"}},
+		{op: opSet, key: "bytes", values: []any{[]byte("value")}, expiresAt: expiresAt},
+		{op: opSet, key: "int", values: []any{int64(-1)}},
+		{op: opSet, key: "float", values: []any{1.5}},
+		{op: opSet, key: "codec", values: []any{12}},
+		{op: opDelete, key: "key"},
+		{op: opLPush, key: "list", values: []any{"a", int64(1)}},
+		{op: opLPop, key: "list"},
+		{op: opSAdd, key: "set", values: []any{"a"}},
+		{op: opSRem, key: "set", values: []any{}},
+		{op: opIncrBy, key: "int", delta: -3},
+		{op: opIncrByFloat, key: "float", fdelta: 0.5},
+	}
+	enc := encoder{codec: snapshot.GobCodec{}}
+	var buf bytes.Buffer
+	for _, r := range records {
+		data, err := enc.encode(r)
+		require.NoError(t, err)
+		buf.Write(data)
+	}
+	valid := buf.Len()
+
+	var got []record
+	offset, err := readRecords(&buf, snapshot.GobCodec{}, func(r record) error {
+		got = append(got, r)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(valid), offset)
+	require.Len(t, got, len(records))
+	for i, want := range records {
+		assert.Equal(t, want.op, got[i].op)
+		assert.Equal(t, want.key, got[i].key)
+		assert.True(t, want.expiresAt.Equal(got[i].expiresAt))
+		assert.Equal(t, want.delta, got[i].delta)
+		assert.Equal(t, want.fdelta, got[i].fdelta)
+		if len(want.values) > 0 {
+			assert.Equal(t, want.values, got[i].values)
+		}
+	}
+}
+
+func TestRecord_encodeError(t *testing.T) {
+	enc := encoder{codec: snapshot.GobCodec{}}
+	_, err := enc.encode(record{op: opSet, key: "key", values: []any{func() {}}})
+	assert.Error(t, err)
+	_, err = enc.encode(record{op: opSet, key: "key", values: []any{make([]byte, maxRecordSize)}})
+	assert.Equal(t, ErrRecordTooLarge, err)
+}
+
+func TestReadRecords(t *testing.T) {
+	enc := encoder{codec: snapshot.GobCodec{}}
+	encode := func(key string) []byte {
+		data, err := enc.encode(record{op: opDelete, key: key})
+		require.NoError(t, err)
+		return append([]byte(nil), data...)
+	}
+	badCRC := func(key string) []byte {
+		data := encode(key)
+		data[len(data)-1] = 'x'
+		return data
+	}
+	tooLarge := func(key string) []byte {
+		data := encode(key)
+		binary.LittleEndian.PutUint32(data[0:4], maxRecordSize+1)
+		return data
+	}
+	first := encode("first")
+	valid := int64(len(first))
+	testCases := []struct {
+		name    string
+		tail    [][]byte
+		wantErr error
+	}{
+		{
+			name: "complete",
+		},
+		{
+			name: "truncated header",
+			tail: [][]byte{encode("key")[:headerSize-1]},
+		},
+		{
+			name: "truncated payload",
+			tail: [][]byte{encode("key")[:headerSize+2]},
+		},
+		{
+			name: "last record crc mismatch",
+			tail: [][]byte{badCRC("key")},
+		},
+		{
+			name: "last record length too large",
+			tail: [][]byte{tooLarge("key")},
+		},
+		{
+			name:    "crc mismatch in the middle",
+			tail:    [][]byte{badCRC("key"), encode("after")},
+			wantErr: ErrCorrupted,
+		},
+		{
+			name:    "length too large in the middle",
+			tail:    [][]byte{tooLarge("key"), make([]byte, maxRecordSize+1)},
+			wantErr: ErrCorrupted,
+		},
+		{
+			name:    "undecodable record in the middle",
+			tail:    [][]byte{encodeRaw([]byte{byte(opSet)}), encode("after")},
+			wantErr: ErrCorrupted,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(append([]byte(nil), first...))
+			for _, data := range tc.tail {
+				buf.Write(data)
+			}
+			var keys []string
+			offset, err := readRecords(buf, snapshot.GobCodec{}, func(r record) error {
+				keys = append(keys, r.key)
+				return nil
+			})
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, valid, offset)
+			assert.Equal(t, []string{"first"}, keys)
+		})
+	}
+}
+
+// encodeRaw 给 payload 加上正确的 length 和 crc32
+func encodeRaw(payload []byte) []byte {
+	data := make([]byte, headerSize, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(data[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(data[4:8], crc32.ChecksumIEEE(payload))
+	return append(data, payload...)
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arc
+
+import (
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/internal/linkedlist"
+)
+
+var _ memory.EvictionPolicy = (*Policy)(nil)
+
+// listType 标记 key 当前在哪一个链表里面
+type listType uint8
+
+const (
+	// listT1 只被访问过一次的 key
+	listT1 listType = iota
+	// listT2 被访问过至少两次的 key
+	listT2
+	// listB1 最近从 T1 淘汰的 key
+	listB1
+	// listB2 最近从 T2 淘汰的 key
+	listB2
+)
+
+type entry struct {
+	key  string
+	list listType
+}
+
+func (e entry) isGhost() bool {
+	return e.list == listB1 || e.list == listB2
+}
+
+// Policy Adaptive Replacement Cache 淘汰策略，在最近访问和频繁访问之间自动平衡
+//
+// T1 和 T2 记录缓存里面的 key，分别偏向最近访问和频繁访问，
+// B1 和 B2 是对应的幽灵链表，只记录最近因为容量不足被淘汰的 key。
+// 命中 B1 说明 T1 太小了，命中 B2 说明 T2 太小了，
+// p 是 T1 的目标大小，根据幽灵链表的命中情况自动调整，不需要人工指定参数
+type Policy struct {
+	capacity int
+	p        int
+
+	data map[string]*linkedlist.Element[entry]
+	t1   *linkedlist.List[entry]
+	t2   *linkedlist.List[entry]
+	b1   *linkedlist.List[entry]
+	b2   *linkedlist.List[entry]
+}
+
+// NewPolicy capacity 需要和 memory.Store 的容量一致，用来限制 p 和幽灵链表的大小
+func NewPolicy(capacity int) *Policy {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Policy{
+		capacity: capacity,
+		data:     make(map[string]*linkedlist.Element[entry], capacity*2),
+		t1:       linkedlist.New[entry](),
+		t2:       linkedlist.New[entry](),
+		b1:       linkedlist.New[entry](),
+		b2:       linkedlist.New[entry](),
+	}
+}
+
+func (a *Policy) listOf(lt listType) *linkedlist.List[entry] {
+	switch lt {
+	case listT2:
+		return a.t2
+	case listB1:
+		return a.b1
+	case listB2:
+		return a.b2
+	default:
+		return a.t1
+	}
+}
+
+// OnInsert 命中幽灵链表的 key 直接进入 T2 并且调整 p，全新的 key 进入 T1
+// Store 在 OnInsert 之前就已经通过 Victim 腾出了位置，
+// 所以命中幽灵链表对 p 的调整从下一次淘汰开始生效
+func (a *Policy) OnInsert(key string) {
+	elem, ok := a.data[key]
+	if !ok {
+		// 幽灵链表的总长度不超过容量
+		if a.b1.Len() > 0 && a.b1.Len() > a.capacity-a.p {
+			a.removeElem(a.b1.Back())
+		}
+		if a.b2.Len() > 0 && a.b2.Len() > a.p {
+			a.removeElem(a.b2.Back())
+		}
+		a.data[key] = a.t1.PushFront(entry{key: key, list: listT1})
+		return
+	}
+	switch elem.Value.list {
+	case listB1:
+		// T1 太小了，调大 p
+		delta := 1
+		if a.b2.Len() > a.b1.Len() {
+			delta = a.b2.Len() / a.b1.Len()
+		}
+		a.p += delta
+		if a.p > a.capacity {
+			a.p = a.capacity
+		}
+	case listB2:
+		// T2 太小了，调小 p
+		delta := 1
+		if a.b1.Len() > a.b2.Len() {
+			delta = a.b1.Len() / a.b2.Len()
+		}
+		a.p -= delta
+		if a.p < 0 {
+			a.p = 0
+		}
+	}
+	a.moveTo(elem, listT2)
+}
+
+// OnAccess 第二次访问，晋升到 T2
+func (a *Policy) OnAccess(key string) {
+	if elem, ok := a.data[key]; ok && !elem.Value.isGhost() {
+		a.moveTo(elem, listT2)
+	}
+}
+
+// OnRemove 因为容量不足被淘汰的 key 进入对应的幽灵链表，其余的直接移除
+func (a *Policy) OnRemove(key string, reason evict.Reason) {
+	elem, ok := a.data[key]
+	if !ok || elem.Value.isGhost() {
+		return
+	}
+	if reason != evict.ReasonCapacity {
+		a.removeElem(elem)
+		return
+	}
+	ghost := listB1
+	if elem.Value.list == listT2 {
+		ghost = listB2
+	}
+	a.moveTo(elem, ghost)
+}
+
+// Victim 根据 p 从 T1 或者 T2 的队尾选一个 key 淘汰
+func (a *Policy) Victim() (string, bool) {
+	t1Len := a.t1.Len()
+	if t1Len > 0 && (t1Len > a.p || a.t2.Len() == 0) {
+		return a.t1.Back().Value.key, true
+	}
+	if elem := a.t2.Back(); elem != nil {
+		return elem.Value.key, true
+	}
+	return "", false
+}
+
+// moveTo 把元素挪到 lt 链表的队头
+func (a *Policy) moveTo(elem *linkedlist.Element[entry], lt listType) {
+	if elem.Value.list == lt {
+		a.listOf(lt).MoveToFront(elem)
+		return
+	}
+	ent := a.listOf(elem.Value.list).Remove(elem)
+	ent.list = lt
+	a.data[ent.key] = a.listOf(lt).PushFront(ent)
+}
+
+func (a *Policy) removeElem(elem *linkedlist.Element[entry]) {
+	ent := a.listOf(elem.Value.list).Remove(elem)
+	delete(a.data, ent.key)
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checkLists(t *testing.T, a *Policy) {
+	total := 0
+	for _, lt := range []listType{listT1, listT2, listB1, listB2} {
+		l := a.listOf(lt)
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			require.Equal(t, lt, elem.Value.list)
+			require.Same(t, elem, a.data[elem.Value.key])
+			total++
+		}
+	}
+	require.Equal(t, len(a.data), total)
+	require.LessOrEqual(t, a.t1.Len()+a.t2.Len(), a.capacity)
+	require.LessOrEqual(t, len(a.data), 2*a.capacity)
+	require.GreaterOrEqual(t, a.p, 0)
+	require.LessOrEqual(t, a.p, a.capacity)
+}
+
+func TestPolicy_lists(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	a := NewPolicy(4)
+	s := memory.NewStore(4, a, memory.WithEvictListener(
+		evict.ListenerFunc(func(evt evict.Event) {
+			events = append(events, evt)
+		})))
+	defer s.Close()
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, s.Set(ctx, fmt.Sprintf("key%d", i), i, 0))
+		checkLists(t, a)
+	}
+	assert.Equal(t, 4, a.t1.Len())
+
+	// 第二次访问晋升到 T2
+	require.NoError(t, s.Get(ctx, "key1").Err)
+	assert.Equal(t, listT2, a.data["key1"].Value.list)
+	checkLists(t, a)
+
+	// 满了之后 T1 的队尾进入 B1
+	require.NoError(t, s.Set(ctx, "key5", 5, 0))
+	checkLists(t, a)
+	assert.Equal(t, listB1, a.data["key2"].Value.list)
+	assert.Error(t, s.Get(ctx, "key2").Err)
+	assert.Equal(t, []evict.Event{{Key: "key2", Value: 2, Reason: evict.ReasonCapacity}}, events)
+
+	// 命中 B1，调大 p，直接进入 T2
+	require.NoError(t, s.Set(ctx, "key2", 2, 0))
+	checkLists(t, a)
+	assert.Equal(t, 1, a.p)
+	assert.Equal(t, listT2, a.data["key2"].Value.list)
+	assert.Equal(t, 2, a.t2.Len())
+
+	// 删除的 key 不会进入幽灵链表
+	_, err := s.Delete(ctx, "key2")
+	require.NoError(t, err)
+	_, ok := a.data["key2"]
+	assert.False(t, ok)
+	checkLists(t, a)
+}
+
+func TestPolicy_ghostB2(t *testing.T) {
+	a := NewPolicy(2)
+	a.OnInsert("key1")
+	a.OnInsert("key2")
+	a.OnAccess("key1")
+	a.OnAccess("key2")
+	assert.Equal(t, 2, a.t2.Len())
+	a.p = 1
+
+	// T1 为空，只能从 T2 淘汰到 B2
+	victim, ok := a.Victim()
+	require.True(t, ok)
+	assert.Equal(t, "key1", victim)
+	a.OnRemove(victim, evict.ReasonCapacity)
+	a.OnInsert("key3")
+	checkLists(t, a)
+	assert.Equal(t, listB2, a.data["key1"].Value.list)
+
+	// 命中 B2，调小 p
+	victim, ok = a.Victim()
+	require.True(t, ok)
+	a.OnRemove(victim, evict.ReasonCapacity)
+	a.OnInsert("key1")
+	checkLists(t, a)
+	assert.Equal(t, 0, a.p)
+	assert.Equal(t, listT2, a.data["key1"].Value.list)
+}
+
+func TestPolicy_scan(t *testing.T) {
+	ctx := context.Background()
+	a := NewPolicy(100)
+	s := memory.NewStore(100, a)
+	defer s.Close()
+	for i := 0; i < 50; i++ {
+		require.NoError(t, s.Set(ctx, fmt.Sprintf("hot%d", i), i, 0))
+		_ = s.Get(ctx, fmt.Sprintf("hot%d", i))
+	}
+	// 一次性扫描只会在 T1 里面轮转
+	for i := 0; i < 10000; i++ {
+		require.NoError(t, s.Set(ctx, fmt.Sprintf("scan%d", i), i, 0))
+	}
+	checkLists(t, a)
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, s.Get(ctx, fmt.Sprintf("hot%d", i)).Err)
+	}
+}
+
+func TestNewCache(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	c := NewCache(2, memory.WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+		evicted = append(evicted, evt.Key)
+	})))
+	defer c.Close()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), i, 0))
+	}
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, 3, c.Get(ctx, "key3").Val)
+}
@@ -0,0 +1,25 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arc
+
+import (
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+// NewCache 创建一个最多容纳 capacity 个键值对、使用 ARC 淘汰策略的缓存，不再使用的时候应该调用 Close
+func NewCache(capacity int, opts ...option.Option[memory.Store]) *memory.Store {
+	return memory.NewStore(capacity, NewPolicy(capacity), opts...)
+}
@@ -0,0 +1,355 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package arena 把数据编码之后保存在预先分配好的大块 []byte 里面，
+// 索引也不包含指针，缓存里面有大量数据的时候 GC 几乎不需要扫描它
+package arena
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/internal/datatype"
+	"github.com/ecodeclub/ekit"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+var (
+	_ ecache.Cache = (*Cache)(nil)
+
+	// ErrEntryTooLarge 键值对编码之后比一个分片的缓冲区还大
+	ErrEntryTooLarge = errors.New("ecache: 键值对太大，超过了分片的容量")
+)
+
+const (
+	defaultShards = 64
+	// minShardSize 自动调整分片数量的时候，每个分片至少分到的字节数
+	minShardSize = 64 << 10
+	// maxShardSize 分片里面的偏移量是 uint32
+	maxShardSize = math.MaxUint32
+)
+
+// Cache 把数据保存在多个环形缓冲区里面的缓存，只支持字符串、[]byte 和数字
+//
+// 空间不够的时候按照写入的顺序覆盖最旧的数据，和访问顺序无关。
+// 覆盖和删除不会立刻回收空间，旧的数据会在缓冲区转一圈之后被覆盖。
+// 列表和集合相关的方法都会返回 ecache.ErrNotSupported
+type Cache struct {
+	shards        []*shard
+	mask          uint64
+	seed          maphash.Seed
+	shardCount    int
+	cycleInterval time.Duration
+	closeOnce     sync.Once
+	done          chan struct{}
+}
+
+// NewCache 创建一个总共占用 maxBytes 字节的缓存，内存在创建的时候一次性分配
+// 如果 maxBytes 太小，分片数量会自动减少，保证每个分片至少有 64KB
+func NewCache(maxBytes int, opts ...option.Option[Cache]) *Cache {
+	res := &Cache{
+		seed:          maphash.MakeSeed(),
+		shardCount:    defaultShards,
+		cycleInterval: time.Second,
+		done:          make(chan struct{}),
+	}
+	option.Apply(res, opts...)
+	shards := 1
+	for shards < res.shardCount {
+		shards <<= 1
+	}
+	for shards > 1 && maxBytes/shards < minShardSize {
+		shards >>= 1
+	}
+	shardSize := maxBytes / shards
+	if shardSize > maxShardSize {
+		shardSize = maxShardSize
+	}
+	res.shards = make([]*shard, shards)
+	for i := range res.shards {
+		res.shards[i] = newShard(shardSize)
+	}
+	res.mask = uint64(shards - 1)
+	go res.cleanCycle()
+	return res
+}
+
+// WithShards 设置分片的数量，会向上取整到 2 的幂，分片越多锁竞争越少
+func WithShards(shards int) option.Option[Cache] {
+	return func(c *Cache) {
+		c.shardCount = shards
+	}
+}
+
+// WithCycleInterval 设置过期清理的间隔
+func WithCycleInterval(interval time.Duration) option.Option[Cache] {
+	return func(c *Cache) {
+		c.cycleInterval = interval
+	}
+}
+
+// cleanCycle 定期从每个分片最旧的数据开始清理过期的 key
+// 比较新的过期数据会留在缓冲区里面，直到被覆盖或者被访问
+func (c *Cache) cleanCycle() {
+	ticker := time.NewTicker(c.cycleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+		for _, s := range c.shards {
+			s.lock.Lock()
+			s.cleanHead(time.Now().UnixNano())
+			s.lock.Unlock()
+		}
+	}
+}
+
+// Close 停止后台清理，Cache 用完之后调用它释放 goroutine
+// Close 之后仍然可以读写，过期的数据会在被访问或者被覆盖的时候清理
+func (c *Cache) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+func (c *Cache) shardOf(key string) (*shard, uint64) {
+	hash := maphash.String(c.seed, key)
+	return c.shards[hash&c.mask], hash
+}
+
+func expiresAt(expiration time.Duration) int64 {
+	if expiration == 0 {
+		return 0
+	}
+	return time.Now().Add(expiration).UnixNano()
+}
+
+// encode 把 val 转换为可以写入缓冲区的形式
+func encode(val any) (value, error) {
+	switch v := val.(type) {
+	case string:
+		return value{kind: kindString, str: v}, nil
+	case []byte:
+		return value{kind: kindBytes, b: v}, nil
+	case int:
+		return value{kind: kindInt, num: uint64(v)}, nil
+	case int32:
+		return value{kind: kindInt, num: uint64(v)}, nil
+	case int64:
+		return value{kind: kindInt, num: uint64(v)}, nil
+	case float32:
+		return value{kind: kindFloat, num: math.Float64bits(float64(v))}, nil
+	case float64:
+		return value{kind: kindFloat, num: math.Float64bits(v)}, nil
+	default:
+		return value{}, fmt.Errorf("%w: 值的类型 %T", errs.ErrNotSupported, val)
+	}
+}
+
+// decode 把缓冲区里面的值拷贝出来，整数统一返回 int64，浮点数统一返回 float64
+func decode(e entry) any {
+	data := e.value()
+	switch e.kind() {
+	case kindString:
+		return string(data)
+	case kindBytes:
+		return append([]byte(nil), data...)
+	case kindInt:
+		return int64(binary.LittleEndian.Uint64(data))
+	default:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data))
+	}
+}
+
+// checkSize 键值对必须能放进一个分片里面
+func (c *Cache) checkSize(key string, val value) error {
+	if len(key) > maxKeyLen {
+		return fmt.Errorf("%w: key 的长度 %d", ErrEntryTooLarge, len(key))
+	}
+	if headerSize+len(key)+val.size() > len(c.shards[0].buf) {
+		return ErrEntryTooLarge
+	}
+	return nil
+}
+
+func (c *Cache) Set(_ context.Context, key string, val any, expiration time.Duration) error {
+	v, err := encode(val)
+	if err != nil {
+		return err
+	}
+	if err = c.checkSize(key, v); err != nil {
+		return err
+	}
+	s, hash := c.shardOf(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.set(key, hash, v, expiresAt(expiration))
+	return nil
+}
+
+func (c *Cache) SetNX(_ context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	v, err := encode(val)
+	if err != nil {
+		return false, err
+	}
+	if err = c.checkSize(key, v); err != nil {
+		return false, err
+	}
+	s, hash := c.shardOf(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.get(key, hash, time.Now().UnixNano()); ok {
+		return false, nil
+	}
+	s.set(key, hash, v, expiresAt(expiration))
+	return true, nil
+}
+
+// Get 只需要分片的读锁，过期的 key 留给写操作和过期清理去处理
+func (c *Cache) Get(_ context.Context, key string) (val ecache.Value) {
+	s, hash := c.shardOf(key)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	e, ok := s.get(key, hash, time.Now().UnixNano())
+	if !ok {
+		val.Err = errs.ErrKeyNotExist
+		return
+	}
+	val.Val = decode(e)
+	return
+}
+
+// GetSet 和 Redis 的 GETSET 一样，新的值永不过期
+func (c *Cache) GetSet(_ context.Context, key string, val string) (result ecache.Value) {
+	v := value{kind: kindString, str: val}
+	if err := c.checkSize(key, v); err != nil {
+		result.Err = err
+		return
+	}
+	s, hash := c.shardOf(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.get(key, hash, time.Now().UnixNano()); ok {
+		result.Val = decode(e)
+	} else {
+		result.Err = errs.ErrKeyNotExist
+	}
+	s.set(key, hash, v, 0)
+	return
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...string) (int64, error) {
+	var n int64
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		s, hash := c.shardOf(key)
+		s.lock.Lock()
+		if s.del(key, hash, time.Now().UnixNano()) {
+			n++
+		}
+		s.lock.Unlock()
+	}
+	return n, nil
+}
+
+func (c *Cache) LPush(context.Context, string, ...any) (int64, error) {
+	return 0, errs.ErrNotSupported
+}
+
+func (c *Cache) LPop(context.Context, string) ecache.Value {
+	return ecache.Value{AnyValue: ekit.AnyValue{Err: errs.ErrNotSupported}}
+}
+
+func (c *Cache) SAdd(context.Context, string, ...any) (int64, error) {
+	return 0, errs.ErrNotSupported
+}
+
+func (c *Cache) SRem(context.Context, string, ...any) (int64, error) {
+	return 0, errs.ErrNotSupported
+}
+
+func (c *Cache) IncrBy(_ context.Context, key string, value int64) (int64, error) {
+	return c.incrBy(key, value, datatype.ErrOnlyNumCanIncrBy)
+}
+
+func (c *Cache) DecrBy(_ context.Context, key string, value int64) (int64, error) {
+	return c.incrBy(key, -value, datatype.ErrOnlyNumCanDecrBy)
+}
+
+// incrBy 数字固定占 8 个字节，所以直接在缓冲区里面修改，保留原本的有效期
+func (c *Cache) incrBy(key string, delta int64, typeErr error) (int64, error) {
+	v := value{kind: kindInt, num: uint64(delta)}
+	if err := c.checkSize(key, v); err != nil {
+		return 0, err
+	}
+	s, hash := c.shardOf(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.get(key, hash, time.Now().UnixNano())
+	if !ok {
+		s.set(key, hash, v, 0)
+		return delta, nil
+	}
+	if e.kind() != kindInt {
+		return 0, typeErr
+	}
+	data := e.value()
+	res := int64(binary.LittleEndian.Uint64(data)) + delta
+	binary.LittleEndian.PutUint64(data, uint64(res))
+	return res, nil
+}
+
+// IncrByFloat 原本的值是整数的时候会被转换为浮点数
+func (c *Cache) IncrByFloat(_ context.Context, key string, delta float64) (float64, error) {
+	v := value{kind: kindFloat, num: math.Float64bits(delta)}
+	if err := c.checkSize(key, v); err != nil {
+		return 0, err
+	}
+	s, hash := c.shardOf(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.get(key, hash, time.Now().UnixNano())
+	if !ok {
+		s.set(key, hash, v, 0)
+		return delta, nil
+	}
+	data := e.value()
+	var num float64
+	switch e.kind() {
+	case kindFloat:
+		num = math.Float64frombits(binary.LittleEndian.Uint64(data))
+	case kindInt:
+		num = float64(int64(binary.LittleEndian.Uint64(data)))
+		e[offsetKind] = kindFloat
+	default:
+		return 0, datatype.ErrOnlyNumCanIncrBy
+	}
+	num += delta
+	binary.LittleEndian.PutUint64(data, math.Float64bits(num))
+	return num, nil
+}
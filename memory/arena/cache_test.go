@@ -0,0 +1,214 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arena
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/internal/datatype"
+	"github.com/ecodeclub/ecache/memory/lru"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCache(t *testing.T) {
+	testCases := []struct {
+		name          string
+		maxBytes      int
+		opts          []option.Option[Cache]
+		wantShards    int
+		wantShardSize int
+	}{
+		{name: "default", maxBytes: 64 << 20, wantShards: 64, wantShardSize: 1 << 20},
+		{name: "small", maxBytes: 256 << 10, wantShards: 4, wantShardSize: 64 << 10},
+		{name: "tiny", maxBytes: 1024, wantShards: 1, wantShardSize: 1024},
+		{name: "shards", maxBytes: 64 << 20, opts: []option.Option[Cache]{WithShards(5)}, wantShards: 8, wantShardSize: 8 << 20},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewCache(tc.maxBytes, tc.opts...)
+			defer c.Close()
+			assert.Equal(t, tc.wantShards, len(c.shards))
+			assert.Equal(t, uint64(tc.wantShards-1), c.mask)
+			assert.Equal(t, tc.wantShardSize, len(c.shards[0].buf))
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(1 << 20)
+	defer c.Close()
+
+	require.NoError(t, c.Set(ctx, "str", "value", time.Minute))
+	require.NoError(t, c.Set(ctx, "bytes", []byte("value"), 0))
+	require.NoError(t, c.Set(ctx, "int", 12, 0))
+	require.NoError(t, c.Set(ctx, "float", float32(1.5), 0))
+	assert.Equal(t, "value", c.Get(ctx, "str").Val)
+	assert.Equal(t, []byte("value"), c.Get(ctx, "bytes").Val)
+	assert.Equal(t, int64(12), c.Get(ctx, "int").Val)
+	assert.Equal(t, 1.5, c.Get(ctx, "float").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "missing").Err)
+
+	err := c.Set(ctx, "struct", struct{}{}, 0)
+	assert.ErrorIs(t, err, ecache.ErrNotSupported)
+
+	ok, err := c.SetNX(ctx, "str", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.SetNX(ctx, "str2", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	res := c.GetSet(ctx, "str", "value3")
+	assert.Equal(t, "value", res.Val)
+	assert.Equal(t, "value3", c.Get(ctx, "str").Val)
+	res = c.GetSet(ctx, "str3", "value3")
+	assert.Equal(t, errs.ErrKeyNotExist, res.Err)
+
+	n, err := c.Delete(ctx, "str", "str2", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	_, err = c.LPush(ctx, "list", 1)
+	assert.ErrorIs(t, err, ecache.ErrNotSupported)
+	assert.ErrorIs(t, c.LPop(ctx, "list").Err, ecache.ErrNotSupported)
+	_, err = c.SAdd(ctx, "set", 1)
+	assert.ErrorIs(t, err, ecache.ErrNotSupported)
+	_, err = c.SRem(ctx, "set", 1)
+	assert.ErrorIs(t, err, ecache.ErrNotSupported)
+}
+
+func TestCache_counter(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(1 << 20)
+	defer c.Close()
+
+	n, err := c.IncrBy(ctx, "counter", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	require.NoError(t, c.Set(ctx, "counter", 10, time.Minute))
+	n, err = c.DecrBy(ctx, "counter", 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+
+	// 直接在缓冲区里面修改，不会写入新的 entry，也保留原本的有效期
+	s, hash := c.shardOf("counter")
+	entries := s.entries
+	e, _ := s.get("counter", hash, time.Now().UnixNano())
+	n, err = c.IncrBy(ctx, "counter", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	assert.Equal(t, entries, s.entries)
+	e2, _ := s.get("counter", hash, time.Now().UnixNano())
+	assert.Equal(t, e.expiresAt(), e2.expiresAt())
+
+	f, err := c.IncrByFloat(ctx, "counter", 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 7.5, f)
+	assert.Equal(t, 7.5, c.Get(ctx, "counter").Val)
+	_, err = c.IncrBy(ctx, "counter", 1)
+	assert.Equal(t, datatype.ErrOnlyNumCanIncrBy, err)
+	f, err = c.IncrByFloat(ctx, "float", 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, f)
+
+	require.NoError(t, c.Set(ctx, "str", "value", 0))
+	_, err = c.DecrBy(ctx, "str", 1)
+	assert.Equal(t, datatype.ErrOnlyNumCanDecrBy, err)
+	_, err = c.IncrByFloat(ctx, "str", 1)
+	assert.Equal(t, datatype.ErrOnlyNumCanIncrBy, err)
+}
+
+func TestCache_expiration(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(1<<20, WithCycleInterval(time.Millisecond*10))
+	defer c.Close()
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Millisecond))
+	require.NoError(t, c.Set(ctx, "key2", "value2", -time.Minute))
+	require.NoError(t, c.Set(ctx, "key3", "value3", time.Minute))
+
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key2").Err)
+	n, err := c.Delete(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = c.IncrBy(ctx, "key2", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	time.Sleep(time.Millisecond * 5)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key1").Err)
+	s, hash := c.shardOf("key1")
+	assert.Eventually(t, func() bool {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		_, ok := s.index[hash]
+		return !ok
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, "value3", c.Get(ctx, "key3").Val)
+}
+
+func TestCache_Close(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(1<<20, WithCycleInterval(time.Millisecond))
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Millisecond))
+	time.Sleep(time.Millisecond * 20)
+
+	s, hash := c.shardOf("key1")
+	s.lock.RLock()
+	_, ok := s.index[hash]
+	s.lock.RUnlock()
+	assert.True(t, ok)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key1").Err)
+}
+
+func TestCache_entryTooLarge(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(1024)
+	defer c.Close()
+	assert.ErrorIs(t, c.Set(ctx, "key", strings.Repeat("a", 1024), 0), ErrEntryTooLarge)
+	assert.ErrorIs(t, c.Set(ctx, strings.Repeat("k", maxKeyLen+1), "value", 0), ErrEntryTooLarge)
+	_, err := c.SetNX(ctx, "key", strings.Repeat("a", 1024), 0)
+	assert.ErrorIs(t, err, ErrEntryTooLarge)
+	assert.ErrorIs(t, c.GetSet(ctx, "key", strings.Repeat("a", 1024)).Err, ErrEntryTooLarge)
+}
+
+func BenchmarkCache_Set(b *testing.B) {
+	testCases := []struct {
+		name  string
+		cache ecache.Cache
+	}{
+		{name: "arena", cache: NewCache(256 << 20)},
+		{name: "lru", cache: lru.NewCache(1 << 20)},
+	}
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			ctx := context.Background()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = tc.cache.Set(ctx, strconv.Itoa(i%(1<<20)), "value", time.Hour)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arena
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// 每一个 entry 在环形缓冲区里面的布局，所有数字都是小端序：
+//
+//	expiresAt int64 | hash uint64 | size uint32 | keyLen uint16 | kind uint8 | key | value
+const (
+	offsetHash   = 8
+	offsetSize   = 16
+	offsetKeyLen = 20
+	offsetKind   = 22
+	headerSize   = 23
+
+	maxKeyLen = math.MaxUint16
+)
+
+// 值的类型
+const (
+	kindString uint8 = iota + 1
+	kindBytes
+	kindInt
+	kindFloat
+)
+
+// value 编码之前的值，字符串和 []byte 直接拷贝到缓冲区里面，数字固定占 8 个字节
+type value struct {
+	kind uint8
+	str  string
+	b    []byte
+	num  uint64
+}
+
+func (v value) size() int {
+	switch v.kind {
+	case kindString:
+		return len(v.str)
+	case kindBytes:
+		return len(v.b)
+	default:
+		return 8
+	}
+}
+
+func (v value) writeTo(dst []byte) {
+	switch v.kind {
+	case kindString:
+		copy(dst, v.str)
+	case kindBytes:
+		copy(dst, v.b)
+	default:
+		binary.LittleEndian.PutUint64(dst, v.num)
+	}
+}
+
+// entry 指向缓冲区里面的一个 entry，只在持有锁的时候有效
+type entry []byte
+
+func (e entry) expiresAt() int64 {
+	return int64(binary.LittleEndian.Uint64(e))
+}
+
+// isExpired now 是 UnixNano，expiresAt 为 0 表示永不过期
+func (e entry) isExpired(now int64) bool {
+	exp := e.expiresAt()
+	return exp != 0 && exp <= now
+}
+
+func (e entry) hash() uint64 {
+	return binary.LittleEndian.Uint64(e[offsetHash:])
+}
+
+func (e entry) size() int {
+	return int(binary.LittleEndian.Uint32(e[offsetSize:]))
+}
+
+func (e entry) kind() uint8 {
+	return e[offsetKind]
+}
+
+func (e entry) key() []byte {
+	keyLen := int(binary.LittleEndian.Uint16(e[offsetKeyLen:]))
+	return e[headerSize : headerSize+keyLen]
+}
+
+func (e entry) value() []byte {
+	keyLen := int(binary.LittleEndian.Uint16(e[offsetKeyLen:]))
+	return e[headerSize+keyLen : e.size()]
+}
+
+// shard 一段预先分配好的环形缓冲区和它的索引
+//
+// entry 按照写入的顺序追加在 tail，空间不够的时候从 head 开始覆盖最旧的 entry，
+// 覆盖 key 或者删除 key 只修改索引，旧的 entry 留在缓冲区里面等待被覆盖。
+// 索引是 map[uint64]uint32，key 和 value 都不包含指针，GC 不需要扫描它
+type shard struct {
+	lock  sync.RWMutex
+	index map[uint64]uint32
+	buf   []byte
+	head  int
+	tail  int
+	// wrap tail 回到缓冲区开头之后，旧数据的结尾；-1 表示没有回绕，数据在 [head, tail)
+	wrap int
+	// entries 缓冲区里面的 entry 数量，包括已经失效的
+	entries int
+}
+
+func newShard(size int) *shard {
+	return &shard{
+		index: make(map[uint64]uint32),
+		buf:   make([]byte, size),
+		wrap:  -1,
+	}
+}
+
+func (s *shard) entryAt(offset int) entry {
+	e := entry(s.buf[offset:])
+	return e[:e.size()]
+}
+
+// lookup 找到 key 对应的 entry，哈希冲突的时候比较 key 本身
+func (s *shard) lookup(key string, hash uint64) (entry, int, bool) {
+	offset, ok := s.index[hash]
+	if !ok {
+		return nil, 0, false
+	}
+	e := s.entryAt(int(offset))
+	if string(e.key()) != key {
+		return nil, 0, false
+	}
+	return e, int(offset), true
+}
+
+// get 返回没有过期的 entry，只需要读锁
+func (s *shard) get(key string, hash uint64, now int64) (entry, bool) {
+	e, _, ok := s.lookup(key, hash)
+	if !ok || e.isExpired(now) {
+		return nil, false
+	}
+	return e, true
+}
+
+// set 在 tail 追加一个新的 entry 并且更新索引，调用方需要保证 entry 能放进缓冲区
+func (s *shard) set(key string, hash uint64, val value, expiresAt int64) {
+	size := headerSize + len(key) + val.size()
+	offset := s.alloc(size)
+	e := entry(s.buf[offset : offset+size])
+	binary.LittleEndian.PutUint64(e, uint64(expiresAt))
+	binary.LittleEndian.PutUint64(e[offsetHash:], hash)
+	binary.LittleEndian.PutUint32(e[offsetSize:], uint32(size))
+	binary.LittleEndian.PutUint16(e[offsetKeyLen:], uint16(len(key)))
+	e[offsetKind] = val.kind
+	copy(e[headerSize:], key)
+	val.writeTo(e[headerSize+len(key):])
+	s.index[hash] = uint32(offset)
+	s.entries++
+}
+
+// del 删除 key，返回 key 在删除之前是否存在并且没有过期
+func (s *shard) del(key string, hash uint64, now int64) bool {
+	e, _, ok := s.lookup(key, hash)
+	if !ok {
+		return false
+	}
+	delete(s.index, hash)
+	return !e.isExpired(now)
+}
+
+// alloc 找到一段连续的 size 个字节，空间不够就从最旧的 entry 开始覆盖
+func (s *shard) alloc(size int) int {
+	for {
+		if s.entries == 0 {
+			s.head, s.tail, s.wrap = 0, 0, -1
+		}
+		if s.wrap < 0 {
+			if s.tail+size <= len(s.buf) {
+				break
+			}
+			// 结尾放不下，回到缓冲区的开头
+			if size <= s.head {
+				s.wrap = s.tail
+				s.tail = 0
+				break
+			}
+		} else if s.tail+size <= s.head {
+			break
+		}
+		s.evictOldest()
+	}
+	offset := s.tail
+	s.tail += size
+	return offset
+}
+
+// evictOldest 移除 head 处最旧的 entry，如果索引还指向它就一起删除
+func (s *shard) evictOldest() {
+	e := s.entryAt(s.head)
+	hash := e.hash()
+	if offset, ok := s.index[hash]; ok && int(offset) == s.head {
+		delete(s.index, hash)
+	}
+	s.head += e.size()
+	s.entries--
+	if s.wrap >= 0 && s.head >= s.wrap {
+		s.head, s.wrap = 0, -1
+	}
+}
+
+// cleanHead 从 head 开始移除已经过期或者已经失效的 entry，遇到有效的 entry 就停下来
+// 返回移除的 entry 数量
+func (s *shard) cleanHead(now int64) int {
+	cnt := 0
+	for s.entries > 0 {
+		e := s.entryAt(s.head)
+		offset, ok := s.index[e.hash()]
+		if ok && int(offset) == s.head && !e.isExpired(now) {
+			break
+		}
+		s.evictOldest()
+		cnt++
+	}
+	return cnt
+}
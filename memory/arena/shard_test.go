@@ -0,0 +1,109 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arena
+
+import (
+	"fmt"
+	"hash/maphash"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkShard 索引里面的每一项都指向 key 一致的 entry，并且 entry 都在有效的数据范围里面
+func checkShard(t *testing.T, s *shard) {
+	for hash, offset := range s.index {
+		e := s.entryAt(int(offset))
+		require.Equal(t, hash, e.hash())
+		if s.wrap < 0 {
+			require.True(t, int(offset) >= s.head && int(offset) < s.tail)
+		} else {
+			require.True(t, int(offset) >= s.head && int(offset) < s.wrap || int(offset) < s.tail)
+		}
+	}
+	require.LessOrEqual(t, len(s.index), s.entries)
+}
+
+func TestShard_wrap(t *testing.T) {
+	seed := maphash.MakeSeed()
+	// 每个 entry 23 + 5 + 5 = 33 字节，缓冲区放得下 3 个
+	s := newShard(100)
+	now := time.Now().UnixNano()
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		s.set(key, maphash.String(seed, key), value{kind: kindString, str: fmt.Sprintf("val%02d", i)}, 0)
+		checkShard(t, s)
+		assert.LessOrEqual(t, len(s.index), 3)
+
+		e, ok := s.get(key, maphash.String(seed, key), now)
+		require.True(t, ok)
+		assert.Equal(t, fmt.Sprintf("val%02d", i), string(e.value()))
+	}
+	// 最旧的数据被覆盖了
+	for i := 0; i < 97; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		_, ok := s.get(key, maphash.String(seed, key), now)
+		assert.False(t, ok)
+	}
+	for i := 97; i < 100; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		_, ok := s.get(key, maphash.String(seed, key), now)
+		assert.True(t, ok)
+	}
+}
+
+func TestShard_variableSize(t *testing.T) {
+	seed := maphash.MakeSeed()
+	s := newShard(256)
+	now := time.Now().UnixNano()
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i%7)
+		val := make([]byte, i%97)
+		s.set(key, maphash.String(seed, key), value{kind: kindBytes, b: val}, 0)
+		checkShard(t, s)
+		e, ok := s.get(key, maphash.String(seed, key), now)
+		require.True(t, ok)
+		assert.Equal(t, i%97, len(e.value()))
+	}
+}
+
+func TestShard_delAndCleanHead(t *testing.T) {
+	seed := maphash.MakeSeed()
+	s := newShard(1024)
+	now := time.Now().UnixNano()
+	hash := func(key string) uint64 {
+		return maphash.String(seed, key)
+	}
+	s.set("key1", hash("key1"), value{kind: kindInt, num: 1}, now-1)
+	s.set("key2", hash("key2"), value{kind: kindInt, num: 2}, 0)
+	s.set("key2", hash("key2"), value{kind: kindInt, num: 3}, 0)
+	s.set("key3", hash("key3"), value{kind: kindInt, num: 4}, now-1)
+	assert.Equal(t, 4, s.entries)
+
+	assert.False(t, s.del("key1", hash("key1"), now))
+	assert.False(t, s.del("key4", hash("key4"), now))
+
+	// key1 过期，第一个 key2 已经被覆盖，第二个 key2 还有效
+	assert.Equal(t, 2, s.cleanHead(now))
+	assert.Equal(t, 2, s.entries)
+	checkShard(t, s)
+
+	assert.True(t, s.del("key2", hash("key2"), now))
+	assert.Equal(t, 2, s.cleanHead(now))
+	assert.Equal(t, 0, s.entries)
+	assert.Equal(t, 0, len(s.index))
+}
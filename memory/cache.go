@@ -0,0 +1,203 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ecodeclub/ecache/memory/internal/linkedlist"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+type cacheEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func (e *cacheEntry[K, V]) isExpired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+func (e *cacheEntry[K, V]) setExpiration(expiration time.Duration) {
+	if expiration == 0 {
+		e.expiresAt = time.Time{}
+		return
+	}
+	e.expiresAt = time.Now().Add(expiration)
+}
+
+// Cache 键和值都带类型参数的 LRU 本地缓存
+// 不需要把值装箱成 any，Get 不会分配内存，适合不需要 ecache.Cache 接口的纯本地缓存。
+// 需要 ecache.Cache 的时候可以用 NewAdapter 包装 key 为 string 的 Cache
+type Cache[K comparable, V any] struct {
+	lock          sync.Mutex
+	capacity      int
+	data          map[K]*linkedlist.Element[cacheEntry[K, V]]
+	list          *linkedlist.List[cacheEntry[K, V]]
+	cycleInterval time.Duration
+	closeOnce     sync.Once
+	done          chan struct{}
+}
+
+// NewCache 创建一个最多容纳 capacity 个键值对的缓存
+func NewCache[K comparable, V any](capacity int, opts ...option.Option[Cache[K, V]]) *Cache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	res := &Cache[K, V]{
+		capacity:      capacity,
+		data:          make(map[K]*linkedlist.Element[cacheEntry[K, V]], capacity),
+		list:          linkedlist.New[cacheEntry[K, V]](),
+		cycleInterval: time.Second,
+		done:          make(chan struct{}),
+	}
+	option.Apply(res, opts...)
+	go res.cleanCycle()
+	return res
+}
+
+// WithCacheCycleInterval 设置 Cache 过期清理的间隔
+func WithCacheCycleInterval[K comparable, V any](interval time.Duration) option.Option[Cache[K, V]] {
+	return func(c *Cache[K, V]) {
+		c.cycleInterval = interval
+	}
+}
+
+// cleanCycle 定期抽样清理过期的 key，如果一轮里面超过四分之一的 key 过期了就继续下一轮
+func (c *Cache[K, V]) cleanCycle() {
+	ticker := time.NewTicker(c.cycleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+		for i := 0; i < cleanMaxRounds; i++ {
+			c.lock.Lock()
+			expired := c.cleanExpired(cleanSampleSize)
+			c.lock.Unlock()
+			if expired*4 <= cleanSampleSize {
+				break
+			}
+		}
+	}
+}
+
+// Close 停止过期清理，之后过期的 key 只会在被访问的时候删除
+func (c *Cache[K, V]) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+// cleanExpired 抽样清理过期的 key，最多检查 limit 个，返回清理掉的数量
+func (c *Cache[K, V]) cleanExpired(limit int) int {
+	now := time.Now()
+	cnt, expired := 0, 0
+	for _, elem := range c.data {
+		if cnt >= limit {
+			break
+		}
+		cnt++
+		if elem.Value.isExpired(now) {
+			c.remove(elem)
+			expired++
+		}
+	}
+	return expired
+}
+
+// Get 读取 key，不存在或者已经过期的时候返回 false
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.get(key)
+}
+
+// Set 写入 key，expiration 为 0 表示永不过期
+func (c *Cache[K, V]) Set(key K, val V, expiration time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.set(key, val, expiration)
+}
+
+// Delete 删除 key，返回 key 在删除之前是否存在并且没有过期
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.delete(key)
+}
+
+// Len 返回键值对的数量，包括已经过期但是还没有被清理的
+func (c *Cache[K, V]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.data)
+}
+
+func (c *Cache[K, V]) get(key K) (V, bool) {
+	elem, ok := c.data[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if elem.Value.isExpired(time.Now()) {
+		c.remove(elem)
+		var zero V
+		return zero, false
+	}
+	c.list.MoveToFront(elem)
+	return elem.Value.value, true
+}
+
+func (c *Cache[K, V]) set(key K, val V, expiration time.Duration) {
+	if elem, ok := c.data[key]; ok {
+		elem.Value.value = val
+		elem.Value.setExpiration(expiration)
+		c.list.MoveToFront(elem)
+		return
+	}
+	if len(c.data) >= c.capacity {
+		c.remove(c.list.Back())
+	}
+	ent := cacheEntry[K, V]{key: key, value: val}
+	ent.setExpiration(expiration)
+	c.data[key] = c.list.PushFront(ent)
+}
+
+// update 修改一个已经存在的 key 的值，保留原本的有效期
+func (c *Cache[K, V]) update(key K, val V) {
+	if elem, ok := c.data[key]; ok {
+		elem.Value.value = val
+	}
+}
+
+func (c *Cache[K, V]) delete(key K) bool {
+	elem, ok := c.data[key]
+	if !ok {
+		return false
+	}
+	c.remove(elem)
+	return !elem.Value.isExpired(time.Now())
+}
+
+func (c *Cache[K, V]) remove(elem *linkedlist.Element[cacheEntry[K, V]]) {
+	c.list.Remove(elem)
+	delete(c.data, elem.Value.key)
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache[string, int](2)
+	defer c.Close()
+
+	c.Set("key1", 1, 0)
+	c.Set("key2", 2, 0)
+	val, ok := c.Get("key1")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+
+	// key2 最久没有被访问，被淘汰
+	c.Set("key3", 3, 0)
+	_, ok = c.Get("key2")
+	assert.False(t, ok)
+	assert.Equal(t, 2, c.Len())
+
+	// 覆盖已经存在的 key 不会淘汰
+	c.Set("key1", 10, 0)
+	val, ok = c.Get("key1")
+	assert.True(t, ok)
+	assert.Equal(t, 10, val)
+	assert.Equal(t, 2, c.Len())
+
+	assert.True(t, c.Delete("key1"))
+	assert.False(t, c.Delete("key1"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCache_expiration(t *testing.T) {
+	c := NewCache[int, string](10, WithCacheCycleInterval[int, string](10*time.Millisecond))
+	defer c.Close()
+
+	c.Set(1, "value1", time.Millisecond)
+	c.Set(2, "value2", time.Minute)
+	c.Set(3, "value3", 0)
+	time.Sleep(5 * time.Millisecond)
+	_, ok := c.Get(1)
+	assert.False(t, ok)
+
+	c.Set(4, "value4", time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return c.Len() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// 重新设置有效期
+	c.Set(2, "value2", 0)
+	val, ok := c.Get(2)
+	assert.True(t, ok)
+	assert.Equal(t, "value2", val)
+}
+
+func TestCache_Close(t *testing.T) {
+	c := NewCache[string, int](10, WithCacheCycleInterval[string, int](time.Millisecond))
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+	c.Set("key1", 1, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, c.Len())
+	_, ok := c.Get("key1")
+	assert.False(t, ok)
+}
+
+func TestCache_GetAllocs(t *testing.T) {
+	c := NewCache[string, int](100)
+	defer c.Close()
+	c.Set("key", 1, time.Minute)
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = c.Get("key")
+		_, _ = c.Get("missing")
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func BenchmarkCache_Get(b *testing.B) {
+	c := NewCache[string, int](1024)
+	defer c.Close()
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		c.Set(keys[i], i, 0)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = c.Get(keys[i&1023])
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"time"
+
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/internal/datatype"
+)
+
+var _ datatype.Storage = (*Core)(nil)
+
+// Entry Core 里面的一个键值对
+type Entry struct {
+	Key   string
+	Value any
+	// ExpiresAt 过期的时间点，零值表示永不过期
+	ExpiresAt time.Time
+	// Size 键值对占用的字节数，只在设置了字节数上限或者淘汰策略实现了 EntryPolicy 的时候计算
+	Size int64
+	// Version 版本号，每次写入都会分配一个新的，同一个 Core 里面不会重复
+	Version int64
+}
+
+func (e *Entry) isExpired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// deadline 把有效期转换为过期的时间点，expiration 为 0 表示永不过期
+func deadline(expiration time.Duration) time.Time {
+	if expiration == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(expiration)
+}
+
+// maxInitCap 存储键值对的 map 最多预先分配的容量
+const maxInitCap = 1024
+
+// Core 是 Store 里面不加锁的部分，负责存储、过期时间、字节数统计和淘汰事件，淘汰的顺序交给 EvictionPolicy
+// 需要在一次加锁里面组合多个操作的缓存通过 Store.Do 拿到 Core，调用方负责保证并发安全
+type Core struct {
+	capacity int
+	data     map[string]*Entry
+	policy   EvictionPolicy
+	// entryPolicy policy 实现了 EntryPolicy 的时候不为 nil
+	entryPolicy EntryPolicy
+	// maxBytes 所有键值对占用的字节数上限，0 表示只限制 key 的数量
+	maxBytes int64
+	bytes    int64
+	// version 上一次分配的版本号
+	version int64
+
+	listener evict.Listener
+	// events 持有锁期间产生的淘汰事件
+	events []evict.Event
+	// tx Begin 和 Commit 或者 Rollback 之间不为 nil
+	tx *coreTx
+}
+
+// coreTx 记录事务里面被修改的 key 在修改之前的样子
+type coreTx struct {
+	clone func(any) any
+	// saved key 第一次被访问之前的键值对，nil 表示当时 key 不存在
+	saved map[string]*Entry
+	// events Begin 的时候已经产生的淘汰事件的数量
+	events int
+}
+
+func newCore(capacity int, policy EvictionPolicy) *Core {
+	if capacity < 1 {
+		capacity = 1
+	}
+	entryPolicy, _ := policy.(EntryPolicy)
+	if p, ok := policy.(CapacityPolicy); ok {
+		p.SetCapacity(capacity)
+	}
+	// 容量很大的时候，比如没有限制数量，不预先分配
+	initCap := capacity
+	if initCap > maxInitCap {
+		initCap = maxInitCap
+	}
+	return &Core{
+		capacity:    capacity,
+		data:        make(map[string]*Entry, initCap),
+		policy:      policy,
+		entryPolicy: entryPolicy,
+	}
+}
+
+// sized 是否需要计算键值对的大小
+func (c *Core) sized() bool {
+	return c.maxBytes > 0 || c.entryPolicy != nil
+}
+
+// peek 只持有读锁的时候使用，过期的 key 留给写操作和过期清理去删除
+func (c *Core) peek(key string) (any, bool) {
+	ent, ok := c.data[key]
+	if !ok || ent.isExpired(time.Now()) {
+		return nil, false
+	}
+	c.policy.OnAccess(key)
+	return ent.Value, true
+}
+
+// Get 读取 key，算作一次访问，已经过期的 key 会被删除
+func (c *Core) Get(key string) (any, bool) {
+	c.save(key)
+	ent, ok := c.data[key]
+	if !ok {
+		return nil, false
+	}
+	if ent.isExpired(time.Now()) {
+		c.remove(ent, evict.ReasonExpired)
+		return nil, false
+	}
+	c.policy.OnAccess(key)
+	return ent.Value, true
+}
+
+// Lookup 返回 key 对应的键值对，不算作访问，也不会删除过期的 key，只持有读锁的时候也可以调用
+// key 不存在或者已经过期的时候返回 false
+func (c *Core) Lookup(key string) (Entry, bool) {
+	ent, ok := c.data[key]
+	if !ok || ent.isExpired(time.Now()) {
+		return Entry{}, false
+	}
+	return *ent, true
+}
+
+// Set 写入 key 并且重新设置有效期，expiration 为 0 表示永不过期
+func (c *Core) Set(key string, val any, expiration time.Duration) {
+	c.SetDeadline(key, val, deadline(expiration))
+}
+
+// SetDeadline 和 Set 一样，但是直接指定过期的时间点，零值表示永不过期
+func (c *Core) SetDeadline(key string, val any, expiresAt time.Time) {
+	c.save(key)
+	if ent, ok := c.data[key]; ok {
+		reason := evict.ReasonReplaced
+		if ent.isExpired(time.Now()) {
+			reason = evict.ReasonExpired
+		}
+		c.addEvent(ent, reason)
+		ent.Value = val
+		ent.ExpiresAt = expiresAt
+		ent.Version = c.nextVersion()
+		c.policy.OnAccess(key)
+		c.resize(ent)
+		return
+	}
+	ent := &Entry{Key: key, Value: val, ExpiresAt: expiresAt, Version: c.nextVersion()}
+	if c.sized() {
+		ent.Size = entrySize(key, val)
+	}
+	c.evictIfNeeded(ent.Size)
+	c.data[key] = ent
+	c.bytes += ent.Size
+	c.policy.OnInsert(key)
+	if c.entryPolicy != nil {
+		c.entryPolicy.OnUpdate(*ent)
+	}
+}
+
+// Update 修改一个已经存在的 key 的值，保留原本的有效期
+// 列表和集合原地修改之后也要用同一个值调用 Update，让 Core 重新计算占用的空间
+func (c *Core) Update(key string, val any) {
+	c.save(key)
+	if ent, ok := c.data[key]; ok {
+		ent.Value = val
+		ent.Version = c.nextVersion()
+		c.resize(ent)
+	}
+}
+
+// nextVersion 分配一个新的版本号，删除之后重新写入的 key 也不会复用之前的版本号
+func (c *Core) nextVersion() int64 {
+	c.version++
+	return c.version
+}
+
+// Delete 删除 key，返回 key 在删除之前是否存在并且没有过期
+func (c *Core) Delete(key string) bool {
+	ent, ok := c.data[key]
+	if !ok {
+		return false
+	}
+	if ent.isExpired(time.Now()) {
+		c.remove(ent, evict.ReasonExpired)
+		return false
+	}
+	c.remove(ent, evict.ReasonDeleted)
+	return true
+}
+
+// Len 返回键值对的数量，包括已经过期但是还没有被删除的
+func (c *Core) Len() int {
+	return len(c.data)
+}
+
+// Bytes 所有键值对占用的字节数，没有设置字节数上限的时候总是返回 0
+func (c *Core) Bytes() int64 {
+	if c.maxBytes <= 0 {
+		return 0
+	}
+	return c.bytes
+}
+
+// evictIfNeeded 写入一个占用 size 字节的新 key 之前，
+// 数量或者字节数超出上限就让 policy 选出要淘汰的 key
+func (c *Core) evictIfNeeded(size int64) {
+	for len(c.data) >= c.capacity || (c.maxBytes > 0 && len(c.data) > 0 && c.bytes+size > c.maxBytes) {
+		if !c.evictOne(nil) {
+			return
+		}
+	}
+}
+
+// resize 值发生变化之后重新计算键值对的大小，超出字节数上限就淘汰其它的 key
+// 正在修改的 key 本身不会被淘汰，所以单个超过上限的值会独占整个缓存
+func (c *Core) resize(ent *Entry) {
+	if c.sized() {
+		size := entrySize(ent.Key, ent.Value)
+		c.bytes += size - ent.Size
+		ent.Size = size
+	}
+	if c.entryPolicy != nil {
+		c.entryPolicy.OnUpdate(*ent)
+	}
+	for c.maxBytes > 0 && c.bytes > c.maxBytes {
+		if !c.evictOne(ent) {
+			return
+		}
+	}
+}
+
+// evictOne 淘汰一个 policy 选出来的 key，已经过期的 key 按照过期处理
+// 没有可以淘汰的 key 或者只能选中 keep 的时候返回 false
+func (c *Core) evictOne(keep *Entry) bool {
+	var (
+		key string
+		ok  bool
+	)
+	if keep != nil && c.entryPolicy != nil {
+		key, ok = c.entryPolicy.VictimExcept(keep.Key)
+	} else {
+		key, ok = c.policy.Victim()
+	}
+	if !ok {
+		return false
+	}
+	ent, ok := c.data[key]
+	if !ok || ent == keep {
+		// policy 和 Core 不一致的时候直接放弃，避免死循环
+		return false
+	}
+	reason := evict.ReasonCapacity
+	if ent.isExpired(time.Now()) {
+		reason = evict.ReasonExpired
+	}
+	c.remove(ent, reason)
+	return true
+}
+
+func (c *Core) remove(ent *Entry, reason evict.Reason) {
+	c.save(ent.Key)
+	delete(c.data, ent.Key)
+	c.bytes -= ent.Size
+	c.policy.OnRemove(ent.Key, reason)
+	c.addEvent(ent, reason)
+}
+
+func (c *Core) addEvent(ent *Entry, reason evict.Reason) {
+	if c.listener == nil {
+		return
+	}
+	c.events = append(c.events, evict.Event{Key: ent.Key, Value: ent.Value, Reason: reason})
+}
+
+// CleanExpired 清理最多 limit 个过期的 key，返回清理掉的数量
+// 淘汰策略实现了 EntryPolicy 的时候只访问真正过期的 key，否则随机抽样检查 limit 个 key
+func (c *Core) CleanExpired(limit int) int {
+	now := time.Now()
+	if c.entryPolicy != nil {
+		expired := 0
+		for expired < limit {
+			key, ok := c.entryPolicy.Expired(now)
+			if !ok {
+				break
+			}
+			ent, ok := c.data[key]
+			if !ok {
+				break
+			}
+			c.remove(ent, evict.ReasonExpired)
+			expired++
+		}
+		return expired
+	}
+	cnt, expired := 0, 0
+	for _, ent := range c.data {
+		if cnt >= limit {
+			break
+		}
+		cnt++
+		if ent.isExpired(now) {
+			c.remove(ent, evict.ReasonExpired)
+			expired++
+		}
+	}
+	return expired
+}
+
+// Begin 开始一个事务，Rollback 可以把之后修改过的 key 恢复成 Begin 之前的样子，包括被淘汰的 key
+// 列表和集合是原地修改的，所以 key 第一次被读取或者修改的时候会用 clone 复制一份它的值
+func (c *Core) Begin(clone func(any) any) {
+	c.tx = &coreTx{clone: clone, saved: make(map[string]*Entry), events: len(c.events)}
+}
+
+// Commit 结束事务，保留所有的修改
+func (c *Core) Commit() {
+	c.tx = nil
+}
+
+// Rollback 结束事务，撤销所有的修改，事务里面产生的淘汰事件也不会再通知
+// key 的值、有效期、版本号和占用的空间都会恢复，但是淘汰策略里面的访问顺序不会
+func (c *Core) Rollback() {
+	tx := c.tx
+	if tx == nil {
+		return
+	}
+	c.tx = nil
+	for key, saved := range tx.saved {
+		ent, ok := c.data[key]
+		switch {
+		case saved == nil && ok:
+			delete(c.data, key)
+			c.bytes -= ent.Size
+			c.policy.OnRemove(key, evict.ReasonDeleted)
+		case saved != nil && ok:
+			c.bytes += saved.Size - ent.Size
+			*ent = *saved
+			if c.entryPolicy != nil {
+				c.entryPolicy.OnUpdate(*ent)
+			}
+		case saved != nil:
+			c.data[key] = saved
+			c.bytes += saved.Size
+			c.policy.OnInsert(key)
+			if c.entryPolicy != nil {
+				c.entryPolicy.OnUpdate(*saved)
+			}
+		}
+	}
+	c.events = c.events[:tx.events]
+}
+
+// save 事务里面 key 第一次被访问的时候记录它原本的样子
+func (c *Core) save(key string) {
+	if c.tx == nil {
+		return
+	}
+	if _, ok := c.tx.saved[key]; ok {
+		return
+	}
+	ent, ok := c.data[key]
+	if !ok {
+		c.tx.saved[key] = nil
+		return
+	}
+	saved := *ent
+	saved.Value = c.tx.clone(ent.Value)
+	c.tx.saved[key] = &saved
+}
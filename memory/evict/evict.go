@@ -0,0 +1,128 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evict
+
+import "sync"
+
+// Reason 键值对离开缓存的原因
+type Reason uint8
+
+const (
+	// ReasonExpired 过期
+	ReasonExpired Reason = iota + 1
+	// ReasonCapacity 容量不足被淘汰
+	ReasonCapacity
+	// ReasonDeleted 被显式删除
+	ReasonDeleted
+	// ReasonReplaced 被新的值覆盖
+	ReasonReplaced
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonCapacity:
+		return "capacity"
+	case ReasonDeleted:
+		return "deleted"
+	case ReasonReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// Event 淘汰事件
+type Event struct {
+	Key    string
+	Value  any
+	Reason Reason
+}
+
+// Listener 淘汰事件的监听者
+// 缓存会在释放锁之后，在执行操作的 goroutine 里面同步调用 OnEvict，
+// 所以 OnEvict 里面可以安全地再次访问缓存，但是耗时操作会拖慢缓存的调用方，
+// 这种情况下可以使用 AsyncListener
+type Listener interface {
+	OnEvict(evt Event)
+}
+
+// ListenerFunc 让普通的函数也可以作为 Listener
+type ListenerFunc func(evt Event)
+
+func (f ListenerFunc) OnEvict(evt Event) {
+	f(evt)
+}
+
+// Notify 把一批事件依次交给 listener，listener 为 nil 时什么都不做
+func Notify(listener Listener, events []Event) {
+	if listener == nil {
+		return
+	}
+	for _, evt := range events {
+		listener.OnEvict(evt)
+	}
+}
+
+// AsyncListener 通过一个有界队列，在单独的 goroutine 里面把事件转交给另一个 Listener
+// 队列满了的时候 OnEvict 会阻塞，直到有空位，所以不会丢失事件
+type AsyncListener struct {
+	listener Listener
+	events   chan Event
+	lock     sync.RWMutex
+	closed   bool
+	done     chan struct{}
+}
+
+// NewAsyncListener 创建一个 AsyncListener，queueSize 是队列的容量
+func NewAsyncListener(listener Listener, queueSize int) *AsyncListener {
+	l := &AsyncListener{
+		listener: listener,
+		events:   make(chan Event, queueSize),
+		done:     make(chan struct{}),
+	}
+	go l.loop()
+	return l
+}
+
+func (l *AsyncListener) loop() {
+	defer close(l.done)
+	for evt := range l.events {
+		l.listener.OnEvict(evt)
+	}
+}
+
+// OnEvict 把事件放入队列，Close 之后的事件会被直接丢弃
+func (l *AsyncListener) OnEvict(evt Event) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.closed {
+		return
+	}
+	l.events <- evt
+}
+
+// Close 不再接收新的事件，并且等待队列中已有的事件全部处理完毕
+// 测试里面可以在 Close 之后再校验收到的事件，从而得到确定的结果
+func (l *AsyncListener) Close() {
+	l.lock.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.events)
+	}
+	l.lock.Unlock()
+	<-l.done
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evict
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReason_String(t *testing.T) {
+	testCases := []struct {
+		reason Reason
+		want   string
+	}{
+		{reason: ReasonExpired, want: "expired"},
+		{reason: ReasonCapacity, want: "capacity"},
+		{reason: ReasonDeleted, want: "deleted"},
+		{reason: ReasonReplaced, want: "replaced"},
+		{reason: Reason(0), want: "unknown"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.reason.String())
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	events := []Event{
+		{Key: "key1", Value: "value1", Reason: ReasonDeleted},
+		{Key: "key2", Value: "value2", Reason: ReasonExpired},
+	}
+	var got []Event
+	Notify(ListenerFunc(func(evt Event) {
+		got = append(got, evt)
+	}), events)
+	assert.Equal(t, events, got)
+
+	// nil listener 什么都不做
+	Notify(nil, events)
+}
+
+func TestAsyncListener(t *testing.T) {
+	var (
+		lock sync.Mutex
+		got  []Event
+	)
+	l := NewAsyncListener(ListenerFunc(func(evt Event) {
+		lock.Lock()
+		got = append(got, evt)
+		lock.Unlock()
+	}), 2)
+
+	var want []Event
+	for i := 0; i < 100; i++ {
+		evt := Event{Key: fmt.Sprintf("key%d", i), Value: i, Reason: ReasonCapacity}
+		want = append(want, evt)
+		l.OnEvict(evt)
+	}
+	l.Close()
+	assert.Equal(t, want, got)
+
+	// Close 之后的事件被丢弃，重复 Close 也没有问题
+	l.OnEvict(Event{Key: "closed"})
+	l.Close()
+	assert.Equal(t, want, got)
+}
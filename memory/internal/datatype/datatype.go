@@ -0,0 +1,252 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package datatype 在一个最简单的键值存储之上实现 ecache.Cache 里面的各种数据类型操作，
+// 供不同淘汰策略的内存缓存复用
+package datatype
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ekit/list"
+	"github.com/ecodeclub/ekit/set"
+)
+
+var (
+	ErrOnlyListCanLPush = errors.New("ecache: 只有 list 类型的数据，才能执行 LPush")
+	ErrOnlyListCanLPop  = errors.New("ecache: 只有 list 类型的数据，才能执行 LPop")
+	ErrOnlySetCanSAdd   = errors.New("ecache: 只有 set 类型的数据，才能执行 SAdd")
+	ErrOnlySetCanSRem   = errors.New("ecache: 只有 set 类型的数据，才能执行 SRem")
+	ErrOnlyNumCanIncrBy = errors.New("ecache: 只有数字类型的数据，才能执行 IncrBy")
+	ErrOnlyNumCanDecrBy = errors.New("ecache: 只有数字类型的数据，才能执行 DecrBy")
+)
+
+// collectionCap 集合类型的值的初始化容量
+const collectionCap = 8
+
+// Storage 内存缓存的底层存储，调用方负责保证并发安全
+type Storage interface {
+	// Get 读取 key，不存在或者已经过期的时候返回 false
+	Get(key string) (any, bool)
+	// Set 写入 key 并且重新设置有效期，expiration 为 0 表示永不过期
+	Set(key string, val any, expiration time.Duration)
+	// Update 修改一个已经存在的 key 的值，保留原本的有效期
+	// 列表和集合原地修改之后也会用同一个值调用 Update，让存储有机会重新计算占用的空间
+	Update(key string, val any)
+	// Delete 删除 key，返回 key 在删除之前是否存在并且没有过期
+	Delete(key string) bool
+}
+
+func Get(s Storage, key string) (val ecache.Value) {
+	var ok bool
+	val.Val, ok = s.Get(key)
+	if !ok {
+		val.Err = errs.ErrKeyNotExist
+	}
+	return
+}
+
+func SetNX(s Storage, key string, val any, expiration time.Duration) bool {
+	if _, ok := s.Get(key); ok {
+		return false
+	}
+	s.Set(key, val, expiration)
+	return true
+}
+
+// GetSet 和 Redis 的 GETSET 一样，新的值永不过期
+func GetSet(s Storage, key string, val string) (result ecache.Value) {
+	result = Get(s, key)
+	s.Set(key, val, 0)
+	return
+}
+
+func Delete(ctx context.Context, s Storage, keys ...string) (int64, error) {
+	var n int64
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		if s.Delete(key) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// LPush 把 vals 依次插入到列表的头部，返回列表的长度
+func LPush(s Storage, key string, vals ...any) (int64, error) {
+	val, ok := s.Get(key)
+	if !ok {
+		l := list.NewLinkedList[any]()
+		for _, v := range vals {
+			_ = l.Add(0, v)
+		}
+		s.Set(key, l, 0)
+		return int64(l.Len()), nil
+	}
+	l, ok := val.(*list.LinkedList[any])
+	if !ok {
+		return 0, ErrOnlyListCanLPush
+	}
+	for _, v := range vals {
+		_ = l.Add(0, v)
+	}
+	s.Update(key, l)
+	return int64(l.Len()), nil
+}
+
+// LPop 移除并返回列表的第一个元素，列表为空之后 key 也会被删除
+func LPop(s Storage, key string) (res ecache.Value) {
+	val, ok := s.Get(key)
+	if !ok {
+		res.Err = errs.ErrKeyNotExist
+		return
+	}
+	l, ok := val.(*list.LinkedList[any])
+	if !ok {
+		res.Err = ErrOnlyListCanLPop
+		return
+	}
+	res.Val, res.Err = l.Delete(0)
+	if l.Len() == 0 {
+		s.Delete(key)
+		return
+	}
+	s.Update(key, l)
+	return
+}
+
+// SAdd 返回新加入集合的元素数量
+func SAdd(s Storage, key string, members ...any) (int64, error) {
+	val, ok := s.Get(key)
+	if !ok {
+		val = set.NewMapSet[any](collectionCap)
+		s.Set(key, val, 0)
+	}
+	ms, ok := val.(*set.MapSet[any])
+	if !ok {
+		return 0, ErrOnlySetCanSAdd
+	}
+	var n int64
+	for _, member := range members {
+		if !ms.Exist(member) {
+			ms.Add(member)
+			n++
+		}
+	}
+	if n > 0 {
+		s.Update(key, ms)
+	}
+	return n, nil
+}
+
+// SRem 返回从集合中删除的元素数量，集合为空之后 key 也会被删除
+func SRem(s Storage, key string, members ...any) (int64, error) {
+	val, ok := s.Get(key)
+	if !ok {
+		return 0, errs.ErrKeyNotExist
+	}
+	ms, ok := val.(*set.MapSet[any])
+	if !ok {
+		return 0, ErrOnlySetCanSRem
+	}
+	var n int64
+	for _, member := range members {
+		if ms.Exist(member) {
+			ms.Delete(member)
+			n++
+		}
+	}
+	if len(ms.Keys()) == 0 {
+		s.Delete(key)
+	} else if n > 0 {
+		s.Update(key, ms)
+	}
+	return n, nil
+}
+
+func IncrBy(s Storage, key string, value int64) (int64, error) {
+	return incrBy(s, key, value, ErrOnlyNumCanIncrBy)
+}
+
+func DecrBy(s Storage, key string, value int64) (int64, error) {
+	return incrBy(s, key, -value, ErrOnlyNumCanDecrBy)
+}
+
+// incrBy 自增之后保留原本的有效期
+func incrBy(s Storage, key string, value int64, typeErr error) (int64, error) {
+	val, ok := s.Get(key)
+	if !ok {
+		s.Set(key, value, 0)
+		return value, nil
+	}
+	num, ok := val.(int64)
+	if !ok {
+		return 0, typeErr
+	}
+	num += value
+	s.Update(key, num)
+	return num, nil
+}
+
+// IncrByFloat 原本的值是 int64 的时候会被转换为 float64
+func IncrByFloat(s Storage, key string, value float64) (float64, error) {
+	val, ok := s.Get(key)
+	if !ok {
+		s.Set(key, value, 0)
+		return value, nil
+	}
+	var num float64
+	switch v := val.(type) {
+	case float64:
+		num = v
+	case int64:
+		num = float64(v)
+	default:
+		return 0, ErrOnlyNumCanIncrBy
+	}
+	num += value
+	s.Update(key, num)
+	return num, nil
+}
+
+// Equal CompareAndSwap 比较当前的值和期望的值，类型不一样的时候认为不相等
+// 列表和集合比较的是其中的元素
+func Equal(cur, expected any) bool {
+	return reflect.DeepEqual(cur, expected)
+}
+
+// Clone 复制会被原地修改的列表和集合，其它的值原样返回
+// 内存缓存的事务用它在回滚的时候恢复列表和集合原本的元素
+func Clone(val any) any {
+	switch v := val.(type) {
+	case *list.LinkedList[any]:
+		return list.NewLinkedListOf[any](v.AsSlice())
+	case *list.ConcurrentList[ecache.Value]:
+		return &list.ConcurrentList[ecache.Value]{List: list.NewLinkedListOf[ecache.Value](v.AsSlice())}
+	case *set.MapSet[any]:
+		res := set.NewMapSet[any](len(v.Keys()))
+		for _, key := range v.Keys() {
+			res.Add(key)
+		}
+		return res
+	}
+	return val
+}
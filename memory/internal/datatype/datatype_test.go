@@ -0,0 +1,231 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datatype
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ekit/list"
+	"github.com/ecodeclub/ekit/set"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mapEntry struct {
+	val        any
+	expiration time.Duration
+}
+
+// mapStorage 测试用的 Storage，记录每个 key 最后一次 Set 的有效期
+type mapStorage map[string]*mapEntry
+
+func (m mapStorage) Get(key string) (any, bool) {
+	ent, ok := m[key]
+	if !ok {
+		return nil, false
+	}
+	return ent.val, true
+}
+
+func (m mapStorage) Set(key string, val any, expiration time.Duration) {
+	m[key] = &mapEntry{val: val, expiration: expiration}
+}
+
+func (m mapStorage) Update(key string, val any) {
+	m[key].val = val
+}
+
+func (m mapStorage) Delete(key string) bool {
+	_, ok := m[key]
+	delete(m, key)
+	return ok
+}
+
+func TestGetSetNXGetSet(t *testing.T) {
+	s := mapStorage{}
+	assert.Equal(t, errs.ErrKeyNotExist, Get(s, "key1").Err)
+
+	assert.True(t, SetNX(s, "key1", "value1", time.Minute))
+	assert.False(t, SetNX(s, "key1", "value2", time.Minute))
+	assert.Equal(t, "value1", Get(s, "key1").Val)
+
+	res := GetSet(s, "key1", "value3")
+	assert.NoError(t, res.Err)
+	assert.Equal(t, "value1", res.Val)
+	assert.Equal(t, time.Duration(0), s["key1"].expiration)
+
+	res = GetSet(s, "key2", "value2")
+	assert.Equal(t, errs.ErrKeyNotExist, res.Err)
+	assert.Equal(t, "value2", Get(s, "key2").Val)
+}
+
+func TestDelete(t *testing.T) {
+	s := mapStorage{}
+	s.Set("key1", "value1", 0)
+	s.Set("key2", "value2", 0)
+	n, err := Delete(context.Background(), s, "key1", "key2", "key3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	s.Set("key1", "value1", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, err = Delete(ctx, s, "key1")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestLPushLPop(t *testing.T) {
+	s := mapStorage{}
+	n, err := LPush(s, "list", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = LPush(s, "list", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, []any{3, 2, 1}, s["list"].val.(*list.LinkedList[any]).AsSlice())
+
+	for _, want := range []int{3, 2, 1} {
+		res := LPop(s, "list")
+		require.NoError(t, res.Err)
+		assert.Equal(t, want, res.Val)
+	}
+	_, ok := s.Get("list")
+	assert.False(t, ok)
+	assert.Equal(t, errs.ErrKeyNotExist, LPop(s, "list").Err)
+
+	s.Set("str", "value", 0)
+	_, err = LPush(s, "str", 1)
+	assert.Equal(t, ErrOnlyListCanLPush, err)
+	assert.Equal(t, ErrOnlyListCanLPop, LPop(s, "str").Err)
+}
+
+func TestSAddSRem(t *testing.T) {
+	s := mapStorage{}
+	n, err := SAdd(s, "set", 1, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = SAdd(s, "set", 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.ElementsMatch(t, []any{1, 2, 3}, s["set"].val.(*set.MapSet[any]).Keys())
+
+	n, err = SRem(s, "set", 1, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = SRem(s, "set", 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	_, ok := s.Get("set")
+	assert.False(t, ok)
+	_, err = SRem(s, "set", 1)
+	assert.Equal(t, errs.ErrKeyNotExist, err)
+
+	s.Set("str", "value", 0)
+	_, err = SAdd(s, "str", 1)
+	assert.Equal(t, ErrOnlySetCanSAdd, err)
+	_, err = SRem(s, "str", 1)
+	assert.Equal(t, ErrOnlySetCanSRem, err)
+}
+
+func TestIncrDecr(t *testing.T) {
+	s := mapStorage{}
+	n, err := IncrBy(s, "num", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// 自增保留原本的有效期
+	s["num"].expiration = time.Minute
+	n, err = IncrBy(s, "num", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = DecrBy(s, "num", 6)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), n)
+	assert.Equal(t, time.Minute, s["num"].expiration)
+
+	n, err = DecrBy(s, "num2", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-2), n)
+
+	f, err := IncrByFloat(s, "num", 1.5)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, f)
+	f, err = IncrByFloat(s, "num", 1.5)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, f)
+	f, err = IncrByFloat(s, "float", 1.5)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, f)
+
+	s.Set("str", "value", 0)
+	_, err = IncrBy(s, "str", 1)
+	assert.Equal(t, ErrOnlyNumCanIncrBy, err)
+	_, err = DecrBy(s, "str", 1)
+	assert.Equal(t, ErrOnlyNumCanDecrBy, err)
+	_, err = IncrByFloat(s, "str", 1)
+	assert.Equal(t, ErrOnlyNumCanIncrBy, err)
+}
+
+func TestEqual(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cur      any
+		expected any
+		wantRes  bool
+	}{
+		{name: "string", cur: "a", expected: "a", wantRes: true},
+		{name: "different string", cur: "a", expected: "b"},
+		{name: "different type", cur: int64(1), expected: 1},
+		{name: "bytes", cur: []byte("a"), expected: []byte("a"), wantRes: true},
+		{
+			name:     "set",
+			cur:      set.NewMapSet[any](1),
+			expected: set.NewMapSet[any](2),
+			wantRes:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantRes, Equal(tc.cur, tc.expected))
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	l := list.NewLinkedListOf[any]([]any{"a"})
+	cl := Clone(l).(*list.LinkedList[any])
+	require.NoError(t, l.Append("b"))
+	assert.Equal(t, []any{"a"}, cl.AsSlice())
+
+	var va, vb ecache.Value
+	va.Val, vb.Val = "a", "b"
+	cc := &list.ConcurrentList[ecache.Value]{List: list.NewLinkedListOf[ecache.Value]([]ecache.Value{va})}
+	ccl := Clone(cc).(*list.ConcurrentList[ecache.Value])
+	require.NoError(t, cc.Append(vb))
+	assert.Equal(t, []ecache.Value{va}, ccl.AsSlice())
+
+	s := set.NewMapSet[any](2)
+	s.Add("a")
+	cs := Clone(s).(*set.MapSet[any])
+	s.Add("b")
+	assert.Equal(t, []any{"a"}, cs.Keys())
+
+	assert.Equal(t, "a", Clone("a"))
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkedlist
+
+// Element 链表中的元素
+type Element[T any] struct {
+	Value      T
+	next, prev *Element[T]
+	list       *List[T]
+}
+
+// Next 返回下一个元素，已经是最后一个元素或者不在链表中的时候返回 nil
+func (e *Element[T]) Next() *Element[T] {
+	if e.list == nil || e.next == e.list.tail {
+		return nil
+	}
+	return e.next
+}
+
+// Prev 返回上一个元素，已经是第一个元素或者不在链表中的时候返回 nil
+func (e *Element[T]) Prev() *Element[T] {
+	if e.list == nil || e.prev == e.list.head {
+		return nil
+	}
+	return e.prev
+}
+
+// List 带头尾哨兵结点的侵入式双向链表
+// 调用方直接持有 Element，所以移动和删除元素都是 O(1)，并且不需要额外的内存分配
+type List[T any] struct {
+	head     *Element[T]
+	tail     *Element[T]
+	capacity int
+}
+
+func New[T any]() *List[T] {
+	head := &Element[T]{}
+	tail := &Element[T]{next: head, prev: head}
+	head.next, head.prev = tail, tail
+	return &List[T]{
+		head: head,
+		tail: tail,
+	}
+}
+
+func (l *List[T]) Len() int {
+	return l.capacity
+}
+
+func (l *List[T]) Front() *Element[T] {
+	if l.capacity == 0 {
+		return nil
+	}
+	return l.head.next
+}
+
+func (l *List[T]) Back() *Element[T] {
+	if l.capacity == 0 {
+		return nil
+	}
+	return l.tail.prev
+}
+
+func (l *List[T]) insert(e, at *Element[T]) *Element[T] {
+	e.prev = at
+	e.next = at.next
+	e.prev.next = e
+	e.next.prev = e
+	e.list = l
+	l.capacity++
+	return e
+}
+
+func (l *List[T]) insertValue(v T, at *Element[T]) *Element[T] {
+	return l.insert(&Element[T]{Value: v}, at)
+}
+
+func (l *List[T]) remove(e *Element[T]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.next = nil
+	e.prev = nil
+	e.list = nil
+	l.capacity--
+}
+
+func (l *List[T]) move(e, at *Element[T]) {
+	if e == at {
+		return
+	}
+	e.prev.next = e.next
+	e.next.prev = e.prev
+
+	e.prev = at
+	e.next = at.next
+	e.prev.next = e
+	e.next.prev = e
+}
+
+// Remove 把元素从链表中移除，返回元素的值
+func (l *List[T]) Remove(e *Element[T]) T {
+	l.remove(e)
+	return e.Value
+}
+
+func (l *List[T]) PushFront(v T) *Element[T] {
+	return l.insertValue(v, l.head)
+}
+
+func (l *List[T]) PushBack(v T) *Element[T] {
+	return l.insertValue(v, l.tail.prev)
+}
+
+func (l *List[T]) MoveToFront(e *Element[T]) {
+	l.move(e, l.head)
+}
+
+func (l *List[T]) MoveToBack(e *Element[T]) {
+	l.move(e, l.tail.prev)
+}
+
+func (l *List[T]) MoveBefore(e, mark *Element[T]) {
+	l.move(e, mark.prev)
+}
+
+func (l *List[T]) MoveAfter(e, mark *Element[T]) {
+	if e == mark {
+		return
+	}
+	l.move(e, mark)
+}
+
+func (l *List[T]) InsertBefore(v T, mark *Element[T]) *Element[T] {
+	return l.insertValue(v, mark.prev)
+}
+
+func (l *List[T]) InsertAfter(v T, mark *Element[T]) *Element[T] {
+	return l.insertValue(v, mark)
+}
+
+func (l *List[T]) PushBackList(other *List[T]) {
+	e := other.Front()
+	for i := other.Len(); i > 0; i-- {
+		l.insertValue(e.Value, l.tail.prev)
+		e = e.next
+	}
+}
+
+func (l *List[T]) PushFrontList(other *List[T]) {
+	for i, e := other.Len(), other.Back(); i > 0; i-- {
+		l.insertValue(e.Value, l.head)
+		e = e.prev
+	}
+}
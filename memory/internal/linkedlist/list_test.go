@@ -0,0 +1,310 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkedlist
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Example() {
+	l := New[int]()
+	e4 := l.PushBack(4)
+	e1 := l.PushFront(1)
+	l.InsertBefore(3, e4)
+	l.InsertAfter(2, e1)
+	for e, i := l.Front(), 0; i < l.capacity; i++ {
+		fmt.Println(e.Value)
+		e = e.next
+	}
+
+	// Output:
+	// 1
+	// 2
+	// 3
+	// 4
+}
+
+func checkLinkedListLen[T any](t *testing.T, l *List[T], len int) bool {
+	if n := l.Len(); n != len {
+		t.Errorf("l.Len() = %d, want %d", n, len)
+		return false
+	}
+	return true
+}
+
+func checkLinkedListPointers[T any](t *testing.T, l *List[T], es []*Element[T]) {
+	root := l.head
+
+	if !checkLinkedListLen[T](t, l, len(es)) {
+		return
+	}
+
+	if len(es) == 0 {
+		if l.head.next != l.tail && l.head.next != root || l.tail.prev != root {
+			t.Errorf("l.head.next = %p, l.tail.prev = %p; both should both be nil or %p", l.head.next, l.tail.prev, root)
+		}
+		return
+	}
+
+	for i, e := range es {
+		prev := root
+		Prev := (*Element[T])(nil)
+		if i > 0 {
+			prev = es[i-1]
+			Prev = prev
+		}
+		if p := e.prev; p != root && p != prev {
+			t.Errorf("elt[%d](%p).prev = %p, want %p", i, e, p, prev)
+		}
+		if p := e.prev; p != root && p != Prev {
+			t.Errorf("elt[%d](%p).prev = %p, want %p", i, e, p, Prev)
+		}
+
+		next := root
+		Next := (*Element[T])(nil)
+		if i < len(es)-1 {
+			next = es[i+1]
+			Next = next
+		}
+		if n := e.next; n != l.tail && n != next {
+			t.Errorf("elt[%d](%p).next = %p, want %p", i, e, n, next)
+		}
+		if n := e.next; n != l.tail && n != Next {
+			t.Errorf("elt[%d](%p).next = %p, want %p", i, e, n, Next)
+		}
+	}
+}
+
+func TestLinkedList(t *testing.T) {
+	l := New[any]()
+	checkLinkedListPointers(t, l, []*Element[any]{})
+	e := l.PushFront("a")
+	checkLinkedListPointers(t, l, []*Element[any]{e})
+	l.MoveToFront(e)
+	checkLinkedListPointers(t, l, []*Element[any]{e})
+	l.MoveToBack(e)
+	checkLinkedListPointers(t, l, []*Element[any]{e})
+	l.Remove(e)
+	checkLinkedListPointers(t, l, []*Element[any]{})
+
+	e2 := l.PushFront(2)
+	e1 := l.PushFront(1)
+	e3 := l.PushBack(3)
+	e4 := l.PushBack("banana")
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e2, e3, e4})
+
+	l.Remove(e2)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e3, e4})
+
+	l.MoveToFront(e3)
+	checkLinkedListPointers(t, l, []*Element[any]{e3, e1, e4})
+
+	l.MoveToFront(e1)
+	l.MoveToBack(e3)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e4, e3})
+
+	l.MoveToFront(e3)
+	checkLinkedListPointers(t, l, []*Element[any]{e3, e1, e4})
+	l.MoveToFront(e3)
+	checkLinkedListPointers(t, l, []*Element[any]{e3, e1, e4})
+
+	l.MoveToBack(e3)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e4, e3})
+	l.MoveToBack(e3)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e4, e3})
+
+	e2 = l.InsertBefore(2, e1)
+	checkLinkedListPointers(t, l, []*Element[any]{e2, e1, e4, e3})
+	l.Remove(e2)
+	e2 = l.InsertBefore(2, e4)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e2, e4, e3})
+	l.Remove(e2)
+	e2 = l.InsertBefore(2, e3)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e4, e2, e3})
+	l.Remove(e2)
+
+	e2 = l.InsertAfter(2, e1)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e2, e4, e3})
+	l.Remove(e2)
+	e2 = l.InsertAfter(2, e4)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e4, e2, e3})
+	l.Remove(e2)
+	e2 = l.InsertAfter(2, e3)
+	checkLinkedListPointers(t, l, []*Element[any]{e1, e4, e3, e2})
+	l.Remove(e2)
+
+	sum := 0
+	for e, i := l.Front(), 0; i < l.capacity; i++ {
+		if i, ok := e.Value.(int); ok {
+			sum += i
+		}
+		e = e.next
+	}
+	if sum != 4 {
+		t.Errorf("sum over l = %d, want 4", sum)
+	}
+
+	//var next *Element[any]
+	capacity := l.capacity
+	for e, i := l.Front(), 0; i < capacity; i++ {
+		next := e.next
+		l.Remove(e)
+		e = next
+	}
+	checkLinkedListPointers(t, l, []*Element[any]{})
+}
+
+func checkLinkedList[T int](t *testing.T, l *List[T], es []any) {
+	if !checkLinkedListLen[T](t, l, len(es)) {
+		return
+	}
+
+	i := 0
+	for e := l.Front(); i < l.capacity; i++ {
+		if e != l.tail {
+			le := e.Value
+			if le != es[i] {
+				t.Errorf("elt[%d].Value = %v, want %v", i, le, es[i])
+			}
+			e = e.next
+		}
+	}
+}
+
+func TestExtendingEle(t *testing.T) {
+	l1 := New[int]()
+	l2 := New[int]()
+
+	l1.PushBack(1)
+	l1.PushBack(2)
+	l1.PushBack(3)
+
+	l2.PushBack(4)
+	l2.PushBack(5)
+
+	l3 := New[int]()
+	l3.PushBackList(l1)
+	checkLinkedList(t, l3, []any{1, 2, 3})
+	l3.PushBackList(l2)
+	checkLinkedList(t, l3, []any{1, 2, 3, 4, 5})
+
+	l3 = New[int]()
+	l3.PushFrontList(l2)
+	checkLinkedList(t, l3, []any{4, 5})
+	l3.PushFrontList(l1)
+	checkLinkedList(t, l3, []any{1, 2, 3, 4, 5})
+
+	checkLinkedList(t, l1, []any{1, 2, 3})
+	checkLinkedList(t, l2, []any{4, 5})
+
+	l3 = New[int]()
+	l3.PushBackList(l1)
+	checkLinkedList(t, l3, []any{1, 2, 3})
+	l3.PushBackList(l3)
+	checkLinkedList(t, l3, []any{1, 2, 3, 1, 2, 3})
+
+	l3 = New[int]()
+	l3.PushFrontList(l1)
+	checkLinkedList(t, l3, []any{1, 2, 3})
+	l3.PushFrontList(l3)
+	checkLinkedList(t, l3, []any{1, 2, 3, 1, 2, 3})
+
+	l3 = New[int]()
+	l1.PushBackList(l3)
+	checkLinkedList(t, l1, []any{1, 2, 3})
+	l1.PushFrontList(l3)
+	checkLinkedList(t, l1, []any{1, 2, 3})
+}
+
+func TestRemoveEle(t *testing.T) {
+	l := New[int]()
+	e1 := l.PushBack(1)
+	e2 := l.PushBack(2)
+	checkLinkedListPointers(t, l, []*Element[int]{e1, e2})
+	e := l.Front()
+	l.Remove(e)
+	checkLinkedListPointers(t, l, []*Element[int]{e2})
+	e = l.Front()
+	l.Remove(e)
+	checkLinkedListPointers(t, l, []*Element[int]{})
+}
+
+func TestIssue6349Ele(t *testing.T) {
+	l := New[int]()
+	l.PushBack(1)
+	l.PushBack(2)
+
+	e := l.Front()
+	l.Remove(e)
+	if e.Value != 1 {
+		t.Errorf("e.value = %d, want 1", e.Value)
+	}
+	if e.next != nil && e.next != l.tail {
+		t.Errorf("e.nextElem() != nil")
+	}
+	if e.prev != nil && e.prev != l.head {
+		t.Errorf("e.prevElem() != nil")
+	}
+}
+
+func TestMoveEle(t *testing.T) {
+	l := New[int]()
+	e1 := l.PushBack(1)
+	e2 := l.PushBack(2)
+	e3 := l.PushBack(3)
+	e4 := l.PushBack(4)
+
+	l.MoveAfter(e3, e3)
+	checkLinkedListPointers(t, l, []*Element[int]{e1, e2, e3, e4})
+	l.MoveBefore(e2, e2)
+	checkLinkedListPointers(t, l, []*Element[int]{e1, e2, e3, e4})
+
+	l.MoveAfter(e3, e2)
+	checkLinkedListPointers(t, l, []*Element[int]{e1, e2, e3, e4})
+	l.MoveBefore(e2, e3)
+	checkLinkedListPointers(t, l, []*Element[int]{e1, e2, e3, e4})
+
+	l.MoveBefore(e2, e4)
+	checkLinkedListPointers(t, l, []*Element[int]{e1, e3, e2, e4})
+	e2, e3 = e3, e2
+
+	l.MoveBefore(e4, e1)
+	checkLinkedListPointers(t, l, []*Element[int]{e4, e1, e2, e3})
+	e1, e2, e3, e4 = e4, e1, e2, e3
+
+	l.MoveAfter(e4, e1)
+	checkLinkedListPointers(t, l, []*Element[int]{e1, e4, e2, e3})
+	e2, e3, e4 = e4, e2, e3
+
+	l.MoveAfter(e2, e3)
+	checkLinkedListPointers(t, l, []*Element[int]{e1, e3, e2, e4})
+}
+
+func TestNextPrev(t *testing.T) {
+	l := New[int]()
+	e1 := l.PushBack(1)
+	e2 := l.PushBack(2)
+	if e1.Prev() != nil || e1.Next() != e2 {
+		t.Errorf("e1.Prev() = %p, e1.Next() = %p, want nil, %p", e1.Prev(), e1.Next(), e2)
+	}
+	if e2.Prev() != e1 || e2.Next() != nil {
+		t.Errorf("e2.Prev() = %p, e2.Next() = %p, want %p, nil", e2.Prev(), e2.Next(), e1)
+	}
+	l.Remove(e1)
+	if e1.Prev() != nil || e1.Next() != nil || e2.Prev() != nil {
+		t.Errorf("removed element should have no neighbours")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pipeline 供内存缓存实现 ecache.PipelineCache：先记录回调里面排队的命令，再在一次加锁里面执行
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+)
+
+var _ ecache.Pipeliner = (*Queue)(nil)
+
+// Queue 记录排队的命令，每个命令在执行的时候调用 ecache.Cache 里面对应的方法
+type Queue struct {
+	cmds []func(ctx context.Context, c ecache.Cache) ecache.Value
+}
+
+// Exec 依次执行所有的命令，c 应该是一个假定已经持有锁的 ecache.Cache
+func (q *Queue) Exec(ctx context.Context, c ecache.Cache) []ecache.Value {
+	res := make([]ecache.Value, 0, len(q.cmds))
+	for _, cmd := range q.cmds {
+		res = append(res, cmd(ctx, c))
+	}
+	return res
+}
+
+// Err 返回第一个失败的命令的错误，key 不存在不算失败
+// TxPipeline 拿到错误之后要回滚所有的命令
+func Err(res []ecache.Value) error {
+	for i, val := range res {
+		if val.Err != nil && !errors.Is(val.Err, errs.ErrKeyNotExist) {
+			return fmt.Errorf("ecache: 第 %d 个命令执行失败，所有的命令都已经回滚: %w", i, val.Err)
+		}
+	}
+	return nil
+}
+
+func (q *Queue) add(cmd func(ctx context.Context, c ecache.Cache) ecache.Value) {
+	q.cmds = append(q.cmds, cmd)
+}
+
+func (q *Queue) Set(key string, val any, expiration time.Duration) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Err = c.Set(ctx, key, val, expiration)
+		return
+	})
+}
+
+func (q *Queue) SetNX(key string, val any, expiration time.Duration) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Val, res.Err = c.SetNX(ctx, key, val, expiration)
+		return
+	})
+}
+
+func (q *Queue) Get(key string) {
+	q.add(func(ctx context.Context, c ecache.Cache) ecache.Value {
+		return c.Get(ctx, key)
+	})
+}
+
+func (q *Queue) GetSet(key string, val string) {
+	q.add(func(ctx context.Context, c ecache.Cache) ecache.Value {
+		return c.GetSet(ctx, key, val)
+	})
+}
+
+func (q *Queue) Delete(key ...string) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Val, res.Err = c.Delete(ctx, key...)
+		return
+	})
+}
+
+func (q *Queue) LPush(key string, val ...any) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Val, res.Err = c.LPush(ctx, key, val...)
+		return
+	})
+}
+
+func (q *Queue) LPop(key string) {
+	q.add(func(ctx context.Context, c ecache.Cache) ecache.Value {
+		return c.LPop(ctx, key)
+	})
+}
+
+func (q *Queue) SAdd(key string, members ...any) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Val, res.Err = c.SAdd(ctx, key, members...)
+		return
+	})
+}
+
+func (q *Queue) SRem(key string, members ...any) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Val, res.Err = c.SRem(ctx, key, members...)
+		return
+	})
+}
+
+func (q *Queue) IncrBy(key string, value int64) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Val, res.Err = c.IncrBy(ctx, key, value)
+		return
+	})
+}
+
+func (q *Queue) DecrBy(key string, value int64) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Val, res.Err = c.DecrBy(ctx, key, value)
+		return
+	})
+}
+
+func (q *Queue) IncrByFloat(key string, value float64) {
+	q.add(func(ctx context.Context, c ecache.Cache) (res ecache.Value) {
+		res.Val, res.Err = c.IncrByFloat(ctx, key, value)
+		return
+	})
+}
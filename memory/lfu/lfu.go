@@ -0,0 +1,169 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lfu
+
+import (
+	"time"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/internal/linkedlist"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+var _ memory.EvictionPolicy = (*Policy)(nil)
+
+type entry struct {
+	key string
+	// bucket 所在的频率桶
+	bucket *linkedlist.Element[*bucket]
+	// elem 在频率桶里面的位置
+	elem *linkedlist.Element[*entry]
+}
+
+// bucket 访问频率相同的 key，越靠近队头越是最近访问的
+type bucket struct {
+	freq    int
+	entries *linkedlist.List[*entry]
+}
+
+// Policy O(1) 的 LFU 淘汰策略，适合访问频率比访问时间更能反映数据价值的场景
+//
+// buckets 按照访问频率从小到大排列，每个频率桶里面是一个 LRU 链表。
+// 访问一个 key 只需要把它挪到相邻的频率桶里面，淘汰的时候取第一个频率桶的队尾，
+// 所以访问和淘汰都是 O(1) 的，同一个频率里面按照 LRU 淘汰
+type Policy struct {
+	data    map[string]*entry
+	buckets *linkedlist.List[*bucket]
+
+	// decayInterval 访问频率减半的间隔，0 表示不衰减
+	decayInterval time.Duration
+	lastDecay     time.Time
+}
+
+func NewPolicy(opts ...option.Option[Policy]) *Policy {
+	res := &Policy{
+		data:      make(map[string]*entry),
+		buckets:   linkedlist.New[*bucket](),
+		lastDecay: time.Now(),
+	}
+	option.Apply(res, opts...)
+	return res
+}
+
+// WithDecayInterval 每隔 interval 把所有 key 的访问频率减半，在写入或者访问的时候顺便检查
+// 默认不衰减，这种情况下很久以前的热点数据可能会一直占着缓存
+func WithDecayInterval(interval time.Duration) option.Option[Policy] {
+	return func(p *Policy) {
+		p.decayInterval = interval
+	}
+}
+
+func (p *Policy) OnInsert(key string) {
+	p.decayIfNeeded()
+	ent := &entry{key: key}
+	front := p.buckets.Front()
+	if front == nil || front.Value.freq != 1 {
+		front = p.buckets.PushFront(&bucket{freq: 1, entries: linkedlist.New[*entry]()})
+	}
+	p.attach(ent, front)
+	p.data[key] = ent
+}
+
+func (p *Policy) OnAccess(key string) {
+	p.decayIfNeeded()
+	if ent, ok := p.data[key]; ok {
+		p.increment(ent)
+	}
+}
+
+func (p *Policy) OnRemove(key string, _ evict.Reason) {
+	if ent, ok := p.data[key]; ok {
+		p.detach(ent)
+		delete(p.data, key)
+	}
+}
+
+// Victim 访问频率最低的 key 里面最久没有被访问的那个
+func (p *Policy) Victim() (string, bool) {
+	front := p.buckets.Front()
+	if front == nil {
+		return "", false
+	}
+	return front.Value.entries.Back().Value.key, true
+}
+
+// attach 把 key 放到频率桶的队头
+func (p *Policy) attach(ent *entry, b *linkedlist.Element[*bucket]) {
+	ent.bucket = b
+	ent.elem = b.Value.entries.PushFront(ent)
+}
+
+// detach 把 key 从所在的频率桶里面移除，频率桶空了就一起移除
+func (p *Policy) detach(ent *entry) {
+	b := ent.bucket
+	b.Value.entries.Remove(ent.elem)
+	if b.Value.entries.Len() == 0 {
+		p.buckets.Remove(b)
+	}
+	ent.bucket, ent.elem = nil, nil
+}
+
+// increment 把 key 挪到频率加一的频率桶
+func (p *Policy) increment(ent *entry) {
+	cur := ent.bucket
+	freq := cur.Value.freq + 1
+	next := cur.Next()
+	if next == nil || next.Value.freq != freq {
+		next = p.buckets.InsertAfter(&bucket{freq: freq, entries: linkedlist.New[*entry]()}, cur)
+	}
+	p.detach(ent)
+	p.attach(ent, next)
+}
+
+func (p *Policy) decayIfNeeded() {
+	if p.decayInterval <= 0 {
+		return
+	}
+	if now := time.Now(); now.Sub(p.lastDecay) >= p.decayInterval {
+		p.lastDecay = now
+		p.decay()
+	}
+}
+
+// decay 所有 key 的访问频率减半（最小为 1），让很久以前的热点有机会被淘汰
+// 减半之后频率相同的桶会被合并，原本频率更高的 key 排在合并后的桶的前面
+func (p *Policy) decay() {
+	var prev *linkedlist.Element[*bucket]
+	for b := p.buckets.Front(); b != nil; {
+		next := b.Next()
+		freq := b.Value.freq / 2
+		if freq < 1 {
+			freq = 1
+		}
+		b.Value.freq = freq
+		if prev != nil && prev.Value.freq == freq {
+			// 从队尾开始挪，保持原来的相对顺序
+			for elem := b.Value.entries.Back(); elem != nil; elem = b.Value.entries.Back() {
+				ent := elem.Value
+				p.detach(ent)
+				p.attach(ent, prev)
+			}
+		} else {
+			prev = b
+		}
+		b = next
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lfu
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bucketsOf 按照淘汰顺序的逆序返回每个频率桶里面的 key
+func bucketsOf(t *testing.T, p *Policy) map[int][]string {
+	res := make(map[int][]string)
+	total := 0
+	lastFreq := 0
+	for b := p.buckets.Front(); b != nil; b = b.Next() {
+		require.Greater(t, b.Value.freq, lastFreq)
+		require.NotZero(t, b.Value.entries.Len())
+		lastFreq = b.Value.freq
+		for e := b.Value.entries.Front(); e != nil; e = e.Next() {
+			require.Same(t, b, e.Value.bucket)
+			require.Same(t, e, e.Value.elem)
+			require.Same(t, e.Value, p.data[e.Value.key])
+			res[b.Value.freq] = append(res[b.Value.freq], e.Value.key)
+			total++
+		}
+	}
+	require.Equal(t, len(p.data), total)
+	return res
+}
+
+func TestPolicy_increment(t *testing.T) {
+	p := NewPolicy()
+	p.OnInsert("key1")
+	p.OnInsert("key2")
+	p.OnInsert("key3")
+	assert.Equal(t, map[int][]string{1: {"key3", "key2", "key1"}}, bucketsOf(t, p))
+
+	p.OnAccess("key1")
+	p.OnAccess("key1")
+	p.OnAccess("key2")
+	assert.Equal(t, map[int][]string{
+		1: {"key3"},
+		2: {"key2"},
+		3: {"key1"},
+	}, bucketsOf(t, p))
+
+	p.OnAccess("key3")
+	assert.Equal(t, map[int][]string{
+		2: {"key3", "key2"},
+		3: {"key1"},
+	}, bucketsOf(t, p))
+
+	p.OnRemove("key1", evict.ReasonDeleted)
+	assert.Equal(t, map[int][]string{
+		2: {"key3", "key2"},
+	}, bucketsOf(t, p))
+	victim, ok := p.Victim()
+	assert.True(t, ok)
+	assert.Equal(t, "key2", victim)
+}
+
+func TestPolicy_store(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	s := memory.NewStore(3, NewPolicy(), memory.WithEvictListener(
+		evict.ListenerFunc(func(evt evict.Event) {
+			events = append(events, evt)
+		})))
+	defer s.Close()
+	require.NoError(t, s.Set(ctx, "key1", "value1", 0))
+	require.NoError(t, s.Set(ctx, "key2", "value2", 0))
+	require.NoError(t, s.Set(ctx, "key3", "value3", 0))
+	_ = s.Get(ctx, "key1")
+	_ = s.Get(ctx, "key3")
+
+	// key2 的频率最低
+	require.NoError(t, s.Set(ctx, "key4", "value4", 0))
+	assert.Error(t, s.Get(ctx, "key2").Err)
+
+	// 频率相同的时候淘汰最久没访问的
+	_ = s.Get(ctx, "key4")
+	require.NoError(t, s.Set(ctx, "key5", "value5", 0))
+	assert.Error(t, s.Get(ctx, "key1").Err)
+
+	assert.Equal(t, []evict.Event{
+		{Key: "key2", Value: "value2", Reason: evict.ReasonCapacity},
+		{Key: "key1", Value: "value1", Reason: evict.ReasonCapacity},
+	}, events)
+}
+
+func TestPolicy_decay(t *testing.T) {
+	p := NewPolicy()
+	for i := 1; i <= 5; i++ {
+		key := fmt.Sprintf("key%d", i)
+		p.OnInsert(key)
+		for j := 1; j < i*2; j++ {
+			p.OnAccess(key)
+		}
+	}
+	assert.Equal(t, map[int][]string{
+		2:  {"key1"},
+		4:  {"key2"},
+		6:  {"key3"},
+		8:  {"key4"},
+		10: {"key5"},
+	}, bucketsOf(t, p))
+
+	p.decay()
+	assert.Equal(t, map[int][]string{
+		1: {"key1"},
+		2: {"key2"},
+		3: {"key3"},
+		4: {"key4"},
+		5: {"key5"},
+	}, bucketsOf(t, p))
+
+	p.decay()
+	assert.Equal(t, map[int][]string{
+		1: {"key3", "key2", "key1"},
+		2: {"key5", "key4"},
+	}, bucketsOf(t, p))
+}
+
+func TestWithDecayInterval(t *testing.T) {
+	p := NewPolicy(WithDecayInterval(time.Millisecond * 10))
+	p.OnInsert("key1")
+	for i := 0; i < 9; i++ {
+		p.OnAccess("key1")
+	}
+	assert.Equal(t, 10, p.data["key1"].bucket.Value.freq)
+
+	// 过了衰减间隔之后，下一次访问会先把频率减半
+	time.Sleep(time.Millisecond * 20)
+	p.OnAccess("key1")
+	assert.Equal(t, 6, p.data["key1"].bucket.Value.freq)
+}
+
+func TestNewCache(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	c := NewCache(2, memory.WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+		evicted = append(evicted, evt.Key)
+	})))
+	defer c.Close()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), i, 0))
+	}
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, 3, c.Get(ctx, "key3").Val)
+}
@@ -17,251 +17,217 @@ package lru
 import (
 	"context"
 	"errors"
-	"fmt"
-	"sync"
 	"time"
 
+	"github.com/ecodeclub/ekit/bean/option"
 	"github.com/ecodeclub/ekit/set"
 
 	"github.com/ecodeclub/ekit/list"
 
 	"github.com/ecodeclub/ecache"
 	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/snapshot"
 )
 
 var (
 	_ ecache.Cache = (*Cache)(nil)
 )
 
-type entry struct {
-	key       string
-	value     any
-	expiresAt time.Time
-}
-
-func (e entry) isExpired() bool {
-	return !e.expiresAt.IsZero() && e.expiresAt.Before(time.Now())
-}
-
 type EvictCallback func(key string, value any)
 
 type Option func(l *Cache)
 
+// WithEvictCallback 键值对因为过期、容量不足或者删除离开缓存的时候，在释放锁之后同步调用 callback
+//
+// Deprecated: 使用 WithEvictListener，它会带上淘汰原因
 func WithEvictCallback(callback func(k string, v any)) Option {
 	return func(l *Cache) {
 		l.callback = callback
 	}
 }
 
+// WithEvictListener 设置淘汰事件的监听者，监听者会在释放锁之后被调用
+func WithEvictListener(listener evict.Listener) Option {
+	return func(l *Cache) {
+		l.listener = listener
+	}
+}
+
+// WithMaxBytes 限制所有键值对占用的字节数，超出之后淘汰最久没有访问的 key，和 capacity 同时生效
+// 键值对的大小是 key 的长度加上 memory.SizeOf 估算的值的大小
+func WithMaxBytes(maxBytes int64) Option {
+	return func(l *Cache) {
+		l.maxBytes = maxBytes
+	}
+}
+
 func WithCycleInterval(interval time.Duration) Option {
 	return func(l *Cache) {
 		l.cycleInterval = interval
 	}
 }
 
+// Cache 使用 Policy 淘汰数据的 memory.Store
+// 存储、过期时间和字节数统计都交给 memory.Store，Cache 只负责 LRU 的顺序和数据类型的操作
 type Cache struct {
-	lock          sync.RWMutex
+	store         *memory.Store
+	policy        *Policy
 	capacity      int
-	list          *linkedList[entry]
-	data          map[string]*element[entry]
 	callback      EvictCallback
+	listener      evict.Listener
 	cycleInterval time.Duration
+	// maxBytes 所有键值对占用的字节数上限，0 表示不限制
+	maxBytes int64
+	// codec Snapshot 和 Restore 使用的 Codec
+	codec snapshot.Codec
 }
 
 func NewCache(capacity int, options ...Option) *Cache {
 	res := &Cache{
-		list:          newLinkedList[entry](),
-		data:          make(map[string]*element[entry], capacity),
+		policy:        NewPolicy(),
 		capacity:      capacity,
 		cycleInterval: time.Second * 10,
 	}
 	for _, opt := range options {
 		opt(res)
 	}
-	res.cleanCycle()
-	return res
-}
-
-func (c *Cache) cleanCycle() {
-	go func() {
-		ticker := time.NewTicker(c.cycleInterval)
-		for range ticker.C {
-			cnt := 0
-			c.lock.Lock()
-			limit := c.list.len() / 3
-			for elem, i := c.list.back(), 0; i < c.list.len(); i++ {
-				if elem.Value.isExpired() {
-					c.removeElement(elem)
-				}
-				elem = elem.prev
-				cnt++
-				if cnt >= limit {
-					break
-				}
-			}
-			c.lock.Unlock()
-		}
-	}()
-}
-
-func (c *Cache) pushEntry(key string, ent entry) bool {
-	if len(c.data) >= c.capacity && c.len() >= c.capacity {
-		if elem, ok := c.data[key]; ok {
-			elem.Value = ent
-			c.list.moveToFront(elem)
-			return false
-		}
-		c.removeOldest()
-	}
-	if elem, ok := c.data[key]; ok {
-		elem.Value = ent
-		c.list.moveToFront(elem)
-		return false
+	opts := []option.Option[memory.Store]{memory.WithCycleInterval(res.cycleInterval)}
+	if res.maxBytes > 0 {
+		opts = append(opts, memory.WithMaxBytes(res.maxBytes))
 	}
-	elem := c.list.pushFront(ent)
-	c.data[key] = elem
-	return true
-}
-
-func (c *Cache) addTTL(key string, value any, expiration time.Duration) bool {
-	ent := entry{key: key, value: value,
-		expiresAt: time.Now().Add(expiration)}
-	return c.pushEntry(key, ent)
-}
-
-func (c *Cache) add(key string, value any) bool {
-	ent := entry{key: key, value: value}
-	return c.pushEntry(key, ent)
-}
-
-func (c *Cache) get(key string) (value any, ok bool) {
-	if elem, exist := c.data[key]; exist {
-		ent := elem.Value
-		if ent.isExpired() {
-			c.removeElement(elem)
-			return
-		}
-		c.list.moveToFront(elem)
-		return ent.value, true
+	if listener := res.evictListener(); listener != nil {
+		opts = append(opts, memory.WithEvictListener(listener))
 	}
-	return
+	res.store = memory.NewStore(capacity, res.policy, opts...)
+	return res
 }
 
-func (c *Cache) removeOldest() {
-	if elem := c.list.back(); elem != nil {
-		c.removeElement(elem)
+// evictListener 把 WithEvictCallback 和 WithEvictListener 合并成一个 evict.Listener
+// 被覆盖的旧值不会交给 callback
+func (c *Cache) evictListener() evict.Listener {
+	if c.callback == nil {
+		return c.listener
 	}
+	return evict.ListenerFunc(func(evt evict.Event) {
+		if evt.Reason != evict.ReasonReplaced {
+			c.callback(evt.Key, evt.Value)
+		}
+		if c.listener != nil {
+			c.listener.OnEvict(evt)
+		}
+	})
 }
 
-func (c *Cache) removeElement(elem *element[entry]) {
-	c.list.removeElem(elem)
-	ent := elem.Value
-	c.delete(ent.key)
-	if c.callback != nil {
-		c.callback(ent.key, ent.value)
-	}
+// Close 停止过期清理，不再使用的 Cache 应该调用 Close
+func (c *Cache) Close() error {
+	return c.store.Close()
 }
 
-func (c *Cache) remove(key string) bool {
-	if elem, ok := c.data[key]; ok {
-		c.removeElement(elem)
-		return !elem.Value.isExpired()
-	}
-	return false
+// Bytes 当前所有键值对占用的字节数，没有设置 WithMaxBytes 的时候不统计，总是返回 0
+func (c *Cache) Bytes() int64 {
+	return c.store.Bytes()
 }
 
-func (c *Cache) contains(key string) (ok bool) {
-	elem, ok := c.data[key]
-	if ok {
-		if elem.Value.isExpired() {
-			c.removeElement(elem)
-			return false
-		}
-	}
-	return ok
+// locked 是已经持有锁的 Cache，方法直接操作 memory.Core，用来在一次加锁里面执行多个操作
+type locked struct {
+	*Cache
+	core *memory.Core
 }
 
-func (c *Cache) delete(key string) {
-	delete(c.data, key)
+// do 持有锁执行 fn
+func (c *Cache) do(fn func(l locked)) {
+	c.store.Do(func(core *memory.Core) {
+		fn(locked{Cache: c, core: core})
+	})
 }
 
-func (c *Cache) len() int {
-	var length int
-	for elem, i := c.list.back(), 0; i < c.list.len(); i++ {
-		if elem.Value.isExpired() {
-			c.removeElement(elem)
-			continue
-		}
-		elem = elem.prev
-		length++
-	}
-	return length
+func (c *Cache) Set(ctx context.Context, key string, val any, expiration time.Duration) (err error) {
+	c.do(func(l locked) {
+		err = l.Set(ctx, key, val, expiration)
+	})
+	return
 }
 
-func (c *Cache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	c.addTTL(key, val, expiration)
+func (c locked) Set(_ context.Context, key string, val any, expiration time.Duration) error {
+	c.core.SetDeadline(key, val, time.Now().Add(expiration))
 	return nil
 }
 
-func (c *Cache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+func (c *Cache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (ok bool, err error) {
+	c.do(func(l locked) {
+		ok, err = l.SetNX(ctx, key, val, expiration)
+	})
+	return
+}
 
-	if c.contains(key) {
+func (c locked) SetNX(_ context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	if _, ok := c.core.Lookup(key); ok {
 		return false, nil
 	}
-
-	c.addTTL(key, val, expiration)
-
+	c.core.SetDeadline(key, val, time.Now().Add(expiration))
 	return true, nil
 }
 
 func (c *Cache) Get(ctx context.Context, key string) (val ecache.Value) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.do(func(l locked) {
+		val = l.Get(ctx, key)
+	})
+	return
+}
+
+func (c locked) Get(_ context.Context, key string) (val ecache.Value) {
 	var ok bool
-	val.Val, ok = c.get(key)
+	val.Val, ok = c.core.Get(key)
 	if !ok {
 		val.Err = errs.ErrKeyNotExist
 	}
+	return
+}
 
+// Deadline 返回 key 的过期时间，零值表示永不过期，key 不存在或者已经过期的时候返回 false
+func (c *Cache) Deadline(_ context.Context, key string) (deadline time.Time, ok bool) {
+	c.store.View(func(core *memory.Core) {
+		var ent memory.Entry
+		ent, ok = core.Lookup(key)
+		deadline = ent.ExpiresAt
+	})
 	return
 }
 
 func (c *Cache) GetSet(ctx context.Context, key string, val string) (result ecache.Value) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.do(func(l locked) {
+		result = l.GetSet(ctx, key, val)
+	})
+	return
+}
 
+func (c locked) GetSet(_ context.Context, key string, val string) (result ecache.Value) {
 	var ok bool
-	result.Val, ok = c.get(key)
+	result.Val, ok = c.core.Get(key)
 	if !ok {
 		result.Err = errs.ErrKeyNotExist
 	}
-
-	c.add(key, val)
-
+	c.core.Set(key, val, 0)
 	return
 }
 
-func (c *Cache) Delete(ctx context.Context, key ...string) (int64, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+func (c *Cache) Delete(ctx context.Context, key ...string) (n int64, err error) {
+	c.do(func(l locked) {
+		n, err = l.Delete(ctx, key...)
+	})
+	return
+}
 
+func (c locked) Delete(ctx context.Context, key ...string) (int64, error) {
 	n := int64(0)
 	for _, k := range key {
 		if ctx.Err() != nil {
 			return n, ctx.Err()
 		}
-		_, ok := c.get(k)
-		if !ok {
-			continue
-		}
-		if c.remove(k) {
+		if c.core.Delete(k) {
 			n++
-		} else {
-			return n, fmt.Errorf("%w: key = %s", errs.ErrDeleteKeyFailed, k)
 		}
 	}
 	return n, nil
@@ -278,20 +244,24 @@ func (c *Cache) anySliceToValueSlice(data ...any) []ecache.Value {
 	return newVal
 }
 
-func (c *Cache) LPush(ctx context.Context, key string, val ...any) (int64, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+func (c *Cache) LPush(ctx context.Context, key string, val ...any) (n int64, err error) {
+	c.do(func(l locked) {
+		n, err = l.LPush(ctx, key, val...)
+	})
+	return
+}
 
+func (c locked) LPush(_ context.Context, key string, val ...any) (int64, error) {
 	var (
 		ok     bool
 		result = ecache.Value{}
 	)
-	result.Val, ok = c.get(key)
+	result.Val, ok = c.core.Get(key)
 	if !ok {
 		l := &list.ConcurrentList[ecache.Value]{
 			List: list.NewLinkedListOf[ecache.Value](c.anySliceToValueSlice(val...)),
 		}
-		c.add(key, l)
+		c.core.Set(key, l, 0)
 		return int64(l.Len()), nil
 	}
 
@@ -305,18 +275,22 @@ func (c *Cache) LPush(ctx context.Context, key string, val ...any) (int64, error
 		return 0, err
 	}
 
-	c.add(key, data)
+	c.core.Update(key, data)
 	return int64(data.Len()), nil
 }
 
 func (c *Cache) LPop(ctx context.Context, key string) (val ecache.Value) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.do(func(l locked) {
+		val = l.LPop(ctx, key)
+	})
+	return
+}
 
+func (c locked) LPop(_ context.Context, key string) (val ecache.Value) {
 	var (
 		ok bool
 	)
-	val.Val, ok = c.get(key)
+	val.Val, ok = c.core.Get(key)
 	if !ok {
 		val.Err = errs.ErrKeyNotExist
 		return
@@ -333,42 +307,55 @@ func (c *Cache) LPop(ctx context.Context, key string) (val ecache.Value) {
 		val.Err = err
 		return
 	}
+	c.core.Update(key, data)
 
 	val = value
 	return
 }
 
-func (c *Cache) SAdd(ctx context.Context, key string, members ...any) (int64, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+func (c *Cache) SAdd(ctx context.Context, key string, members ...any) (n int64, err error) {
+	c.do(func(l locked) {
+		n, err = l.SAdd(ctx, key, members...)
+	})
+	return
+}
 
+func (c locked) SAdd(_ context.Context, key string, members ...any) (int64, error) {
 	var (
 		ok     bool
 		result = ecache.Value{}
 	)
-	result.Val, ok = c.get(key)
+	result.Val, ok = c.core.Get(key)
 	if !ok {
 		result.Val = set.NewMapSet[any](8)
 	}
 
-	s, ok := result.Val.(set.Set[any])
-	if !ok {
+	s, isSet := result.Val.(set.Set[any])
+	if !isSet {
 		return 0, errors.New("当前key已存在不是set类型")
 	}
 
 	for _, value := range members {
 		s.Add(value)
 	}
-	c.add(key, s)
+	if ok {
+		c.core.Update(key, s)
+	} else {
+		c.core.Set(key, s, 0)
+	}
 
 	return int64(len(s.Keys())), nil
 }
 
-func (c *Cache) SRem(ctx context.Context, key string, members ...any) (int64, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+func (c *Cache) SRem(ctx context.Context, key string, members ...any) (n int64, err error) {
+	c.do(func(l locked) {
+		n, err = l.SRem(ctx, key, members...)
+	})
+	return
+}
 
-	result, ok := c.get(key)
+func (c locked) SRem(_ context.Context, key string, members ...any) (int64, error) {
+	result, ok := c.core.Get(key)
 	if !ok {
 		return 0, errs.ErrKeyNotExist
 	}
@@ -385,20 +372,25 @@ func (c *Cache) SRem(ctx context.Context, key string, members ...any) (int64, er
 			rems++
 		}
 	}
+	c.core.Update(key, s)
 	return rems, nil
 }
 
-func (c *Cache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+func (c *Cache) IncrBy(ctx context.Context, key string, value int64) (n int64, err error) {
+	c.do(func(l locked) {
+		n, err = l.IncrBy(ctx, key, value)
+	})
+	return
+}
 
+func (c locked) IncrBy(_ context.Context, key string, value int64) (int64, error) {
 	var (
 		ok     bool
 		result = ecache.Value{}
 	)
-	result.Val, ok = c.get(key)
+	result.Val, ok = c.core.Get(key)
 	if !ok {
-		c.add(key, value)
+		c.core.Set(key, value, 0)
 		return value, nil
 	}
 
@@ -408,22 +400,26 @@ func (c *Cache) IncrBy(ctx context.Context, key string, value int64) (int64, err
 	}
 
 	newVal := incr + value
-	c.add(key, newVal)
+	c.core.Update(key, newVal)
 
 	return newVal, nil
 }
 
-func (c *Cache) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+func (c *Cache) DecrBy(ctx context.Context, key string, value int64) (n int64, err error) {
+	c.do(func(l locked) {
+		n, err = l.DecrBy(ctx, key, value)
+	})
+	return
+}
 
+func (c locked) DecrBy(_ context.Context, key string, value int64) (int64, error) {
 	var (
 		ok     bool
 		result = ecache.Value{}
 	)
-	result.Val, ok = c.get(key)
+	result.Val, ok = c.core.Get(key)
 	if !ok {
-		c.add(key, -value)
+		c.core.Set(key, -value, 0)
 		return -value, nil
 	}
 
@@ -433,22 +429,26 @@ func (c *Cache) DecrBy(ctx context.Context, key string, value int64) (int64, err
 	}
 
 	newVal := decr - value
-	c.add(key, newVal)
+	c.core.Update(key, newVal)
 
 	return newVal, nil
 }
 
-func (c *Cache) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+func (c *Cache) IncrByFloat(ctx context.Context, key string, value float64) (f float64, err error) {
+	c.do(func(l locked) {
+		f, err = l.IncrByFloat(ctx, key, value)
+	})
+	return
+}
 
+func (c locked) IncrByFloat(_ context.Context, key string, value float64) (float64, error) {
 	var (
 		ok     bool
 		result = ecache.Value{}
 	)
-	result.Val, ok = c.get(key)
+	result.Val, ok = c.core.Get(key)
 	if !ok {
-		c.add(key, value)
+		c.core.Set(key, value, 0)
 		return value, nil
 	}
 
@@ -458,7 +458,7 @@ func (c *Cache) IncrByFloat(ctx context.Context, key string, value float64) (flo
 	}
 
 	newVal := val + value
-	c.add(key, newVal)
+	c.core.Update(key, newVal)
 
 	return newVal, nil
 }
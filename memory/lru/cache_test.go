@@ -24,11 +24,47 @@ import (
 
 	"github.com/ecodeclub/ecache"
 	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
 	"github.com/ecodeclub/ekit/list"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// get 测试用，直接读取 key
+func (c *Cache) get(key string) (val any, ok bool) {
+	c.store.Do(func(core *memory.Core) {
+		val, ok = core.Get(key)
+	})
+	return
+}
+
+// add 测试用，写入一个永不过期的键值对，返回 key 原本是否不存在
+func (c *Cache) add(key string, val any) bool {
+	return c.addDeadline(key, val, time.Time{})
+}
+
+func (c *Cache) addTTL(key string, val any, expiration time.Duration) bool {
+	return c.addDeadline(key, val, time.Now().Add(expiration))
+}
+
+func (c *Cache) addDeadline(key string, val any, expiresAt time.Time) (ok bool) {
+	c.store.Do(func(core *memory.Core) {
+		_, exist := core.Lookup(key)
+		core.SetDeadline(key, val, expiresAt)
+		ok = !exist
+	})
+	return
+}
+
+// remove 测试用，删除 key，返回 key 在删除之前是否存在并且没有过期
+func (c *Cache) remove(key string) (ok bool) {
+	c.store.Do(func(core *memory.Core) {
+		ok = core.Delete(key)
+	})
+	return
+}
+
 func TestLocalCache_cleanCycle(t *testing.T) {
 	c := NewCache(200, WithCycleInterval(time.Second))
 
@@ -1017,3 +1053,119 @@ func TestCache_IncrByFloat(t *testing.T) {
 		})
 	}
 }
+
+func TestCache_evictListener(t *testing.T) {
+	testCases := []struct {
+		name       string
+		before     func(cache *Cache)
+		wantEvents []evict.Event
+	}{
+		{
+			name: "replaced",
+			before: func(cache *Cache) {
+				_ = cache.Set(context.Background(), "key1", "value1", time.Minute)
+				_ = cache.Set(context.Background(), "key1", "value2", time.Minute)
+				_ = cache.GetSet(context.Background(), "key1", "value3")
+			},
+			wantEvents: []evict.Event{
+				{Key: "key1", Value: "value1", Reason: evict.ReasonReplaced},
+				{Key: "key1", Value: "value2", Reason: evict.ReasonReplaced},
+			},
+		},
+		{
+			name: "capacity",
+			before: func(cache *Cache) {
+				_ = cache.Set(context.Background(), "key1", "value1", time.Minute)
+				_ = cache.Set(context.Background(), "key2", "value2", time.Minute)
+				_ = cache.Get(context.Background(), "key1")
+				_ = cache.Set(context.Background(), "key3", "value3", time.Minute)
+			},
+			wantEvents: []evict.Event{
+				{Key: "key2", Value: "value2", Reason: evict.ReasonCapacity},
+			},
+		},
+		{
+			name: "deleted",
+			before: func(cache *Cache) {
+				_ = cache.Set(context.Background(), "key1", "value1", time.Minute)
+				_, _ = cache.Delete(context.Background(), "key1")
+			},
+			wantEvents: []evict.Event{
+				{Key: "key1", Value: "value1", Reason: evict.ReasonDeleted},
+			},
+		},
+		{
+			name: "expired",
+			before: func(cache *Cache) {
+				_ = cache.Set(context.Background(), "key1", "value1", -time.Minute)
+				_ = cache.Set(context.Background(), "key2", "value2", -time.Minute)
+				_ = cache.Get(context.Background(), "key1")
+				_ = cache.Set(context.Background(), "key2", "value3", time.Minute)
+			},
+			wantEvents: []evict.Event{
+				{Key: "key1", Value: "value1", Reason: evict.ReasonExpired},
+				{Key: "key2", Value: "value2", Reason: evict.ReasonExpired},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []evict.Event
+			var cache *Cache
+			cache = NewCache(2, WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+				// 在锁外调用，可以再次访问缓存
+				_ = cache.Get(context.Background(), evt.Key)
+				events = append(events, evt)
+			})))
+			tc.before(cache)
+			assert.Equal(t, tc.wantEvents, events)
+		})
+	}
+}
+
+func TestCache_maxBytes(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	cache := NewCache(100, WithMaxBytes(20), WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+		events = append(events, evt)
+	})))
+	assert.Equal(t, int64(0), cache.Bytes())
+	// 每个键值对 4 + 4 = 8 字节
+	require.NoError(t, cache.Set(ctx, "key1", "val1", time.Minute))
+	require.NoError(t, cache.Set(ctx, "key2", "val2", time.Minute))
+	require.NoError(t, cache.Get(ctx, "key1").Err)
+	require.NoError(t, cache.Set(ctx, "key3", "val3", time.Minute))
+	assert.Equal(t, int64(16), cache.Bytes())
+	assert.Equal(t, errs.ErrKeyNotExist, cache.Get(ctx, "key2").Err)
+
+	// 覆盖之后变大，淘汰最久没有访问的 key
+	require.NoError(t, cache.Set(ctx, "key3", "value3-longer", time.Minute))
+	assert.Equal(t, int64(17), cache.Bytes())
+	assert.Equal(t, errs.ErrKeyNotExist, cache.Get(ctx, "key1").Err)
+
+	// 集合原地修改之后重新计算大小
+	_, err := cache.Delete(ctx, "key3")
+	require.NoError(t, err)
+	_, err = cache.SAdd(ctx, "set", "a", "b", "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), cache.Bytes())
+	_, err = cache.SRem(ctx, "set", "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), cache.Bytes())
+
+	// 单个超过上限的值会独占整个缓存
+	require.NoError(t, cache.Set(ctx, "large", "0123456789abcdefghijklmn", time.Minute))
+	assert.Equal(t, int64(29), cache.Bytes())
+	assert.Equal(t, errs.ErrKeyNotExist, cache.Get(ctx, "set").Err)
+	cache.store.View(func(core *memory.Core) {
+		assert.Equal(t, 1, core.Len())
+	})
+
+	assert.Equal(t, []evict.Event{
+		{Key: "key2", Value: "val2", Reason: evict.ReasonCapacity},
+		{Key: "key3", Value: "val3", Reason: evict.ReasonReplaced},
+		{Key: "key1", Value: "val1", Reason: evict.ReasonCapacity},
+		{Key: "key3", Value: "value3-longer", Reason: evict.ReasonDeleted},
+		{Key: "set", Value: events[4].Value, Reason: evict.ReasonCapacity},
+	}, events)
+}
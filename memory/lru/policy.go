@@ -0,0 +1,62 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/internal/linkedlist"
+)
+
+var _ memory.EvictionPolicy = (*Policy)(nil)
+
+// Policy LRU 淘汰策略，和 memory.NewStore 一起使用
+// 越靠近队头越是最近访问的，淘汰的时候取队尾
+type Policy struct {
+	data map[string]*linkedlist.Element[string]
+	list *linkedlist.List[string]
+}
+
+func NewPolicy() *Policy {
+	return &Policy{
+		data: make(map[string]*linkedlist.Element[string]),
+		list: linkedlist.New[string](),
+	}
+}
+
+func (p *Policy) OnInsert(key string) {
+	p.data[key] = p.list.PushFront(key)
+}
+
+func (p *Policy) OnAccess(key string) {
+	if elem, ok := p.data[key]; ok {
+		p.list.MoveToFront(elem)
+	}
+}
+
+func (p *Policy) OnRemove(key string, _ evict.Reason) {
+	if elem, ok := p.data[key]; ok {
+		p.list.Remove(elem)
+		delete(p.data, key)
+	}
+}
+
+func (p *Policy) Victim() (string, bool) {
+	elem := p.list.Back()
+	if elem == nil {
+		return "", false
+	}
+	return elem.Value, true
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	p := NewPolicy()
+	s := memory.NewStore(3, p, memory.WithEvictListener(
+		evict.ListenerFunc(func(evt evict.Event) {
+			events = append(events, evt)
+		})))
+	defer s.Close()
+	require.NoError(t, s.Set(ctx, "key1", "value1", 0))
+	require.NoError(t, s.Set(ctx, "key2", "value2", 0))
+	require.NoError(t, s.Set(ctx, "key3", "value3", 0))
+	require.NoError(t, s.Get(ctx, "key1").Err)
+
+	require.NoError(t, s.Set(ctx, "key4", "value4", 0))
+	assert.Error(t, s.Get(ctx, "key2").Err)
+	require.NoError(t, s.Set(ctx, "key3", "value5", 0))
+	require.NoError(t, s.Set(ctx, "key5", "value5", 0))
+	assert.Error(t, s.Get(ctx, "key1").Err)
+
+	assert.Equal(t, []evict.Event{
+		{Key: "key2", Value: "value2", Reason: evict.ReasonCapacity},
+		{Key: "key3", Value: "value3", Reason: evict.ReasonReplaced},
+		{Key: "key1", Value: "value1", Reason: evict.ReasonCapacity},
+	}, events)
+	var keys []string
+	for elem := p.list.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value)
+	}
+	assert.Equal(t, []string{"key5", "key3", "key4"}, keys)
+	assert.Equal(t, 3, len(p.data))
+}
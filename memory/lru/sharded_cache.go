@@ -0,0 +1,133 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"context"
+	"hash/maphash"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+)
+
+var (
+	_ ecache.Cache = (*ShardedCache)(nil)
+)
+
+// ShardedCache 把 key 哈希到多个相互独立的 Cache 上
+// 每个分片有自己的锁、容量和过期清理，不同分片上的操作不会互相阻塞。
+// 淘汰是在分片内部进行的，所以整体上是近似 LRU
+type ShardedCache struct {
+	seed   maphash.Seed
+	mask   uint64
+	shards []*Cache
+}
+
+// NewShardedCache 创建一个分片的 LRU 缓存
+// shards 会被向上取整到 2 的幂，capacity 是总容量，尽量平均地分给每一个分片，所有分片的容量加起来正好是 capacity。
+// capacity 比分片数量还小的时候会减少分片，保证每个分片至少能容纳一个 key。
+// options 会作用到每一个分片上
+func NewShardedCache(shards int, capacity int, options ...Option) *ShardedCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	n := 1
+	for n < shards && n*2 <= capacity {
+		n <<= 1
+	}
+	res := &ShardedCache{
+		seed:   maphash.MakeSeed(),
+		mask:   uint64(n - 1),
+		shards: make([]*Cache, n),
+	}
+	for i := range res.shards {
+		shardCapacity := capacity / n
+		if i < capacity%n {
+			shardCapacity++
+		}
+		res.shards[i] = NewCache(shardCapacity, options...)
+	}
+	return res
+}
+
+// Close 关闭所有的分片，停止它们的过期清理
+func (s *ShardedCache) Close() error {
+	for _, shard := range s.shards {
+		if err := shard.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ShardedCache) shard(key string) *Cache {
+	return s.shards[maphash.String(s.seed, key)&s.mask]
+}
+
+func (s *ShardedCache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
+	return s.shard(key).Set(ctx, key, val, expiration)
+}
+
+func (s *ShardedCache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	return s.shard(key).SetNX(ctx, key, val, expiration)
+}
+
+func (s *ShardedCache) Get(ctx context.Context, key string) ecache.Value {
+	return s.shard(key).Get(ctx, key)
+}
+
+func (s *ShardedCache) GetSet(ctx context.Context, key string, val string) ecache.Value {
+	return s.shard(key).GetSet(ctx, key, val)
+}
+
+func (s *ShardedCache) Delete(ctx context.Context, key ...string) (int64, error) {
+	var n int64
+	for _, k := range key {
+		cnt, err := s.shard(k).Delete(ctx, k)
+		n += cnt
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (s *ShardedCache) LPush(ctx context.Context, key string, val ...any) (int64, error) {
+	return s.shard(key).LPush(ctx, key, val...)
+}
+
+func (s *ShardedCache) LPop(ctx context.Context, key string) ecache.Value {
+	return s.shard(key).LPop(ctx, key)
+}
+
+func (s *ShardedCache) SAdd(ctx context.Context, key string, members ...any) (int64, error) {
+	return s.shard(key).SAdd(ctx, key, members...)
+}
+
+func (s *ShardedCache) SRem(ctx context.Context, key string, members ...any) (int64, error) {
+	return s.shard(key).SRem(ctx, key, members...)
+}
+
+func (s *ShardedCache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	return s.shard(key).IncrBy(ctx, key, value)
+}
+
+func (s *ShardedCache) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
+	return s.shard(key).DecrBy(ctx, key, value)
+}
+
+func (s *ShardedCache) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
+	return s.shard(key).IncrByFloat(ctx, key, value)
+}
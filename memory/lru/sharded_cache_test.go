@@ -0,0 +1,193 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewShardedCache(t *testing.T) {
+	testCases := []struct {
+		name           string
+		shards         int
+		capacity       int
+		wantCapacities []int
+	}{
+		{
+			name:           "power of two",
+			shards:         4,
+			capacity:       100,
+			wantCapacities: []int{25, 25, 25, 25},
+		},
+		{
+			name:           "round up shards",
+			shards:         5,
+			capacity:       100,
+			wantCapacities: []int{13, 13, 13, 13, 12, 12, 12, 12},
+		},
+		{
+			name:           "single shard",
+			shards:         0,
+			capacity:       10,
+			wantCapacities: []int{10},
+		},
+		{
+			name:           "capacity less than shards",
+			shards:         8,
+			capacity:       3,
+			wantCapacities: []int{2, 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewShardedCache(tc.shards, tc.capacity)
+			defer c.Close()
+			capacities := make([]int, 0, len(c.shards))
+			for _, shard := range c.shards {
+				capacities = append(capacities, shard.capacity)
+			}
+			assert.Equal(t, tc.wantCapacities, capacities)
+		})
+	}
+}
+
+func TestShardedCache_Close(t *testing.T) {
+	c := NewShardedCache(4, 100)
+	require.NoError(t, c.Close())
+	// 重复调用也没有问题，关闭之后仍然可以读写
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Set(context.Background(), "key1", "value1", time.Minute))
+	assert.Equal(t, "value1", c.Get(context.Background(), "key1").Val)
+}
+
+func TestShardedCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewShardedCache(4, 1000)
+	defer c.Close()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), i, time.Minute))
+	}
+	for i := 0; i < 100; i++ {
+		val, err := c.Get(ctx, fmt.Sprintf("key%d", i)).Int()
+		require.NoError(t, err)
+		assert.Equal(t, i, val)
+	}
+	keys := make([]string, 0, 101)
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+	}
+	keys = append(keys, "not exist")
+	n, err := c.Delete(ctx, keys...)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), n)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key1").Err)
+
+	ok, err := c.SetNX(ctx, "nx", "value1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.SetNX(ctx, "nx", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	old := c.GetSet(ctx, "nx", "value3")
+	assert.Equal(t, "value1", old.Val)
+
+	cnt, err := c.LPush(ctx, "list", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+	assert.Equal(t, "a", c.LPop(ctx, "list").Val)
+
+	cnt, err = c.SAdd(ctx, "set", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+	cnt, err = c.SRem(ctx, "set", "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	cnt, err = c.IncrBy(ctx, "counter", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), cnt)
+	cnt, err = c.DecrBy(ctx, "counter", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+	f, err := c.IncrByFloat(ctx, "float", 1.5)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, f)
+}
+
+func benchmarkParallelGet(b *testing.B, c ecache.Cache) {
+	ctx := context.Background()
+	const keys = 1024
+	for i := 0; i < keys; i++ {
+		_ = c.Set(ctx, strconv.Itoa(i), i, time.Hour)
+	}
+	var seq atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seq.Add(1))
+		for pb.Next() {
+			_ = c.Get(ctx, strconv.Itoa(i%keys))
+			i++
+		}
+	})
+}
+
+func benchmarkParallelSet(b *testing.B, c ecache.Cache) {
+	ctx := context.Background()
+	var seq atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seq.Add(1)) << 20
+		for pb.Next() {
+			_ = c.Set(ctx, strconv.Itoa(i), i, time.Hour)
+			i++
+		}
+	})
+}
+
+func BenchmarkCache_Get_Parallel(b *testing.B) {
+	benchmarkParallelGet(b, NewCache(4096))
+}
+
+func BenchmarkShardedCache_Get_Parallel(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			benchmarkParallelGet(b, NewShardedCache(shards, 4096))
+		})
+	}
+}
+
+func BenchmarkCache_Set_Parallel(b *testing.B) {
+	benchmarkParallelSet(b, NewCache(4096))
+}
+
+func BenchmarkShardedCache_Set_Parallel(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			benchmarkParallelSet(b, NewShardedCache(shards, 4096))
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"io"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/snapshot"
+	"github.com/ecodeclub/ekit/list"
+	"github.com/ecodeclub/ekit/set"
+)
+
+// WithCodec 设置 Snapshot 和 Restore 编码值使用的 Codec，默认是 snapshot.GobCodec
+func WithCodec(codec snapshot.Codec) Option {
+	return func(l *Cache) {
+		l.codec = codec
+	}
+}
+
+// Snapshot 把没有过期的键值对按照从最久没有访问到最近访问的顺序写入 w
+// 持有锁的时候只复制键值对，编码和写入都在锁外进行
+func (c *Cache) Snapshot(w io.Writer) error {
+	var entries []snapshot.Entry
+	c.store.View(func(core *memory.Core) {
+		entries = make([]snapshot.Entry, 0, core.Len())
+		for elem := c.policy.list.Back(); elem != nil; elem = elem.Prev() {
+			ent, ok := core.Lookup(elem.Value)
+			if !ok {
+				continue
+			}
+			e := snapshot.Entry{Key: ent.Key, ExpiresAt: ent.ExpiresAt}
+			e.Kind, e.Value = c.snapshotValue(ent.Value)
+			entries = append(entries, e)
+		}
+	})
+
+	sw, err := snapshot.NewWriter(w, c.codec)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = sw.Write(e); err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
+
+// snapshotValue 列表和集合复制成 []any，避免在锁外访问
+func (c *Cache) snapshotValue(val any) (snapshot.Kind, any) {
+	switch v := val.(type) {
+	case list.List[ecache.Value]:
+		values := v.AsSlice()
+		elems := make([]any, len(values))
+		for i, value := range values {
+			elems[i] = value.Val
+		}
+		return snapshot.KindList, elems
+	case set.Set[any]:
+		return snapshot.KindSet, v.Keys()
+	default:
+		return snapshot.KindOf(val), val
+	}
+}
+
+// Restore 读取 Snapshot 写入的键值对，覆盖已经存在的 key，恢复之后的访问顺序和快照一致
+// 已经过期的键值对会被跳过，快照损坏的时候返回错误并且不会修改缓存
+func (c *Cache) Restore(r io.Reader) error {
+	entries, err := snapshot.ReadAll(r, c.codec, time.Now())
+	if err != nil {
+		return err
+	}
+	c.store.Do(func(core *memory.Core) {
+		for _, e := range entries {
+			core.SetDeadline(e.Key, c.restoreValue(e), e.ExpiresAt)
+		}
+	})
+	return nil
+}
+
+func (c *Cache) restoreValue(e snapshot.Entry) any {
+	switch e.Kind {
+	case snapshot.KindList:
+		return &list.ConcurrentList[ecache.Value]{
+			List: list.NewLinkedListOf[ecache.Value](c.anySliceToValueSlice(e.Value.([]any)...)),
+		}
+	case snapshot.KindSet:
+		elems := e.Value.([]any)
+		s := set.NewMapSet[any](len(elems))
+		for _, elem := range elems {
+			s.Add(elem)
+		}
+		return s
+	default:
+		return e.Value
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/memory/snapshot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type snapshotStruct struct {
+	Name string
+}
+
+func init() {
+	gob.Register(snapshotStruct{})
+}
+
+func TestCache_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(100)
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	require.NoError(t, c.Set(ctx, "expired", "value", time.Millisecond))
+	require.NoError(t, c.Set(ctx, "struct", snapshotStruct{Name: "name"}, time.Minute))
+	_, err := c.LPush(ctx, "list", "a", "b")
+	require.NoError(t, err)
+	_, err = c.SAdd(ctx, "set", "a", 1)
+	require.NoError(t, err)
+	_, err = c.IncrBy(ctx, "int", 3)
+	require.NoError(t, err)
+	_, err = c.IncrByFloat(ctx, "float", 1.5)
+	require.NoError(t, err)
+	require.NoError(t, c.Get(ctx, "key1").Err)
+	time.Sleep(2 * time.Millisecond)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Snapshot(&buf))
+
+	restored := NewCache(100)
+	require.NoError(t, restored.Set(ctx, "key1", "old", time.Minute))
+	require.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+
+	assert.Equal(t, "value1", restored.Get(ctx, "key1").Val)
+	assert.Equal(t, snapshotStruct{Name: "name"}, restored.Get(ctx, "struct").Val)
+	assert.Error(t, restored.Get(ctx, "expired").Err)
+	assert.Equal(t, "a", restored.LPop(ctx, "list").Val)
+	n, err := restored.SRem(ctx, "set", "a", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	num, err := restored.IncrBy(ctx, "int", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), num)
+	f, err := restored.IncrByFloat(ctx, "float", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+}
+
+func TestCache_Restore_order(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(100)
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		require.NoError(t, c.Set(ctx, key, key, time.Minute))
+	}
+	require.NoError(t, c.Get(ctx, "key1").Err)
+	require.NoError(t, c.Get(ctx, "key3").Err)
+	var buf bytes.Buffer
+	require.NoError(t, c.Snapshot(&buf))
+
+	// 容量不够的时候先淘汰最久没有访问的
+	restored := NewCache(3)
+	require.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+	var keys []string
+	for elem := restored.policy.list.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value)
+	}
+	assert.Equal(t, []string{"key3", "key1", "key4"}, keys)
+}
+
+func TestCache_Restore_invalid(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(100)
+	require.NoError(t, c.Set(ctx, "key1", "value1", time.Minute))
+	var buf bytes.Buffer
+	require.NoError(t, c.Snapshot(&buf))
+	data := buf.Bytes()
+
+	restored := NewCache(100)
+	err := restored.Restore(bytes.NewReader(data[:len(data)-1]))
+	assert.ErrorIs(t, err, snapshot.ErrInvalidSnapshot)
+	assert.Error(t, restored.Get(ctx, "key1").Err)
+}
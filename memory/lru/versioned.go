@@ -0,0 +1,76 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"context"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/internal/datatype"
+)
+
+var _ ecache.CASCache = (*Cache)(nil)
+
+// CompareAndSwap 当前的值等于 oldVal 的时候写入 newVal，在锁里面完成比较和写入
+func (c *Cache) CompareAndSwap(_ context.Context, key string, oldVal, newVal any, expiration time.Duration) (err error) {
+	c.store.Do(func(core *memory.Core) {
+		cur, ok := core.Get(key)
+		if !ok {
+			err = errs.ErrKeyNotExist
+			return
+		}
+		if !datatype.Equal(cur, oldVal) {
+			err = &ecache.ConflictError{Key: key}
+			return
+		}
+		core.Set(key, newVal, expiration)
+	})
+	return
+}
+
+func (c *Cache) GetWithVersion(_ context.Context, key string) (res ecache.VersionedValue) {
+	c.store.Do(func(core *memory.Core) {
+		var ok bool
+		res.Val, ok = core.Get(key)
+		if !ok {
+			res.Err = errs.ErrKeyNotExist
+			return
+		}
+		ent, _ := core.Lookup(key)
+		res.Version = ent.Version
+	})
+	return
+}
+
+func (c *Cache) SetIfVersion(_ context.Context, key string, val any, version int64, expiration time.Duration) (res int64, err error) {
+	c.store.Do(func(core *memory.Core) {
+		var cur int64
+		if _, ok := core.Get(key); ok {
+			ent, _ := core.Lookup(key)
+			cur = ent.Version
+		}
+		if cur != version {
+			err = &ecache.ConflictError{Key: key, Version: cur}
+			return
+		}
+		core.Set(key, val, expiration)
+		ent, _ := core.Lookup(key)
+		res = ent.Version
+	})
+	return
+}
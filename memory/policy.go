@@ -0,0 +1,66 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory 提供淘汰策略可以插拔的本地缓存
+// 存储、过期时间和各种数据类型的操作都由 Store 负责，淘汰策略只需要实现 EvictionPolicy
+package memory
+
+import (
+	"time"
+
+	"github.com/ecodeclub/ecache/memory/evict"
+)
+
+// EvictionPolicy 淘汰策略，只需要维护 key 的顺序，不需要关心值和过期时间
+// Store 会在持有写锁的时候调用这些方法，所以实现不需要考虑并发安全
+type EvictionPolicy interface {
+	// OnInsert 一个新的 key 写入了缓存
+	OnInsert(key string)
+	// OnAccess 一个已经存在的 key 被读取或者被覆盖
+	OnAccess(key string)
+	// OnRemove key 离开了缓存，reason 是离开的原因
+	OnRemove(key string, reason evict.Reason)
+	// Victim 缓存满了的时候，在写入新的 key 之前选出应该被淘汰的 key，没有可以淘汰的 key 的时候返回 false
+	// Victim 只负责选择，Store 随后会调用 OnRemove 把它移除
+	Victim() (string, bool)
+}
+
+// ConcurrentAccessPolicy OnAccess 可以在只持有读锁的时候被并发调用的淘汰策略
+// Store 发现淘汰策略实现了这个接口之后，Get 只会加读锁
+type ConcurrentAccessPolicy interface {
+	EvictionPolicy
+	// ConcurrentAccess 只是一个标记，不会被调用
+	ConcurrentAccess()
+}
+
+// EntryPolicy 需要知道值、有效期和大小才能决定淘汰顺序的淘汰策略，比如按照优先级淘汰
+// 实现了这个接口的淘汰策略，Core 总是会计算键值对的大小
+type EntryPolicy interface {
+	EvictionPolicy
+	// OnUpdate key 被写入、覆盖或者值被原地修改之后调用，ent 是修改之后的键值对
+	OnUpdate(ent Entry)
+	// Expired 返回一个在 now 时刻已经过期的 key，没有的话返回 false
+	// Core 清理过期的 key 的时候用它代替随机抽样
+	Expired(now time.Time) (string, bool)
+	// VictimExcept 和 Victim 一样，但是不会选中 key
+	// 字节数超出上限的时候，Core 用它淘汰正在修改的 key 以外的 key
+	VictimExcept(key string) (string, bool)
+}
+
+// CapacityPolicy 需要知道 Store 的容量的淘汰策略，比如按照容量划分分段
+// NewStore 发现淘汰策略实现了这个接口之后，会在写入任何 key 之前用 Store 的容量调用一次 SetCapacity
+type CapacityPolicy interface {
+	EvictionPolicy
+	SetCapacity(capacity int)
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expirationHeap 按照有效期排序的小顶堆，堆顶是最早过期的缓存结点
+// 永不过期的结点不会进入这个堆
+// 结点自己记录在堆中的下标，所以删除和调整都是 O(log n)
+type expirationHeap struct {
+	nodes []*rbTreeCacheNode
+}
+
+func newExpirationHeap(capacity int) *expirationHeap {
+	return &expirationHeap{
+		nodes: make([]*rbTreeCacheNode, 0, capacity),
+	}
+}
+
+func (h *expirationHeap) Len() int {
+	return len(h.nodes)
+}
+
+func (h *expirationHeap) Less(i, j int) bool {
+	return h.nodes[i].deadline.Before(h.nodes[j].deadline)
+}
+
+func (h *expirationHeap) Swap(i, j int) {
+	h.nodes[i], h.nodes[j] = h.nodes[j], h.nodes[i]
+	h.nodes[i].expirationIndex = i
+	h.nodes[j].expirationIndex = j
+}
+
+func (h *expirationHeap) Push(x any) {
+	node := x.(*rbTreeCacheNode)
+	node.expirationIndex = len(h.nodes)
+	h.nodes = append(h.nodes, node)
+}
+
+func (h *expirationHeap) Pop() any {
+	n := len(h.nodes)
+	node := h.nodes[n-1]
+	h.nodes[n-1] = nil
+	h.nodes = h.nodes[:n-1]
+	node.expirationIndex = -1
+	return node
+}
+
+// peek 查看最早过期的结点，堆为空时返回 nil
+func (h *expirationHeap) peek() *rbTreeCacheNode {
+	if len(h.nodes) == 0 {
+		return nil
+	}
+	return h.nodes[0]
+}
+
+// update 根据结点当前的有效期调整它在堆中的位置
+// 有效期被清零的结点会从堆中移除，新设置了有效期的结点会被加入堆
+func (h *expirationHeap) update(node *rbTreeCacheNode) {
+	inHeap := node.expirationIndex >= 0
+	switch {
+	case node.deadline.IsZero() && inHeap:
+		heap.Remove(h, node.expirationIndex)
+	case node.deadline.IsZero():
+	case inHeap:
+		heap.Fix(h, node.expirationIndex)
+	default:
+		heap.Push(h, node)
+	}
+}
+
+// remove 把结点从堆中移除，结点不在堆中时什么都不做
+func (h *expirationHeap) remove(node *rbTreeCacheNode) {
+	if node.expirationIndex >= 0 {
+		heap.Remove(h, node.expirationIndex)
+	}
+}
+
+// popExpired 弹出一个在 now 时刻已经过期的结点，没有的话返回 nil
+func (h *expirationHeap) popExpired(now time.Time) *rbTreeCacheNode {
+	top := h.peek()
+	if top == nil || top.beforeDeadline(now) {
+		return nil
+	}
+	return heap.Pop(h).(*rbTreeCacheNode)
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"context"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/memory/internal/datatype"
+	"github.com/ecodeclub/ecache/memory/internal/pipeline"
+)
+
+var (
+	_ ecache.PipelineCache = (*RBTreePriorityCache)(nil)
+	_ ecache.Cache         = locked{}
+)
+
+// Pipeline 内存缓存没有网络开销，在一次加锁里面执行所有的命令，某个命令失败不会影响其它的命令
+func (r *RBTreePriorityCache) Pipeline(ctx context.Context, fn func(p ecache.Pipeliner) error) ([]ecache.Value, error) {
+	q := &pipeline.Queue{}
+	if err := fn(q); err != nil {
+		return nil, err
+	}
+	var res []ecache.Value
+	r.do(func(l locked) {
+		res = q.Exec(ctx, l)
+	})
+	return res, nil
+}
+
+// TxPipeline 回调返回之后在一次加锁里面执行所有的命令，其它的操作只能看到全部命令执行之前或者之后的状态
+// 回调返回错误的时候不会执行任何命令；某个命令失败的时候回滚所有的命令，返回每个命令的结果和这个命令的错误，
+// key 不存在不算失败
+func (r *RBTreePriorityCache) TxPipeline(ctx context.Context, fn func(p ecache.Pipeliner) error) ([]ecache.Value, error) {
+	q := &pipeline.Queue{}
+	if err := fn(q); err != nil {
+		return nil, err
+	}
+	var (
+		res []ecache.Value
+		err error
+	)
+	r.do(func(l locked) {
+		l.core.Begin(datatype.Clone)
+		res = q.Exec(ctx, l)
+		if err = pipeline.Err(res); err != nil {
+			l.core.Rollback()
+			return
+		}
+		l.core.Commit()
+	})
+	return res, err
+}
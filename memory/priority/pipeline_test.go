@@ -0,0 +1,164 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	c, err := NewRBTreePriorityCache()
+	require.NoError(t, err)
+	ctx := context.Background()
+	res, err := c.Pipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Set("key", "value", time.Minute)
+		p.SetNX("key", "other", time.Minute)
+		p.Get("key")
+		p.GetSet("key", "new")
+		p.Get("missing")
+		p.IncrBy("num", 2)
+		p.DecrBy("num", 1)
+		p.SAdd("set", "a", "b")
+		p.SRem("set", "a")
+		// 字符串不能自增，错误只影响这一个命令
+		p.IncrBy("key", 1)
+		p.Delete("key", "num")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 11)
+	want := []any{nil, false, "value", "value", nil, int64(2), int64(1), nil, int64(1), nil, int64(2)}
+	for i, val := range res {
+		switch i {
+		case 4:
+			assert.Equal(t, errs.ErrKeyNotExist, val.Err)
+		case 7:
+			// 两种缓存的 SAdd 返回值的含义不同，这里只检查没有出错
+			assert.NoError(t, val.Err)
+		case 9:
+			assert.Error(t, val.Err)
+		default:
+			require.NoError(t, val.Err, i)
+			assert.Equal(t, want[i], val.Val, i)
+		}
+	}
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key").Err)
+}
+
+func TestTxPipeline_callbackError(t *testing.T) {
+	c, err := NewRBTreePriorityCache()
+	require.NoError(t, err)
+	ctx := context.Background()
+	failed := errors.New("failed")
+	res, err := c.TxPipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Set("key", "value", time.Minute)
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	assert.Nil(t, res)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key").Err)
+}
+
+// TestTxPipeline_atomic 其它的操作看不到执行到一半的状态
+func TestTxPipeline_atomic(t *testing.T) {
+	c, err := NewRBTreePriorityCache()
+	require.NoError(t, err)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_, err := c.TxPipeline(ctx, func(p ecache.Pipeliner) error {
+					p.IncrBy("a", 1)
+					p.IncrBy("b", 1)
+					return nil
+				})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		res, err := c.TxPipeline(ctx, func(p ecache.Pipeliner) error {
+			p.Get("a")
+			p.Get("b")
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, res[0].Val, res[1].Val)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(800), c.Get(ctx, "a").Val)
+}
+
+// TestTxPipeline_rollback 某个命令失败的时候所有的命令都不生效，包括因为容量被淘汰的 key
+func TestTxPipeline_rollback(t *testing.T) {
+	var evicted []string
+	listener := evict.ListenerFunc(func(evt evict.Event) {
+		evicted = append(evicted, evt.Key)
+	})
+	c, err := NewRBTreePriorityCache(WithCacheLimit(4), WithEvictListener(listener))
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "key", "value", time.Minute))
+	require.NoError(t, c.Set(ctx, "num", int64(1), 0))
+	_, err = c.LPush(ctx, "list", "a")
+	require.NoError(t, err)
+	_, err = c.SAdd(ctx, "set", "a")
+	require.NoError(t, err)
+
+	res, err := c.TxPipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Set("key", "new", 0)
+		p.Delete("num")
+		p.LPush("list", "b")
+		p.SAdd("set", "b")
+		p.Set("added", "value", 0)
+		p.Get("missing")
+		// 字符串不能自增
+		p.IncrBy("key", 1)
+		return nil
+	})
+	require.Len(t, res, 7)
+	assert.ErrorIs(t, err, res[6].Err)
+	assert.Equal(t, errs.ErrKeyNotExist, res[5].Err)
+	assert.Empty(t, evicted)
+
+	assert.Equal(t, "value", c.Get(ctx, "key").Val)
+	assert.Equal(t, int64(1), c.Get(ctx, "num").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "added").Err)
+	assert.Equal(t, 1, c.Get(ctx, "list").Val.(interface{ Len() int }).Len())
+	n, err := c.SRem(ctx, "set", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// 回滚之后可以继续正常使用
+	_, err = c.TxPipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Set("key", "new", 0)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new", c.Get(ctx, "key").Val)
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ekit/tree"
+)
+
+var _ memory.EntryPolicy = (*policy)(nil)
+
+// policy 按照优先级淘汰数据的 memory.EntryPolicy
+// 优先级和淘汰分数依赖值、有效期和大小，所以每个 key 都有一个缓存结点保存这些元数据，
+// 键值对本身保存在 memory.Core 里面，Core 会在持有锁的时候调用这些方法
+type policy struct {
+	cacheData       *tree.RBTree[string, *rbTreeCacheNode] //缓存结点，和 memory.Core 里面的键值对一一对应
+	priorityData    *priorityHeap                          //优先级数据，和缓存结点一一对应
+	expirationData  *expirationHeap                        //过期时间数据，只包含设置了有效期的结点
+	defaultPriority int                                    //默认优先级
+	accessSeq       uint64                                 //访问序号，每访问一次结点加一
+	scoreFunc       ScoreFunc                              //淘汰分数的计算方式，默认使用优先级
+	agingInterval   time.Duration                          //优先级衰减的间隔，默认0，不衰减
+}
+
+func newPolicy() *policy {
+	const priorityQueueDefaultSize = 8 //优先级队列的初始大小
+	rbTree, _ := tree.NewRBTree[string, *rbTreeCacheNode](comparatorRBTreeCacheNodeByKey())
+	return &policy{
+		cacheData:      rbTree,
+		priorityData:   newPriorityHeap(priorityQueueDefaultSize, comparatorRBTreeCacheNodeByPriority()),
+		expirationData: newExpirationHeap(priorityQueueDefaultSize),
+	}
+}
+
+// OnInsert 创建缓存结点，值、有效期和优先级在紧接着的 OnUpdate 里面设置
+func (p *policy) OnInsert(key string) {
+	node := newRBTreeCacheNode(key, nil)
+	_ = p.cacheData.Add(key, node) //这里的error理论上不会出现
+	if p.dynamicScore() {
+		node.createdAt = time.Now()
+	}
+	p.touchNode(node)
+}
+
+func (p *policy) OnAccess(key string) {
+	if node, err := p.cacheData.Find(key); err == nil {
+		p.touchNode(node)
+	}
+}
+
+func (p *policy) OnUpdate(ent memory.Entry) {
+	node, err := p.cacheData.Find(ent.Key)
+	if err != nil {
+		return
+	}
+	node.value = ent.Value
+	node.deadline = ent.ExpiresAt
+	node.size = ent.Size
+	p.updateNodePriority(node)
+	p.expirationData.update(node)
+}
+
+func (p *policy) OnRemove(key string, _ evict.Reason) {
+	node, err := p.cacheData.Find(key)
+	if err != nil {
+		return
+	}
+	p.cacheData.Delete(key)
+	p.expirationData.remove(node)
+	p.priorityData.remove(node)
+}
+
+// Victim 已经过期的结点优先，其次是淘汰分数最低的结点
+func (p *policy) Victim() (string, bool) {
+	if key, ok := p.Expired(time.Now()); ok {
+		return key, true
+	}
+	top := p.priorityData.peek()
+	if top == nil {
+		return "", false
+	}
+	return top.key, true
+}
+
+// VictimExcept 暂时把 key 对应的结点从优先级数据和过期时间数据里面拿出来，保证它不会被选中
+func (p *policy) VictimExcept(key string) (string, bool) {
+	node, err := p.cacheData.Find(key)
+	if err != nil {
+		return p.Victim()
+	}
+	p.priorityData.remove(node)
+	p.expirationData.remove(node)
+	victim, ok := p.Victim()
+	p.priorityData.push(node)
+	p.expirationData.update(node)
+	return victim, ok
+}
+
+func (p *policy) Expired(now time.Time) (string, bool) {
+	top := p.expirationData.peek()
+	if top == nil || top.beforeDeadline(now) {
+		return "", false
+	}
+	return top.key, true
+}
+
+// setPriority 设置 key 通过 ContextWithPriority 或者 SetPriority 指定的优先级，ok 为 false 表示清除
+func (p *policy) setPriority(key string, priority int, ok bool) {
+	node, err := p.cacheData.Find(key)
+	if err != nil {
+		return
+	}
+	node.customPriority, node.hasCustomPriority = priority, ok
+	p.updateNodePriority(node)
+}
+
+// calculatePriority 获取缓存数据的优先级权重
+// 依次使用指定的优先级、值实现的 Priority 接口和默认优先级
+func (p *policy) calculatePriority(node *rbTreeCacheNode) int {
+	if node.hasCustomPriority {
+		return node.customPriority
+	}
+	priority := p.defaultPriority
+
+	//如果实现了Priority接口，那么就用接口的方法获取优先级权重
+	val, ok := node.value.(Priority)
+	if ok {
+		priority = val.Priority()
+	}
+
+	return priority
+}
+
+// dynamicScore 淘汰分数是否会随着时间变化
+func (p *policy) dynamicScore() bool {
+	return p.scoreFunc != nil || p.agingInterval > 0
+}
+
+// calculateScore 计算缓存结点的淘汰分数，需要先计算好优先级
+func (p *policy) calculateScore(node *rbTreeCacheNode, now time.Time) float64 {
+	if !p.dynamicScore() {
+		return float64(node.priority)
+	}
+	priority := node.priority
+	idle := now.Sub(node.accessedAt)
+	if p.agingInterval > 0 {
+		priority -= int(idle / p.agingInterval)
+	}
+	if p.scoreFunc == nil {
+		return float64(priority)
+	}
+	var ttl time.Duration
+	if !node.deadline.IsZero() {
+		ttl = node.deadline.Sub(now)
+	}
+	return p.scoreFunc(NodeMeta{
+		Key:         node.key,
+		Priority:    priority,
+		TTL:         ttl,
+		Size:        node.size,
+		AccessCount: node.accessCount,
+		Age:         now.Sub(node.createdAt),
+		Idle:        idle,
+	})
+}
+
+// updateNodePriority 缓存结点的值发生变化后，重新计算优先级和淘汰分数并调整它在优先级数据中的位置
+// 新创建的结点在这里加入优先级数据
+func (p *policy) updateNodePriority(node *rbTreeCacheNode) {
+	node.priority = p.calculatePriority(node)
+	node.score = p.calculateScore(node, time.Now())
+	p.priorityData.push(node)
+}
+
+// rescore 重新计算所有结点的淘汰分数，让随着时间变化的分数生效
+func (p *policy) rescore(now time.Time) {
+	for _, node := range p.priorityData.nodes {
+		node.score = p.calculateScore(node, now)
+	}
+	heap.Init(p.priorityData)
+}
+
+// touchNode 记录结点最近一次被访问，优先级相同的时候最久没有被访问的结点先淘汰
+func (p *policy) touchNode(node *rbTreeCacheNode) {
+	p.accessSeq++
+	node.accessSeq = p.accessSeq
+	node.accessCount++
+	if p.dynamicScore() {
+		node.accessedAt = time.Now()
+		node.score = p.calculateScore(node, node.accessedAt)
+	}
+	p.priorityData.fix(node)
+}
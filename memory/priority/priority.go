@@ -14,8 +14,24 @@
 
 package priority
 
+import "context"
+
 // Priority 如果传进来的元素没有实现该接口，则默认优先级为0
 type Priority interface {
 	// Priority 获取元素的优先级
 	Priority() int
 }
+
+type priorityKey struct{}
+
+// ContextWithPriority 返回携带优先级的 context，RBTreePriorityCache 创建或者写入 key 的时候会使用这个优先级，
+// 它比值实现的 Priority 接口和 WithDefaultPriority 都要优先
+func ContextWithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priorityFromContext 取出 ContextWithPriority 设置的优先级
+func priorityFromContext(ctx context.Context) (int, bool) {
+	priority, ok := ctx.Value(priorityKey{}).(int)
+	return priority, ok
+}
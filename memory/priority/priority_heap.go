@@ -0,0 +1,104 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"container/heap"
+
+	"github.com/ecodeclub/ekit"
+)
+
+// priorityHeap 按照优先级排序的小顶堆，堆顶是最先被淘汰的缓存结点
+// 结点自己记录在堆中的下标，所以删除和调整优先级都是 O(log n)，
+// 堆中的结点数量和缓存中的结点数量始终一致
+type priorityHeap struct {
+	nodes   []*rbTreeCacheNode
+	compare ekit.Comparator[*rbTreeCacheNode]
+}
+
+func newPriorityHeap(capacity int, compare ekit.Comparator[*rbTreeCacheNode]) *priorityHeap {
+	return &priorityHeap{
+		nodes:   make([]*rbTreeCacheNode, 0, capacity),
+		compare: compare,
+	}
+}
+
+func (h *priorityHeap) Len() int {
+	return len(h.nodes)
+}
+
+func (h *priorityHeap) Less(i, j int) bool {
+	return h.compare(h.nodes[i], h.nodes[j]) < 0
+}
+
+func (h *priorityHeap) Swap(i, j int) {
+	h.nodes[i], h.nodes[j] = h.nodes[j], h.nodes[i]
+	h.nodes[i].priorityIndex = i
+	h.nodes[j].priorityIndex = j
+}
+
+func (h *priorityHeap) Push(x any) {
+	node := x.(*rbTreeCacheNode)
+	node.priorityIndex = len(h.nodes)
+	h.nodes = append(h.nodes, node)
+}
+
+func (h *priorityHeap) Pop() any {
+	n := len(h.nodes)
+	node := h.nodes[n-1]
+	h.nodes[n-1] = nil
+	h.nodes = h.nodes[:n-1]
+	node.priorityIndex = -1
+	return node
+}
+
+// peek 查看最先被淘汰的结点，堆为空时返回 nil
+func (h *priorityHeap) peek() *rbTreeCacheNode {
+	if len(h.nodes) == 0 {
+		return nil
+	}
+	return h.nodes[0]
+}
+
+// push 把结点加入堆，结点已经在堆中时调整它的位置
+func (h *priorityHeap) push(node *rbTreeCacheNode) {
+	if node.priorityIndex >= 0 {
+		heap.Fix(h, node.priorityIndex)
+		return
+	}
+	heap.Push(h, node)
+}
+
+// pop 弹出最先被淘汰的结点，堆为空时返回 nil
+func (h *priorityHeap) pop() *rbTreeCacheNode {
+	if len(h.nodes) == 0 {
+		return nil
+	}
+	return heap.Pop(h).(*rbTreeCacheNode)
+}
+
+// fix 结点的优先级发生变化后调整它在堆中的位置，结点不在堆中时什么都不做
+func (h *priorityHeap) fix(node *rbTreeCacheNode) {
+	if node.priorityIndex >= 0 {
+		heap.Fix(h, node.priorityIndex)
+	}
+}
+
+// remove 把结点从堆中移除，结点不在堆中时什么都不做
+func (h *priorityHeap) remove(node *rbTreeCacheNode) {
+	if node.priorityIndex >= 0 {
+		heap.Remove(h, node.priorityIndex)
+	}
+}
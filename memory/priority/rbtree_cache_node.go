@@ -25,18 +25,33 @@ import (
 
 // rbTreeCacheNode 缓存结点
 type rbTreeCacheNode struct {
-	key       string    //键
-	value     any       //值
-	deadline  time.Time //有效期，默认0，永不过期
-	priority  int       //优先级
-	isDeleted bool      //是否被删除
+	key             string    //键
+	value           any       //值
+	deadline        time.Time //有效期，默认0，永不过期
+	priority        int       //优先级
+	priorityIndex   int       //在优先级堆中的下标，-1 表示不在堆中
+	expirationIndex int       //在过期时间堆中的下标，-1 表示不在堆中
+	size            int64     //键值对占用的字节数，由 memory.Core 计算
+	accessSeq       uint64    //最近一次访问的序号，优先级相同的时候序号小的先淘汰
+	// customPriority 通过 ContextWithPriority 或者 SetPriority 指定的优先级，
+	// hasCustomPriority 为 true 的时候优先于 Priority 接口和默认优先级
+	customPriority    int
+	hasCustomPriority bool
+	// score 淘汰分数，没有设置 WithScoreFunc 的时候等于（衰减之后的）优先级
+	score       float64
+	accessCount uint64
+	// createdAt 和 accessedAt 只在设置了 WithScoreFunc 或者 WithPriorityAging 的时候记录
+	createdAt  time.Time
+	accessedAt time.Time
 }
 
 // newRBTreeCacheNode 创建红黑树节点，注意如果是容器类型节点要value传递初始化一个零值
 func newRBTreeCacheNode(key string, value any) *rbTreeCacheNode {
 	return &rbTreeCacheNode{
-		key:   key,
-		value: value,
+		key:             key,
+		value:           value,
+		priorityIndex:   -1,
+		expirationIndex: -1,
 	}
 }
 
@@ -85,13 +100,6 @@ func (node *rbTreeCacheNode) beforeDeadline(checkTime time.Time) bool {
 	return checkTime.Before(node.deadline)
 }
 
-// truncate 清空缓存结点中的数据
-func (node *rbTreeCacheNode) truncate() {
-	var nilValue any
-	node.value = nilValue
-	node.isDeleted = true
-}
-
 // comparatorRBTreeCacheNodeByKey 缓存结点根据key的比较方式（给红黑树用）
 func comparatorRBTreeCacheNodeByKey() ekit.Comparator[string] {
 	return func(src string, dst string) int {
@@ -105,12 +113,18 @@ func comparatorRBTreeCacheNodeByKey() ekit.Comparator[string] {
 	}
 }
 
-// comparatorRBTreeCacheNodeByPriority 缓存结点根据优先级的比较方式（给优先级队列用）
+// comparatorRBTreeCacheNodeByPriority 缓存结点根据淘汰分数的比较方式（给优先级队列用）
+// 分数相同的时候比较最近一次访问的序号，所以同一个优先级里面按照 LRU 淘汰
 func comparatorRBTreeCacheNodeByPriority() ekit.Comparator[*rbTreeCacheNode] {
 	return func(src *rbTreeCacheNode, dst *rbTreeCacheNode) int {
-		if src.priority < dst.priority {
+		if src.score < dst.score {
+			return -1
+		} else if src.score > dst.score {
+			return 1
+		}
+		if src.accessSeq < dst.accessSeq {
 			return -1
-		} else if src.priority == dst.priority {
+		} else if src.accessSeq == dst.accessSeq {
 			return 0
 		} else {
 			return 1
@@ -21,14 +21,14 @@ import (
 	"sync"
 	"time"
 
-	"github.com/ecodeclub/ekit/queue"
-
 	"github.com/ecodeclub/ecache"
 	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/snapshot"
 	"github.com/ecodeclub/ekit/bean/option"
 	"github.com/ecodeclub/ekit/list"
 	"github.com/ecodeclub/ekit/set"
-	"github.com/ecodeclub/ekit/tree"
 )
 
 var (
@@ -40,16 +40,37 @@ var (
 	errOnlyNumCanDecrBy = errors.New("ecache: 只有数字类型的数据，才能执行 DecrBy")
 )
 
+// RBTreePriorityCache 按照优先级淘汰数据的本地缓存
+// 存储、过期时间和字节数统计都交给 memory.Store，淘汰的顺序由 policy 决定
 type RBTreePriorityCache struct {
-	globalLock      *sync.RWMutex                          //内部全局读写锁，保护缓存数据和优先级数据
-	cacheData       *tree.RBTree[string, *rbTreeCacheNode] //缓存数据
-	cacheNum        int                                    //缓存中总键值对数量
-	cacheLimit      int                                    //键值对数量限制，默认MaxInt32，约等于没有限制
-	priorityData    *queue.PriorityQueue[*rbTreeCacheNode] //优先级数据
-	defaultPriority int                                    //默认优先级
-	cleanInterval   time.Duration
+	store         *memory.Store
+	policy        *policy
+	cacheLimit    int   //键值对数量限制，默认MaxInt32，约等于没有限制
+	maxBytes      int64 //键值对占用的字节数限制，默认0，不限制
+	cleanInterval time.Duration
 	// 集合类型的值的初始化容量
 	collectionCap int
+	// cleanStats 过期清理的统计数据，受 store 的锁保护
+	cleanStats CleanStats
+	listener   evict.Listener
+	// codec Snapshot 和 Restore 使用的 Codec
+	codec     snapshot.Codec
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// CleanStats 过期自动清理的统计数据
+type CleanStats struct {
+	// Runs 清理执行的总次数
+	Runs int64
+	// Expired 累计清理掉的过期键值对数量
+	Expired int64
+	// LastExpired 最近一次清理掉的过期键值对数量
+	LastExpired int
+	// LastCleanAt 最近一次清理的开始时间
+	LastCleanAt time.Time
+	// LastDuration 最近一次清理的耗时
+	LastDuration time.Duration
 }
 
 func NewRBTreePriorityCache(opts ...option.Option[RBTreePriorityCache]) (*RBTreePriorityCache, error) {
@@ -59,25 +80,26 @@ func NewRBTreePriorityCache(opts ...option.Option[RBTreePriorityCache]) (*RBTree
 }
 
 func newRBTreePriorityCache(opts ...option.Option[RBTreePriorityCache]) (*RBTreePriorityCache, error) {
-	rbTree, _ := tree.NewRBTree[string, *rbTreeCacheNode](comparatorRBTreeCacheNodeByKey())
-
-	const (
-		priorityQueueDefaultSize = 8 //优先级队列的初始大小
-		collectionDefaultCap     = 8 //缓存结点中set.MapSet的初始大小
-	)
-	priorityQueue := queue.NewPriorityQueue[*rbTreeCacheNode](priorityQueueDefaultSize, comparatorRBTreeCacheNodeByPriority())
+	const collectionDefaultCap = 8 //缓存结点中set.MapSet的初始大小
 	cache := &RBTreePriorityCache{
-		globalLock:   &sync.RWMutex{},
-		cacheData:    rbTree,
-		cacheNum:     0,
-		cacheLimit:   math.MaxInt32,
-		priorityData: priorityQueue,
+		policy:     newPolicy(),
+		cacheLimit: math.MaxInt32,
 		// 暂时设置为一秒间隔
 		cleanInterval: time.Second,
 		collectionCap: collectionDefaultCap,
+		done:          make(chan struct{}),
 	}
 	option.Apply(cache, opts...)
 
+	// 过期清理还要记录统计数据和重新计算淘汰分数，所以由 autoClean 负责，关闭 Store 自己的清理
+	storeOpts := []option.Option[memory.Store]{memory.WithCycleInterval(0)}
+	if cache.maxBytes > 0 {
+		storeOpts = append(storeOpts, memory.WithMaxBytes(cache.maxBytes))
+	}
+	if cache.listener != nil {
+		storeOpts = append(storeOpts, memory.WithEvictListener(cache.listener))
+	}
+	cache.store = memory.NewStore(cache.cacheLimit, cache.policy, storeOpts...)
 	return cache, nil
 }
 
@@ -88,126 +110,182 @@ func WithCacheLimit(cacheLimit int) option.Option[RBTreePriorityCache] {
 	}
 }
 
-func WithDefaultPriority(priority int) option.Option[RBTreePriorityCache] {
+// WithMaxBytes 设置所允许的键值对占用的最大字节数，超出之后按照优先级淘汰，和 WithCacheLimit 同时生效
+// 键值对的大小是 key 的长度加上 memory.SizeOf 估算的值的大小
+func WithMaxBytes(maxBytes int64) option.Option[RBTreePriorityCache] {
 	return func(opt *RBTreePriorityCache) {
-		opt.defaultPriority = priority
+		opt.maxBytes = maxBytes
 	}
 }
 
-func (r *RBTreePriorityCache) Set(_ context.Context, key string, val any, expiration time.Duration) error {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
-
-	node := r.findOrCreateNode(key, func() any { return val })
-
-	node.replace(val, expiration)
-	return nil
+func WithDefaultPriority(priority int) option.Option[RBTreePriorityCache] {
+	return func(opt *RBTreePriorityCache) {
+		opt.policy.defaultPriority = priority
+	}
 }
 
-// addNode 把缓存结点添加到缓存结构中
-func (r *RBTreePriorityCache) addNode(node *rbTreeCacheNode) {
-	_ = r.cacheData.Add(node.key, node) //这里的error理论上不会出现
-	r.cacheNum++
-	r.addNodeToPriority(node)
+// WithScoreFunc 使用 fn 计算的分数代替优先级决定淘汰顺序，分数越低越先被淘汰
+// 和时间相关的元数据（TTL、Age、Idle）只在结点被读写和每次过期清理的时候重新计算，
+// 过期清理会重新计算所有结点的分数，所以缓存很大的时候要注意 fn 的开销
+func WithScoreFunc(fn ScoreFunc) option.Option[RBTreePriorityCache] {
+	return func(opt *RBTreePriorityCache) {
+		opt.policy.scoreFunc = fn
+	}
 }
 
-// deleteNode 把缓存结点从缓存结构中移除
-func (r *RBTreePriorityCache) deleteNode(node *rbTreeCacheNode) {
-	r.cacheData.Delete(node.key)
-	r.cacheNum--
-	r.deleteNodeFromPriority(node)
+// WithPriorityAging 结点每隔 interval 没有被读写，优先级就减一，
+// 这样很久没有被使用的高优先级结点最终也会被淘汰，被读写之后恢复原本的优先级
+// 和 WithScoreFunc 一样，衰减在结点被读写和每次过期清理的时候生效
+func WithPriorityAging(interval time.Duration) option.Option[RBTreePriorityCache] {
+	return func(opt *RBTreePriorityCache) {
+		opt.policy.agingInterval = interval
+	}
 }
 
-func (r *RBTreePriorityCache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
+// WithEvictListener 设置淘汰事件的监听者，监听者会在释放锁之后被调用
+func WithEvictListener(listener evict.Listener) option.Option[RBTreePriorityCache] {
+	return func(opt *RBTreePriorityCache) {
+		opt.listener = listener
+	}
+}
 
-	node, cacheErr := r.cacheData.Find(key)
-	if cacheErr != nil {
-		node = newKVRBTreeCacheNode(key, val, expiration)
-		r.addNode(node)
+// Close 停止过期自动清理，不再使用的缓存应该调用 Close
+// Close 之后仍然可以读写，过期的 key 只会在被访问或者被淘汰的时候删除
+func (r *RBTreePriorityCache) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	return r.store.Close()
+}
 
-		return true, nil
-	}
+// locked 是已经持有锁的 RBTreePriorityCache，方法直接操作 memory.Core，用来在一次加锁里面执行多个操作
+type locked struct {
+	*RBTreePriorityCache
+	core *memory.Core
+}
 
-	if !node.beforeDeadline(time.Now()) {
-		node.replace(val, expiration) //过期的，key一样，直接覆盖
+// do 持有锁执行 fn
+func (r *RBTreePriorityCache) do(fn func(l locked)) {
+	r.store.Do(func(core *memory.Core) {
+		fn(locked{RBTreePriorityCache: r, core: core})
+	})
+}
 
-		return true, nil
-	}
+func (r *RBTreePriorityCache) Set(ctx context.Context, key string, val any, expiration time.Duration) (err error) {
+	r.do(func(l locked) {
+		err = l.Set(ctx, key, val, expiration)
+	})
+	return
+}
 
-	return false, nil
+func (r locked) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
+	r.core.Set(key, val, expiration)
+	// Set 覆盖整个键值对，ctx 没有指定优先级的时候也会清除之前指定的优先级
+	priority, ok := priorityFromContext(ctx)
+	r.policy.setPriority(key, priority, ok)
+	return nil
 }
 
-func (r *RBTreePriorityCache) Get(ctx context.Context, key string) (val ecache.Value) {
-	r.globalLock.RLock()
-	node, cacheErr := r.cacheData.Find(key)
-	r.globalLock.RUnlock()
+// SetWithPriority 写入 key 并且指定它的优先级，等价于使用 ContextWithPriority 调用 Set
+func (r *RBTreePriorityCache) SetWithPriority(ctx context.Context, key string, val any,
+	expiration time.Duration, priority int) error {
+	return r.Set(ContextWithPriority(ctx, priority), key, val, expiration)
+}
 
-	if cacheErr != nil {
-		val.Err = errs.ErrKeyNotExist
+// SetPriority 修改已经存在的 key 的优先级，之后修改 key 的值不会改变这个优先级，除非用 Set 覆盖整个键值对
+// key 不存在或者已经过期的时候返回 errs.ErrKeyNotExist
+func (r *RBTreePriorityCache) SetPriority(_ context.Context, key string, priority int) (err error) {
+	r.do(func(l locked) {
+		if _, ok := l.core.Lookup(key); !ok {
+			l.core.Delete(key) //已经过期的顺便删除
+			err = errs.ErrKeyNotExist
+			return
+		}
+		l.policy.setPriority(key, priority, true)
+	})
+	return
+}
 
-		return
-	}
+// Bytes 返回键值对占用的字节数，没有设置 WithMaxBytes 的时候不统计，总是返回 0
+func (r *RBTreePriorityCache) Bytes() int64 {
+	return r.store.Bytes()
+}
 
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
-	now := time.Now()
-	if !node.beforeDeadline(now) {
-		r.doubleCheckWhenExpire(node, now)
-		val.Err = errs.ErrKeyNotExist // 缓存过期归类为找不到
+func (r *RBTreePriorityCache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (ok bool, err error) {
+	r.do(func(l locked) {
+		ok, err = l.SetNX(ctx, key, val, expiration)
+	})
+	return
+}
 
-		return
+func (r locked) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	if _, ok := r.core.Lookup(key); ok {
+		return false, nil
 	}
-	val.Val = node.value
+	//不存在或者过期了，直接覆盖
+	return true, r.Set(ctx, key, val, expiration)
+}
 
+func (r *RBTreePriorityCache) Get(ctx context.Context, key string) (val ecache.Value) {
+	r.do(func(l locked) {
+		val = l.Get(ctx, key)
+	})
 	return
 }
 
-// doubleCheckWhenExpire 缓存过期时的二次校验，防止被抢先删除了【调用该方法必须先获得锁】
-func (r *RBTreePriorityCache) doubleCheckWhenExpire(node *rbTreeCacheNode, now time.Time) {
-	checkNode, checkCacheErr := r.cacheData.Find(node.key)
-	if checkCacheErr != nil {
-		return //被抢先删除了
-	}
-	if !checkNode.beforeDeadline(now) {
-		r.deleteNode(checkNode)
+// Get 和 RBTreePriorityCache.Get 一样，但是调用方已经持有锁
+func (r locked) Get(_ context.Context, key string) (val ecache.Value) {
+	var ok bool
+	val.Val, ok = r.core.Get(key)
+	if !ok {
+		val.Err = errs.ErrKeyNotExist // 缓存过期归类为找不到
 	}
+	return
 }
 
-func (r *RBTreePriorityCache) GetSet(ctx context.Context, key string, val string) ecache.Value {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
+// Deadline 返回 key 的过期时间，零值表示永不过期，key 不存在或者已经过期的时候返回 false
+func (r *RBTreePriorityCache) Deadline(_ context.Context, key string) (deadline time.Time, ok bool) {
+	r.store.View(func(core *memory.Core) {
+		var ent memory.Entry
+		ent, ok = core.Lookup(key)
+		deadline = ent.ExpiresAt
+	})
+	return
+}
 
-	var retVal ecache.Value
+func (r *RBTreePriorityCache) GetSet(ctx context.Context, key string, val string) (retVal ecache.Value) {
+	r.do(func(l locked) {
+		retVal = l.GetSet(ctx, key, val)
+	})
+	return
+}
 
-	node, cacheErr := r.cacheData.Find(key)
-	if cacheErr != nil {
+func (r locked) GetSet(ctx context.Context, key string, val string) (retVal ecache.Value) {
+	//这里不需要判断缓存过期没有，取出旧值放入新值就完事了，保留原本的有效期
+	var deadline time.Time
+	if node, err := r.policy.cacheData.Find(key); err == nil {
+		retVal.Val = node.value
+		deadline = node.deadline
+	} else {
 		retVal.Err = errs.ErrKeyNotExist
-		if r.isFull() {
-			r.deleteNodeByPriority()
-		}
-		node = newKVRBTreeCacheNode(key, val, 0)
-		r.addNode(node)
-
-		return retVal
 	}
-
-	//这里不需要判断缓存过期没有，取出旧值放入新值就完事了
-	retVal.Val = node.value
-	node.value = val
-
-	return retVal
+	r.core.SetDeadline(key, val, deadline)
+	priority, hasPriority := priorityFromContext(ctx)
+	r.policy.setPriority(key, priority, hasPriority)
+	return
 }
 
-func (r *RBTreePriorityCache) LPush(ctx context.Context, key string, val ...any) (int64, error) {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
+func (r *RBTreePriorityCache) LPush(ctx context.Context, key string, val ...any) (n int64, err error) {
+	r.do(func(l locked) {
+		n, err = l.LPush(ctx, key, val...)
+	})
+	return
+}
 
-	node := r.findOrCreateNode(key, func() any {
+func (r locked) LPush(ctx context.Context, key string, val ...any) (int64, error) {
+	nodeVal, ok := r.findOrCreate(ctx, key, func() any {
 		return list.NewLinkedList[any]()
-	})
-	nodeVal, ok := node.value.(*list.LinkedList[any])
+	}).(*list.LinkedList[any])
 	if !ok {
 		return 0, errOnlyListCanLPUSH
 	}
@@ -217,47 +295,53 @@ func (r *RBTreePriorityCache) LPush(ctx context.Context, key string, val ...any)
 		_ = nodeVal.Add(0, item) //这里的error理论上是不会出现的
 		successNum++
 	}
+	r.core.Update(key, nodeVal)
 
 	return successNum, nil
 }
 
-func (r *RBTreePriorityCache) LPop(ctx context.Context, key string) ecache.Value {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
-
-	var retVal ecache.Value
+func (r *RBTreePriorityCache) LPop(ctx context.Context, key string) (val ecache.Value) {
+	r.do(func(l locked) {
+		val = l.LPop(ctx, key)
+	})
+	return
+}
 
-	node, cacheErr := r.cacheData.Find(key)
-	if cacheErr != nil {
+func (r locked) LPop(_ context.Context, key string) (retVal ecache.Value) {
+	val, ok := r.core.Get(key)
+	if !ok {
 		retVal.Err = errs.ErrKeyNotExist
-
-		return retVal
+		return
 	}
 
-	nodeVal, ok := node.value.(*list.LinkedList[any])
+	nodeVal, ok := val.(*list.LinkedList[any])
 	if !ok {
 		retVal.Err = errOnlyListCanLPOP
-
-		return retVal
+		return
 	}
 
 	retVal.Val, retVal.Err = nodeVal.Delete(0) //lpop就是删除并获取list的第一个元素
 
 	if nodeVal.Len() == 0 {
-		r.deleteNode(node) //如果列表为空就删除缓存结点
+		r.core.Delete(key) //如果列表为空就删除缓存结点
+	} else {
+		r.core.Update(key, nodeVal)
 	}
 
-	return retVal
+	return
 }
 
-func (r *RBTreePriorityCache) SAdd(ctx context.Context, key string, members ...any) (int64, error) {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
+func (r *RBTreePriorityCache) SAdd(ctx context.Context, key string, members ...any) (n int64, err error) {
+	r.do(func(l locked) {
+		n, err = l.SAdd(ctx, key, members...)
+	})
+	return
+}
 
-	node := r.findOrCreateNode(key, func() any {
+func (r locked) SAdd(ctx context.Context, key string, members ...any) (int64, error) {
+	nodeVal, ok := r.findOrCreate(ctx, key, func() any {
 		return set.NewMapSet[any](r.collectionCap)
-	})
-	nodeVal, ok := node.value.(*set.MapSet[any])
+	}).(*set.MapSet[any])
 	if !ok {
 		return 0, errOnlySetCanSAdd
 	}
@@ -270,20 +354,25 @@ func (r *RBTreePriorityCache) SAdd(ctx context.Context, key string, members ...a
 			successNum++
 		}
 	}
+	r.core.Update(key, nodeVal)
 
 	return successNum, nil
 }
 
-func (r *RBTreePriorityCache) SRem(_ context.Context, key string, members ...any) (int64, error) {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
+func (r *RBTreePriorityCache) SRem(ctx context.Context, key string, members ...any) (n int64, err error) {
+	r.do(func(l locked) {
+		n, err = l.SRem(ctx, key, members...)
+	})
+	return
+}
 
-	node, cacheErr := r.cacheData.Find(key)
-	if cacheErr != nil {
+func (r locked) SRem(_ context.Context, key string, members ...any) (int64, error) {
+	val, ok := r.core.Get(key)
+	if !ok {
 		return 0, errs.ErrKeyNotExist
 	}
 
-	nodeVal, ok := node.value.(*set.MapSet[any])
+	nodeVal, ok := val.(*set.MapSet[any])
 	if !ok {
 		return 0, errOnlySetCanSRem
 	}
@@ -298,37 +387,45 @@ func (r *RBTreePriorityCache) SRem(_ context.Context, key string, members ...any
 	}
 
 	if len(nodeVal.Keys()) == 0 {
-		r.deleteNode(node) //如果集合为空，删除缓存结点
+		r.core.Delete(key) //如果集合为空，删除缓存结点
+	} else {
+		r.core.Update(key, nodeVal)
 	}
 	return successNum, nil
 }
 
-func (r *RBTreePriorityCache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
-
-	node := r.findOrCreateNode(key, func() any { return int64(0) })
+func (r *RBTreePriorityCache) IncrBy(ctx context.Context, key string, value int64) (n int64, err error) {
+	r.do(func(l locked) {
+		n, err = l.IncrBy(ctx, key, value)
+	})
+	return
+}
 
-	nodeVal, ok := node.value.(int64)
+func (r locked) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	nodeVal, ok := r.findOrCreate(ctx, key, func() any { return int64(0) }).(int64)
 	if !ok {
 		return 0, errOnlyNumCanIncrBy
 	}
 
 	newVal := nodeVal + value
-	node.value = newVal
+	r.core.Update(key, newVal)
 
 	return newVal, nil
 }
 
-func (r *RBTreePriorityCache) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
+func (r *RBTreePriorityCache) IncrByFloat(ctx context.Context, key string, value float64) (f float64, err error) {
+	r.do(func(l locked) {
+		f, err = l.IncrByFloat(ctx, key, value)
+	})
+	return
+}
 
-	node := r.findOrCreateNode(key, func() any { return float64(0) })
-	nodeVal, ok := node.value.(float64)
+func (r locked) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
+	val := r.findOrCreate(ctx, key, func() any { return float64(0) })
+	nodeVal, ok := val.(float64)
 	if !ok {
 		//如果是int类型可以尝试转换
-		intNodeVal, ok := node.value.(int64)
+		intNodeVal, ok := val.(int64)
 		if !ok {
 			return 0, errOnlyNumCanIncrBy
 		}
@@ -336,140 +433,115 @@ func (r *RBTreePriorityCache) IncrByFloat(ctx context.Context, key string, value
 	}
 
 	newVal := nodeVal + value
-	node.value = newVal
+	r.core.Update(key, newVal)
 
 	return newVal, nil
 }
 
-func (r *RBTreePriorityCache) Delete(ctx context.Context, keys ...string) (int64, error) {
+func (r *RBTreePriorityCache) Delete(ctx context.Context, keys ...string) (n int64, err error) {
+	r.do(func(l locked) {
+		n, err = l.Delete(ctx, keys...)
+	})
+	return
+}
+
+// Delete 和 RBTreePriorityCache.Delete 一样，但是调用方已经持有锁
+func (r locked) Delete(_ context.Context, keys ...string) (int64, error) {
 	delCount := int64(0)
-	now := time.Now()
 	for _, key := range keys {
-		r.globalLock.RLock()
-		_, cacheErr := r.cacheData.Find(key)
-		r.globalLock.RUnlock()
-		if cacheErr != nil {
-			continue
-		}
-
-		r.globalLock.Lock()
-		node, cacheErr := r.cacheData.Find(key)
-		if cacheErr != nil {
-			r.globalLock.Unlock()
-			continue
-		}
-
 		// 过期删除不添加计数
-		if !node.beforeDeadline(now) {
-			r.deleteNode(node)
-			r.globalLock.Unlock()
-			continue
+		if r.core.Delete(key) {
+			delCount++
 		}
-
-		r.deleteNode(node)
-		r.globalLock.Unlock()
-		delCount++
 	}
 	return delCount, nil
 }
 
-func (r *RBTreePriorityCache) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
-	r.globalLock.Lock()
-	defer r.globalLock.Unlock()
-
-	node := r.findOrCreateNode(key, func() any { return int64(0) })
+func (r *RBTreePriorityCache) DecrBy(ctx context.Context, key string, value int64) (n int64, err error) {
+	r.do(func(l locked) {
+		n, err = l.DecrBy(ctx, key, value)
+	})
+	return
+}
 
-	nodeVal, ok := node.value.(int64)
+func (r locked) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
+	nodeVal, ok := r.findOrCreate(ctx, key, func() any { return int64(0) }).(int64)
 	if !ok {
 		return 0, errOnlyNumCanDecrBy
 	}
 
 	newVal := nodeVal - value
-	node.value = newVal
+	r.core.Update(key, newVal)
 
 	return newVal, nil
 }
 
-// calculatePriority 获取缓存数据的优先级权重
-func (r *RBTreePriorityCache) calculatePriority(node *rbTreeCacheNode) int {
-	priority := r.defaultPriority
-
-	//如果实现了Priority接口，那么就用接口的方法获取优先级权重
-	val, ok := node.value.(Priority)
-	if ok {
-		priority = val.Priority()
+// findOrCreate 查找 key，不存在时使用默认值创建，找到的 key 算作一次访问
+// ctx 里面指定了优先级的时候，用它覆盖 key 的优先级
+func (r locked) findOrCreate(ctx context.Context, key string, initFunc func() any) any {
+	priority, hasPriority := priorityFromContext(ctx)
+	val, ok := r.core.Get(key)
+	if !ok {
+		val = initFunc()
+		r.core.Set(key, val, 0)
+		r.policy.setPriority(key, priority, hasPriority)
+		return val
 	}
-
-	return priority
-}
-
-// addNodeToPriority 把缓存结点添加到优先级数据中去
-func (r *RBTreePriorityCache) addNodeToPriority(node *rbTreeCacheNode) {
-	node.priority = r.calculatePriority(node)
-	_ = r.priorityData.Enqueue(node)
-}
-
-// deleteNodeFromPriority 从优先级数据中移除缓存结点
-func (r *RBTreePriorityCache) deleteNodeFromPriority(node *rbTreeCacheNode) {
-	//优先级队列无法随机删除结点
-	//这里的方案是把优先级数据中的缓存结点置空，并标记为已删除
-	//等到触发淘汰的时候再处理
-	node.truncate()
-}
-
-// isFull 键值对数量满了没有
-func (r *RBTreePriorityCache) isFull() bool {
-	return r.cacheNum >= r.cacheLimit
-}
-
-// findOrCreateNode 查找节点，不存在时使用默认值创建节点【调用该方法必须先获得锁】
-func (r *RBTreePriorityCache) findOrCreateNode(key string, initFunc func() any) *rbTreeCacheNode {
-	node, cacheErr := r.cacheData.Find(key)
-	if cacheErr != nil {
-		if r.isFull() {
-			r.deleteNodeByPriority()
-		}
-		node = newRBTreeCacheNode(key, initFunc())
-		r.addNode(node)
+	if hasPriority {
+		r.policy.setPriority(key, priority, true)
 	}
-	return node
+	return val
 }
 
-// deleteNodeByPriority 根据优先级淘汰缓存结点【调用该方法必须先获得锁】
-func (r *RBTreePriorityCache) deleteNodeByPriority() {
+// autoClean 自动清理过期缓存，Close 之后退出
+func (r *RBTreePriorityCache) autoClean() {
+	ticker := time.NewTicker(r.cleanInterval)
+	defer ticker.Stop()
 	for {
-		//这里需要循环，因为有的优先级结点是空的
-		topNode, topErr := r.priorityData.Dequeue()
-		if topErr != nil {
-			return //走这里铁有bug，不可能缓存满了但是优先级队列是空的
+		select {
+		case <-ticker.C:
+		case <-r.done:
+			return
 		}
-		if topNode.isDeleted {
-			continue //空结点，直接回去，继续下一轮
+		r.cleanExpired()
+		if r.policy.dynamicScore() {
+			r.store.Do(func(*memory.Core) {
+				r.policy.rescore(time.Now())
+			})
 		}
-		// 结点非空，删除缓存
-		r.cacheData.Delete(topNode.key)
-		r.cacheNum--
-
-		return
 	}
 }
 
-// autoClean 自动清理过期缓存
-func (r *RBTreePriorityCache) autoClean() {
-	ticker := time.NewTicker(r.cleanInterval)
-	defer ticker.Stop()
-	for range ticker.C {
-		r.globalLock.RLock()
-		_, values := r.cacheData.KeyValues()
-		r.globalLock.RUnlock()
-
-		now := time.Now()
-		for _, value := range values {
-			if !value.beforeDeadline(now) {
-				r.globalLock.Lock()
-				r.doubleCheckWhenExpire(value, now)
-				r.globalLock.Unlock()
+// cleanExpired 清理已经过期的键值对，返回清理的数量
+// 借助过期时间数据只访问真正过期的结点，每清理一批就释放一次锁，避免长时间阻塞读写
+func (r *RBTreePriorityCache) cleanExpired() int {
+	const batchSize = 128
+	start := time.Now()
+	expired := 0
+	for {
+		finished := false
+		r.store.Do(func(core *memory.Core) {
+			cnt := core.CleanExpired(batchSize)
+			expired += cnt
+			if cnt < batchSize {
+				finished = true
+				r.cleanStats.Runs++
+				r.cleanStats.Expired += int64(expired)
+				r.cleanStats.LastExpired = expired
+				r.cleanStats.LastCleanAt = start
+				r.cleanStats.LastDuration = time.Since(start)
 			}
+		})
+		if finished {
+			return expired
 		}
 	}
 }
+
+// CleanStats 返回过期自动清理的统计数据
+func (r *RBTreePriorityCache) CleanStats() (stats CleanStats) {
+	r.store.View(func(*memory.Core) {
+		stats = r.cleanStats
+	})
+	return
+}
@@ -17,6 +17,8 @@ package priority
 import (
 	"context"
 	"fmt"
+	"math"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -24,6 +26,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
 	"github.com/ecodeclub/ekit/list"
 	"github.com/ecodeclub/ekit/set"
 	"github.com/stretchr/testify/assert"
@@ -38,28 +42,56 @@ func (ts testStructForPriority) Priority() int {
 	return ts.priority
 }
 
+// addNode 测试用，按照缓存结点的值、有效期和指定的优先级写入 key
+func (r *RBTreePriorityCache) addNode(node *rbTreeCacheNode) {
+	r.store.Do(func(core *memory.Core) {
+		core.SetDeadline(node.key, node.value, node.deadline)
+		r.policy.setPriority(node.key, node.customPriority, node.hasCustomPriority)
+	})
+}
+
+// deleteNode 测试用，删除缓存结点对应的 key
+func (r *RBTreePriorityCache) deleteNode(node *rbTreeCacheNode) {
+	r.store.Do(func(core *memory.Core) {
+		core.Delete(node.key)
+	})
+}
+
+// removeFromPriorityData 测试用，把 key 对应的缓存结点从优先级数据里面拿出来，模拟两者不一致
+func (r *RBTreePriorityCache) removeFromPriorityData(key string) {
+	r.store.Do(func(_ *memory.Core) {
+		if node, err := r.policy.cacheData.Find(key); err == nil {
+			r.policy.priorityData.remove(node)
+		}
+	})
+}
+
+// len 测试用，返回键值对的数量
+func (r *RBTreePriorityCache) len() (n int) {
+	r.store.View(func(core *memory.Core) {
+		n = core.Len()
+	})
+	return
+}
+
 func compareTwoRBTreeClient(src *RBTreePriorityCache, dst *RBTreePriorityCache) bool {
 	//如果缓存结构中的红黑树的大小一样，红黑树的每个key都有
 	//键值对结点和数字结点中的元素一样，list和set结点中的元素数量一样
 	//优先级队列长度一样，优先级队列顶部元素一样
 	//那么就姑且认为两个缓存结构中的数据是一样的
-	if src.cacheNum != dst.cacheNum {
+	if src.len() != dst.len() {
 		return false
 	}
-	if src.cacheData.Size() != dst.cacheData.Size() {
+	if src.policy.cacheData.Size() != dst.policy.cacheData.Size() {
 		return false
 	}
 
-	src.globalLock.RLock()
-	srcKeys, srcNodes := src.cacheData.KeyValues()
-	src.globalLock.RUnlock()
+	srcKeys, srcNodes := src.policy.cacheData.KeyValues()
 	srcKeysMap := make(map[string]*rbTreeCacheNode)
 	for index, item := range srcKeys {
 		srcKeysMap[item] = srcNodes[index]
 	}
-	dst.globalLock.RLock()
-	dstKeys, dstNodes := dst.cacheData.KeyValues()
-	dst.globalLock.RUnlock()
+	dstKeys, dstNodes := dst.policy.cacheData.KeyValues()
 	dstKeysMap := make(map[string]*rbTreeCacheNode)
 	for index, item := range dstKeys {
 		dstKeysMap[item] = dstNodes[index]
@@ -100,15 +132,11 @@ func compareTwoRBTreeClient(src *RBTreePriorityCache, dst *RBTreePriorityCache)
 		}
 	}
 
-	if src.priorityData.Len() != dst.priorityData.Len() {
+	if src.policy.priorityData.Len() != dst.policy.priorityData.Len() {
 		return false
 	}
-	src.globalLock.Lock()
-	srcTop, _ := src.priorityData.Peek()
-	src.globalLock.Unlock()
-	dst.globalLock.Lock()
-	dstTop, _ := dst.priorityData.Peek()
-	dst.globalLock.Unlock()
+	srcTop := src.policy.priorityData.peek()
+	dstTop := dst.policy.priorityData.peek()
 	if srcTop == nil && dstTop == nil {
 		return true
 	}
@@ -142,8 +170,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: "value1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -152,8 +178,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			name: "cache 1,add 1,ok",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -161,8 +185,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				cache.addNode(newKVRBTreeCacheNode("key2", "value2", 0))
 				return cache
@@ -172,8 +194,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			name: "cache 1,add 1,cover",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -181,8 +201,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value2", 0))
 				return cache
 			},
@@ -191,8 +209,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			name: "limit 1,cache 1,add 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -200,8 +216,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key2", "value2", 0))
 				return cache
 			},
@@ -210,8 +224,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			name: "limit 2,cache 2,add 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(2))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", testStructForPriority{priority: 1}, 0))
 				cache.addNode(newKVRBTreeCacheNode("key2", testStructForPriority{priority: 2}, 0))
 				return cache
@@ -220,8 +232,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: testStructForPriority{priority: 3},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(2))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key2", testStructForPriority{priority: 2}, 0))
 				cache.addNode(newKVRBTreeCacheNode("key3", testStructForPriority{priority: 3}, 0))
 				return cache
@@ -231,8 +241,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			name: "limit 2,cache 2,add 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(2))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key2", testStructForPriority{priority: 2}, 0))
 				cache.addNode(newKVRBTreeCacheNode("key1", testStructForPriority{priority: 1}, 0))
 				return cache
@@ -241,8 +249,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: testStructForPriority{priority: 3},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(2))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key2", testStructForPriority{priority: 2}, 0))
 				cache.addNode(newKVRBTreeCacheNode("key3", testStructForPriority{priority: 3}, 0))
 				return cache
@@ -252,8 +258,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			name: "limit 2,cache 2,add 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(2), WithDefaultPriority(5))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				cache.addNode(newKVRBTreeCacheNode("key2", testStructForPriority{priority: 2}, 0))
 				return cache
@@ -262,8 +266,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: testStructForPriority{priority: 3},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(2), WithDefaultPriority(5))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				cache.addNode(newKVRBTreeCacheNode("key3", testStructForPriority{priority: 3}, 0))
 				return cache
@@ -273,8 +275,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			name: "limit 1,cache 1,add 1,evict,cover empty priority queue top",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newKVRBTreeCacheNode("key1", testStructForPriority{priority: 1}, 0)
 				cache.addNode(node1)
 				cache.deleteNode(node1) //模拟删除结点，构造空的优先级队列头
@@ -285,8 +285,6 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: testStructForPriority{priority: 3},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key3", testStructForPriority{priority: 3}, 0))
 				return cache
 			},
@@ -295,13 +293,9 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			name: "limit 1,cache 1,add 1,evict,cover heap top nil,should not happen",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
-				node1 := newKVRBTreeCacheNode("key1", "value1", 0)
-				_ = cache.cacheData.Add("key1", node1)
-				cache.cacheNum++
+				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				//这里不应该出现没有设置的情况，出现这种这种情况肯定有bug
-				//cache.SetCacheNodePriority(node1)
+				cache.removeFromPriorityData("key1")
 
 				return cache
 			},
@@ -309,12 +303,9 @@ func TestRBTreePriorityCache_Set(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				//上面的bug导致这个结点没被删掉
-				node1 := newKVRBTreeCacheNode("key1", "value1", 0)
-				_ = cache.cacheData.Add("key1", node1)
-				cache.cacheNum++
+				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
+				cache.removeFromPriorityData("key1")
 				cache.addNode(newKVRBTreeCacheNode("key2", "value2", 0))
 				return cache
 			},
@@ -352,7 +343,20 @@ func TestCache_Set2(t *testing.T) {
 	}
 	wg.Wait()
 
-	assert.Equal(t, cacheLimit, cache.cacheNum)
+	assert.Equal(t, cacheLimit, cache.len())
+}
+
+func TestRBTreePriorityCache_SetNXLimit(t *testing.T) {
+	cache, _ := newRBTreePriorityCache(WithCacheLimit(2))
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		ok, err := cache.SetNX(ctx, fmt.Sprintf("key%d", i), testStructForPriority{priority: i}, 0)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, errs.ErrKeyNotExist, cache.Get(ctx, "key1").Err)
+	assert.NoError(t, cache.Get(ctx, "key2").Err)
+	assert.NoError(t, cache.Get(ctx, "key3").Err)
 }
 
 func TestRBTreePriorityCache_SetNX(t *testing.T) {
@@ -376,8 +380,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			value: "value1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -387,8 +389,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			name: "cache 0,add 1,not conflict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -396,8 +396,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				cache.addNode(newKVRBTreeCacheNode("key2", "value2", 0))
 				return cache
@@ -408,8 +406,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			name: "cache 1,add 1,conflict,self",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -417,8 +413,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			value: "value1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -428,8 +422,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			name: "cache 1,add 1,conflict,failed",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -437,8 +429,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -448,8 +438,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			name: "cache 1,add 1,conflict,expired",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", -time.Minute))
 				return cache
 			},
@@ -457,8 +445,6 @@ func TestRBTreePriorityCache_SetNX(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value2", 0))
 				return cache
 			},
@@ -504,16 +490,12 @@ func TestRBTreePriorityCache_Get(t *testing.T) {
 			name: "cache 1,miss",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
 			key: "key2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -523,16 +505,12 @@ func TestRBTreePriorityCache_Get(t *testing.T) {
 			name: "cache 1,hit",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
 			key: "key1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -542,8 +520,6 @@ func TestRBTreePriorityCache_Get(t *testing.T) {
 			name: "cache num 1,hit,expire",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", -time.Minute))
 				return cache
 			},
@@ -558,8 +534,6 @@ func TestRBTreePriorityCache_Get(t *testing.T) {
 			name: "cache 1,hit,not expire",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -596,16 +570,12 @@ func TestRBTreePriorityCache_doubleCheckInGet(t *testing.T) {
 			name: "key not deleted by other thread",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", -time.Minute))
 				return cache
 			},
 			node: newKVRBTreeCacheNode("key1", "value1", -time.Minute),
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newKVRBTreeCacheNode("key1", "value1", -time.Minute)
 				cache.addNode(node1)
 				cache.deleteNode(node1)
@@ -628,9 +598,7 @@ func TestRBTreePriorityCache_doubleCheckInGet(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			startCache := tc.startCache()
-			startCache.globalLock.Lock()
-			startCache.doubleCheckWhenExpire(tc.node, time.Now())
-			startCache.globalLock.Unlock()
+			assert.Equal(t, errs.ErrKeyNotExist, startCache.Get(context.Background(), tc.node.key).Err)
 			assert.Equal(t, true, compareTwoRBTreeClient(startCache, tc.wantCache()))
 		})
 	}
@@ -656,8 +624,6 @@ func TestRBTreePriorityCache_GetSet(t *testing.T) {
 			value: "value1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -667,18 +633,13 @@ func TestRBTreePriorityCache_GetSet(t *testing.T) {
 			name: "cache 1,miss,add 1",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
-				cache.cacheNum++
 				return cache
 			},
 			key:   "key2",
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				cache.addNode(newKVRBTreeCacheNode("key2", "value2", 0))
 				return cache
@@ -689,8 +650,6 @@ func TestRBTreePriorityCache_GetSet(t *testing.T) {
 			name: "cache 1,hit",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -698,8 +657,6 @@ func TestRBTreePriorityCache_GetSet(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value2", 0))
 				return cache
 			},
@@ -709,8 +666,6 @@ func TestRBTreePriorityCache_GetSet(t *testing.T) {
 			name: "cache 1,hit,expired",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", -time.Minute))
 				return cache
 			},
@@ -718,8 +673,6 @@ func TestRBTreePriorityCache_GetSet(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value2", 0))
 				return cache
 			},
@@ -729,8 +682,6 @@ func TestRBTreePriorityCache_GetSet(t *testing.T) {
 			name: "limit 1,cache 1,miss,add 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -738,8 +689,6 @@ func TestRBTreePriorityCache_GetSet(t *testing.T) {
 			value: "value2",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key2", "value2", 0))
 				return cache
 			},
@@ -780,8 +729,6 @@ func TestRBTreePriorityCache_LPush(t *testing.T) {
 			value: []any{"value1"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value1")
 				node1 := newListRBTreeCacheNode("key1")
@@ -795,8 +742,6 @@ func TestRBTreePriorityCache_LPush(t *testing.T) {
 			name: "cache 1,item 1,push 1",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value1")
 				node1 := newListRBTreeCacheNode("key1")
@@ -808,8 +753,6 @@ func TestRBTreePriorityCache_LPush(t *testing.T) {
 			value: []any{"value2"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value1")
 				_ = valList.Append("value2")
@@ -830,8 +773,6 @@ func TestRBTreePriorityCache_LPush(t *testing.T) {
 			value: []any{"value1", "value2"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value1")
 				_ = valList.Append("value2")
@@ -846,8 +787,6 @@ func TestRBTreePriorityCache_LPush(t *testing.T) {
 			name: "limit 1,cache 1,push 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value1")
 				node1 := newListRBTreeCacheNode("key1")
@@ -859,8 +798,6 @@ func TestRBTreePriorityCache_LPush(t *testing.T) {
 			value: []any{"value2"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value2")
 				node1 := newListRBTreeCacheNode("key2")
@@ -874,16 +811,12 @@ func TestRBTreePriorityCache_LPush(t *testing.T) {
 			name: "wrong type",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
 			key: "key1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -930,8 +863,6 @@ func TestRBTreePriorityCache_LPop(t *testing.T) {
 			name: "cache 1,item 1,pop 1,delete node",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value1")
 				node1 := newListRBTreeCacheNode("key1")
@@ -942,8 +873,6 @@ func TestRBTreePriorityCache_LPop(t *testing.T) {
 			key: "key1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newListRBTreeCacheNode("key1")
 				cache.addNode(node1)
 				cache.deleteNode(node1)
@@ -955,8 +884,6 @@ func TestRBTreePriorityCache_LPop(t *testing.T) {
 			name: "cache 1,item 2,pop 1",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value1")
 				_ = valList.Append("value2")
@@ -968,8 +895,6 @@ func TestRBTreePriorityCache_LPop(t *testing.T) {
 			key: "key1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valList := list.NewLinkedList[any]()
 				_ = valList.Append("value1")
 				node1 := newListRBTreeCacheNode("key1")
@@ -983,16 +908,12 @@ func TestRBTreePriorityCache_LPop(t *testing.T) {
 			name: "wrong type",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
 			key: "key1",
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1033,8 +954,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			values: []any{"value1"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1048,8 +967,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			name: "cache 1,add 1,not repeat",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1061,8 +978,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			values: []any{"value2"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				valSet1.Add("value2")
@@ -1077,8 +992,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			name: "cache 1,add 1,repeat",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1090,8 +1003,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			values: []any{"value1"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1111,8 +1022,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			values: []any{"value1", "value2"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				valSet1.Add("value2")
@@ -1127,8 +1036,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			name: "limit 1,cache 1,add 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1140,8 +1047,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			values: []any{"value2"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value2")
 				node1 := newSetRBTreeCacheNode("key2", 8)
@@ -1155,8 +1060,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			name: "wrong type",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1164,8 +1067,6 @@ func TestRBTreePriorityCache_SAdd(t *testing.T) {
 			values: []any{"value1"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1216,8 +1117,6 @@ func TestRBTreePriorityCache_SRem(t *testing.T) {
 			name: "cache 1,item 1,rem 1,hit,delete node",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1229,8 +1128,6 @@ func TestRBTreePriorityCache_SRem(t *testing.T) {
 			values: []any{"value1"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1245,8 +1142,6 @@ func TestRBTreePriorityCache_SRem(t *testing.T) {
 			name: "cache 1,item 1,rem 1,miss",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1258,8 +1153,6 @@ func TestRBTreePriorityCache_SRem(t *testing.T) {
 			values: []any{"value2"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				node1 := newSetRBTreeCacheNode("key1", 8)
@@ -1273,8 +1166,6 @@ func TestRBTreePriorityCache_SRem(t *testing.T) {
 			name: "cache 1,item 2,rem 2,hit 2",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				valSet1.Add("value2")
@@ -1287,8 +1178,6 @@ func TestRBTreePriorityCache_SRem(t *testing.T) {
 			values: []any{"value1", "value2"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				valSet1 := set.NewMapSet[any](8)
 				valSet1.Add("value1")
 				valSet1.Add("value2")
@@ -1304,8 +1193,6 @@ func TestRBTreePriorityCache_SRem(t *testing.T) {
 			name: "wrong type",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1313,8 +1200,6 @@ func TestRBTreePriorityCache_SRem(t *testing.T) {
 			values: []any{"value1"},
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1353,8 +1238,6 @@ func TestRBTreePriorityCache_IncrBy(t *testing.T) {
 			value: 1,
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key1")
 				node1.value = int64(1)
 				cache.addNode(node1)
@@ -1366,8 +1249,6 @@ func TestRBTreePriorityCache_IncrBy(t *testing.T) {
 			name: "cache 1,hit,value add 1",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key1")
 				node1.value = int64(1)
 				cache.addNode(node1)
@@ -1377,8 +1258,6 @@ func TestRBTreePriorityCache_IncrBy(t *testing.T) {
 			value: 1,
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key1")
 				node1.value = int64(2)
 				cache.addNode(node1)
@@ -1390,8 +1269,6 @@ func TestRBTreePriorityCache_IncrBy(t *testing.T) {
 			name: "limit 1,cache 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key1")
 				node1.value = int64(1)
 				cache.addNode(node1)
@@ -1401,8 +1278,6 @@ func TestRBTreePriorityCache_IncrBy(t *testing.T) {
 			value: 1,
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key2")
 				node1.value = int64(1)
 				cache.addNode(node1)
@@ -1414,8 +1289,6 @@ func TestRBTreePriorityCache_IncrBy(t *testing.T) {
 			name: "wrong string type ",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1423,8 +1296,6 @@ func TestRBTreePriorityCache_IncrBy(t *testing.T) {
 			value: 1,
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1434,8 +1305,6 @@ func TestRBTreePriorityCache_IncrBy(t *testing.T) {
 			name: "wrong float type",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node := newFloatRBTreeCacheNode("key1")
 				node.value = float64(3.14)
 				cache.addNode(node)
@@ -1480,8 +1349,6 @@ func TestRBTreePriorityCache_DecrBy(t *testing.T) {
 			value: 1,
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key1")
 				node1.value = int64(-1)
 				cache.addNode(node1)
@@ -1493,8 +1360,6 @@ func TestRBTreePriorityCache_DecrBy(t *testing.T) {
 			name: "cache 1,hit,value decr 1",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key1")
 				node1.value = int64(1)
 				cache.addNode(node1)
@@ -1504,8 +1369,6 @@ func TestRBTreePriorityCache_DecrBy(t *testing.T) {
 			value: 1,
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key1")
 				node1.value = int64(0)
 				cache.addNode(node1)
@@ -1517,8 +1380,6 @@ func TestRBTreePriorityCache_DecrBy(t *testing.T) {
 			name: "limit 1,cache 1,evict",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key1")
 				node1.value = int64(1)
 				cache.addNode(node1)
@@ -1528,8 +1389,6 @@ func TestRBTreePriorityCache_DecrBy(t *testing.T) {
 			value: 1,
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache(WithCacheLimit(1))
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node1 := newIntRBTreeCacheNode("key2")
 				node1.value = int64(-1)
 				cache.addNode(node1)
@@ -1541,8 +1400,6 @@ func TestRBTreePriorityCache_DecrBy(t *testing.T) {
 			name: "wrong type",
 			startCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1550,8 +1407,6 @@ func TestRBTreePriorityCache_DecrBy(t *testing.T) {
 			value: 1,
 			wantCache: func() *RBTreePriorityCache {
 				cache, _ := NewRBTreePriorityCache()
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			},
@@ -1623,9 +1478,7 @@ func TestRBTreePriorityCache_Delete(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(8))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
 				cache.addNode(newKVRBTreeCacheNode("key1", testStructForPriority{priority: -1}, 0))
-				cache.globalLock.Unlock()
 				return cache
 			}(),
 			keys:    []string{"key1"},
@@ -1637,9 +1490,7 @@ func TestRBTreePriorityCache_Delete(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(8))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
 				cache.addNode(newKVRBTreeCacheNode("key1", testStructForPriority{priority: -1}, 0))
-				cache.globalLock.Unlock()
 				return cache
 			}(),
 			keys:    []string{"key2"},
@@ -1651,9 +1502,7 @@ func TestRBTreePriorityCache_Delete(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(8))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
 				cache.addNode(newKVRBTreeCacheNode("key1", testStructForPriority{priority: -1}, time.Second))
-				cache.globalLock.Unlock()
 
 				time.Sleep(3 * time.Second)
 				return cache
@@ -1667,12 +1516,10 @@ func TestRBTreePriorityCache_Delete(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(8))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
 				cache.addNode(newKVRBTreeCacheNode("key1", testStructForPriority{priority: -1}, time.Second))
 				cache.addNode(newKVRBTreeCacheNode("key2", testStructForPriority{priority: -1}, time.Second))
 				cache.addNode(newKVRBTreeCacheNode("key3", testStructForPriority{priority: -1}, time.Second))
 				cache.addNode(newKVRBTreeCacheNode("key4", testStructForPriority{priority: -1}, time.Second))
-				cache.globalLock.Unlock()
 				return cache
 			}(),
 			keys:    []string{"key1", "key2", "key3"},
@@ -1691,7 +1538,7 @@ func TestRBTreePriorityCache_Delete(t *testing.T) {
 
 			//确认已经被删除
 			for _, key := range tc.keys {
-				_, err = tc.cache.cacheData.Find(key)
+				_, err = tc.cache.policy.cacheData.Find(key)
 				assert.NotNil(t, err)
 			}
 		})
@@ -1715,8 +1562,6 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(8))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node := newFloatRBTreeCacheNode("key1")
 				node.value = float64(3.14)
 				cache.addNode(node)
@@ -1729,8 +1574,6 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(8))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node := newFloatRBTreeCacheNode("key1")
 				node.value = 3.24
 				cache.addNode(node)
@@ -1751,8 +1594,6 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(8))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node := newFloatRBTreeCacheNode("key1")
 				node.value = 0.1
 				cache.addNode(node)
@@ -1765,8 +1606,6 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(8))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				cache.addNode(newKVRBTreeCacheNode("key1", "value1", 0))
 				return cache
 			}(),
@@ -1780,8 +1619,6 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(1))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node := newFloatRBTreeCacheNode("key0")
 				node.value = 3.14
 				cache.addNode(node)
@@ -1794,8 +1631,6 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(1))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node := newFloatRBTreeCacheNode("key1")
 				node.value = 0.1
 				cache.addNode(node)
@@ -1808,8 +1643,6 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(1))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node := newIntRBTreeCacheNode("key1")
 				node.value = int64(3)
 				cache.addNode(node)
@@ -1822,8 +1655,6 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 				cache, err := newRBTreePriorityCache(WithCacheLimit(1))
 				require.NoError(t, err)
 
-				cache.globalLock.Lock()
-				defer cache.globalLock.Unlock()
 				node := newFloatRBTreeCacheNode("key1")
 				node.value = 3.1
 				cache.addNode(node)
@@ -1844,3 +1675,510 @@ func TestRBTreePriorityCache_IncrByFloat(t *testing.T) {
 		})
 	}
 }
+
+func TestRBTreePriorityCache_cleanExpired(t *testing.T) {
+	testCases := []struct {
+		name        string
+		startCache  func() *RBTreePriorityCache
+		wantCleaned int
+		wantKeys    []string
+	}{
+		{
+			name: "no expiration",
+			startCache: func() *RBTreePriorityCache {
+				cache, _ := newRBTreePriorityCache()
+				_ = cache.Set(context.Background(), "key1", "value1", 0)
+				return cache
+			},
+			wantKeys: []string{"key1"},
+		},
+		{
+			name: "clean expired only",
+			startCache: func() *RBTreePriorityCache {
+				cache, _ := newRBTreePriorityCache()
+				_ = cache.Set(context.Background(), "key1", "value1", -time.Minute)
+				_ = cache.Set(context.Background(), "key2", "value2", time.Minute)
+				_ = cache.Set(context.Background(), "key3", "value3", 0)
+				_ = cache.Set(context.Background(), "key4", "value4", -time.Second)
+				return cache
+			},
+			wantCleaned: 2,
+			wantKeys:    []string{"key2", "key3"},
+		},
+		{
+			name: "replace with no expiration",
+			startCache: func() *RBTreePriorityCache {
+				cache, _ := newRBTreePriorityCache()
+				_ = cache.Set(context.Background(), "key1", "value1", -time.Minute)
+				_ = cache.Set(context.Background(), "key1", "value1", 0)
+				return cache
+			},
+			wantKeys: []string{"key1"},
+		},
+		{
+			name: "replace with later expiration",
+			startCache: func() *RBTreePriorityCache {
+				cache, _ := newRBTreePriorityCache()
+				_ = cache.Set(context.Background(), "key1", "value1", -time.Minute)
+				_ = cache.Set(context.Background(), "key2", "value2", -time.Second)
+				_ = cache.Set(context.Background(), "key1", "value1", time.Minute)
+				return cache
+			},
+			wantCleaned: 1,
+			wantKeys:    []string{"key1"},
+		},
+		{
+			name: "deleted node leaves heap",
+			startCache: func() *RBTreePriorityCache {
+				cache, _ := newRBTreePriorityCache()
+				_ = cache.Set(context.Background(), "key1", "value1", -time.Minute)
+				_, _ = cache.Delete(context.Background(), "key1")
+				return cache
+			},
+		},
+		{
+			name: "evicted node leaves heap",
+			startCache: func() *RBTreePriorityCache {
+				cache, _ := newRBTreePriorityCache(WithCacheLimit(1))
+				_ = cache.Set(context.Background(), "key1", "value1", time.Minute)
+				_ = cache.Set(context.Background(), "key2", "value2", -time.Minute)
+				return cache
+			},
+			wantCleaned: 1,
+		},
+		{
+			name: "more than one batch",
+			startCache: func() *RBTreePriorityCache {
+				cache, _ := newRBTreePriorityCache()
+				for i := 0; i < 300; i++ {
+					_ = cache.Set(context.Background(), fmt.Sprintf("key%d", i), i, -time.Minute)
+				}
+				_ = cache.Set(context.Background(), "key", "value", time.Minute)
+				return cache
+			},
+			wantCleaned: 300,
+			wantKeys:    []string{"key"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := tc.startCache()
+			cleaned := cache.cleanExpired()
+			assert.Equal(t, tc.wantCleaned, cleaned)
+			keys, _ := cache.policy.cacheData.KeyValues()
+			assert.ElementsMatch(t, tc.wantKeys, keys)
+			assert.Equal(t, len(tc.wantKeys), cache.len())
+
+			stats := cache.CleanStats()
+			assert.Equal(t, int64(1), stats.Runs)
+			assert.Equal(t, int64(tc.wantCleaned), stats.Expired)
+			assert.Equal(t, tc.wantCleaned, stats.LastExpired)
+			assert.False(t, stats.LastCleanAt.IsZero())
+			for i, node := range cache.policy.expirationData.nodes {
+				assert.Equal(t, i, node.expirationIndex)
+				assert.False(t, node.deadline.IsZero())
+			}
+		})
+	}
+}
+
+func TestRBTreePriorityCache_priorityDataSize(t *testing.T) {
+	cache, _ := newRBTreePriorityCache(WithCacheLimit(16))
+	ctx := context.Background()
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i%32)
+		switch i % 4 {
+		case 0:
+			_ = cache.Set(ctx, key, testStructForPriority{priority: i % 7}, 0)
+		case 1:
+			_, _ = cache.Delete(ctx, key)
+		case 2:
+			_, _ = cache.IncrBy(ctx, fmt.Sprintf("incr%d", i%8), 1)
+		case 3:
+			_ = cache.GetSet(ctx, key, "value")
+		}
+		require.Equal(t, cache.len(), cache.policy.priorityData.Len())
+		require.Equal(t, cache.policy.cacheData.Size(), cache.policy.priorityData.Len())
+	}
+	for i, node := range cache.policy.priorityData.nodes {
+		assert.Equal(t, i, node.priorityIndex)
+	}
+}
+
+func TestRBTreePriorityCache_updatePriority(t *testing.T) {
+	testCases := []struct {
+		name     string
+		before   func(cache *RBTreePriorityCache)
+		wantKeys []string
+	}{
+		{
+			name: "set raises priority",
+			before: func(cache *RBTreePriorityCache) {
+				ctx := context.Background()
+				_ = cache.Set(ctx, "key1", testStructForPriority{priority: 1}, 0)
+				_ = cache.Set(ctx, "key2", testStructForPriority{priority: 2}, 0)
+				_ = cache.Set(ctx, "key1", testStructForPriority{priority: 3}, 0)
+				_ = cache.Set(ctx, "key3", testStructForPriority{priority: 4}, 0)
+			},
+			wantKeys: []string{"key1", "key3"},
+		},
+		{
+			name: "set lowers priority",
+			before: func(cache *RBTreePriorityCache) {
+				ctx := context.Background()
+				_ = cache.Set(ctx, "key1", testStructForPriority{priority: 3}, 0)
+				_ = cache.Set(ctx, "key2", testStructForPriority{priority: 2}, 0)
+				_ = cache.Set(ctx, "key1", testStructForPriority{priority: 1}, 0)
+				_ = cache.Set(ctx, "key3", testStructForPriority{priority: 4}, 0)
+			},
+			wantKeys: []string{"key2", "key3"},
+		},
+		{
+			name: "getset falls back to default priority",
+			before: func(cache *RBTreePriorityCache) {
+				ctx := context.Background()
+				_ = cache.Set(ctx, "key1", testStructForPriority{priority: 3}, 0)
+				_ = cache.Set(ctx, "key2", testStructForPriority{priority: 2}, 0)
+				_ = cache.GetSet(ctx, "key1", "value1")
+				_ = cache.Set(ctx, "key3", testStructForPriority{priority: 4}, 0)
+			},
+			wantKeys: []string{"key2", "key3"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cache, _ := newRBTreePriorityCache(WithCacheLimit(2))
+			tc.before(cache)
+			keys, _ := cache.policy.cacheData.KeyValues()
+			assert.ElementsMatch(t, tc.wantKeys, keys)
+			assert.Equal(t, cache.len(), cache.policy.priorityData.Len())
+		})
+	}
+}
+
+func TestRBTreePriorityCache_evictListener(t *testing.T) {
+	testCases := []struct {
+		name       string
+		before     func(cache *RBTreePriorityCache)
+		wantEvents []evict.Event
+	}{
+		{
+			name: "replaced",
+			before: func(cache *RBTreePriorityCache) {
+				_ = cache.Set(context.Background(), "key1", "value1", 0)
+				_ = cache.Set(context.Background(), "key1", "value2", 0)
+				_ = cache.GetSet(context.Background(), "key1", "value3")
+			},
+			wantEvents: []evict.Event{
+				{Key: "key1", Value: "value1", Reason: evict.ReasonReplaced},
+				{Key: "key1", Value: "value2", Reason: evict.ReasonReplaced},
+			},
+		},
+		{
+			name: "capacity",
+			before: func(cache *RBTreePriorityCache) {
+				_ = cache.Set(context.Background(), "key1", testStructForPriority{priority: 2}, 0)
+				_ = cache.Set(context.Background(), "key2", testStructForPriority{priority: 1}, 0)
+				_ = cache.Set(context.Background(), "key3", testStructForPriority{priority: 3}, 0)
+			},
+			wantEvents: []evict.Event{
+				{Key: "key2", Value: testStructForPriority{priority: 1}, Reason: evict.ReasonCapacity},
+			},
+		},
+		{
+			name: "deleted",
+			before: func(cache *RBTreePriorityCache) {
+				_ = cache.Set(context.Background(), "key1", "value1", 0)
+				_, _ = cache.Delete(context.Background(), "key1")
+			},
+			wantEvents: []evict.Event{
+				{Key: "key1", Value: "value1", Reason: evict.ReasonDeleted},
+			},
+		},
+		{
+			name: "expired",
+			before: func(cache *RBTreePriorityCache) {
+				_ = cache.Set(context.Background(), "key1", "value1", -time.Minute)
+				_ = cache.Set(context.Background(), "key2", "value2", -time.Minute)
+				_ = cache.Set(context.Background(), "key3", "value3", -time.Minute)
+				_ = cache.Get(context.Background(), "key1")
+				_, _ = cache.SetNX(context.Background(), "key2", "value4", 0)
+				cache.cleanExpired()
+			},
+			wantEvents: []evict.Event{
+				{Key: "key1", Value: "value1", Reason: evict.ReasonExpired},
+				{Key: "key2", Value: "value2", Reason: evict.ReasonExpired},
+				{Key: "key3", Value: "value3", Reason: evict.ReasonExpired},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []evict.Event
+			var cache *RBTreePriorityCache
+			cache, _ = newRBTreePriorityCache(WithCacheLimit(2),
+				WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+					// 在锁外调用，可以再次访问缓存
+					_ = cache.Get(context.Background(), evt.Key)
+					events = append(events, evt)
+				})))
+			tc.before(cache)
+			assert.Equal(t, tc.wantEvents, events)
+		})
+	}
+}
+
+// 测试用的，可以指定权重和大小的结构
+type sizedStructForPriority struct {
+	priority int
+	size     int
+}
+
+func (s sizedStructForPriority) Priority() int {
+	return s.priority
+}
+
+func (s sizedStructForPriority) Size() int {
+	return s.size
+}
+
+func TestRBTreePriorityCache_maxBytes(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	cache, _ := newRBTreePriorityCache(WithMaxBytes(40),
+		WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+			events = append(events, evt)
+		})))
+	assert.Equal(t, int64(0), cache.Bytes())
+	// 每个键值对 4 + 6 = 10 字节
+	_ = cache.Set(ctx, "key1", sizedStructForPriority{priority: 2, size: 6}, 0)
+	_ = cache.Set(ctx, "key2", sizedStructForPriority{priority: 1, size: 6}, 0)
+	_ = cache.Set(ctx, "key3", sizedStructForPriority{priority: 3, size: 6}, 0)
+	assert.Equal(t, int64(30), cache.Bytes())
+
+	// 超出限制之后按照优先级淘汰，即使新的结点优先级最低也不会淘汰它自己
+	_ = cache.Set(ctx, "key4", sizedStructForPriority{priority: 0, size: 16}, 0)
+	assert.Equal(t, int64(40), cache.Bytes())
+	assert.Equal(t, errs.ErrKeyNotExist, cache.Get(ctx, "key2").Err)
+	assert.Equal(t, 3, cache.policy.priorityData.Len())
+
+	// 原地修改的集合重新计算大小
+	_, _ = cache.Delete(ctx, "key4")
+	_, _ = cache.SAdd(ctx, "set", "ab", "cd")
+	assert.Equal(t, int64(27), cache.Bytes())
+	_, _ = cache.SRem(ctx, "set", "ab")
+	assert.Equal(t, int64(25), cache.Bytes())
+	_, _ = cache.IncrBy(ctx, "num", 1)
+	assert.Equal(t, int64(36), cache.Bytes())
+	// 默认优先级的 num 比 key1 和 key3 低
+	_, _ = cache.SAdd(ctx, "set", "efghijk")
+	assert.Equal(t, int64(32), cache.Bytes())
+
+	assert.Equal(t, []evict.Event{
+		{Key: "key2", Value: sizedStructForPriority{priority: 1, size: 6}, Reason: evict.ReasonCapacity},
+		{Key: "key4", Value: sizedStructForPriority{priority: 0, size: 16}, Reason: evict.ReasonDeleted},
+		{Key: "num", Value: int64(1), Reason: evict.ReasonCapacity},
+	}, events)
+}
+
+func TestRBTreePriorityCache_lruWithinPriority(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	cache, _ := newRBTreePriorityCache(WithCacheLimit(3),
+		WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+			evicted = append(evicted, evt.Key)
+		})))
+
+	_ = cache.Set(ctx, "key1", "value1", 0)
+	_ = cache.Set(ctx, "key2", "value2", 0)
+	_ = cache.Set(ctx, "key3", "value3", 0)
+
+	// 优先级都是 0，最久没有被访问的先淘汰
+	_ = cache.Get(ctx, "key1")
+	_ = cache.Set(ctx, "key4", "value4", 0)
+	assert.Equal(t, []string{"key2"}, evicted)
+
+	// 写入也算作访问
+	_, _ = cache.IncrBy(ctx, "key5", 1)
+	assert.Equal(t, []string{"key2", "key3"}, evicted)
+	_, _ = cache.IncrBy(ctx, "key5", 1)
+	_ = cache.Get(ctx, "key1")
+	_ = cache.Set(ctx, "key6", "value6", 0)
+	assert.Equal(t, []string{"key2", "key3", "key4"}, evicted)
+
+	// 优先级更高的不会因为最近没有被访问而被淘汰
+	_ = cache.Set(ctx, "high", testStructForPriority{priority: 1}, 0)
+	_ = cache.Get(ctx, "key1")
+	_ = cache.Get(ctx, "key6")
+	_ = cache.Set(ctx, "key7", "value7", 0)
+	assert.Equal(t, []string{"key2", "key3", "key4", "key5", "key1"}, evicted)
+}
+
+func TestRBTreePriorityCache_customPriority(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	cache, _ := newRBTreePriorityCache(WithCacheLimit(3),
+		WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+			if evt.Reason == evict.ReasonCapacity {
+				evicted = append(evicted, evt.Key)
+			}
+		})))
+
+	require.NoError(t, cache.SetWithPriority(ctx, "high", "value", 0, 10))
+	// 指定的优先级比 Priority 接口优先
+	require.NoError(t, cache.Set(ContextWithPriority(ctx, 5), "struct", testStructForPriority{priority: 100}, 0))
+	// 计数器和集合创建的时候也可以指定优先级
+	_, err := cache.IncrBy(ContextWithPriority(ctx, 1), "counter", 1)
+	require.NoError(t, err)
+
+	_, err = cache.SAdd(ctx, "set", "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"counter"}, evicted)
+
+	// 原地修改不会清除指定的优先级
+	_, err = cache.SAdd(ContextWithPriority(ctx, 20), "set", "b")
+	require.NoError(t, err)
+	_ = cache.Set(ctx, "key1", "value1", 0)
+	assert.Equal(t, []string{"counter", "struct"}, evicted)
+
+	// SetPriority 修改已经存在的 key
+	require.NoError(t, cache.SetPriority(ctx, "key1", 30))
+	assert.Equal(t, errs.ErrKeyNotExist, cache.SetPriority(ctx, "missing", 1))
+	_ = cache.Set(ctx, "key2", "value2", 0)
+	assert.Equal(t, []string{"counter", "struct", "high"}, evicted)
+
+	// Set 覆盖整个键值对，没有指定优先级的时候回到默认优先级
+	_ = cache.Set(ctx, "key1", "value1", 0)
+	_ = cache.Set(ctx, "key3", "value3", 0)
+	assert.Equal(t, []string{"counter", "struct", "high", "key2"}, evicted)
+	_ = cache.Set(ctx, "key4", "value4", 0)
+	assert.Equal(t, []string{"counter", "struct", "high", "key2", "key1"}, evicted)
+
+	// 过期的 key 不能修改优先级
+	_ = cache.Set(ctx, "expired", "value", time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, errs.ErrKeyNotExist, cache.SetPriority(ctx, "expired", 1))
+}
+
+func TestRBTreePriorityCache_evictExpiredFirst(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	cache, _ := newRBTreePriorityCache(WithCacheLimit(2),
+		WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+			events = append(events, evt)
+		})))
+
+	_ = cache.Set(ctx, "key1", testStructForPriority{priority: 10}, time.Millisecond)
+	_ = cache.Set(ctx, "key2", "value2", 0)
+	time.Sleep(2 * time.Millisecond)
+	// key1 的优先级更高，但是已经过期了
+	_ = cache.Set(ctx, "key3", "value3", 0)
+	assert.Equal(t, []evict.Event{
+		{Key: "key1", Value: testStructForPriority{priority: 10}, Reason: evict.ReasonExpired},
+	}, events)
+	assert.Equal(t, 2, cache.policy.priorityData.Len())
+	assert.Equal(t, 0, cache.policy.expirationData.Len())
+}
+
+func TestRBTreePriorityCache_scoreFunc(t *testing.T) {
+	testCases := []struct {
+		name      string
+		scoreFunc ScoreFunc
+		before    func(cache *RBTreePriorityCache)
+		wantKeys  []string
+	}{
+		{
+			name: "larger first",
+			scoreFunc: func(meta NodeMeta) float64 {
+				return float64(meta.Priority) - float64(meta.Size)
+			},
+			before: func(cache *RBTreePriorityCache) {
+				ctx := context.Background()
+				_ = cache.Set(ctx, "key1", "v", 0)
+				_ = cache.Set(ctx, "key2", strings.Repeat("v", 100), 0)
+				_ = cache.Set(ctx, "key3", "vv", 0)
+				_ = cache.Set(ctx, "key4", "vvv", 0)
+			},
+			wantKeys: []string{"key1", "key3", "key4"},
+		},
+		{
+			name: "grown list",
+			scoreFunc: func(meta NodeMeta) float64 {
+				return -float64(meta.Size)
+			},
+			before: func(cache *RBTreePriorityCache) {
+				ctx := context.Background()
+				_, _ = cache.LPush(ctx, "list", "a")
+				_ = cache.Set(ctx, "key1", "value1", 0)
+				_ = cache.Set(ctx, "key2", "value2", 0)
+				_, _ = cache.LPush(ctx, "list", strings.Repeat("v", 100))
+				_ = cache.Set(ctx, "key3", "v", 0)
+			},
+			wantKeys: []string{"key1", "key2", "key3"},
+		},
+		{
+			name: "closer to expiry first",
+			scoreFunc: func(meta NodeMeta) float64 {
+				if meta.TTL == 0 {
+					return math.MaxFloat64
+				}
+				return meta.TTL.Seconds()
+			},
+			before: func(cache *RBTreePriorityCache) {
+				ctx := context.Background()
+				_ = cache.Set(ctx, "key1", "value1", time.Hour)
+				_ = cache.Set(ctx, "key2", "value2", time.Minute)
+				_ = cache.Set(ctx, "key3", "value3", 0)
+				_ = cache.Set(ctx, "key4", "value4", 2*time.Minute)
+			},
+			wantKeys: []string{"key1", "key3", "key4"},
+		},
+		{
+			name: "access count",
+			scoreFunc: func(meta NodeMeta) float64 {
+				return float64(meta.AccessCount)
+			},
+			before: func(cache *RBTreePriorityCache) {
+				ctx := context.Background()
+				_ = cache.Set(ctx, "key1", "value1", 0)
+				_ = cache.Set(ctx, "key2", "value2", 0)
+				_ = cache.Set(ctx, "key3", "value3", 0)
+				_ = cache.Get(ctx, "key1")
+				_ = cache.Get(ctx, "key3")
+				_ = cache.Set(ctx, "key4", "value4", 0)
+			},
+			wantKeys: []string{"key1", "key3", "key4"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cache, _ := newRBTreePriorityCache(WithCacheLimit(3), WithScoreFunc(tc.scoreFunc))
+			tc.before(cache)
+			keys, _ := cache.policy.cacheData.KeyValues()
+			assert.ElementsMatch(t, tc.wantKeys, keys)
+			assert.Equal(t, int64(0), cache.Bytes())
+		})
+	}
+}
+
+func TestRBTreePriorityCache_priorityAging(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := newRBTreePriorityCache(WithCacheLimit(2), WithPriorityAging(10*time.Millisecond))
+
+	_ = cache.Set(ctx, "high", testStructForPriority{priority: 1}, 0)
+	_ = cache.Set(ctx, "low", testStructForPriority{priority: 0}, 0)
+	// 还没有衰减，淘汰优先级低的
+	_ = cache.Set(ctx, "key1", testStructForPriority{priority: 0}, 0)
+	keys, _ := cache.policy.cacheData.KeyValues()
+	assert.ElementsMatch(t, []string{"high", "key1"}, keys)
+
+	time.Sleep(30 * time.Millisecond)
+	_ = cache.Get(ctx, "key1")
+	cache.store.Do(func(*memory.Core) {
+		cache.policy.rescore(time.Now())
+	})
+	// high 很久没有被访问，优先级衰减到了 key1 之下
+	_ = cache.Set(ctx, "key2", testStructForPriority{priority: 0}, 0)
+	keys, _ = cache.policy.cacheData.KeyValues()
+	assert.ElementsMatch(t, []string{"key1", "key2"}, keys)
+}
@@ -0,0 +1,38 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import "time"
+
+// NodeMeta 计算淘汰分数时用到的缓存结点元数据
+type NodeMeta struct {
+	Key string
+	// Priority 结点的优先级，设置了 WithPriorityAging 的时候是衰减之后的值
+	Priority int
+	// TTL 剩余的有效期，0 表示永不过期，已经过期的结点是负数
+	TTL time.Duration
+	// Size 键值对占用的字节数，由 memory.SizeOf 估算
+	Size int64
+	// AccessCount 结点被读写的次数
+	AccessCount uint64
+	// Age 结点从创建到现在的时长
+	Age time.Duration
+	// Idle 结点从最近一次被读写到现在的时长
+	Idle time.Duration
+}
+
+// ScoreFunc 根据元数据计算缓存结点的淘汰分数，分数越低越先被淘汰，
+// 分数相同的时候最久没有被访问的结点先淘汰
+type ScoreFunc func(meta NodeMeta) float64
@@ -0,0 +1,120 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/snapshot"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/ecodeclub/ekit/list"
+	"github.com/ecodeclub/ekit/set"
+)
+
+// WithCodec 设置 Snapshot 和 Restore 编码值使用的 Codec，默认是 snapshot.GobCodec
+func WithCodec(codec snapshot.Codec) option.Option[RBTreePriorityCache] {
+	return func(opt *RBTreePriorityCache) {
+		opt.codec = codec
+	}
+}
+
+// Snapshot 把没有过期的键值对按照从最久没有访问到最近访问的顺序写入 w，
+// 通过 ContextWithPriority 或者 SetPriority 指定的优先级也会写入快照
+// 持有锁的时候只复制键值对，编码和写入都在锁外进行
+func (r *RBTreePriorityCache) Snapshot(w io.Writer) error {
+	var entries []snapshot.Entry
+	r.store.View(func(core *memory.Core) {
+		nodes := make([]*rbTreeCacheNode, 0, core.Len())
+		for _, node := range r.policy.priorityData.nodes {
+			if _, ok := core.Lookup(node.key); ok {
+				nodes = append(nodes, node)
+			}
+		}
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].accessSeq < nodes[j].accessSeq
+		})
+		entries = make([]snapshot.Entry, 0, len(nodes))
+		for _, node := range nodes {
+			ent, _ := core.Lookup(node.key)
+			e := snapshot.Entry{
+				Key:         ent.Key,
+				ExpiresAt:   ent.ExpiresAt,
+				Priority:    node.customPriority,
+				HasPriority: node.hasCustomPriority,
+			}
+			e.Kind, e.Value = snapshotValue(ent.Value)
+			entries = append(entries, e)
+		}
+	})
+
+	sw, err := snapshot.NewWriter(w, r.codec)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = sw.Write(e); err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
+
+// snapshotValue 列表和集合复制成 []any，避免在锁外访问
+func snapshotValue(val any) (snapshot.Kind, any) {
+	switch v := val.(type) {
+	case *list.LinkedList[any]:
+		return snapshot.KindList, v.AsSlice()
+	case *set.MapSet[any]:
+		return snapshot.KindSet, v.Keys()
+	default:
+		return snapshot.KindOf(val), val
+	}
+}
+
+// Restore 读取 Snapshot 写入的键值对，覆盖已经存在的 key，
+// 恢复之后指定的优先级和同一个优先级里面的访问顺序都和快照一致
+// 已经过期的键值对会被跳过，快照损坏的时候返回错误并且不会修改缓存
+func (r *RBTreePriorityCache) Restore(reader io.Reader) error {
+	entries, err := snapshot.ReadAll(reader, r.codec, time.Now())
+	if err != nil {
+		return err
+	}
+	r.store.Do(func(core *memory.Core) {
+		for _, e := range entries {
+			core.SetDeadline(e.Key, r.restoreValue(e), e.ExpiresAt)
+			r.policy.setPriority(e.Key, e.Priority, e.HasPriority)
+		}
+	})
+	return nil
+}
+
+func (r *RBTreePriorityCache) restoreValue(e snapshot.Entry) any {
+	switch e.Kind {
+	case snapshot.KindList:
+		return list.NewLinkedListOf[any](e.Value.([]any))
+	case snapshot.KindSet:
+		elems := e.Value.([]any)
+		s := set.NewMapSet[any](len(elems))
+		for _, elem := range elems {
+			s.Add(elem)
+		}
+		return s
+	default:
+		return e.Value
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/snapshot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type snapshotStructForPriority struct {
+	Weight int
+}
+
+func (s snapshotStructForPriority) Priority() int {
+	return s.Weight
+}
+
+func init() {
+	gob.Register(snapshotStructForPriority{})
+}
+
+func TestRBTreePriorityCache_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := newRBTreePriorityCache()
+	require.NoError(t, cache.SetWithPriority(ctx, "high", "value", time.Minute, 10))
+	require.NoError(t, cache.Set(ctx, "struct", snapshotStructForPriority{Weight: 5}, 0))
+	require.NoError(t, cache.Set(ctx, "expired", "value", time.Millisecond))
+	_, err := cache.LPush(ctx, "list", "a", "b")
+	require.NoError(t, err)
+	_, err = cache.SAdd(ContextWithPriority(ctx, 3), "set", "a", 1)
+	require.NoError(t, err)
+	_, err = cache.IncrBy(ctx, "int", 3)
+	require.NoError(t, err)
+	_, err = cache.IncrByFloat(ctx, "float", 1.5)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+
+	var buf bytes.Buffer
+	require.NoError(t, cache.Snapshot(&buf))
+
+	restored, _ := newRBTreePriorityCache()
+	require.NoError(t, restored.Set(ctx, "high", "old", 0))
+	require.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+
+	assert.Equal(t, "value", restored.Get(ctx, "high").Val)
+	assert.Equal(t, snapshotStructForPriority{Weight: 5}, restored.Get(ctx, "struct").Val)
+	assert.Equal(t, errs.ErrKeyNotExist, restored.Get(ctx, "expired").Err)
+	n, err := restored.SRem(ctx, "set", "a", 1, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	num, err := restored.IncrBy(ctx, "int", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), num)
+	f, err := restored.IncrByFloat(ctx, "float", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+
+	high, err := restored.policy.cacheData.Find("high")
+	require.NoError(t, err)
+	assert.Equal(t, 10, high.priority)
+	assert.True(t, high.hasCustomPriority)
+	assert.False(t, high.beforeDeadline(time.Now().Add(time.Minute)))
+	assert.Equal(t, 1, restored.policy.expirationData.Len())
+	structNode, err := restored.policy.cacheData.Find("struct")
+	require.NoError(t, err)
+	assert.Equal(t, 5, structNode.priority)
+	assert.False(t, structNode.hasCustomPriority)
+	assert.Equal(t, cache.LPop(ctx, "list").Val, restored.LPop(ctx, "list").Val)
+}
+
+func TestRBTreePriorityCache_Restore_order(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := newRBTreePriorityCache()
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		require.NoError(t, cache.Set(ctx, key, key, 0))
+	}
+	require.NoError(t, cache.Set(ctx, "high", snapshotStructForPriority{Weight: 1}, 0))
+	require.NoError(t, cache.Get(ctx, "key1").Err)
+	var buf bytes.Buffer
+	require.NoError(t, cache.Snapshot(&buf))
+
+	// 容量不够的时候按照优先级和访问顺序淘汰
+	restored, _ := newRBTreePriorityCache(WithCacheLimit(3))
+	require.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+	keys, _ := restored.policy.cacheData.KeyValues()
+	assert.ElementsMatch(t, []string{"key4", "high", "key1"}, keys)
+}
+
+func TestRBTreePriorityCache_Restore_invalid(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := newRBTreePriorityCache()
+	require.NoError(t, cache.Set(ctx, "key1", "value1", 0))
+	var buf bytes.Buffer
+	require.NoError(t, cache.Snapshot(&buf))
+	data := buf.Bytes()
+
+	restored, _ := newRBTreePriorityCache()
+	err := restored.Restore(bytes.NewReader(data[:len(data)-1]))
+	assert.ErrorIs(t, err, snapshot.ErrInvalidSnapshot)
+	assert.Equal(t, errs.ErrKeyNotExist, restored.Get(ctx, "key1").Err)
+}
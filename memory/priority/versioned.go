@@ -0,0 +1,72 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"context"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/memory/internal/datatype"
+)
+
+var _ ecache.CASCache = (*RBTreePriorityCache)(nil)
+
+// CompareAndSwap 当前的值等于 oldVal 的时候写入 newVal，和 Set 一样会使用 ctx 里面指定的优先级
+func (r *RBTreePriorityCache) CompareAndSwap(ctx context.Context, key string, oldVal, newVal any, expiration time.Duration) (err error) {
+	r.do(func(l locked) {
+		val := l.Get(ctx, key)
+		if val.Err != nil {
+			err = val.Err
+			return
+		}
+		if !datatype.Equal(val.Val, oldVal) {
+			err = &ecache.ConflictError{Key: key}
+			return
+		}
+		err = l.Set(ctx, key, newVal, expiration)
+	})
+	return
+}
+
+func (r *RBTreePriorityCache) GetWithVersion(ctx context.Context, key string) (res ecache.VersionedValue) {
+	r.do(func(l locked) {
+		res.Value = l.Get(ctx, key)
+		if res.Err != nil {
+			return
+		}
+		ent, _ := l.core.Lookup(key)
+		res.Version = ent.Version
+	})
+	return
+}
+
+func (r *RBTreePriorityCache) SetIfVersion(ctx context.Context, key string, val any, version int64, expiration time.Duration) (res int64, err error) {
+	r.do(func(l locked) {
+		var cur int64
+		if l.Get(ctx, key).Err == nil {
+			ent, _ := l.core.Lookup(key)
+			cur = ent.Version
+		}
+		if cur != version {
+			err = &ecache.ConflictError{Key: key, Version: cur}
+			return
+		}
+		_ = l.Set(ctx, key, val, expiration)
+		ent, _ := l.core.Lookup(key)
+		res = ent.Version
+	})
+	return
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRBTreePriorityCache_CompareAndSwap(t *testing.T) {
+	testCases := []struct {
+		name    string
+		before  func(c *RBTreePriorityCache)
+		oldVal  any
+		newVal  any
+		wantErr error
+		wantVal any
+	}{
+		{
+			name:    "key not exist",
+			before:  func(c *RBTreePriorityCache) {},
+			oldVal:  "a",
+			newVal:  "b",
+			wantErr: errs.ErrKeyNotExist,
+		},
+		{
+			name: "swapped",
+			before: func(c *RBTreePriorityCache) {
+				_ = c.Set(context.Background(), "key", "a", time.Minute)
+			},
+			oldVal:  "a",
+			newVal:  "b",
+			wantVal: "b",
+		},
+		{
+			name: "conflict",
+			before: func(c *RBTreePriorityCache) {
+				_ = c.Set(context.Background(), "key", "c", time.Minute)
+			},
+			oldVal:  "a",
+			newVal:  "b",
+			wantErr: ecache.ErrConflict,
+			wantVal: "c",
+		},
+		{
+			name: "different type",
+			before: func(c *RBTreePriorityCache) {
+				_, _ = c.IncrBy(context.Background(), "key", 1)
+			},
+			oldVal:  1,
+			newVal:  2,
+			wantErr: ecache.ErrConflict,
+			wantVal: int64(1),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewRBTreePriorityCache()
+			require.NoError(t, err)
+			tc.before(c)
+			err = c.CompareAndSwap(context.Background(), "key", tc.oldVal, tc.newVal, 0)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if tc.wantVal == nil {
+				return
+			}
+			val := c.Get(context.Background(), "key")
+			require.NoError(t, val.Err)
+			assert.Equal(t, tc.wantVal, val.Val)
+		})
+	}
+}
+
+func TestRBTreePriorityCache_CompareAndSwap_expiration(t *testing.T) {
+	c, err := NewRBTreePriorityCache()
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "key", "a", time.Minute))
+	require.NoError(t, c.CompareAndSwap(ctx, "key", "a", "b", time.Millisecond))
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key").Err)
+}
+
+func TestRBTreePriorityCache_SetIfVersion(t *testing.T) {
+	c, err := NewRBTreePriorityCache()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	val := c.GetWithVersion(ctx, "key")
+	assert.Equal(t, errs.ErrKeyNotExist, val.Err)
+
+	v1, err := c.SetIfVersion(ctx, "key", "a", 0, time.Minute)
+	require.NoError(t, err)
+	val = c.GetWithVersion(ctx, "key")
+	require.NoError(t, val.Err)
+	assert.Equal(t, "a", val.Val)
+	assert.Equal(t, v1, val.Version)
+
+	_, err = c.SetIfVersion(ctx, "key", "b", 0, time.Minute)
+	var conflict *ecache.ConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, v1, conflict.Version)
+
+	v2, err := c.SetIfVersion(ctx, "key", "b", v1, time.Minute)
+	require.NoError(t, err)
+	assert.NotEqual(t, v1, v2)
+
+	// 其它方法写入之后版本号也会变化，不会被当作不存在的 key
+	require.NoError(t, c.Set(ctx, "key", "c", time.Minute))
+	_, err = c.SetIfVersion(ctx, "key", "d", v2, time.Minute)
+	assert.ErrorIs(t, err, ecache.ErrConflict)
+	_, err = c.SetIfVersion(ctx, "key", "d", 0, time.Minute)
+	assert.ErrorIs(t, err, ecache.ErrConflict)
+	val = c.GetWithVersion(ctx, "key")
+	assert.NotEqual(t, int64(0), val.Version)
+	assert.NotEqual(t, v2, val.Version)
+	require.NoError(t, c.Set(ctx, "key", "c", time.Minute))
+	_, err = c.SetIfVersion(ctx, "key", "d", val.Version, time.Minute)
+	assert.ErrorIs(t, err, ecache.ErrConflict)
+
+	// 删除之后重新写入也不会复用版本号
+	_, err = c.Delete(ctx, "key")
+	require.NoError(t, err)
+	v3, err := c.SetIfVersion(ctx, "key", "e", 0, time.Minute)
+	require.NoError(t, err)
+	assert.NotEqual(t, v1, v3)
+	assert.NotEqual(t, v2, v3)
+
+	// 原地修改集合之后版本号也会变化
+	_, err = c.SAdd(ctx, "set", "a", "b")
+	require.NoError(t, err)
+	v4 := c.GetWithVersion(ctx, "set").Version
+	_, err = c.SRem(ctx, "set", "a")
+	require.NoError(t, err)
+	_, err = c.SetIfVersion(ctx, "set", c.Get(ctx, "set").Val, v4, time.Minute)
+	assert.ErrorIs(t, err, ecache.ErrConflict)
+}
+
+func TestRBTreePriorityCache_SetIfVersion_concurrent(t *testing.T) {
+	c, err := NewRBTreePriorityCache()
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = c.SetIfVersion(ctx, "cnt", int64(0), 0, 0)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					val := c.GetWithVersion(ctx, "cnt")
+					n, _ := val.Int64()
+					_, err := c.SetIfVersion(ctx, "cnt", n+1, val.Version, 0)
+					if err == nil {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	n, err := c.Get(ctx, "cnt").Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(800), n)
+}
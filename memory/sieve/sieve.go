@@ -0,0 +1,95 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sieve
+
+import (
+	"sync/atomic"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/internal/linkedlist"
+)
+
+var _ memory.ConcurrentAccessPolicy = (*Policy)(nil)
+
+type entry struct {
+	key string
+	// visited 上一次被指针扫过之后有没有被访问过
+	// OnAccess 只持有读锁，所以需要原子操作
+	visited atomic.Bool
+}
+
+// Policy SIEVE 淘汰策略，适合读多写少并且并发很高的场景
+//
+// 所有的 key 按照写入顺序排成一个 FIFO 队列，新的 key 放在队头。
+// 命中的时候只是把 visited 置为 true，不需要移动结点，所以 memory.Store 的 Get 只需要读锁。
+// 淘汰的时候 hand 从队尾往队头扫描，遇到 visited 的 key 就清除标记并跳过，
+// 遇到没有被访问过的 key 就淘汰它，hand 停在原地等待下一次淘汰
+type Policy struct {
+	data  map[string]*linkedlist.Element[*entry]
+	queue *linkedlist.List[*entry]
+	hand  *linkedlist.Element[*entry]
+}
+
+func NewPolicy() *Policy {
+	return &Policy{
+		data:  make(map[string]*linkedlist.Element[*entry]),
+		queue: linkedlist.New[*entry](),
+	}
+}
+
+func (p *Policy) ConcurrentAccess() {}
+
+func (p *Policy) OnInsert(key string) {
+	p.data[key] = p.queue.PushFront(&entry{key: key})
+}
+
+// OnAccess 只会被读锁保护，所以只能读 data
+func (p *Policy) OnAccess(key string) {
+	if elem, ok := p.data[key]; ok {
+		elem.Value.visited.Store(true)
+	}
+}
+
+func (p *Policy) OnRemove(key string, _ evict.Reason) {
+	elem, ok := p.data[key]
+	if !ok {
+		return
+	}
+	if p.hand == elem {
+		p.hand = elem.Prev()
+	}
+	p.queue.Remove(elem)
+	delete(p.data, key)
+}
+
+// Victim 移动 hand 找到一个没有被访问过的 key
+func (p *Policy) Victim() (string, bool) {
+	hand := p.hand
+	for {
+		if hand == nil {
+			hand = p.queue.Back()
+			if hand == nil {
+				return "", false
+			}
+		}
+		if !hand.Value.visited.Load() {
+			p.hand = hand
+			return hand.Value.key, true
+		}
+		hand.Value.visited.Store(false)
+		hand = hand.Prev()
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sieve
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/lru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keysOf 从队头到队尾返回所有的 key
+func keysOf(t *testing.T, p *Policy) []string {
+	var res []string
+	for elem := p.queue.Front(); elem != nil; elem = elem.Next() {
+		require.Same(t, elem, p.data[elem.Value.key])
+		res = append(res, elem.Value.key)
+	}
+	require.Equal(t, len(p.data), len(res))
+	return res
+}
+
+func TestPolicy_evict(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	p := NewPolicy()
+	s := memory.NewStore(4, p, memory.WithEvictListener(
+		evict.ListenerFunc(func(evt evict.Event) {
+			events = append(events, evt)
+		})))
+	defer s.Close()
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, s.Set(ctx, fmt.Sprintf("key%d", i), i, 0))
+	}
+	assert.Equal(t, []string{"key4", "key3", "key2", "key1"}, keysOf(t, p))
+
+	// key1 被访问过，跳过它淘汰 key2
+	require.NoError(t, s.Get(ctx, "key1").Err)
+	require.NoError(t, s.Set(ctx, "key5", 5, 0))
+	assert.Equal(t, []string{"key5", "key4", "key3", "key1"}, keysOf(t, p))
+	assert.False(t, p.data["key1"].Value.visited.Load())
+	assert.Equal(t, "key3", p.hand.Value.key)
+
+	// hand 从上一次停下的位置继续
+	_ = s.Get(ctx, "key1")
+	require.NoError(t, s.Set(ctx, "key6", 6, 0))
+	assert.Equal(t, []string{"key6", "key5", "key4", "key1"}, keysOf(t, p))
+	assert.Equal(t, "key4", p.hand.Value.key)
+
+	// 所有 key 都被访问过的时候转一圈回来
+	for _, key := range []string{"key6", "key5", "key4", "key1"} {
+		_ = s.Get(ctx, key)
+	}
+	require.NoError(t, s.Set(ctx, "key7", 7, 0))
+	assert.Equal(t, []string{"key7", "key6", "key5", "key1"}, keysOf(t, p))
+
+	assert.Equal(t, []evict.Event{
+		{Key: "key2", Value: 2, Reason: evict.ReasonCapacity},
+		{Key: "key3", Value: 3, Reason: evict.ReasonCapacity},
+		{Key: "key4", Value: 4, Reason: evict.ReasonCapacity},
+	}, events)
+}
+
+func TestPolicy_removeHand(t *testing.T) {
+	ctx := context.Background()
+	p := NewPolicy()
+	s := memory.NewStore(3, p)
+	defer s.Close()
+	require.NoError(t, s.Set(ctx, "key1", 1, 0))
+	require.NoError(t, s.Set(ctx, "key2", 2, 0))
+	require.NoError(t, s.Set(ctx, "key3", 3, 0))
+	_ = s.Get(ctx, "key1")
+	require.NoError(t, s.Set(ctx, "key4", 4, 0))
+	require.Equal(t, "key3", p.hand.Value.key)
+
+	// 删除 hand 指向的 key，hand 往队头移动
+	n, err := s.Delete(ctx, "key3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, "key4", p.hand.Value.key)
+	assert.Equal(t, []string{"key4", "key1"}, keysOf(t, p))
+
+	// hand 走到队头之后回到队尾
+	_, err = s.Delete(ctx, "key4")
+	require.NoError(t, err)
+	assert.Nil(t, p.hand)
+	require.NoError(t, s.Set(ctx, "key5", 5, 0))
+	require.NoError(t, s.Set(ctx, "key6", 6, 0))
+	require.NoError(t, s.Set(ctx, "key7", 7, 0))
+	assert.Equal(t, []string{"key7", "key6", "key5"}, keysOf(t, p))
+}
+
+func BenchmarkStore_Get_Parallel(b *testing.B) {
+	testCases := []struct {
+		name  string
+		cache ecache.Cache
+	}{
+		{name: "sieve", cache: memory.NewStore(4096, NewPolicy())},
+		{name: "lru", cache: lru.NewCache(4096)},
+	}
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			ctx := context.Background()
+			const keys = 1024
+			for i := 0; i < keys; i++ {
+				_ = tc.cache.Set(ctx, strconv.Itoa(i), i, time.Hour)
+			}
+			var seq atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(seq.Add(1))
+				for pb.Next() {
+					_ = tc.cache.Get(ctx, strconv.Itoa(i%keys))
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestNewCache(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	c := NewCache(2, memory.WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+		evicted = append(evicted, evt.Key)
+	})))
+	defer c.Close()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), i, 0))
+	}
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, 3, c.Get(ctx, "key3").Val)
+}
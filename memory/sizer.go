@@ -0,0 +1,82 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"reflect"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ekit/list"
+	"github.com/ecodeclub/ekit/set"
+)
+
+// Sizer 值可以实现这个接口，告诉缓存自己占用的字节数
+type Sizer interface {
+	Size() int
+}
+
+// SizeOf 估算一个值占用的字节数，按照字节数限制容量的缓存用它来计算内存占用
+// 实现了 Sizer 的值以 Size 为准；字符串和 []byte 按照长度计算；数字按照类型的大小计算；
+// 内置的 list 和 set 类型按照所有元素的大小之和计算；
+// 其余的类型只计算值本身的大小，不会跟随指针，需要精确计算的时候应该实现 Sizer
+func SizeOf(val any) int {
+	switch v := val.(type) {
+	case nil:
+		return 0
+	case Sizer:
+		return v.Size()
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, uint, int64, uint64, uintptr, float64, complex64:
+		return 8
+	case complex128:
+		return 16
+	case ecache.Value:
+		return SizeOf(v.Val)
+	case list.List[any]:
+		return sizeOfSlice(v.AsSlice())
+	case list.List[ecache.Value]:
+		res := 0
+		for _, elem := range v.AsSlice() {
+			res += SizeOf(elem.Val)
+		}
+		return res
+	case set.Set[any]:
+		return sizeOfSlice(v.Keys())
+	default:
+		return int(reflect.TypeOf(val).Size())
+	}
+}
+
+func sizeOfSlice(vals []any) int {
+	res := 0
+	for _, val := range vals {
+		res += SizeOf(val)
+	}
+	return res
+}
+
+// entrySize 一个键值对占用的字节数
+func entrySize(key string, val any) int64 {
+	return int64(len(key) + SizeOf(val))
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ekit"
+	"github.com/ecodeclub/ekit/list"
+	"github.com/ecodeclub/ekit/set"
+	"github.com/stretchr/testify/assert"
+)
+
+type sizedValue struct{}
+
+func (sizedValue) Size() int {
+	return 1024
+}
+
+func TestSizeOf(t *testing.T) {
+	l := list.NewLinkedList[any]()
+	_ = l.Append("abc", int64(1))
+	s := set.NewMapSet[any](4)
+	s.Add("abcd")
+	s.Add(int32(1))
+	testCases := []struct {
+		name string
+		val  any
+		want int
+	}{
+		{name: "nil", val: nil, want: 0},
+		{name: "sizer", val: sizedValue{}, want: 1024},
+		{name: "string", val: "hello", want: 5},
+		{name: "bytes", val: []byte("hello world"), want: 11},
+		{name: "bool", val: true, want: 1},
+		{name: "int16", val: int16(1), want: 2},
+		{name: "float32", val: float32(1), want: 4},
+		{name: "int64", val: int64(1), want: 8},
+		{name: "complex128", val: complex128(1), want: 16},
+		{name: "value", val: ecache.Value{AnyValue: ekit.AnyValue{Val: "hello"}}, want: 5},
+		{name: "list", val: l, want: 11},
+		{name: "value list", val: &list.ConcurrentList[ecache.Value]{
+			List: list.NewLinkedListOf[ecache.Value]([]ecache.Value{
+				{AnyValue: ekit.AnyValue{Val: "ab"}},
+				{AnyValue: ekit.AnyValue{Val: int64(1)}},
+			}),
+		}, want: 10},
+		{name: "set", val: s, want: 8},
+		{name: "struct", val: struct{ a, b int64 }{}, want: 16},
+		{name: "pointer", val: &struct{ a, b int64 }{}, want: 8},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, SizeOf(tc.val))
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Codec 把普通的值以及列表、集合里面的元素编码成字节
+// string、[]byte、int64 和 float64 类型的值由快照格式自己编码，不会经过 Codec
+type Codec interface {
+	Marshal(val any) ([]byte, error)
+	Unmarshal(data []byte) (any, error)
+}
+
+var _ Codec = GobCodec{}
+
+// GobCodec 默认的 Codec，使用 encoding/gob 编码
+// 除了基本类型以外，自定义的类型需要先调用 gob.Register 注册
+type GobCodec struct{}
+
+func (GobCodec) Marshal(val any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&val)
+	return buf.Bytes(), err
+}
+
+func (GobCodec) Unmarshal(data []byte) (any, error) {
+	var val any
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&val)
+	return val, err
+}
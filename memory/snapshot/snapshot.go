@@ -0,0 +1,410 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshot 定义了内存缓存的快照格式
+//
+// 快照以 magic 和版本号开头，后面是一条一条的键值对，最后以 kindEnd 结束：
+//
+//	magic "ECSS" | version uint8 | entry... | kindEnd
+//	entry: kind uint8 | flags uint8 | key | expiresAt varint | priority varint | payload
+//
+// 字符串和字节切片都是 uvarint 长度加内容，expiresAt 是过期时间的 Unix 纳秒，0 表示永不过期
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	magic = "ECSS"
+	// Version 当前的快照格式版本
+	Version uint8 = 1
+	// maxLen 单个字符串或者集合的最大长度
+	maxLen = 1 << 30
+	// maxPrealloc 按照快照里面的长度预先分配的上限，更长的内容按照实际读到的数据增长，
+	// 这样损坏的长度不会导致一次分配过多的内存
+	maxPrealloc = 64 << 10
+)
+
+const (
+	flagPriority uint8 = 1 << iota
+)
+
+var (
+	ErrInvalidSnapshot    = errors.New("ecache: 快照格式错误")
+	ErrUnsupportedVersion = errors.New("ecache: 不支持的快照版本")
+)
+
+// Kind 键值对的类型
+type Kind uint8
+
+const (
+	kindEnd Kind = iota
+	// KindValue 需要 Codec 编码的值
+	KindValue
+	KindString
+	KindBytes
+	// KindInt IncrBy 之类的计数器
+	KindInt
+	KindFloat
+	// KindList 列表，元素按照从头到尾的顺序保存在 []any 里面
+	KindList
+	// KindSet 集合，元素保存在 []any 里面
+	KindSet
+)
+
+// KindOf 返回普通的值对应的 Kind，列表和集合需要调用方自己判断
+func KindOf(val any) Kind {
+	switch val.(type) {
+	case string:
+		return KindString
+	case []byte:
+		return KindBytes
+	case int64:
+		return KindInt
+	case float64:
+		return KindFloat
+	default:
+		return KindValue
+	}
+}
+
+// Entry 快照里面的一个键值对
+type Entry struct {
+	Key  string
+	Kind Kind
+	// Value KindList 和 KindSet 是 []any，其余的是值本身
+	Value any
+	// ExpiresAt 过期时间，零值表示永不过期
+	ExpiresAt time.Time
+	// Priority HasPriority 为 true 的时候有效，记录单独为 key 指定的优先级
+	Priority    int
+	HasPriority bool
+}
+
+// Expired 在 now 时刻是否已经过期
+func (e Entry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Writer 按照快照格式写入键值对，写完之后必须调用 Close
+type Writer struct {
+	w     *bufio.Writer
+	codec Codec
+	buf   [binary.MaxVarintLen64]byte
+}
+
+// NewWriter 写入快照的头部，codec 为 nil 的时候使用 GobCodec
+func NewWriter(w io.Writer, codec Codec) (*Writer, error) {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	res := &Writer{w: bufio.NewWriter(w), codec: codec}
+	if _, err := res.w.WriteString(magic); err != nil {
+		return nil, err
+	}
+	if err := res.w.WriteByte(Version); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (w *Writer) Write(e Entry) error {
+	var flags uint8
+	if e.HasPriority {
+		flags |= flagPriority
+	}
+	var expiresAt int64
+	if !e.ExpiresAt.IsZero() {
+		expiresAt = e.ExpiresAt.UnixNano()
+	}
+	if err := w.w.WriteByte(byte(e.Kind)); err != nil {
+		return err
+	}
+	if err := w.w.WriteByte(flags); err != nil {
+		return err
+	}
+	if err := w.writeBytes([]byte(e.Key)); err != nil {
+		return err
+	}
+	if err := w.writeVarint(expiresAt); err != nil {
+		return err
+	}
+	if err := w.writeVarint(int64(e.Priority)); err != nil {
+		return err
+	}
+	return w.writePayload(e.Kind, e.Value)
+}
+
+func (w *Writer) writePayload(kind Kind, val any) error {
+	var ok bool
+	switch kind {
+	case KindString:
+		var s string
+		if s, ok = val.(string); ok {
+			return w.writeBytes([]byte(s))
+		}
+	case KindBytes:
+		var b []byte
+		if b, ok = val.([]byte); ok {
+			return w.writeBytes(b)
+		}
+	case KindInt:
+		var i int64
+		if i, ok = val.(int64); ok {
+			return w.writeVarint(i)
+		}
+	case KindFloat:
+		var f float64
+		if f, ok = val.(float64); ok {
+			binary.LittleEndian.PutUint64(w.buf[:8], math.Float64bits(f))
+			_, err := w.w.Write(w.buf[:8])
+			return err
+		}
+	case KindValue:
+		return w.writeValue(val)
+	case KindList, KindSet:
+		var elems []any
+		if elems, ok = val.([]any); ok {
+			if err := w.writeUvarint(uint64(len(elems))); err != nil {
+				return err
+			}
+			for _, elem := range elems {
+				if err := w.writeValue(elem); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		return fmt.Errorf("ecache: 未知的快照类型 %d", kind)
+	}
+	return fmt.Errorf("ecache: 快照类型 %d 和值的类型 %T 不匹配", kind, val)
+}
+
+func (w *Writer) writeValue(val any) error {
+	data, err := w.codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return w.writeBytes(data)
+}
+
+func (w *Writer) writeBytes(b []byte) error {
+	if err := w.writeUvarint(uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+func (w *Writer) writeUvarint(v uint64) error {
+	n := binary.PutUvarint(w.buf[:], v)
+	_, err := w.w.Write(w.buf[:n])
+	return err
+}
+
+func (w *Writer) writeVarint(v int64) error {
+	n := binary.PutVarint(w.buf[:], v)
+	_, err := w.w.Write(w.buf[:n])
+	return err
+}
+
+// Close 写入结束标记并且刷新缓冲区，不会关闭底层的 io.Writer
+func (w *Writer) Close() error {
+	if err := w.w.WriteByte(byte(kindEnd)); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// Reader 按照快照格式读取键值对
+type Reader struct {
+	r     *bufio.Reader
+	codec Codec
+}
+
+// NewReader 读取并且校验快照的头部，codec 为 nil 的时候使用 GobCodec
+func NewReader(r io.Reader, codec Codec) (*Reader, error) {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	res := &Reader{r: bufio.NewReader(r), codec: codec}
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(res.r, header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrInvalidSnapshot
+	}
+	if version := header[len(magic)]; version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	return res, nil
+}
+
+// Next 读取下一个键值对，读到结束标记的时候返回 io.EOF
+// 没有结束标记的快照是不完整的，返回 ErrInvalidSnapshot
+func (r *Reader) Next() (Entry, error) {
+	var e Entry
+	kind, err := r.r.ReadByte()
+	if err != nil {
+		return e, r.wrap(err)
+	}
+	e.Kind = Kind(kind)
+	if e.Kind == kindEnd {
+		return e, io.EOF
+	}
+	flags, err := r.r.ReadByte()
+	if err != nil {
+		return e, r.wrap(err)
+	}
+	e.HasPriority = flags&flagPriority != 0
+	key, err := r.readBytes()
+	if err != nil {
+		return e, err
+	}
+	e.Key = string(key)
+	expiresAt, err := binary.ReadVarint(r.r)
+	if err != nil {
+		return e, r.wrap(err)
+	}
+	if expiresAt != 0 {
+		e.ExpiresAt = time.Unix(0, expiresAt)
+	}
+	priority, err := binary.ReadVarint(r.r)
+	if err != nil {
+		return e, r.wrap(err)
+	}
+	e.Priority = int(priority)
+	e.Value, err = r.readPayload(e.Kind)
+	return e, err
+}
+
+func (r *Reader) readPayload(kind Kind) (any, error) {
+	switch kind {
+	case KindString:
+		b, err := r.readBytes()
+		return string(b), err
+	case KindBytes:
+		return r.readBytes()
+	case KindInt:
+		i, err := binary.ReadVarint(r.r)
+		return i, r.wrap(err)
+	case KindFloat:
+		var buf [8]byte
+		if _, err := io.ReadFull(r.r, buf[:]); err != nil {
+			return nil, r.wrap(err)
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), nil
+	case KindValue:
+		return r.readValue()
+	case KindList, KindSet:
+		n, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return nil, r.wrap(err)
+		}
+		if n > maxLen {
+			return nil, ErrInvalidSnapshot
+		}
+		elems := make([]any, 0, prealloc(n))
+		for i := uint64(0); i < n; i++ {
+			elem, err := r.readValue()
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+	default:
+		return nil, fmt.Errorf("%w: 未知的类型 %d", ErrInvalidSnapshot, kind)
+	}
+}
+
+func (r *Reader) readValue() (any, error) {
+	data, err := r.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	return r.codec.Unmarshal(data)
+}
+
+func (r *Reader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, r.wrap(err)
+	}
+	if n > maxLen {
+		return nil, ErrInvalidSnapshot
+	}
+	if n > maxPrealloc {
+		var buf bytes.Buffer
+		if _, err = io.CopyN(&buf, r.r, int64(n)); err != nil {
+			return nil, r.wrap(err)
+		}
+		return buf.Bytes(), nil
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(r.r, b); err != nil {
+		return nil, r.wrap(err)
+	}
+	return b, nil
+}
+
+// prealloc 长度为 n 的内容预先分配的容量
+func prealloc(n uint64) int {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return int(n)
+}
+
+// wrap 在结束标记之前读到末尾说明快照不完整
+func (r *Reader) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrInvalidSnapshot, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// ReadAll 读取快照里面的所有键值对，跳过在 now 时刻已经过期的
+func ReadAll(r io.Reader, codec Codec, now time.Time) ([]Entry, error) {
+	reader, err := NewReader(r, codec)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		e, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !e.Expired(now) {
+			entries = append(entries, e)
+		}
+	}
+}
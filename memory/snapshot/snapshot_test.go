@@ -0,0 +1,201 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{Key: "string", Kind: KindString, Value: "value"},
+		{Key: "bytes", Kind: KindBytes, Value: []byte("value"), ExpiresAt: now.Add(time.Minute)},
+		{Key: "int", Kind: KindInt, Value: int64(-12), Priority: 3, HasPriority: true},
+		{Key: "float", Kind: KindFloat, Value: 1.5, Priority: -1, HasPriority: true},
+		{Key: "value", Kind: KindValue, Value: 123},
+		{Key: "list", Kind: KindList, Value: []any{"a", 1, 2.5}},
+		{Key: "set", Kind: KindSet, Value: []any{"a"}},
+		{Key: "", Kind: KindString, Value: ""},
+		{Key: "large", Kind: KindBytes, Value: bytes.Repeat([]byte("a"), maxPrealloc+1)},
+	}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NoError(t, w.Write(e))
+	}
+	require.NoError(t, w.Close())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	for _, want := range entries {
+		got, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, want.Key, got.Key)
+		assert.Equal(t, want.Kind, got.Kind)
+		assert.Equal(t, want.Value, got.Value)
+		assert.Equal(t, want.Priority, got.Priority)
+		assert.Equal(t, want.HasPriority, got.HasPriority)
+		assert.True(t, want.ExpiresAt.Equal(got.ExpiresAt))
+	}
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSnapshot_write(t *testing.T) {
+	testCases := []struct {
+		name  string
+		entry Entry
+	}{
+		{
+			name:  "kind mismatch",
+			entry: Entry{Key: "key", Kind: KindInt, Value: "value"},
+		},
+		{
+			name:  "unknown kind",
+			entry: Entry{Key: "key", Kind: Kind(100), Value: "value"},
+		},
+		{
+			name:  "codec error",
+			entry: Entry{Key: "key", Kind: KindValue, Value: func() {}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := NewWriter(io.Discard, nil)
+			require.NoError(t, err)
+			assert.Error(t, w.Write(tc.entry))
+		})
+	}
+}
+
+func TestSnapshot_read(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(Entry{Key: "key", Kind: KindString, Value: "value"}))
+	require.NoError(t, w.Close())
+	valid := buf.Bytes()
+
+	testCases := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{
+			name:    "empty",
+			data:    nil,
+			wantErr: ErrInvalidSnapshot,
+		},
+		{
+			name:    "bad magic",
+			data:    []byte("XXXX\x01\x00"),
+			wantErr: ErrInvalidSnapshot,
+		},
+		{
+			name:    "unsupported version",
+			data:    []byte("ECSS\x02\x00"),
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "truncated",
+			data:    valid[:len(valid)-3],
+			wantErr: ErrInvalidSnapshot,
+		},
+		{
+			name:    "missing end",
+			data:    valid[:len(valid)-1],
+			wantErr: ErrInvalidSnapshot,
+		},
+		{
+			name:    "unknown kind",
+			data:    []byte("ECSS\x01\x64"),
+			wantErr: ErrInvalidSnapshot,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadAll(bytes.NewReader(tc.data), nil, time.Now())
+			assert.True(t, errors.Is(err, tc.wantErr), err)
+		})
+	}
+}
+
+// TestSnapshot_readHugeLength 损坏的长度不能导致按照长度一次分配内存
+func TestSnapshot_readHugeLength(t *testing.T) {
+	header := []byte("ECSS\x01")
+	// hugeLen 接近 maxLen 的长度，后面并没有这么多数据
+	hugeLen := binary.AppendUvarint(nil, maxLen)
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "key",
+			data: append(append(append(header, byte(KindString), 0), hugeLen...), 'k'),
+		},
+		{
+			name: "list",
+			data: append(append(header, byte(KindList), 0, 1, 'k', 0, 0), hugeLen...),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err := ReadAll(bytes.NewReader(tc.data), nil, time.Now())
+			runtime.ReadMemStats(&after)
+			assert.ErrorIs(t, err, ErrInvalidSnapshot)
+			assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16<<20))
+		})
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	now := time.Now()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, GobCodec{})
+	require.NoError(t, err)
+	require.NoError(t, w.Write(Entry{Key: "expired", Kind: KindString, Value: "value", ExpiresAt: now.Add(-time.Second)}))
+	require.NoError(t, w.Write(Entry{Key: "live", Kind: KindString, Value: "value", ExpiresAt: now.Add(time.Second)}))
+	require.NoError(t, w.Write(Entry{Key: "forever", Kind: KindString, Value: "value"}))
+	require.NoError(t, w.Close())
+
+	entries, err := ReadAll(&buf, GobCodec{}, now)
+	require.NoError(t, err)
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	assert.Equal(t, []string{"live", "forever"}, keys)
+}
+
+func TestKindOf(t *testing.T) {
+	assert.Equal(t, KindString, KindOf("value"))
+	assert.Equal(t, KindBytes, KindOf([]byte("value")))
+	assert.Equal(t, KindInt, KindOf(int64(1)))
+	assert.Equal(t, KindFloat, KindOf(1.5))
+	assert.Equal(t, KindValue, KindOf(1))
+}
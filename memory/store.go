@@ -0,0 +1,231 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/internal/datatype"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+var _ ecache.Cache = (*Store)(nil)
+
+const (
+	// cleanSampleSize 每一轮过期清理抽样检查的 key 数量
+	cleanSampleSize = 20
+	// cleanMaxRounds 每次过期清理最多执行的轮数
+	cleanMaxRounds = 16
+)
+
+// Store 淘汰策略可以插拔的本地缓存
+// 存储、过期时间和数据类型的操作只实现一次，不同的淘汰策略通过 EvictionPolicy 接入
+type Store struct {
+	lock sync.RWMutex
+	core *Core
+	// concurrentAccess policy 允许只持有读锁的时候调用 OnAccess
+	concurrentAccess bool
+	cycleInterval    time.Duration
+	closeOnce        sync.Once
+	done             chan struct{}
+}
+
+// NewStore 创建一个最多容纳 capacity 个键值对，使用 policy 淘汰数据的缓存
+func NewStore(capacity int, policy EvictionPolicy, opts ...option.Option[Store]) *Store {
+	_, concurrentAccess := policy.(ConcurrentAccessPolicy)
+	res := &Store{
+		core:             newCore(capacity, policy),
+		concurrentAccess: concurrentAccess,
+		cycleInterval:    time.Second,
+		done:             make(chan struct{}),
+	}
+	option.Apply(res, opts...)
+	if res.cycleInterval > 0 {
+		go res.cleanCycle()
+	}
+	return res
+}
+
+// WithEvictListener 设置淘汰事件的监听者，监听者会在释放锁之后被调用
+func WithEvictListener(listener evict.Listener) option.Option[Store] {
+	return func(s *Store) {
+		s.core.listener = listener
+	}
+}
+
+// WithMaxBytes 限制所有键值对占用的字节数，超出之后按照淘汰策略淘汰，和数量上限同时生效
+// 键值对的大小是 key 的长度加上 SizeOf 估算的值的大小，
+// 列表和集合每次修改都会重新估算，元素很多的时候开销不小
+func WithMaxBytes(maxBytes int64) option.Option[Store] {
+	return func(s *Store) {
+		s.core.maxBytes = maxBytes
+	}
+}
+
+// WithCycleInterval 设置过期清理的间隔，不大于 0 的时候不会定期清理
+func WithCycleInterval(interval time.Duration) option.Option[Store] {
+	return func(s *Store) {
+		s.cycleInterval = interval
+	}
+}
+
+// cleanCycle 定期抽样清理过期的 key，如果一轮里面超过四分之一的 key 过期了就继续下一轮
+func (s *Store) cleanCycle() {
+	ticker := time.NewTicker(s.cycleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		for i := 0; i < cleanMaxRounds; i++ {
+			s.lock.Lock()
+			expired := s.core.CleanExpired(cleanSampleSize)
+			s.unlock()
+			if expired*4 <= cleanSampleSize {
+				break
+			}
+		}
+	}
+}
+
+// Close 停止过期清理的 goroutine，不再使用的 Store 应该调用 Close
+// Close 之后仍然可以读写，过期的 key 只会在被访问或者被淘汰的时候删除
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// unlock 释放写锁，然后在锁外把持有锁期间产生的淘汰事件交给 listener
+func (s *Store) unlock() {
+	events := s.core.events
+	s.core.events = nil
+	s.lock.Unlock()
+	evict.Notify(s.core.listener, events)
+}
+
+// Do 持有写锁执行 fn，fn 里面可以对 c 执行多个操作，释放锁之后才会通知淘汰事件
+// fn 里面不能再调用 Store 的方法，否则会死锁
+func (s *Store) Do(fn func(c *Core)) {
+	s.lock.Lock()
+	defer s.unlock()
+	fn(s.core)
+}
+
+// View 持有读锁执行 fn，fn 里面只能调用 Core 的 Lookup 和 Len
+func (s *Store) View(fn func(c *Core)) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	fn(s.core)
+}
+
+// Bytes 当前所有键值对占用的字节数，没有设置 WithMaxBytes 的时候不统计，总是返回 0
+func (s *Store) Bytes() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.core.Bytes()
+}
+
+func (s *Store) Set(_ context.Context, key string, val any, expiration time.Duration) error {
+	s.lock.Lock()
+	defer s.unlock()
+	s.core.Set(key, val, expiration)
+	return nil
+}
+
+func (s *Store) SetNX(_ context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.SetNX(s.core, key, val, expiration), nil
+}
+
+// Get 淘汰策略实现了 ConcurrentAccessPolicy 的时候只加读锁
+func (s *Store) Get(_ context.Context, key string) (val ecache.Value) {
+	if s.concurrentAccess {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		var ok bool
+		val.Val, ok = s.core.peek(key)
+		if !ok {
+			val.Err = errs.ErrKeyNotExist
+		}
+		return
+	}
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.Get(s.core, key)
+}
+
+func (s *Store) GetSet(_ context.Context, key string, val string) ecache.Value {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.GetSet(s.core, key, val)
+}
+
+func (s *Store) Delete(ctx context.Context, key ...string) (int64, error) {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.Delete(ctx, s.core, key...)
+}
+
+func (s *Store) LPush(_ context.Context, key string, val ...any) (int64, error) {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.LPush(s.core, key, val...)
+}
+
+func (s *Store) LPop(_ context.Context, key string) ecache.Value {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.LPop(s.core, key)
+}
+
+func (s *Store) SAdd(_ context.Context, key string, members ...any) (int64, error) {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.SAdd(s.core, key, members...)
+}
+
+func (s *Store) SRem(_ context.Context, key string, members ...any) (int64, error) {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.SRem(s.core, key, members...)
+}
+
+func (s *Store) IncrBy(_ context.Context, key string, value int64) (int64, error) {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.IncrBy(s.core, key, value)
+}
+
+func (s *Store) DecrBy(_ context.Context, key string, value int64) (int64, error) {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.DecrBy(s.core, key, value)
+}
+
+func (s *Store) IncrByFloat(_ context.Context, key string, value float64) (float64, error) {
+	s.lock.Lock()
+	defer s.unlock()
+	return datatype.IncrByFloat(s.core, key, value)
+}
@@ -0,0 +1,298 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fifoPolicy 测试用的先进先出淘汰策略，记录每一次回调
+type fifoPolicy struct {
+	keys     []string
+	accessed []string
+	removed  []string
+}
+
+func (f *fifoPolicy) OnInsert(key string) {
+	f.keys = append(f.keys, key)
+}
+
+func (f *fifoPolicy) OnAccess(key string) {
+	f.accessed = append(f.accessed, key)
+}
+
+func (f *fifoPolicy) OnRemove(key string, reason evict.Reason) {
+	f.removed = append(f.removed, key+":"+reason.String())
+	for i, k := range f.keys {
+		if k == key {
+			f.keys = append(f.keys[:i], f.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+func (f *fifoPolicy) Victim() (string, bool) {
+	if len(f.keys) == 0 {
+		return "", false
+	}
+	return f.keys[0], true
+}
+
+// concurrentPolicy Get 只需要读锁的淘汰策略
+type concurrentPolicy struct {
+	fifoPolicy
+	lock sync.Mutex
+}
+
+func (c *concurrentPolicy) ConcurrentAccess() {}
+
+func (c *concurrentPolicy) OnAccess(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.fifoPolicy.OnAccess(key)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(100, &fifoPolicy{})
+	defer s.Close()
+
+	require.NoError(t, s.Set(ctx, "key1", "value1", time.Minute))
+	val, err := s.Get(ctx, "key1").String()
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+	assert.Equal(t, errs.ErrKeyNotExist, s.Get(ctx, "key2").Err)
+
+	ok, err := s.SetNX(ctx, "key1", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = s.SetNX(ctx, "key2", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	res := s.GetSet(ctx, "key1", "value3")
+	assert.Equal(t, "value1", res.Val)
+
+	n, err := s.Delete(ctx, "key1", "key2", "key3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = s.LPush(ctx, "list", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, "b", s.LPop(ctx, "list").Val)
+
+	n, err = s.SAdd(ctx, "set", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = s.SRem(ctx, "set", "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = s.IncrBy(ctx, "counter", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	n, err = s.DecrBy(ctx, "counter", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	f, err := s.IncrByFloat(ctx, "counter", 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+}
+
+func TestStore_policy(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	p := &fifoPolicy{}
+	s := NewStore(2, p, WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+		events = append(events, evt)
+	})))
+	defer s.Close()
+	require.NoError(t, s.Set(ctx, "key1", "value1", -time.Minute))
+	require.NoError(t, s.Set(ctx, "key2", "value2", 0))
+	require.NoError(t, s.Get(ctx, "key2").Err)
+	require.NoError(t, s.Set(ctx, "key2", "value3", 0))
+	// 被淘汰的 key 已经过期了，按照过期处理
+	require.NoError(t, s.Set(ctx, "key3", "value3", 0))
+	require.NoError(t, s.Set(ctx, "key4", "value4", 0))
+	_, err := s.Delete(ctx, "key3")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"key4"}, p.keys)
+	assert.Equal(t, []string{"key2", "key2"}, p.accessed)
+	assert.Equal(t, []string{"key1:expired", "key2:capacity", "key3:deleted"}, p.removed)
+	assert.Equal(t, []evict.Event{
+		{Key: "key2", Value: "value2", Reason: evict.ReasonReplaced},
+		{Key: "key1", Value: "value1", Reason: evict.ReasonExpired},
+		{Key: "key2", Value: "value3", Reason: evict.ReasonCapacity},
+		{Key: "key3", Value: "value3", Reason: evict.ReasonDeleted},
+	}, events)
+}
+
+func TestStore_expiration(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	s := NewStore(10, &fifoPolicy{}, WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+		events = append(events, evt)
+	})))
+	defer s.Close()
+	require.NoError(t, s.Set(ctx, "key1", "value1", -time.Minute))
+	require.NoError(t, s.Set(ctx, "key2", "value2", time.Minute))
+	require.NoError(t, s.Set(ctx, "key3", "value3", -time.Minute))
+	require.NoError(t, s.Set(ctx, "key4", "value4", -time.Minute))
+
+	assert.Equal(t, errs.ErrKeyNotExist, s.Get(ctx, "key1").Err)
+	n, err := s.Delete(ctx, "key3", "key2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	require.NoError(t, s.Set(ctx, "key4", "value5", time.Minute))
+	assert.Equal(t, []evict.Event{
+		{Key: "key1", Value: "value1", Reason: evict.ReasonExpired},
+		{Key: "key3", Value: "value3", Reason: evict.ReasonExpired},
+		{Key: "key2", Value: "value2", Reason: evict.ReasonDeleted},
+		{Key: "key4", Value: "value4", Reason: evict.ReasonExpired},
+	}, events)
+
+	for _, key := range []string{"expired1", "expired2", "expired3"} {
+		require.NoError(t, s.Set(ctx, key, key, -time.Minute))
+	}
+	s.lock.Lock()
+	assert.Equal(t, 3, s.core.CleanExpired(100))
+	s.unlock()
+	assert.Equal(t, "value5", s.Get(ctx, "key4").Val)
+}
+
+func TestStore_concurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	p := &concurrentPolicy{}
+	s := NewStore(10, p)
+	defer s.Close()
+	assert.True(t, s.concurrentAccess)
+	require.NoError(t, s.Set(ctx, "key1", "value1", 0))
+	require.NoError(t, s.Set(ctx, "key2", "value2", -time.Minute))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "value1", s.Get(ctx, "key1").Val)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 10, len(p.accessed))
+
+	// 只持有读锁的时候不会删除过期的 key
+	assert.Equal(t, errs.ErrKeyNotExist, s.Get(ctx, "key2").Err)
+	assert.Equal(t, []string{"key1", "key2"}, p.keys)
+}
+
+func TestStore_cleanCycle(t *testing.T) {
+	ctx := context.Background()
+	var (
+		lock   sync.Mutex
+		events []evict.Event
+	)
+	s := NewStore(100, &fifoPolicy{}, WithCycleInterval(time.Millisecond*10),
+		WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+			lock.Lock()
+			events = append(events, evt)
+			lock.Unlock()
+		})))
+	defer s.Close()
+	require.NoError(t, s.Set(ctx, "key1", "value1", time.Millisecond))
+	require.NoError(t, s.Set(ctx, "key2", "value2", time.Minute))
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(events) == 1
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, evict.Event{Key: "key1", Value: "value1", Reason: evict.ReasonExpired}, events[0])
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	assert.Equal(t, 1, len(s.core.data))
+}
+
+func TestStore_Close(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(100, &fifoPolicy{}, WithCycleInterval(time.Millisecond))
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Set(ctx, "key1", "value1", time.Millisecond))
+	time.Sleep(time.Millisecond * 20)
+
+	s.lock.Lock()
+	assert.Equal(t, 1, len(s.core.data))
+	s.lock.Unlock()
+	// 关闭之后过期的 key 仍然会在被访问的时候删除
+	assert.Equal(t, errs.ErrKeyNotExist, s.Get(ctx, "key1").Err)
+}
+
+func TestStore_maxBytes(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	p := &fifoPolicy{}
+	s := NewStore(100, p, WithMaxBytes(20), WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+		events = append(events, evt)
+	})))
+	defer s.Close()
+	assert.Equal(t, int64(0), s.Bytes())
+	// 每个键值对 4 + 4 = 8 字节
+	require.NoError(t, s.Set(ctx, "key1", "val1", 0))
+	require.NoError(t, s.Set(ctx, "key2", "val2", 0))
+	assert.Equal(t, int64(16), s.Bytes())
+	require.NoError(t, s.Set(ctx, "key3", "val3", 0))
+	assert.Equal(t, int64(16), s.Bytes())
+	assert.Equal(t, []string{"key2", "key3"}, p.keys)
+
+	// 覆盖之后变大，淘汰其它的 key
+	require.NoError(t, s.Set(ctx, "key3", "value3-longer", 0))
+	assert.Equal(t, int64(17), s.Bytes())
+	assert.Equal(t, []string{"key3"}, p.keys)
+
+	// 列表原地修改之后重新计算大小
+	_, err := s.Delete(ctx, "key3")
+	require.NoError(t, err)
+	_, err = s.LPush(ctx, "list", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), s.Bytes())
+	_, err = s.LPush(ctx, "list", "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), s.Bytes())
+	assert.Equal(t, "c", s.LPop(ctx, "list").Val)
+	assert.Equal(t, int64(6), s.Bytes())
+
+	// 单个超过上限的值会独占整个缓存
+	require.NoError(t, s.Set(ctx, "large", "0123456789abcdefghijklmn", 0))
+	assert.Equal(t, int64(29), s.Bytes())
+	assert.Equal(t, []string{"large"}, p.keys)
+
+	assert.Equal(t, []evict.Event{
+		{Key: "key1", Value: "val1", Reason: evict.ReasonCapacity},
+		{Key: "key3", Value: "val3", Reason: evict.ReasonReplaced},
+		{Key: "key2", Value: "val2", Reason: evict.ReasonCapacity},
+		{Key: "key3", Value: "value3-longer", Reason: evict.ReasonDeleted},
+		{Key: "list", Value: events[4].Value, Reason: evict.ReasonCapacity},
+	}, events)
+}
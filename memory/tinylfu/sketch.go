@@ -0,0 +1,184 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinylfu
+
+const (
+	// sketchDepth count-min sketch 的行数
+	sketchDepth = 4
+	// maxCounter 计数器的上限，和 Caffeine 一样使用 4 bit 的计数器
+	maxCounter = 15
+	// doorkeeperHashes doorkeeper 使用的哈希函数个数
+	doorkeeperHashes = 3
+)
+
+// nextPowerOfTwo 返回不小于 n 的最小的 2 的幂
+func nextPowerOfTwo(n int) int {
+	res := 1
+	for res < n {
+		res <<= 1
+	}
+	return res
+}
+
+// indexOf 用双重哈希从一个 64 位哈希值里面派生出第 i 个下标
+func indexOf(hash uint64, i int, mask uint64) uint64 {
+	h1 := hash & 0xffffffff
+	h2 := hash >> 32
+	return (h1 + uint64(i)*h2) & mask
+}
+
+// countMinSketch 估算 key 的访问频率
+// 每一行的计数器在累计到上限之后不再增长，
+// 每累计 sampleSize 次增加就把所有计数器减半，让历史上的热点逐渐冷却
+type countMinSketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := nextPowerOfTwo(capacity)
+	s := &countMinSketch{
+		mask:       uint64(width - 1),
+		sampleSize: 10 * capacity,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// increment 增加计数，返回这一次是否触发了减半
+func (s *countMinSketch) increment(hash uint64) bool {
+	added := false
+	for i := range s.rows {
+		idx := indexOf(hash, i, s.mask)
+		if s.rows[i][idx] < maxCounter {
+			s.rows[i][idx]++
+			added = true
+		}
+	}
+	if !added {
+		return false
+	}
+	s.additions++
+	if s.additions < s.sampleSize {
+		return false
+	}
+	s.reset()
+	return true
+}
+
+func (s *countMinSketch) estimate(hash uint64) int {
+	res := maxCounter
+	for i := range s.rows {
+		if cnt := int(s.rows[i][indexOf(hash, i, s.mask)]); cnt < res {
+			res = cnt
+		}
+	}
+	return res
+}
+
+// reset 所有计数器减半
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// doorkeeper 一个简单的布隆过滤器
+// 只出现过一次的 key 只会记录在这里，不会进入 countMinSketch，避免一次性的访问污染频率统计
+type doorkeeper struct {
+	bits []uint64
+	mask uint64
+}
+
+func newDoorkeeper(capacity int) *doorkeeper {
+	size := nextPowerOfTwo(capacity * 8)
+	if size < 64 {
+		size = 64
+	}
+	return &doorkeeper{
+		bits: make([]uint64, size/64),
+		mask: uint64(size - 1),
+	}
+}
+
+// add 记录 hash，返回 hash 之前是否已经存在
+func (d *doorkeeper) add(hash uint64) bool {
+	exist := true
+	for i := 0; i < doorkeeperHashes; i++ {
+		idx := indexOf(hash, i, d.mask)
+		word, bit := idx/64, uint64(1)<<(idx%64)
+		if d.bits[word]&bit == 0 {
+			exist = false
+			d.bits[word] |= bit
+		}
+	}
+	return exist
+}
+
+func (d *doorkeeper) contains(hash uint64) bool {
+	for i := 0; i < doorkeeperHashes; i++ {
+		idx := indexOf(hash, i, d.mask)
+		if d.bits[idx/64]&(uint64(1)<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *doorkeeper) reset() {
+	for i := range d.bits {
+		d.bits[i] = 0
+	}
+}
+
+// frequency 组合 doorkeeper 和 countMinSketch 的频率估算
+type frequency struct {
+	capacity   int
+	sketch     *countMinSketch
+	doorkeeper *doorkeeper
+}
+
+func newFrequency(capacity int) *frequency {
+	return &frequency{
+		capacity:   capacity,
+		sketch:     newCountMinSketch(capacity),
+		doorkeeper: newDoorkeeper(capacity),
+	}
+}
+
+func (f *frequency) increment(hash uint64) {
+	if !f.doorkeeper.add(hash) {
+		return
+	}
+	if f.sketch.increment(hash) {
+		// 减半的同时清空 doorkeeper
+		f.doorkeeper.reset()
+	}
+}
+
+func (f *frequency) estimate(hash uint64) int {
+	res := f.sketch.estimate(hash)
+	if f.doorkeeper.contains(hash) {
+		res++
+	}
+	return res
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinylfu
+
+import (
+	"hash/maphash"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextPowerOfTwo(t *testing.T) {
+	testCases := []struct {
+		n    int
+		want int
+	}{
+		{n: 0, want: 1},
+		{n: 1, want: 1},
+		{n: 3, want: 4},
+		{n: 64, want: 64},
+		{n: 65, want: 128},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, nextPowerOfTwo(tc.n))
+	}
+}
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch(64)
+	seed := maphash.MakeSeed()
+	hot := maphash.String(seed, "hot")
+	cold := maphash.String(seed, "cold")
+
+	for i := 0; i < 20; i++ {
+		s.increment(hot)
+	}
+	s.increment(cold)
+	// 计数器不会超过上限
+	assert.Equal(t, maxCounter, s.estimate(hot))
+	assert.GreaterOrEqual(t, s.estimate(cold), 1)
+	assert.Less(t, s.estimate(cold), maxCounter)
+
+	s.reset()
+	assert.Equal(t, maxCounter/2, s.estimate(hot))
+}
+
+func TestCountMinSketch_aging(t *testing.T) {
+	s := newCountMinSketch(4)
+	seed := maphash.MakeSeed()
+	hot := maphash.String(seed, "hot")
+	for i := 0; i < 10; i++ {
+		s.increment(hot)
+	}
+	assert.Equal(t, 10, s.estimate(hot))
+
+	// 累计 sampleSize 次增加之后减半
+	reset := false
+	for i := 0; !reset; i++ {
+		reset = s.increment(maphash.String(seed, string(rune('a'+i%26))))
+	}
+	assert.Less(t, s.estimate(hot), 10)
+	assert.Less(t, s.additions, s.sampleSize)
+}
+
+func TestDoorkeeper(t *testing.T) {
+	d := newDoorkeeper(16)
+	seed := maphash.MakeSeed()
+	h := maphash.String(seed, "key")
+	assert.False(t, d.contains(h))
+	assert.False(t, d.add(h))
+	assert.True(t, d.contains(h))
+	assert.True(t, d.add(h))
+	d.reset()
+	assert.False(t, d.contains(h))
+}
+
+func TestFrequency(t *testing.T) {
+	f := newFrequency(16)
+	seed := maphash.MakeSeed()
+	h := maphash.String(seed, "key")
+	assert.Equal(t, 0, f.estimate(h))
+	// 第一次只进入 doorkeeper
+	f.increment(h)
+	assert.Equal(t, 1, f.estimate(h))
+	assert.Equal(t, 0, f.sketch.estimate(h))
+	f.increment(h)
+	assert.Equal(t, 2, f.estimate(h))
+}
@@ -0,0 +1,198 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinylfu
+
+import (
+	"hash/maphash"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/ecodeclub/ecache/memory/internal/linkedlist"
+)
+
+var _ memory.CapacityPolicy = (*Policy)(nil)
+
+type segment uint8
+
+const (
+	segmentWindow segment = iota
+	segmentProbation
+	segmentProtected
+)
+
+type entry struct {
+	key     string
+	hash    uint64
+	segment segment
+}
+
+// Policy Window-TinyLFU 淘汰策略，适合访问分布倾斜并且夹杂着大量一次性扫描的场景
+//
+// 新的 key 先进入 window 这个小的 LRU，从 window 里面被挤出来的 key 进入 probation，
+// 在 probation 里面再次被访问的 key 晋升到 protected。
+// 缓存满了的时候，从 window 里面挤出来的候选者和 probation 的队尾比较访问频率，
+// 频率更低的那个被淘汰，所以只访问一次的 key 不会把热点数据挤出去
+type Policy struct {
+	capacity     int
+	windowCap    int
+	protectedCap int
+
+	data      map[string]*linkedlist.Element[entry]
+	window    *linkedlist.List[entry]
+	probation *linkedlist.List[entry]
+	protected *linkedlist.List[entry]
+
+	seed      maphash.Seed
+	frequency *frequency
+}
+
+// maxInitCap 和 memory.Core 一样，map 和频率统计最多预先分配的容量，key 变多之后再扩容
+const maxInitCap = 1024
+
+// NewPolicy 各个分段的大小由 memory.NewStore 通过 SetCapacity 按照 Store 的容量设置
+func NewPolicy() *Policy {
+	p := &Policy{
+		window:    linkedlist.New[entry](),
+		probation: linkedlist.New[entry](),
+		protected: linkedlist.New[entry](),
+		seed:      maphash.MakeSeed(),
+	}
+	p.SetCapacity(1)
+	return p
+}
+
+// SetCapacity 按照容量划分各个分段的大小，只能在写入任何 key 之前调用
+func (p *Policy) SetCapacity(capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	windowCap := capacity / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	initCap := capacity
+	if initCap > maxInitCap {
+		initCap = maxInitCap
+	}
+	p.capacity = capacity
+	p.windowCap = windowCap
+	p.protectedCap = (capacity - windowCap) * 80 / 100
+	p.data = make(map[string]*linkedlist.Element[entry], initCap)
+	p.frequency = newFrequency(initCap)
+}
+
+func (p *Policy) listOf(seg segment) *linkedlist.List[entry] {
+	switch seg {
+	case segmentProbation:
+		return p.probation
+	case segmentProtected:
+		return p.protected
+	default:
+		return p.window
+	}
+}
+
+// OnInsert 新的 key 进入 window，window 满了就把队尾挤到 probation
+func (p *Policy) OnInsert(key string) {
+	ent := entry{key: key, hash: maphash.String(p.seed, key), segment: segmentWindow}
+	p.frequency.increment(ent.hash)
+	p.data[key] = p.window.PushFront(ent)
+	p.growFrequency()
+	if p.window.Len() > p.windowCap {
+		p.moveTo(p.window.Back(), segmentProbation)
+	}
+}
+
+// OnAccess 记录一次访问，并且在各个分段之间调整位置
+func (p *Policy) OnAccess(key string) {
+	elem, ok := p.data[key]
+	if !ok {
+		return
+	}
+	p.frequency.increment(elem.Value.hash)
+	switch elem.Value.segment {
+	case segmentWindow:
+		p.window.MoveToFront(elem)
+	case segmentProtected:
+		p.protected.MoveToFront(elem)
+	case segmentProbation:
+		p.moveTo(elem, segmentProtected)
+		if p.protected.Len() > p.protectedCap {
+			// protected 满了，把最久没访问的降级到 probation
+			p.moveTo(p.protected.Back(), segmentProbation)
+		}
+	}
+}
+
+func (p *Policy) OnRemove(key string, _ evict.Reason) {
+	elem, ok := p.data[key]
+	if !ok {
+		return
+	}
+	p.listOf(elem.Value.segment).Remove(elem)
+	delete(p.data, key)
+}
+
+// Victim window 满了的时候，新的 key 会把 window 的队尾挤出来作为候选者，
+// 候选者的频率比主区的队尾更高才能进入主区，否则淘汰候选者自己
+func (p *Policy) Victim() (string, bool) {
+	victim := p.victim()
+	if victim == nil {
+		return "", false
+	}
+	if p.window.Len() < p.windowCap {
+		return victim.Value.key, true
+	}
+	candidate := p.window.Back()
+	if candidate == victim ||
+		p.frequency.estimate(candidate.Value.hash) > p.frequency.estimate(victim.Value.hash) {
+		return victim.Value.key, true
+	}
+	return candidate.Value.key, true
+}
+
+// moveTo 把元素移动到 seg 分段的队头，返回新的元素
+func (p *Policy) moveTo(elem *linkedlist.Element[entry], seg segment) *linkedlist.Element[entry] {
+	ent := p.listOf(elem.Value.segment).Remove(elem)
+	ent.segment = seg
+	res := p.listOf(seg).PushFront(ent)
+	p.data[ent.key] = res
+	return res
+}
+
+// growFrequency key 的数量超过频率统计的容量之后把容量加倍，最多到 capacity
+// 和 Caffeine 一样，扩容的时候丢掉之前的统计
+func (p *Policy) growFrequency() {
+	size := p.frequency.capacity
+	if len(p.data) <= size || size >= p.capacity {
+		return
+	}
+	size *= 2
+	if size > p.capacity {
+		size = p.capacity
+	}
+	p.frequency = newFrequency(size)
+}
+
+// victim 主区里面下一个应该被淘汰的元素
+func (p *Policy) victim() *linkedlist.Element[entry] {
+	if elem := p.probation.Back(); elem != nil {
+		return elem
+	}
+	if elem := p.protected.Back(); elem != nil {
+		return elem
+	}
+	return p.window.Back()
+}
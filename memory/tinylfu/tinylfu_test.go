@@ -0,0 +1,203 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinylfu
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/evict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicy(t *testing.T) {
+	testCases := []struct {
+		name             string
+		capacity         int
+		wantCapacity     int
+		wantWindowCap    int
+		wantProtectedCap int
+		wantFrequencyCap int
+	}{
+		{name: "zero", capacity: 0, wantCapacity: 1, wantWindowCap: 1, wantProtectedCap: 0, wantFrequencyCap: 1},
+		{name: "small", capacity: 10, wantCapacity: 10, wantWindowCap: 1, wantProtectedCap: 7, wantFrequencyCap: 10},
+		{name: "large", capacity: 1000, wantCapacity: 1000, wantWindowCap: 10, wantProtectedCap: 792, wantFrequencyCap: 1000},
+		// 只预先分配 maxInitCap
+		{name: "huge", capacity: 1 << 30, wantCapacity: 1 << 30, wantWindowCap: 1 << 30 / 100,
+			wantProtectedCap: (1<<30 - 1<<30/100) * 80 / 100, wantFrequencyCap: maxInitCap},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newPolicy(tc.capacity)
+			assert.Equal(t, tc.wantCapacity, p.capacity)
+			assert.Equal(t, tc.wantWindowCap, p.windowCap)
+			assert.Equal(t, tc.wantProtectedCap, p.protectedCap)
+			assert.Equal(t, tc.wantFrequencyCap, p.frequency.capacity)
+		})
+	}
+}
+
+// newPolicy 模拟 memory.NewStore 设置容量
+func newPolicy(capacity int) *Policy {
+	p := NewPolicy()
+	p.SetCapacity(capacity)
+	return p
+}
+
+func TestPolicy_growFrequency(t *testing.T) {
+	p := newPolicy(3000)
+	for i := 0; i < maxInitCap; i++ {
+		insert(p, fmt.Sprintf("key%d", i))
+	}
+	assert.Equal(t, maxInitCap, p.frequency.capacity)
+	// 超过之后加倍，最多到容量
+	insert(p, "grow")
+	assert.Equal(t, 2*maxInitCap, p.frequency.capacity)
+	for i := maxInitCap; i <= 2*maxInitCap; i++ {
+		insert(p, fmt.Sprintf("key%d", i))
+	}
+	assert.Equal(t, 3000, p.frequency.capacity)
+	checkSegments(t, p)
+}
+
+// insert 模拟 memory.Store 写入一个新的 key
+func insert(p *Policy, key string) {
+	for len(p.data) >= p.capacity {
+		victim, ok := p.Victim()
+		if !ok {
+			break
+		}
+		p.OnRemove(victim, evict.ReasonCapacity)
+	}
+	p.OnInsert(key)
+}
+
+func checkSegments(t *testing.T, p *Policy) {
+	total := 0
+	for _, seg := range []segment{segmentWindow, segmentProbation, segmentProtected} {
+		l := p.listOf(seg)
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			assert.Equal(t, seg, elem.Value.segment)
+			assert.Same(t, elem, p.data[elem.Value.key])
+			total++
+		}
+	}
+	assert.Equal(t, len(p.data), total)
+	assert.LessOrEqual(t, len(p.data), p.capacity)
+	assert.LessOrEqual(t, p.window.Len(), p.windowCap)
+	assert.LessOrEqual(t, p.protected.Len(), p.protectedCap)
+}
+
+func TestPolicy_segments(t *testing.T) {
+	p := newPolicy(10)
+	for i := 0; i < 10; i++ {
+		insert(p, fmt.Sprintf("key%d", i))
+		checkSegments(t, p)
+	}
+	assert.Equal(t, 10, len(p.data))
+	assert.Equal(t, 1, p.window.Len())
+	assert.Equal(t, 9, p.probation.Len())
+
+	// probation 里面被访问的 key 晋升到 protected
+	p.OnAccess("key0")
+	assert.Equal(t, segmentProtected, p.data["key0"].Value.segment)
+	checkSegments(t, p)
+
+	// protected 满了之后队尾降级回 probation
+	for i := 1; i < 9; i++ {
+		p.OnAccess(fmt.Sprintf("key%d", i))
+		checkSegments(t, p)
+	}
+	assert.Equal(t, 7, p.protected.Len())
+	assert.Equal(t, segmentProbation, p.data["key0"].Value.segment)
+
+	p.OnRemove("key0", evict.ReasonDeleted)
+	_, ok := p.data["key0"]
+	assert.False(t, ok)
+	checkSegments(t, p)
+}
+
+func TestPolicy_admission(t *testing.T) {
+	p := newPolicy(100)
+	for i := 0; i < 50; i++ {
+		insert(p, fmt.Sprintf("hot%d", i))
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			p.OnAccess(fmt.Sprintf("hot%d", i))
+		}
+	}
+	// 一次性的扫描不会把热点数据挤出去
+	for i := 0; i < 10000; i++ {
+		insert(p, fmt.Sprintf("scan%d", i))
+	}
+	checkSegments(t, p)
+	hits := 0
+	for i := 0; i < 50; i++ {
+		if _, ok := p.data[fmt.Sprintf("hot%d", i)]; ok {
+			hits++
+		}
+	}
+	assert.GreaterOrEqual(t, hits, 45)
+}
+
+func TestPolicy_store(t *testing.T) {
+	ctx := context.Background()
+	var events []evict.Event
+	s := memory.NewStore(100, NewPolicy(), memory.WithEvictListener(
+		evict.ListenerFunc(func(evt evict.Event) {
+			events = append(events, evt)
+		})))
+	defer s.Close()
+	for i := 0; i < 50; i++ {
+		require.NoError(t, s.Set(ctx, fmt.Sprintf("hot%d", i), i, 0))
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			_ = s.Get(ctx, fmt.Sprintf("hot%d", i))
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, s.Set(ctx, fmt.Sprintf("scan%d", i), i, 0))
+	}
+	assert.Equal(t, 950, len(events))
+	for _, evt := range events {
+		assert.Equal(t, evict.ReasonCapacity, evt.Reason)
+	}
+	hits := 0
+	for i := 0; i < 50; i++ {
+		if s.Get(ctx, fmt.Sprintf("hot%d", i)).Err == nil {
+			hits++
+		}
+	}
+	assert.GreaterOrEqual(t, hits, 45)
+}
+
+func TestNewCache(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	c := NewCache(2, memory.WithEvictListener(evict.ListenerFunc(func(evt evict.Event) {
+		evicted = append(evicted, evt.Key)
+	})))
+	defer c.Close()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), i, 0))
+	}
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, 3, c.Get(ctx, "key3").Val)
+}
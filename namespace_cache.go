@@ -22,59 +22,70 @@ import (
 type NamespaceCache struct {
 	C         Cache
 	Namespace string
+	// HashTag 为 true 的时候用 {Namespace} 作为前缀，
+	// 这样同一个命名空间下的 key 在 Redis Cluster 上会落到同一个 slot，可以一起执行多个 key 的命令
+	HashTag bool
+}
+
+func (c *NamespaceCache) prefix() string {
+	if c.HashTag {
+		return "{" + c.Namespace + "}"
+	}
+	return c.Namespace
 }
 
 func (c *NamespaceCache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
-	return c.C.Set(ctx, c.Namespace+key, val, expiration)
+	return c.C.Set(ctx, c.prefix()+key, val, expiration)
 }
 
 func (c *NamespaceCache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
-	return c.C.SetNX(ctx, c.Namespace+key, val, expiration)
+	return c.C.SetNX(ctx, c.prefix()+key, val, expiration)
 }
 
 func (c *NamespaceCache) GetSet(ctx context.Context, key string, val string) Value {
-	return c.C.GetSet(ctx, c.Namespace+key, val)
+	return c.C.GetSet(ctx, c.prefix()+key, val)
 }
 
 func (c *NamespaceCache) Delete(ctx context.Context, key ...string) (int64, error) {
 	if len(key) == 1 {
-		return c.C.Delete(ctx, c.Namespace+key[0])
+		return c.C.Delete(ctx, c.prefix()+key[0])
 	}
+	prefix := c.prefix()
 	newkey := make([]string, len(key))
 	for i, v := range key {
-		newkey[i] = c.Namespace + v
+		newkey[i] = prefix + v
 	}
 	return c.C.Delete(ctx, newkey...)
 }
 
 func (c *NamespaceCache) LPush(ctx context.Context, key string, val ...any) (int64, error) {
-	return c.C.LPush(ctx, c.Namespace+key, val...)
+	return c.C.LPush(ctx, c.prefix()+key, val...)
 }
 
 func (c *NamespaceCache) LPop(ctx context.Context, key string) Value {
-	return c.C.LPop(ctx, c.Namespace+key)
+	return c.C.LPop(ctx, c.prefix()+key)
 }
 
 func (c *NamespaceCache) SAdd(ctx context.Context, key string, members ...any) (int64, error) {
-	return c.C.SAdd(ctx, c.Namespace+key, members...)
+	return c.C.SAdd(ctx, c.prefix()+key, members...)
 }
 
 func (c *NamespaceCache) SRem(ctx context.Context, key string, members ...any) (int64, error) {
-	return c.C.SRem(ctx, c.Namespace+key, members...)
+	return c.C.SRem(ctx, c.prefix()+key, members...)
 }
 
 func (c *NamespaceCache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
-	return c.C.IncrBy(ctx, c.Namespace+key, value)
+	return c.C.IncrBy(ctx, c.prefix()+key, value)
 }
 
 func (c *NamespaceCache) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
-	return c.C.DecrBy(ctx, c.Namespace+key, value)
+	return c.C.DecrBy(ctx, c.prefix()+key, value)
 }
 
 func (c *NamespaceCache) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
-	return c.C.IncrByFloat(ctx, c.Namespace+key, value)
+	return c.C.IncrByFloat(ctx, c.prefix()+key, value)
 }
 
 func (c *NamespaceCache) Get(ctx context.Context, key string) Value {
-	return c.C.Get(ctx, c.Namespace+key)
+	return c.C.Get(ctx, c.prefix()+key)
 }
@@ -654,3 +654,42 @@ func TestNamespaceCache_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestNamespaceCache_HashTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		hashTag bool
+		keys    []string
+		want    []string
+	}{
+		{
+			name: "no hash tag",
+			keys: []string{"key1", "key2"},
+			want: []string{"app1:key1", "app1:key2"},
+		},
+		{
+			name:    "hash tag",
+			hashTag: true,
+			keys:    []string{"key1", "key2"},
+			want:    []string{"{app1:}key1", "{app1:}key2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockCache(gomock.NewController(t))
+			c := &NamespaceCache{
+				C:         mock,
+				Namespace: "app1:",
+				HashTag:   tt.hashTag,
+			}
+			ctx := context.Background()
+			mock.EXPECT().Get(ctx, tt.want[0]).Return(Value{})
+			c.Get(ctx, tt.keys[0])
+			mock.EXPECT().Delete(ctx, tt.want[0], tt.want[1]).Return(int64(2), nil)
+			got, err := c.Delete(ctx, tt.keys...)
+			if err != nil || got != 2 {
+				t.Errorf("Delete() got = %v, err = %v", got, err)
+			}
+		})
+	}
+}
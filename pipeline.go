@@ -0,0 +1,134 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ecache
+
+import (
+	"context"
+	"time"
+)
+
+// Pipeliner 在 Pipeline 和 TxPipeline 的回调里面排队命令，命令在回调返回之后才会执行
+// 方法和 Cache 一一对应，每个命令的结果按照排队的顺序放在 Pipeline 的返回值里面：
+// Set 的 Val 为 nil，SetNX 是 bool，Get、GetSet 和 LPop 是读到的值，IncrByFloat 是 float64，其余的是 int64
+type Pipeliner interface {
+	Set(key string, val any, expiration time.Duration)
+	SetNX(key string, val any, expiration time.Duration)
+	Get(key string)
+	GetSet(key string, val string)
+	Delete(key ...string)
+	LPush(key string, val ...any)
+	LPop(key string)
+	SAdd(key string, members ...any)
+	SRem(key string, members ...any)
+	IncrBy(key string, value int64)
+	DecrBy(key string, value int64)
+	IncrByFloat(key string, value float64)
+}
+
+// PipelineCache 可以一次执行多个命令的缓存，不是所有的 Cache 都支持
+type PipelineCache interface {
+	// Pipeline 执行回调里面排队的所有命令，返回每个命令的结果
+	// 回调返回错误的时候不会执行任何命令；单个命令的错误放在对应的 Value.Err 里面，
+	// 返回的 error 只表示整批命令都没有办法执行，例如网络错误
+	Pipeline(ctx context.Context, fn func(p Pipeliner) error) ([]Value, error)
+	// TxPipeline 和 Pipeline 一样，但是所有的命令作为一个整体执行，中间不会插入其它的命令
+	// Redis 的实现和 MULTI/EXEC 一样，某个命令失败不会回滚已经执行的命令；
+	// 内存缓存的实现在某个命令失败的时候回滚所有的命令，并且返回这个命令的错误
+	TxPipeline(ctx context.Context, fn func(p Pipeliner) error) ([]Value, error)
+}
+
+var _ PipelineCache = (*NamespaceCache)(nil)
+
+// Pipeline C 没有实现 PipelineCache 的时候返回 ErrNotSupported
+func (c *NamespaceCache) Pipeline(ctx context.Context, fn func(p Pipeliner) error) ([]Value, error) {
+	pc, ok := c.C.(PipelineCache)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return pc.Pipeline(ctx, c.wrap(fn))
+}
+
+// TxPipeline C 没有实现 PipelineCache 的时候返回 ErrNotSupported
+func (c *NamespaceCache) TxPipeline(ctx context.Context, fn func(p Pipeliner) error) ([]Value, error) {
+	pc, ok := c.C.(PipelineCache)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return pc.TxPipeline(ctx, c.wrap(fn))
+}
+
+func (c *NamespaceCache) wrap(fn func(p Pipeliner) error) func(p Pipeliner) error {
+	return func(p Pipeliner) error {
+		return fn(&namespacePipeliner{p: p, prefix: c.prefix()})
+	}
+}
+
+// namespacePipeliner 给排队的命令的 key 加上命名空间
+type namespacePipeliner struct {
+	p      Pipeliner
+	prefix string
+}
+
+func (n *namespacePipeliner) Set(key string, val any, expiration time.Duration) {
+	n.p.Set(n.prefix+key, val, expiration)
+}
+
+func (n *namespacePipeliner) SetNX(key string, val any, expiration time.Duration) {
+	n.p.SetNX(n.prefix+key, val, expiration)
+}
+
+func (n *namespacePipeliner) Get(key string) {
+	n.p.Get(n.prefix + key)
+}
+
+func (n *namespacePipeliner) GetSet(key string, val string) {
+	n.p.GetSet(n.prefix+key, val)
+}
+
+func (n *namespacePipeliner) Delete(key ...string) {
+	keys := make([]string, len(key))
+	for i, k := range key {
+		keys[i] = n.prefix + k
+	}
+	n.p.Delete(keys...)
+}
+
+func (n *namespacePipeliner) LPush(key string, val ...any) {
+	n.p.LPush(n.prefix+key, val...)
+}
+
+func (n *namespacePipeliner) LPop(key string) {
+	n.p.LPop(n.prefix + key)
+}
+
+func (n *namespacePipeliner) SAdd(key string, members ...any) {
+	n.p.SAdd(n.prefix+key, members...)
+}
+
+func (n *namespacePipeliner) SRem(key string, members ...any) {
+	n.p.SRem(n.prefix+key, members...)
+}
+
+func (n *namespacePipeliner) IncrBy(key string, value int64) {
+	n.p.IncrBy(n.prefix+key, value)
+}
+
+func (n *namespacePipeliner) DecrBy(key string, value int64) {
+	n.p.DecrBy(n.prefix+key, value)
+}
+
+func (n *namespacePipeliner) IncrByFloat(key string, value float64) {
+	n.p.IncrByFloat(n.prefix+key, value)
+}
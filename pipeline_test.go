@@ -0,0 +1,123 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ecache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// recordPipeliner 把排队的命令记录为 "命令名 key"
+type recordPipeliner struct {
+	cmds []string
+}
+
+func (r *recordPipeliner) record(name string, key ...string) {
+	r.cmds = append(r.cmds, name+" "+strings.Join(key, " "))
+}
+
+func (r *recordPipeliner) Set(key string, _ any, _ time.Duration)   { r.record("Set", key) }
+func (r *recordPipeliner) SetNX(key string, _ any, _ time.Duration) { r.record("SetNX", key) }
+func (r *recordPipeliner) Get(key string)                           { r.record("Get", key) }
+func (r *recordPipeliner) GetSet(key string, _ string)              { r.record("GetSet", key) }
+func (r *recordPipeliner) Delete(key ...string)                     { r.record("Delete", key...) }
+func (r *recordPipeliner) LPush(key string, _ ...any)               { r.record("LPush", key) }
+func (r *recordPipeliner) LPop(key string)                          { r.record("LPop", key) }
+func (r *recordPipeliner) SAdd(key string, _ ...any)                { r.record("SAdd", key) }
+func (r *recordPipeliner) SRem(key string, _ ...any)                { r.record("SRem", key) }
+func (r *recordPipeliner) IncrBy(key string, _ int64)               { r.record("IncrBy", key) }
+func (r *recordPipeliner) DecrBy(key string, _ int64)               { r.record("DecrBy", key) }
+func (r *recordPipeliner) IncrByFloat(key string, _ float64)        { r.record("IncrByFloat", key) }
+
+// pipelineCache 把回调里面的命令记录到 rec 里面
+type pipelineCache struct {
+	Cache
+	rec *recordPipeliner
+}
+
+func (c pipelineCache) Pipeline(_ context.Context, fn func(p Pipeliner) error) ([]Value, error) {
+	return nil, fn(c.rec)
+}
+
+func (c pipelineCache) TxPipeline(_ context.Context, fn func(p Pipeliner) error) ([]Value, error) {
+	return nil, fn(c.rec)
+}
+
+func TestNamespaceCache_Pipeline(t *testing.T) {
+	tests := []struct {
+		name    string
+		hashTag bool
+		tx      bool
+		prefix  string
+	}{
+		{name: "pipeline", prefix: "app1:"},
+		{name: "tx pipeline", tx: true, prefix: "app1:"},
+		{name: "hash tag", hashTag: true, prefix: "{app1:}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordPipeliner{}
+			c := &NamespaceCache{
+				C:         pipelineCache{Cache: NewMockCache(gomock.NewController(t)), rec: rec},
+				Namespace: "app1:",
+				HashTag:   tt.hashTag,
+			}
+			exec := c.Pipeline
+			if tt.tx {
+				exec = c.TxPipeline
+			}
+			_, err := exec(context.Background(), func(p Pipeliner) error {
+				p.Set("a", "value", time.Minute)
+				p.SetNX("a", "value", time.Minute)
+				p.Get("a")
+				p.GetSet("a", "value")
+				p.Delete("a", "b")
+				p.LPush("a", "value")
+				p.LPop("a")
+				p.SAdd("a", "value")
+				p.SRem("a", "value")
+				p.IncrBy("a", 1)
+				p.DecrBy("a", 1)
+				p.IncrByFloat("a", 1)
+				return nil
+			})
+			require.NoError(t, err)
+			a, b := tt.prefix+"a", tt.prefix+"b"
+			assert.Equal(t, []string{
+				"Set " + a, "SetNX " + a, "Get " + a, "GetSet " + a, "Delete " + a + " " + b,
+				"LPush " + a, "LPop " + a, "SAdd " + a, "SRem " + a,
+				"IncrBy " + a, "DecrBy " + a, "IncrByFloat " + a,
+			}, rec.cmds)
+		})
+	}
+}
+
+func TestNamespaceCache_PipelineNotSupported(t *testing.T) {
+	c := &NamespaceCache{C: NewMockCache(gomock.NewController(t)), Namespace: "app1:"}
+	_, err := c.Pipeline(context.Background(), func(p Pipeliner) error {
+		return nil
+	})
+	assert.Equal(t, ErrNotSupported, err)
+	_, err = c.TxPipeline(context.Background(), func(p Pipeliner) error {
+		return nil
+	})
+	assert.Equal(t, ErrNotSupported, err)
+}
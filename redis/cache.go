@@ -28,10 +28,14 @@ var _ ecache.Cache = (*Cache)(nil)
 
 type Cache struct {
 	client redis.Cmdable
+	// slotAware 为 true 的时候多个 key 的命令按照 slot 拆分，避免 Redis Cluster 返回 CROSSSLOT
+	slotAware bool
 }
 
+// NewCache client 是 *redis.ClusterClient 的时候，Delete 会按照 slot 拆分 key
 func NewCache(client redis.Cmdable) *Cache {
-	return &Cache{client: client}
+	_, cluster := client.(*redis.ClusterClient)
+	return &Cache{client: client, slotAware: cluster}
 }
 
 func (c *Cache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
@@ -43,7 +47,41 @@ func (c *Cache) SetNX(ctx context.Context, key string, val any, expiration time.
 }
 
 func (c *Cache) Delete(ctx context.Context, key ...string) (int64, error) {
-	return c.client.Del(ctx, key...).Result()
+	if !c.slotAware || len(key) < 2 {
+		return c.client.Del(ctx, key...).Result()
+	}
+	return c.deleteBySlot(ctx, key)
+}
+
+// deleteBySlot 按照 slot 拆分 key，所有的 DEL 放在一个 pipeline 里面发送，ClusterClient 会按照节点分组
+// 部分 slot 出错的时候，返回其它 slot 删除的数量以及所有的错误
+func (c *Cache) deleteBySlot(ctx context.Context, keys []string) (int64, error) {
+	if len(groupBySlot(keys)) == 1 {
+		return c.client.Del(ctx, keys...).Result()
+	}
+	res, _ := c.Pipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Delete(keys...)
+		return nil
+	})
+	n, _ := res[0].Val.(int64)
+	return n, res[0].Err
+}
+
+// groupBySlot 按照 slot 拆分 key，分组的顺序和组内 key 的顺序都和 keys 里面第一次出现的顺序一致
+func groupBySlot(keys []string) [][]string {
+	index := make(map[int]int)
+	var groups [][]string
+	for _, key := range keys {
+		s := slot(key)
+		i, ok := index[s]
+		if !ok {
+			i = len(groups)
+			index[s] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], key)
+	}
+	return groups
 }
 
 func (c *Cache) Get(ctx context.Context, key string) (val ecache.Value) {
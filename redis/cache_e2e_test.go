@@ -813,3 +813,95 @@ func newRedisClient() *redis.Client {
 		Addr: "localhost:6379",
 	})
 }
+
+func TestCache_e2e_TxPipeline(t *testing.T) {
+	rdb := newRedisClient()
+	require.NoError(t, rdb.Ping(context.Background()).Err())
+	c := NewCache(rdb)
+	ctx := context.Background()
+	defer func() {
+		_, err := c.Delete(ctx, "tx_key", "tx_num")
+		require.NoError(t, err)
+	}()
+
+	res, err := c.TxPipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Set("tx_key", "value", time.Minute)
+		p.IncrBy("tx_num", 2)
+		p.Get("tx_key")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.NoError(t, res[0].Err)
+	assert.Equal(t, int64(2), res[1].Val)
+	assert.Equal(t, "value", res[2].Val)
+}
+
+func TestCache_e2e_CompareAndSwap(t *testing.T) {
+	rdb := newRedisClient()
+	require.NoError(t, rdb.Ping(context.Background()).Err())
+	c := NewCache(rdb)
+	ctx := context.Background()
+	defer func() {
+		_, err := c.Delete(ctx, "cas_key")
+		require.NoError(t, err)
+	}()
+
+	assert.Equal(t, errs.ErrKeyNotExist, c.CompareAndSwap(ctx, "cas_key", "a", "b", time.Minute))
+	require.NoError(t, c.Set(ctx, "cas_key", "a", time.Minute))
+	assert.ErrorIs(t, c.CompareAndSwap(ctx, "cas_key", "c", "b", time.Minute), ecache.ErrConflict)
+	require.NoError(t, c.CompareAndSwap(ctx, "cas_key", "a", "b", time.Minute))
+	assert.Equal(t, "b", c.Get(ctx, "cas_key").Val)
+}
+
+func TestCache_e2e_SetIfVersion(t *testing.T) {
+	rdb := newRedisClient()
+	require.NoError(t, rdb.Ping(context.Background()).Err())
+	c := NewCache(rdb)
+	ctx := context.Background()
+	defer func() {
+		_, err := c.Delete(ctx, "ver_key", versionKey("ver_key"))
+		require.NoError(t, err)
+	}()
+
+	assert.Equal(t, errs.ErrKeyNotExist, c.GetWithVersion(ctx, "ver_key").Err)
+	v1, err := c.SetIfVersion(ctx, "ver_key", "a", 0, time.Minute)
+	require.NoError(t, err)
+	val := c.GetWithVersion(ctx, "ver_key")
+	require.NoError(t, val.Err)
+	assert.Equal(t, "a", val.Val)
+	assert.Equal(t, v1, val.Version)
+
+	_, err = c.SetIfVersion(ctx, "ver_key", "b", 0, time.Minute)
+	assert.Equal(t, &ecache.ConflictError{Key: "ver_key", Version: v1}, err)
+	v2, err := c.SetIfVersion(ctx, "ver_key", "b", v1, time.Minute)
+	require.NoError(t, err)
+	assert.Greater(t, v2, v1)
+
+	// Set 修改值之后分配新的版本号，不会被当作不存在的 key
+	require.NoError(t, c.Set(ctx, "ver_key", "c", time.Minute))
+	_, err = c.SetIfVersion(ctx, "ver_key", "d", v2, time.Minute)
+	assert.ErrorIs(t, err, ecache.ErrConflict)
+	_, err = c.SetIfVersion(ctx, "ver_key", "d", 0, time.Minute)
+	assert.ErrorIs(t, err, ecache.ErrConflict)
+	val = c.GetWithVersion(ctx, "ver_key")
+	assert.Greater(t, val.Version, v2)
+	v3, err := c.SetIfVersion(ctx, "ver_key", "d", val.Version, time.Minute)
+	require.NoError(t, err)
+	assert.Greater(t, v3, val.Version)
+
+	// 版本号的 key 和值一起过期，重新写入也不会复用版本号
+	assert.Equal(t, rdb.PTTL(ctx, "ver_key").Val() > 0, rdb.PTTL(ctx, versionKey("ver_key")).Val() > 0)
+	_, err = c.Delete(ctx, "ver_key")
+	require.NoError(t, err)
+	v4, err := c.SetIfVersion(ctx, "ver_key", "e", 0, 0)
+	require.NoError(t, err)
+	assert.Greater(t, v4, v3)
+	// 值没有有效期的时候版本号的 key 最多保留 maxVersionTTL
+	ttl := rdb.PTTL(ctx, versionKey("ver_key")).Val()
+	assert.True(t, ttl > 0 && ttl <= maxVersionTTL)
+	_, err = c.Delete(ctx, "ver_key")
+	require.NoError(t, err)
+	assert.Equal(t, errs.ErrKeyNotExist, c.GetWithVersion(ctx, "ver_key").Err)
+	assert.Equal(t, int64(0), rdb.Exists(ctx, versionKey("ver_key")).Val())
+}
@@ -359,6 +359,98 @@ func TestCache_Delete(t *testing.T) {
 	}
 }
 
+func TestCache_DeleteBySlot(t *testing.T) {
+	intCmd := func(n int64, err error) *redis.IntCmd {
+		cmd := redis.NewIntCmd(context.Background())
+		cmd.SetVal(n)
+		cmd.SetErr(err)
+		return cmd
+	}
+	testCases := []struct {
+		name string
+
+		mock func(*gomock.Controller) redis.Cmdable
+
+		key []string
+
+		wantN   int64
+		wantErr error
+	}{
+		{
+			name: "same slot",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					Del(context.Background(), "{user}:name", "{user}:age").
+					Return(intCmd(2, nil))
+				return cmd
+			},
+			key:   []string{"{user}:name", "{user}:age"},
+			wantN: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := &Cache{client: tc.mock(ctrl), slotAware: true}
+			n, err := c.Delete(context.Background(), tc.key...)
+			assert.Equal(t, tc.wantN, n)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestCache_DeleteBySlotPipeline(t *testing.T) {
+	testCases := []struct {
+		name    string
+		failKey string
+
+		wantN   int64
+		wantErr error
+	}{
+		{
+			name:  "multiple slots",
+			wantN: 2,
+		},
+		{
+			name:    "partial failure",
+			failKey: "{b}:name",
+			wantN:   1,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newLocalClient(t)
+			recorder := &pipelineRecorder{failKey: tc.failKey}
+			client.AddHook(recorder)
+			c := &Cache{client: client, slotAware: true}
+			ctx := context.Background()
+			require.NoError(t, c.Set(ctx, "{a}:name", "a", time.Minute))
+			require.NoError(t, c.Set(ctx, "{b}:name", "b", time.Minute))
+
+			n, err := c.Delete(ctx, "{a}:name", "{b}:name", "{a}:age")
+			assert.Equal(t, tc.wantN, n)
+			assert.ErrorIs(t, err, tc.wantErr)
+			// 所有 slot 的 DEL 在同一个 pipeline 里面发送
+			assert.Equal(t, [][]any{
+				{"del", "{a}:name", "{a}:age"},
+				{"del", "{b}:name"},
+			}, recorder.cmds)
+		})
+	}
+}
+
+func TestNewCache_slotAware(t *testing.T) {
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"localhost:7000"}})
+	defer cluster.Close()
+	assert.True(t, NewCache(cluster).slotAware)
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+	assert.False(t, NewCache(client).slotAware)
+}
+
 func TestCache_LPush(t *testing.T) {
 	testCase := []struct {
 		name    string
@@ -0,0 +1,176 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ ecache.PipelineCache = (*Cache)(nil)
+
+// Pipeline 用 go-redis 的 pipeline 一次发送所有的命令
+func (c *Cache) Pipeline(ctx context.Context, fn func(p ecache.Pipeliner) error) ([]ecache.Value, error) {
+	return c.exec(ctx, c.client.Pipeline(), fn)
+}
+
+// TxPipeline 用 MULTI/EXEC 包裹所有的命令
+func (c *Cache) TxPipeline(ctx context.Context, fn func(p ecache.Pipeliner) error) ([]ecache.Value, error) {
+	return c.exec(ctx, c.client.TxPipeline(), fn)
+}
+
+func (c *Cache) exec(ctx context.Context, pipe redis.Pipeliner, fn func(p ecache.Pipeliner) error) ([]ecache.Value, error) {
+	p := &pipeliner{ctx: ctx, pipe: pipe, slotAware: c.slotAware}
+	if err := fn(p); err != nil {
+		pipe.Discard()
+		return nil, err
+	}
+	res := make([]ecache.Value, 0, len(p.results))
+	if len(p.results) == 0 {
+		return res, nil
+	}
+	_, err := pipe.Exec(ctx)
+	for _, result := range p.results {
+		res = append(res, result())
+	}
+	// Exec 返回的是第一个失败的命令的错误，命令本身的错误已经放在了对应的结果里面
+	var redisErr redis.Error
+	if err != nil && !errors.Is(err, redis.Nil) && !errors.As(err, &redisErr) {
+		// 网络错误之类的错误不一定会设置到每个命令上
+		for i := range res {
+			if res[i].Err == nil {
+				res[i].Err = err
+			}
+		}
+		return res, err
+	}
+	return res, nil
+}
+
+// pipeliner 把命令交给 go-redis，Exec 之后再把每个命令的结果转换为 ecache.Value
+type pipeliner struct {
+	ctx  context.Context
+	pipe redis.Pipeliner
+	// slotAware 和 Cache.slotAware 一样，为 true 的时候 Delete 按照 slot 拆分 key
+	slotAware bool
+	results   []func() ecache.Value
+}
+
+func (p *pipeliner) intResult(cmd *redis.IntCmd) {
+	p.results = append(p.results, func() (res ecache.Value) {
+		res.Val, res.Err = cmd.Result()
+		return
+	})
+}
+
+func (p *pipeliner) stringResult(cmd *redis.StringCmd) {
+	p.results = append(p.results, func() (res ecache.Value) {
+		res.Val, res.Err = cmd.Result()
+		if errors.Is(res.Err, redis.Nil) {
+			res.Err = errs.ErrKeyNotExist
+		}
+		return
+	})
+}
+
+func (p *pipeliner) Set(key string, val any, expiration time.Duration) {
+	cmd := p.pipe.Set(p.ctx, key, val, expiration)
+	p.results = append(p.results, func() (res ecache.Value) {
+		res.Err = cmd.Err()
+		return
+	})
+}
+
+func (p *pipeliner) SetNX(key string, val any, expiration time.Duration) {
+	cmd := p.pipe.SetNX(p.ctx, key, val, expiration)
+	p.results = append(p.results, func() (res ecache.Value) {
+		res.Val, res.Err = cmd.Result()
+		return
+	})
+}
+
+func (p *pipeliner) Get(key string) {
+	p.stringResult(p.pipe.Get(p.ctx, key))
+}
+
+func (p *pipeliner) GetSet(key string, val string) {
+	p.stringResult(p.pipe.GetSet(p.ctx, key, val))
+}
+
+// Delete 和 Cache.Delete 一样，ClusterClient 的时候按照 slot 拆分成多个 DEL，结果是删除的数量之和
+// 部分 DEL 出错的时候，结果是其它 DEL 删除的数量以及所有的错误
+func (p *pipeliner) Delete(key ...string) {
+	if !p.slotAware || len(key) < 2 {
+		p.intResult(p.pipe.Del(p.ctx, key...))
+		return
+	}
+	groups := groupBySlot(key)
+	cmds := make([]*redis.IntCmd, 0, len(groups))
+	for _, group := range groups {
+		cmds = append(cmds, p.pipe.Del(p.ctx, group...))
+	}
+	p.results = append(p.results, func() (res ecache.Value) {
+		var (
+			n        int64
+			failures []error
+		)
+		for _, cmd := range cmds {
+			cnt, err := cmd.Result()
+			n += cnt
+			if err != nil {
+				failures = append(failures, err)
+			}
+		}
+		res.Val, res.Err = n, errors.Join(failures...)
+		return
+	})
+}
+
+func (p *pipeliner) LPush(key string, val ...any) {
+	p.intResult(p.pipe.LPush(p.ctx, key, val...))
+}
+
+func (p *pipeliner) LPop(key string) {
+	p.stringResult(p.pipe.LPop(p.ctx, key))
+}
+
+func (p *pipeliner) SAdd(key string, members ...any) {
+	p.intResult(p.pipe.SAdd(p.ctx, key, members...))
+}
+
+func (p *pipeliner) SRem(key string, members ...any) {
+	p.intResult(p.pipe.SRem(p.ctx, key, members...))
+}
+
+func (p *pipeliner) IncrBy(key string, value int64) {
+	p.intResult(p.pipe.IncrBy(p.ctx, key, value))
+}
+
+func (p *pipeliner) DecrBy(key string, value int64) {
+	p.intResult(p.pipe.DecrBy(p.ctx, key, value))
+}
+
+func (p *pipeliner) IncrByFloat(key string, value float64) {
+	cmd := p.pipe.IncrByFloat(p.ctx, key, value)
+	p.results = append(p.results, func() (res ecache.Value) {
+		res.Val, res.Err = cmd.Result()
+		return
+	})
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/server"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLocalClient 连接一个进程内的 RESP 服务器
+func newLocalClient(t *testing.T) *redis.Client {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	backend := memory.NewAdapter(memory.NewCache[string, any](1024))
+	s := server.NewServer(backend)
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	client := redis.NewClient(&redis.Options{Addr: ln.Addr().String()})
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = s.Close()
+		_ = backend.Close()
+	})
+	return client
+}
+
+func TestCache_Pipeline(t *testing.T) {
+	c := NewCache(newLocalClient(t))
+	ctx := context.Background()
+	res, err := c.Pipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Set("key", "value", time.Minute)
+		p.SetNX("key", "other", time.Minute)
+		p.Get("key")
+		p.GetSet("key", "new")
+		p.Get("missing")
+		p.IncrBy("num", 2)
+		p.DecrBy("num", 1)
+		p.IncrByFloat("num", 0.5)
+		p.LPush("list", "a", "b")
+		p.LPop("list")
+		p.SAdd("set", "a", "b")
+		p.SRem("set", "a")
+		// 列表不能自增，错误只影响这一个命令
+		p.IncrBy("list", 1)
+		p.Delete("key", "num")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 14)
+	want := []any{nil, false, "value", "value", nil, int64(2), int64(1), 1.5,
+		int64(2), "b", int64(2), int64(1), nil, int64(2)}
+	for i, val := range res {
+		switch i {
+		case 4:
+			assert.Equal(t, errs.ErrKeyNotExist, val.Err)
+		case 12:
+			assert.Error(t, val.Err)
+		default:
+			require.NoError(t, val.Err, i)
+			assert.Equal(t, want[i], val.Val, i)
+		}
+	}
+}
+
+func TestCache_PipelineCallbackError(t *testing.T) {
+	c := NewCache(newLocalClient(t))
+	ctx := context.Background()
+	failed := errors.New("failed")
+	res, err := c.Pipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Set("key", "value", time.Minute)
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	assert.Nil(t, res)
+	assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "key").Err)
+
+	res, err = c.Pipeline(ctx, func(p ecache.Pipeliner) error {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestCache_PipelineNetworkError(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	res, err := NewCache(client).Pipeline(context.Background(), func(p ecache.Pipeliner) error {
+		p.Get("key")
+		return nil
+	})
+	assert.Error(t, err)
+	require.Len(t, res, 1)
+	assert.Error(t, res[0].Err)
+}
+
+// pipelineRecorder 记录 pipeline 里面发送的命令
+type pipelineRecorder struct {
+	cmds [][]any
+	// failKey 不为空的时候，第一个参数是 failKey 的 DEL 执行之后改为失败
+	failKey string
+}
+
+func (r *pipelineRecorder) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (r *pipelineRecorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (r *pipelineRecorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			r.cmds = append(r.cmds, cmd.Args())
+		}
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			if args := cmd.Args(); r.failKey != "" && len(args) > 1 && args[1] == r.failKey {
+				cmd.(*redis.IntCmd).SetVal(0)
+				cmd.SetErr(context.DeadlineExceeded)
+			}
+		}
+		return err
+	}
+}
+
+func TestCache_PipelineDeleteBySlot(t *testing.T) {
+	client := newLocalClient(t)
+	recorder := &pipelineRecorder{}
+	client.AddHook(recorder)
+	c := &Cache{client: client, slotAware: true}
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "{a}:name", "a", time.Minute))
+	require.NoError(t, c.Set(ctx, "{b}:name", "b", time.Minute))
+
+	res, err := c.Pipeline(ctx, func(p ecache.Pipeliner) error {
+		p.Delete("{a}:name", "{b}:name", "{a}:age")
+		p.Delete("{a}:name")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.NoError(t, res[0].Err)
+	assert.Equal(t, int64(2), res[0].Val)
+	require.NoError(t, res[1].Err)
+	assert.Equal(t, int64(0), res[1].Val)
+
+	// 每个 slot 一个 DEL，TxPipeline 使用同样的拆分
+	var dels [][]any
+	for _, args := range recorder.cmds {
+		if args[0] == "del" {
+			dels = append(dels, args)
+		}
+	}
+	assert.Equal(t, [][]any{
+		{"del", "{a}:name", "{a}:age"},
+		{"del", "{b}:name"},
+		{"del", "{a}:name"},
+	}, dels)
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// slotCount Redis Cluster 的 slot 数量
+const slotCount = 16384
+
+// slot 和 Redis Cluster 一样计算 key 所在的 slot：
+// key 里面有非空的 {hash-tag} 的时候只对 hash-tag 计算 CRC16，否则对整个 key 计算
+func slot(key string) int {
+	if tag, ok := hashTag(key); ok {
+		key = tag
+	}
+	return int(crc16(key) % slotCount)
+}
+
+// hashTag 返回 key 里面第一个非空的 {hash-tag}
+func hashTag(key string) (string, bool) {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key[s+1 : s+1+e], true
+		}
+	}
+	return "", false
+}
+
+var (
+	slotTagsOnce sync.Once
+	// slotTags 第 i 个元素是 CRC16 落在 slot i 上的最小的非负整数
+	slotTags []string
+)
+
+// slotTag 返回一个落在 slot s 上并且不包含 { 和 } 的 hash-tag，第一次调用的时候计算所有 slot 的结果
+func slotTag(s int) string {
+	slotTagsOnce.Do(func() {
+		slotTags = make([]string, slotCount)
+		for i, found := 0, 0; found < slotCount; i++ {
+			tag := strconv.Itoa(i)
+			if j := crc16(tag) % slotCount; slotTags[j] == "" {
+				slotTags[j] = tag
+				found++
+			}
+		}
+	})
+	return slotTags[s]
+}
+
+// crc16 CRC16-CCITT（XMODEM），Redis Cluster 用它计算 slot
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16("123456789"))
+	testCases := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "whole key", key: "foo", want: 12182},
+		{name: "hash tag", key: "{foo}.bar", want: 12182},
+		{name: "first tag", key: "x{foo}{bar}", want: 12182},
+		// 空的 hash-tag 对整个 key 计算
+		{name: "empty tag", key: "{}foo", want: int(crc16("{}foo") % slotCount)},
+		{name: "unclosed", key: "{foo", want: int(crc16("{foo") % slotCount)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, slot(tc.key))
+		})
+	}
+	assert.Equal(t, slot("{user1000}.following"), slot("{user1000}.followers"))
+}
+
+func TestSlotTag(t *testing.T) {
+	for s := 0; s < slotCount; s++ {
+		tag := slotTag(s)
+		assert.NotContains(t, tag, "{")
+		assert.NotContains(t, tag, "}")
+		assert.Equal(t, s, slot("{"+tag+"}"))
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ ecache.CASCache = (*Cache)(nil)
+
+// versionSuffix 版本号保存在 key 加上这个后缀的 key 里面
+const versionSuffix = ":ecache:version"
+
+// casScript 当前的值等于 ARGV[1] 的时候写入 ARGV[2]，返回 -1 表示 key 不存在，0 表示值不相等
+var casScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if not cur then
+	return -1
+end
+if cur ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// 版本号的 key 保存 "版本号:值的 SHA1"，值的 SHA1 对不上说明值被其它命令修改过，这个时候重新分配一个版本号，
+// 这样 Set 之类的命令不需要知道版本号的存在，存在的 key 的版本号也不会是 0。
+// 版本号取 Redis 的时间，单位微秒，并且至少比上一个版本号大一，所以版本号的 key 被删除或者过期之后也不会复用版本号。
+// 版本号的 key 和值使用同样的有效期，值没有有效期的时候最多保留 maxVersionTTL，不会一直留在 Redis 里面
+
+// maxVersionTTL 值没有有效期的时候版本号的 key 的有效期，过期之后重新读到的是一个新的版本号
+const maxVersionTTL = 24 * time.Hour
+
+// versionLua 两个脚本共用的函数，KEYS[1] 是值，KEYS[2] 是版本号
+// currentVersion 返回值、当前的版本号和上一次分配的版本号，值不存在的时候版本号为 0
+var versionLua = `
+redis.replicate_commands()
+local function nextVersion(last)
+	local now = redis.call('TIME')
+	return math.max(last + 1, tonumber(now[1]) * 1000000 + tonumber(now[2]))
+end
+local function saveVersion(ver, val, maxTTL)
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl <= 0 or ttl > maxTTL then
+		ttl = maxTTL
+	end
+	redis.call('SET', KEYS[2], string.format('%d:%s', ver, redis.sha1hex(val)), 'PX', ttl)
+end
+local function currentVersion(maxTTL)
+	local val = redis.call('GET', KEYS[1])
+	local meta = redis.call('GET', KEYS[2])
+	local last = 0
+	if meta then
+		local sep = string.find(meta, ':', 1, true)
+		last = tonumber(string.sub(meta, 1, sep - 1))
+		if val and string.sub(meta, sep + 1) == redis.sha1hex(val) then
+			return val, last, last
+		end
+	end
+	if not val then
+		if meta then
+			redis.call('DEL', KEYS[2])
+		end
+		return false, 0, last
+	end
+	local ver = nextVersion(last)
+	saveVersion(ver, val, maxTTL)
+	return val, ver, ver
+end
+`
+
+// getVersionScript 返回 {值, 版本号}，key 不存在的时候返回 nil，ARGV[1] 是 maxVersionTTL
+var getVersionScript = redis.NewScript(versionLua + `
+local val, ver = currentVersion(tonumber(ARGV[1]))
+if not val then
+	return false
+end
+return {val, ver}
+`)
+
+// setIfVersionScript 当前的版本号等于 ARGV[2] 的时候写入 ARGV[1]，返回 {1, 新的版本号} 或者 {0, 当前的版本号}
+// ARGV[3] 是值的有效期，ARGV[4] 是 maxVersionTTL
+var setIfVersionScript = redis.NewScript(versionLua + `
+local maxTTL = tonumber(ARGV[4])
+local _, cur, last = currentVersion(maxTTL)
+if cur ~= tonumber(ARGV[2]) then
+	return {0, cur}
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+local ver = nextVersion(last)
+saveVersion(ver, ARGV[1], maxTTL)
+return {1, ver}
+`)
+
+// CompareAndSwap 在 Lua 脚本里面比较和写入，oldVal 和当前的值按照 Redis 保存的字符串比较
+func (c *Cache) CompareAndSwap(ctx context.Context, key string, oldVal, newVal any, expiration time.Duration) error {
+	res, err := casScript.Run(ctx, c.client, []string{key}, oldVal, newVal, milliseconds(expiration)).Int64()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case -1:
+		return errs.ErrKeyNotExist
+	case 0:
+		return &ecache.ConflictError{Key: key}
+	}
+	return nil
+}
+
+// GetWithVersion 值被其它命令修改过之后会分配一个新的版本号，所以这也是一个写操作。
+// 其它命令写入和原本一模一样的值的时候版本号不会变化
+func (c *Cache) GetWithVersion(ctx context.Context, key string) (res ecache.VersionedValue) {
+	reply, err := getVersionScript.Run(ctx, c.client, []string{key, versionKey(key)},
+		maxVersionTTL.Milliseconds()).Slice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			err = errs.ErrKeyNotExist
+		}
+		res.Err = err
+		return
+	}
+	if len(reply) != 2 {
+		res.Err = fmt.Errorf("ecache: GetWithVersion 的返回值不正确 %v", reply)
+		return
+	}
+	res.Val = reply[0]
+	res.Version, _ = reply[1].(int64)
+	return
+}
+
+// SetIfVersion 版本号保存在同一个 slot 的另外一个 key 里面，和值使用同样的有效期
+func (c *Cache) SetIfVersion(ctx context.Context, key string, val any, version int64, expiration time.Duration) (int64, error) {
+	reply, err := setIfVersionScript.Run(ctx, c.client, []string{key, versionKey(key)},
+		val, version, milliseconds(expiration), maxVersionTTL.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, err
+	}
+	if len(reply) != 2 {
+		return 0, fmt.Errorf("ecache: SetIfVersion 的返回值不正确 %v", reply)
+	}
+	if reply[0] == 0 {
+		return 0, &ecache.ConflictError{Key: key, Version: reply[1]}
+	}
+	return reply[1], nil
+}
+
+// versionKey 返回保存 key 的版本号的 key，Redis Cluster 里面两者要在同一个 slot 才能在一个脚本里面访问
+// key 本身没有 hash-tag 的时候把整个 key 作为 hash-tag，key 里面有不成对的 } 的时候整个 key 不能作为 hash-tag，
+// 换成一个落在同一个 slot 的 hash-tag
+func versionKey(key string) string {
+	if _, ok := hashTag(key); ok {
+		return key + versionSuffix
+	}
+	if strings.IndexByte(key, '}') >= 0 {
+		return "{" + slotTag(slot(key)) + "}" + key + versionSuffix
+	}
+	return "{" + key + "}" + versionSuffix
+}
+
+// milliseconds 脚本里面使用毫秒设置有效期，不足一毫秒的按照一毫秒处理
+func milliseconds(expiration time.Duration) int64 {
+	if expiration > 0 && expiration < time.Millisecond {
+		return 1
+	}
+	return expiration.Milliseconds()
+}
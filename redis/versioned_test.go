@@ -0,0 +1,262 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/mocks"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// redisError 模拟 Redis 返回的错误，go-redis 只对这种错误检查 NOSCRIPT
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func (redisError) RedisError() {}
+
+func newScriptCmd(val any, err error) *redis.Cmd {
+	cmd := redis.NewCmd(context.Background())
+	if err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(val)
+	}
+	return cmd
+}
+
+func TestCache_CompareAndSwap(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(*gomock.Controller) redis.Cmdable
+		wantErr error
+	}{
+		{
+			name: "swapped",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), casScript.Hash(), []string{"key"}, "a", "b", int64(60000)).
+					Return(newScriptCmd(int64(1), nil))
+				return cmd
+			},
+		},
+		{
+			name: "key not exist",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), casScript.Hash(), []string{"key"}, "a", "b", int64(60000)).
+					Return(newScriptCmd(int64(-1), nil))
+				return cmd
+			},
+			wantErr: errs.ErrKeyNotExist,
+		},
+		{
+			name: "conflict",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), casScript.Hash(), []string{"key"}, "a", "b", int64(60000)).
+					Return(newScriptCmd(int64(0), nil))
+				return cmd
+			},
+			wantErr: ecache.ErrConflict,
+		},
+		{
+			name: "script not loaded",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), casScript.Hash(), []string{"key"}, "a", "b", int64(60000)).
+					Return(newScriptCmd(nil, redisError("NOSCRIPT No matching script")))
+				cmd.EXPECT().
+					Eval(gomock.Any(), gomock.Any(), []string{"key"}, "a", "b", int64(60000)).
+					Return(newScriptCmd(int64(1), nil))
+				return cmd
+			},
+		},
+		{
+			name: "timeout",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), casScript.Hash(), []string{"key"}, "a", "b", int64(60000)).
+					Return(newScriptCmd(nil, context.DeadlineExceeded))
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewCache(tc.mock(ctrl))
+			err := c.CompareAndSwap(context.Background(), "key", "a", "b", time.Minute)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestCache_GetWithVersion(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mock        func(*gomock.Controller) redis.Cmdable
+		wantVal     any
+		wantVersion int64
+		wantErr     error
+	}{
+		{
+			name: "versioned",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), getVersionScript.Hash(), []string{"key", "{key}" + versionSuffix}, int64(86400000)).
+					Return(newScriptCmd([]any{"value", int64(3)}, nil))
+				return cmd
+			},
+			wantVal:     "value",
+			wantVersion: 3,
+		},
+		{
+			name: "key not exist",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), getVersionScript.Hash(), []string{"key", "{key}" + versionSuffix}, int64(86400000)).
+					Return(newScriptCmd(nil, redis.Nil))
+				return cmd
+			},
+			wantErr: errs.ErrKeyNotExist,
+		},
+		{
+			name: "timeout",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), getVersionScript.Hash(), []string{"key", "{key}" + versionSuffix}, int64(86400000)).
+					Return(newScriptCmd(nil, context.DeadlineExceeded))
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewCache(tc.mock(ctrl))
+			val := c.GetWithVersion(context.Background(), "key")
+			assert.Equal(t, tc.wantErr, val.Err)
+			if val.Err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantVal, val.Val)
+			assert.Equal(t, tc.wantVersion, val.Version)
+		})
+	}
+}
+
+func TestCache_SetIfVersion(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mock        func(*gomock.Controller) redis.Cmdable
+		wantVersion int64
+		wantErr     error
+	}{
+		{
+			name: "set",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), setIfVersionScript.Hash(), []string{"{user}.name", "{user}.name" + versionSuffix},
+						"value", int64(2), int64(0), int64(86400000)).
+					Return(newScriptCmd([]any{int64(1), int64(3)}, nil))
+				return cmd
+			},
+			wantVersion: 3,
+		},
+		{
+			name: "conflict",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), setIfVersionScript.Hash(), []string{"{user}.name", "{user}.name" + versionSuffix},
+						"value", int64(2), int64(0), int64(86400000)).
+					Return(newScriptCmd([]any{int64(0), int64(5)}, nil))
+				return cmd
+			},
+			wantErr: &ecache.ConflictError{Key: "{user}.name", Version: 5},
+		},
+		{
+			name: "timeout",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().
+					EvalSha(gomock.Any(), setIfVersionScript.Hash(), []string{"{user}.name", "{user}.name" + versionSuffix},
+						"value", int64(2), int64(0), int64(86400000)).
+					Return(newScriptCmd(nil, context.DeadlineExceeded))
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewCache(tc.mock(ctrl))
+			version, err := c.SetIfVersion(context.Background(), "{user}.name", "value", 2, 0)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantVersion, version)
+		})
+	}
+}
+
+func TestVersionKey(t *testing.T) {
+	testCases := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{name: "whole key as tag", key: "user:1", want: "{user:1}" + versionSuffix},
+		{name: "hash tag", key: "{user}.name", want: "{user}.name" + versionSuffix},
+		{name: "unclosed", key: "{user", want: "{{user}" + versionSuffix},
+		{name: "unbalanced", key: "user}:1", want: "{" + slotTag(slot("user}:1")) + "}user}:1" + versionSuffix},
+		{name: "close before open", key: "}{user", want: "{" + slotTag(slot("}{user")) + "}}{user" + versionSuffix},
+		{name: "empty tag", key: "{}user", want: "{" + slotTag(slot("{}user")) + "}{}user" + versionSuffix},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := versionKey(tc.key)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, slot(tc.key), slot(got))
+		})
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	assert.Equal(t, int64(0), milliseconds(0))
+	assert.Equal(t, int64(1), milliseconds(time.Microsecond))
+	assert.Equal(t, int64(1500), milliseconds(1500*time.Millisecond))
+}
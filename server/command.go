@@ -0,0 +1,493 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+)
+
+const (
+	errSyntax      = "ERR syntax error"
+	errNotInteger  = "ERR value is not an integer or out of range"
+	errNotFloat    = "ERR value is not a valid float"
+	errWrongType   = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	errInvalidTime = "ERR invalid expire time in 'set' command"
+	errExpireTime  = "ERR invalid expire time in 'expire' command"
+)
+
+type command struct {
+	// arity 和 Redis 一样包含命令名本身，负数表示至少需要 -arity 个参数
+	arity   int
+	handler func(s *Server, c *conn, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":        {arity: -1, handler: ping},
+		"HELLO":       {arity: -1, handler: hello},
+		"COMMAND":     {arity: -1, handler: commandCmd},
+		"CLIENT":      {arity: -2, handler: client},
+		"SELECT":      {arity: 2, handler: selectCmd},
+		"GET":         {arity: 2, handler: get},
+		"SET":         {arity: -3, handler: set},
+		"SETNX":       {arity: 3, handler: setNX},
+		"GETSET":      {arity: 3, handler: getSet},
+		"DEL":         {arity: -2, handler: del},
+		"LPUSH":       {arity: -3, handler: lPush},
+		"LPOP":        {arity: 2, handler: lPop},
+		"SADD":        {arity: -3, handler: sAdd},
+		"SREM":        {arity: -3, handler: sRem},
+		"INCR":        {arity: 2, handler: incr},
+		"DECR":        {arity: 2, handler: decr},
+		"INCRBY":      {arity: 3, handler: incrBy},
+		"DECRBY":      {arity: 3, handler: decrBy},
+		"INCRBYFLOAT": {arity: 3, handler: incrByFloat},
+		"EXPIRE":      {arity: 3, handler: expire},
+		"TTL":         {arity: 2, handler: ttl},
+	}
+}
+
+// lookup 找到命令并且检查参数数量，失败的时候返回发给客户端的错误
+func lookup(args [][]byte) (command, string) {
+	name := strings.ToUpper(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		return cmd, "ERR unknown command '" + string(args[0]) + "'"
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		return cmd, "ERR wrong number of arguments for '" + strings.ToLower(name) + "' command"
+	}
+	return cmd, ""
+}
+
+func ping(_ *Server, c *conn, args [][]byte) {
+	if len(args) > 1 {
+		c.w.writeBulk(string(args[1]))
+		return
+	}
+	c.w.writeSimple("PONG")
+}
+
+// hello 切换协议版本，认证和设置客户端名字的参数会被忽略
+func hello(_ *Server, c *conn, args [][]byte) {
+	proto := 2
+	if c.w.resp3 {
+		proto = 3
+	}
+	if len(args) > 1 {
+		v, err := strconv.Atoi(string(args[1]))
+		if err != nil || v < 2 || v > 3 {
+			c.w.writeError("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = v
+	}
+	c.w.resp3 = proto == 3
+	c.w.writeMap(7)
+	c.w.writeBulk("server")
+	c.w.writeBulk("ecache")
+	c.w.writeBulk("version")
+	c.w.writeBulk("1.0.0")
+	c.w.writeBulk("proto")
+	c.w.writeInt(int64(proto))
+	c.w.writeBulk("id")
+	c.w.writeInt(c.id)
+	c.w.writeBulk("mode")
+	c.w.writeBulk("standalone")
+	c.w.writeBulk("role")
+	c.w.writeBulk("master")
+	c.w.writeBulk("modules")
+	c.w.writeArray(0)
+}
+
+// commandCmd redis-cli 启动的时候会调用 COMMAND DOCS，返回空的结果就可以
+func commandCmd(_ *Server, c *conn, _ [][]byte) {
+	c.w.writeArray(0)
+}
+
+// client 客户端连接之后会发送 CLIENT SETNAME 之类的命令，全部忽略
+func client(_ *Server, c *conn, _ [][]byte) {
+	c.w.writeSimple("OK")
+}
+
+// selectCmd 只有一个 0 号数据库
+func selectCmd(_ *Server, c *conn, args [][]byte) {
+	if string(args[1]) != "0" {
+		c.w.writeError("ERR DB index is out of range")
+		return
+	}
+	c.w.writeSimple("OK")
+}
+
+func get(s *Server, c *conn, args [][]byte) {
+	val := s.cache.Get(s.ctx, string(args[1]))
+	writeValue(c.w, val.Val, val.Err)
+}
+
+// set 支持 EX、PX 和 NX 选项
+func set(s *Server, c *conn, args [][]byte) {
+	key := string(args[1])
+	var (
+		expiration time.Duration
+		nx         bool
+	)
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		switch {
+		case opt == "NX":
+			nx = true
+		case (opt == "EX" || opt == "PX") && i+1 < len(args) && expiration == 0:
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				c.w.writeError(errNotInteger)
+				return
+			}
+			unit := time.Millisecond
+			if opt == "EX" {
+				unit = time.Second
+			}
+			var ok bool
+			expiration, ok = duration(n, unit)
+			if !ok || n <= 0 {
+				c.w.writeError(errInvalidTime)
+				return
+			}
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+	val := parseValue(string(args[2]))
+	if nx {
+		ok, err := s.cache.SetNX(s.ctx, key, val, s.expiration(expiration))
+		if err != nil {
+			writeErr(c.w, err)
+			return
+		}
+		if !ok {
+			c.w.writeNull()
+			return
+		}
+	} else if err := s.cache.Set(s.ctx, key, val, s.expiration(expiration)); err != nil {
+		writeErr(c.w, err)
+		return
+	}
+	s.setDeadline(key, expiration)
+	c.w.writeSimple("OK")
+}
+
+func setNX(s *Server, c *conn, args [][]byte) {
+	key := string(args[1])
+	ok, err := s.cache.SetNX(s.ctx, key, parseValue(string(args[2])), s.noExpiration)
+	if err != nil {
+		writeErr(c.w, err)
+		return
+	}
+	if !ok {
+		c.w.writeInt(0)
+		return
+	}
+	s.setDeadline(key, 0)
+	c.w.writeInt(1)
+}
+
+// getSet 旧的值按照原样返回。ecache.Cache 的 GetSet 只能写入字符串，
+// 新的值是数字的时候再和 SET 一样转换为数字，这样之后可以和 Redis 一样执行 INCR
+func getSet(s *Server, c *conn, args [][]byte) {
+	key, raw := string(args[1]), string(args[2])
+	val := s.cache.GetSet(s.ctx, key, raw)
+	if val.Err != nil && !errors.Is(val.Err, errs.ErrKeyNotExist) {
+		writeErr(c.w, val.Err)
+		return
+	}
+	s.setDeadline(key, 0)
+	if num := parseValue(raw); num != any(raw) {
+		if err := s.convertValue(key, raw, num); err != nil {
+			writeErr(c.w, err)
+			return
+		}
+	}
+	writeValue(c.w, val.Val, val.Err)
+}
+
+// convertValue 把 GetSet 写入的字符串 raw 替换为 num
+// 后端实现了 ecache.CASCache 的时候用 CompareAndSwap 替换，中间被其它命令修改过就保留修改之后的值；
+// 否则用 Set 替换，并不是原子操作
+func (s *Server) convertValue(key, raw string, num any) error {
+	cas, ok := s.cache.(ecache.CASCache)
+	if !ok {
+		return s.cache.Set(s.ctx, key, num, s.noExpiration)
+	}
+	err := cas.CompareAndSwap(s.ctx, key, raw, num, 0)
+	if errors.Is(err, ecache.ErrConflict) || errors.Is(err, errs.ErrKeyNotExist) {
+		return nil
+	}
+	return err
+}
+
+func del(s *Server, c *conn, args [][]byte) {
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		keys = append(keys, string(arg))
+	}
+	n, err := s.cache.Delete(s.ctx, keys...)
+	if err != nil {
+		writeErr(c.w, err)
+		return
+	}
+	for _, key := range keys {
+		s.setDeadline(key, 0)
+	}
+	c.w.writeInt(n)
+}
+
+func lPush(s *Server, c *conn, args [][]byte) {
+	n, err := s.cache.LPush(s.ctx, string(args[1]), members(args[2:])...)
+	writeInt(c.w, n, err)
+}
+
+func lPop(s *Server, c *conn, args [][]byte) {
+	val := s.cache.LPop(s.ctx, string(args[1]))
+	writeValue(c.w, val.Val, val.Err)
+}
+
+func sAdd(s *Server, c *conn, args [][]byte) {
+	n, err := s.cache.SAdd(s.ctx, string(args[1]), members(args[2:])...)
+	writeInt(c.w, n, err)
+}
+
+// sRem key 不存在的时候和 Redis 一样返回 0
+func sRem(s *Server, c *conn, args [][]byte) {
+	n, err := s.cache.SRem(s.ctx, string(args[1]), members(args[2:])...)
+	if errors.Is(err, errs.ErrKeyNotExist) {
+		n, err = 0, nil
+	}
+	writeInt(c.w, n, err)
+}
+
+func incr(s *Server, c *conn, args [][]byte) {
+	n, err := s.cache.IncrBy(s.ctx, string(args[1]), 1)
+	writeInt(c.w, n, err)
+}
+
+func decr(s *Server, c *conn, args [][]byte) {
+	n, err := s.cache.DecrBy(s.ctx, string(args[1]), 1)
+	writeInt(c.w, n, err)
+}
+
+func incrBy(s *Server, c *conn, args [][]byte) {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.writeError(errNotInteger)
+		return
+	}
+	n, err := s.cache.IncrBy(s.ctx, string(args[1]), delta)
+	writeInt(c.w, n, err)
+}
+
+func decrBy(s *Server, c *conn, args [][]byte) {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.writeError(errNotInteger)
+		return
+	}
+	n, err := s.cache.DecrBy(s.ctx, string(args[1]), delta)
+	writeInt(c.w, n, err)
+}
+
+// incrByFloat 和 Redis 一样用字符串返回结果
+func incrByFloat(s *Server, c *conn, args [][]byte) {
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		c.w.writeError(errNotFloat)
+		return
+	}
+	n, err := s.cache.IncrByFloat(s.ctx, string(args[1]), delta)
+	if err != nil {
+		writeErr(c.w, err)
+		return
+	}
+	c.w.writeBulk(strconv.FormatFloat(n, 'f', -1, 64))
+}
+
+// maxExpireRetries EXPIRE 因为并发修改重新读取的最大次数
+const maxExpireRetries = 16
+
+// expire 读出原本的值再带着新的有效期写回去
+// 后端实现了 ecache.CASCache 的时候用 CompareAndSwap 写回，读出之后被其它命令修改过就重新读取，不会覆盖并发写入的值；
+// 否则用 Set 写回，并不是原子操作，读出和写回之间其它命令写入的值会被覆盖
+// 内存缓存里面的列表和集合写回的是同一个对象，不会丢失数据
+func expire(s *Server, c *conn, args [][]byte) {
+	key := string(args[1])
+	seconds, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.writeError(errNotInteger)
+		return
+	}
+	expiration, ok := duration(seconds, time.Second)
+	if !ok {
+		c.w.writeError(errExpireTime)
+		return
+	}
+	for i := 0; ; i++ {
+		val := s.cache.Get(s.ctx, key)
+		if errors.Is(val.Err, errs.ErrKeyNotExist) {
+			c.w.writeInt(0)
+			return
+		}
+		if val.Err != nil {
+			writeErr(c.w, val.Err)
+			return
+		}
+		if seconds <= 0 {
+			_, err = s.cache.Delete(s.ctx, key)
+			s.setDeadline(key, 0)
+			writeInt(c.w, 1, err)
+			return
+		}
+		err = s.resetExpiration(key, val.Val, expiration)
+		var conflict *ecache.ConflictError
+		if errors.As(err, &conflict) && i < maxExpireRetries {
+			continue
+		}
+		if errors.Is(err, errs.ErrKeyNotExist) {
+			c.w.writeInt(0)
+			return
+		}
+		if err != nil {
+			writeErr(c.w, err)
+			return
+		}
+		s.setDeadline(key, expiration)
+		c.w.writeInt(1)
+		return
+	}
+}
+
+// resetExpiration 带着新的有效期把读出来的 val 写回 key
+func (s *Server) resetExpiration(key string, val any, expiration time.Duration) error {
+	if cas, ok := s.cache.(ecache.CASCache); ok {
+		return cas.CompareAndSwap(s.ctx, key, val, val, expiration)
+	}
+	return s.cache.Set(s.ctx, key, val, expiration)
+}
+
+// ttl ecache.Cache 没有办法读取有效期，所以只知道通过这个服务器的 SET 和 EXPIRE 设置的有效期，
+// 直接通过后端或者其它服务器设置的有效期会被当作永不过期返回 -1
+// key 不存在返回 -2，不知道有效期或者永不过期返回 -1
+func ttl(s *Server, c *conn, args [][]byte) {
+	key := string(args[1])
+	val := s.cache.Get(s.ctx, key)
+	if errors.Is(val.Err, errs.ErrKeyNotExist) {
+		c.w.writeInt(-2)
+		return
+	}
+	if val.Err != nil {
+		writeErr(c.w, val.Err)
+		return
+	}
+	remaining, ok := s.remaining(key)
+	if !ok {
+		c.w.writeInt(-1)
+		return
+	}
+	c.w.writeInt(int64((remaining + time.Second - 1) / time.Second))
+}
+
+// duration 把 n 个 unit 转换为 time.Duration，超出范围返回 false
+func duration(n int64, unit time.Duration) (time.Duration, bool) {
+	if n > int64(math.MaxInt64/unit) || n < int64(math.MinInt64/unit) {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+func members(args [][]byte) []any {
+	res := make([]any, 0, len(args))
+	for _, arg := range args {
+		res = append(res, string(arg))
+	}
+	return res
+}
+
+// parseValue 格式化之后和原本的字符串完全一样的数字保存为 int64 或者 float64，
+// 这样 SET 之后可以和 Redis 一样执行 INCRBY，GET 的时候再格式化为同样的字符串
+func parseValue(s string) any {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) &&
+		strconv.FormatFloat(f, 'f', -1, 64) == s {
+		return f
+	}
+	return s
+}
+
+// formatValue 列表和集合之类的值没有办法用字符串表示，返回 false
+func formatValue(val any) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case int:
+		return strconv.Itoa(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+func writeValue(w *writer, val any, err error) {
+	if errors.Is(err, errs.ErrKeyNotExist) {
+		w.writeNull()
+		return
+	}
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	s, ok := formatValue(val)
+	if !ok {
+		w.writeError(errWrongType)
+		return
+	}
+	w.writeBulk(s)
+}
+
+func writeInt(w *writer, n int64, err error) {
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	w.writeInt(n)
+}
+
+func writeErr(w *writer, err error) {
+	w.writeError("ERR " + strings.ReplaceAll(err.Error(), "\r\n", " "))
+}
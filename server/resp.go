@@ -0,0 +1,174 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// errProtocol 客户端发送的数据不符合 RESP 协议，回复错误之后断开连接
+var errProtocol = errors.New("Protocol error")
+
+const maxArrayLen = 1024 * 1024
+
+// reader 读取客户端发送的命令，支持 RESP 数组和 redis-cli 使用的内联命令
+type reader struct {
+	rd         *bufio.Reader
+	maxBulkLen int
+}
+
+func newReader(rd io.Reader, maxBulkLen int) *reader {
+	return &reader{rd: bufio.NewReader(rd), maxBulkLen: maxBulkLen}
+}
+
+// buffered 缓冲区里是否还有没有处理的数据，也就是客户端是否使用了 pipeline
+func (r *reader) buffered() bool {
+	return r.rd.Buffered() > 0
+}
+
+// readCommand 读取一条命令，空的内联命令返回长度为 0 的结果
+func (r *reader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+	n, err := parseLen(line[1:], maxArrayLen)
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func (r *reader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, errProtocol
+	}
+	n, err := parseLen(line[1:], r.maxBulkLen)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n+2)
+	if _, err = io.ReadFull(r.rd, buf); err != nil {
+		return nil, err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, errProtocol
+	}
+	return buf[:n], nil
+}
+
+// readLine 读取一行，去掉末尾的 \r\n
+func (r *reader) readLine() ([]byte, error) {
+	line, err := r.rd.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, errProtocol
+		}
+		return nil, err
+	}
+	return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+}
+
+func parseLen(b []byte, limit int) (int, error) {
+	n, err := strconv.Atoi(string(b))
+	if err != nil || n < 0 || n > limit {
+		return 0, errProtocol
+	}
+	return n, nil
+}
+
+// writer 按照客户端协商的协议版本写回复，RESP2 没有的类型会被转换为 RESP2 里面对应的类型
+type writer struct {
+	wr    *bufio.Writer
+	resp3 bool
+	buf   []byte
+}
+
+func newWriter(wr io.Writer) *writer {
+	return &writer{wr: bufio.NewWriter(wr)}
+}
+
+func (w *writer) flush() error {
+	return w.wr.Flush()
+}
+
+func (w *writer) writeSimple(s string) {
+	w.wr.WriteByte('+')
+	w.wr.WriteString(s)
+	w.wr.WriteString("\r\n")
+}
+
+func (w *writer) writeError(s string) {
+	w.wr.WriteByte('-')
+	w.wr.WriteString(s)
+	w.wr.WriteString("\r\n")
+}
+
+func (w *writer) writeInt(n int64) {
+	w.writePrefix(':', n)
+}
+
+func (w *writer) writeBulk(s string) {
+	w.writePrefix('$', int64(len(s)))
+	w.wr.WriteString(s)
+	w.wr.WriteString("\r\n")
+}
+
+func (w *writer) writeNull() {
+	if w.resp3 {
+		w.wr.WriteString("_\r\n")
+		return
+	}
+	w.wr.WriteString("$-1\r\n")
+}
+
+func (w *writer) writeArray(n int) {
+	w.writePrefix('*', int64(n))
+}
+
+// writeMap RESP2 里面用长度翻倍的数组表示
+func (w *writer) writeMap(n int) {
+	if w.resp3 {
+		w.writePrefix('%', int64(n))
+		return
+	}
+	w.writeArray(n * 2)
+}
+
+func (w *writer) writePrefix(prefix byte, n int64) {
+	w.buf = append(w.buf[:0], prefix)
+	w.buf = strconv.AppendInt(w.buf, n, 10)
+	w.buf = append(w.buf, '\r', '\n')
+	w.wr.Write(w.buf)
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader_readCommand(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "array",
+			input: "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n",
+			want:  []string{"GET", "key"},
+		},
+		{
+			name:  "binary bulk",
+			input: "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n",
+			want:  []string{"ECHO", "a\r\nb"},
+		},
+		{
+			name:  "inline",
+			input: "SET  key value\r\n",
+			want:  []string{"SET", "key", "value"},
+		},
+		{
+			name:  "empty inline",
+			input: "\r\n",
+			want:  []string{},
+		},
+		{
+			name:    "bad array length",
+			input:   "*x\r\n",
+			wantErr: errProtocol,
+		},
+		{
+			name:    "not bulk",
+			input:   "*1\r\n:1\r\n",
+			wantErr: errProtocol,
+		},
+		{
+			name:    "bulk too long",
+			input:   "*1\r\n$100\r\n",
+			wantErr: errProtocol,
+		},
+		{
+			name:    "bad bulk terminator",
+			input:   "*1\r\n$1\r\nab\r\n",
+			wantErr: errProtocol,
+		},
+		{
+			name:    "eof",
+			input:   "*2\r\n$3\r\nGET\r\n",
+			wantErr: io.EOF,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newReader(strings.NewReader(tc.input), 16)
+			args, err := r.readCommand()
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			res := make([]string, 0, len(args))
+			for _, arg := range args {
+				res = append(res, string(arg))
+			}
+			assert.Equal(t, tc.want, res)
+		})
+	}
+}
+
+func TestReader_pipeline(t *testing.T) {
+	r := newReader(strings.NewReader("PING\r\n*1\r\n$4\r\nPING\r\n"), 16)
+	_, err := r.readCommand()
+	require.NoError(t, err)
+	assert.True(t, r.buffered())
+	_, err = r.readCommand()
+	require.NoError(t, err)
+	assert.False(t, r.buffered())
+}
+
+func TestWriter(t *testing.T) {
+	testCases := []struct {
+		name  string
+		resp3 bool
+		want  string
+	}{
+		{
+			name: "resp2",
+			want: "+OK\r\n-ERR bad\r\n:-1\r\n$2\r\nab\r\n$-1\r\n*2\r\n*2\r\n",
+		},
+		{
+			name:  "resp3",
+			resp3: true,
+			want:  "+OK\r\n-ERR bad\r\n:-1\r\n$2\r\nab\r\n_\r\n*2\r\n%1\r\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := newWriter(buf)
+			w.resp3 = tc.resp3
+			w.writeSimple("OK")
+			w.writeError("ERR bad")
+			w.writeInt(-1)
+			w.writeBulk("ab")
+			w.writeNull()
+			w.writeArray(2)
+			w.writeMap(1)
+			require.NoError(t, w.flush())
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server 用 Redis 的 RESP2/RESP3 协议对外提供任意 ecache.Cache，
+// 可以作为 sidecar 让 redis-cli 和已有的 Redis 客户端直接访问内存缓存
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+// ErrServerClosed 调用 Shutdown 或者 Close 之后 Serve 返回的错误
+var ErrServerClosed = errors.New("ecache: 服务器已经关闭")
+
+type Server struct {
+	cache        ecache.Cache
+	maxBulkLen   int
+	noExpiration time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	wg        sync.WaitGroup
+	nextID    atomic.Int64
+
+	// deadlines 通过这个服务器设置的有效期，TTL 命令需要用到
+	deadlineMu    sync.Mutex
+	deadlines     map[string]time.Time
+	sweepDeadline int
+}
+
+func NewServer(cache ecache.Cache, opts ...option.Option[Server]) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	res := &Server{
+		cache:         cache,
+		maxBulkLen:    512 * 1024 * 1024,
+		ctx:           ctx,
+		cancel:        cancel,
+		listeners:     make(map[net.Listener]struct{}),
+		conns:         make(map[*conn]struct{}),
+		deadlines:     make(map[string]time.Time),
+		sweepDeadline: 1024,
+	}
+	option.Apply(res, opts...)
+	return res
+}
+
+// WithMaxBulkLen 单个参数的最大长度，默认和 Redis 一样是 512MB
+func WithMaxBulkLen(n int) option.Option[Server] {
+	return func(s *Server) {
+		s.maxBulkLen = n
+	}
+}
+
+// WithNoExpiration 客户端没有指定有效期的时候传给后端的有效期，默认是 0
+// lru.Cache 会把 0 当作立刻过期，作为后端的时候需要传入一个足够长的有效期
+func WithNoExpiration(expiration time.Duration) option.Option[Server] {
+	return func(s *Server) {
+		s.noExpiration = expiration
+	}
+}
+
+// expiration 把客户端的有效期转换为传给后端的有效期，0 表示永不过期
+func (s *Server) expiration(expiration time.Duration) time.Duration {
+	if expiration == 0 {
+		return s.noExpiration
+	}
+	return expiration
+}
+
+// ListenAndServe network 可以是 tcp 或者 unix
+func (s *Server) ListenAndServe(network, address string) error {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve 阻塞直到 ln 出错或者服务器关闭，关闭的时候返回 ErrServerClosed
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+		_ = ln.Close()
+	}()
+
+	var delay time.Duration
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				delay = backoff(delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		c := &conn{
+			id: s.nextID.Add(1),
+			nc: nc,
+			r:  newReader(nc, s.maxBulkLen),
+			w:  newWriter(nc),
+		}
+		if !s.track(c) {
+			_ = nc.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(c)
+	}
+}
+
+func backoff(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	if delay *= 2; delay > time.Second {
+		delay = time.Second
+	}
+	return delay
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// track 记录新的连接，服务器已经关闭的时候返回 false
+func (s *Server) track(c *conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) serveConn(c *conn) {
+	defer func() {
+		_ = c.nc.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	for {
+		args, err := c.r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.w.writeError("ERR " + err.Error())
+				_ = c.w.flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.execute(c, args)
+		// 客户端使用 pipeline 的时候，处理完缓冲区里面所有的命令再一起写回
+		if quit || !c.r.buffered() {
+			if err = c.w.flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// execute 执行一条命令，返回是否需要断开连接
+func (s *Server) execute(c *conn, args [][]byte) bool {
+	if strings.EqualFold(string(args[0]), "QUIT") {
+		c.w.writeSimple("OK")
+		return true
+	}
+	cmd, errMsg := lookup(args)
+	if errMsg != "" {
+		c.w.writeError(errMsg)
+		return false
+	}
+	cmd.handler(s, c, args)
+	return false
+}
+
+// Shutdown 优雅关闭：不再接受新的连接，等待每个连接处理完已经收到的命令之后断开
+// ctx 结束的时候强制断开剩余的连接并且返回 ctx 的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		_ = ln.Close()
+	}
+	// 正在等待新命令的连接会立刻返回，缓冲区里面已经读到的命令不受影响
+	for c := range s.conns {
+		_ = c.nc.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		_ = s.Close()
+		return ctx.Err()
+	}
+}
+
+// Close 立刻关闭所有的监听和连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		_ = ln.Close()
+	}
+	for c := range s.conns {
+		_ = c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.cancel()
+	return nil
+}
+
+// setDeadline 记录 key 的有效期，expiration 为 0 表示永不过期
+func (s *Server) setDeadline(key string, expiration time.Duration) {
+	s.deadlineMu.Lock()
+	defer s.deadlineMu.Unlock()
+	if expiration == 0 {
+		delete(s.deadlines, key)
+		return
+	}
+	now := time.Now()
+	s.deadlines[key] = now.Add(expiration)
+	// 过期的 key 不会通知服务器，所以记录的数量翻倍的时候清理一次
+	if len(s.deadlines) < s.sweepDeadline {
+		return
+	}
+	for k, deadline := range s.deadlines {
+		if !deadline.After(now) {
+			delete(s.deadlines, k)
+		}
+	}
+	s.sweepDeadline = 2 * len(s.deadlines)
+	if s.sweepDeadline < 1024 {
+		s.sweepDeadline = 1024
+	}
+}
+
+// remaining 返回 key 剩余的有效期，不知道的时候返回 false
+// 记录的有效期已经过了但是 key 还存在，说明 key 是之后重新创建的
+func (s *Server) remaining(key string) (time.Duration, bool) {
+	s.deadlineMu.Lock()
+	defer s.deadlineMu.Unlock()
+	deadline, ok := s.deadlines[key]
+	if !ok {
+		return 0, false
+	}
+	res := time.Until(deadline)
+	if res <= 0 {
+		delete(s.deadlines, key)
+		return 0, false
+	}
+	return res, true
+}
+
+type conn struct {
+	id int64
+	nc net.Conn
+	r  *reader
+	w  *writer
+}
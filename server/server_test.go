@@ -0,0 +1,451 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory"
+	"github.com/ecodeclub/ecache/memory/lru"
+	"github.com/ecodeclub/ecache/memory/priority"
+	ecacheredis "github.com/ecodeclub/ecache/redis"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCache(t *testing.T) ecache.Cache {
+	c := memory.NewAdapter(memory.NewCache[string, any](1024))
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c
+}
+
+// backends 服务器在不同的内存缓存上的行为应该一致
+var backends = []struct {
+	name     string
+	newCache func(t *testing.T) ecache.Cache
+	opts     []option.Option[Server]
+}{
+	{
+		name:     "adapter",
+		newCache: newCache,
+	},
+	{
+		name: "lru",
+		newCache: func(t *testing.T) ecache.Cache {
+			c := lru.NewCache(1024)
+			t.Cleanup(func() {
+				_ = c.Close()
+			})
+			return c
+		},
+		// lru.Cache 的有效期为 0 表示立刻过期
+		opts: []option.Option[Server]{WithNoExpiration(time.Hour)},
+	},
+	{
+		name: "priority",
+		newCache: func(t *testing.T) ecache.Cache {
+			c, err := priority.NewRBTreePriorityCache()
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				_ = c.Close()
+			})
+			return c
+		},
+	},
+}
+
+// startServer 在随机端口上启动服务器，测试结束的时候关闭
+func startServer(t *testing.T, network, address string) (*Server, string) {
+	return serveCache(t, newCache(t), network, address)
+}
+
+// serveCache 和 startServer 一样，但是使用 c 作为后端
+func serveCache(t *testing.T, c ecache.Cache, network, address string, opts ...option.Option[Server]) (*Server, string) {
+	ln, err := net.Listen(network, address)
+	require.NoError(t, err)
+	s := NewServer(c, opts...)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = s.Close()
+		assert.Equal(t, ErrServerClosed, <-done)
+	})
+	return s, ln.Addr().String()
+}
+
+func TestServer_redisCache(t *testing.T) {
+	for _, backend := range backends {
+		for _, protocol := range []int{2, 3} {
+			t.Run(backend.name+"/resp"+string(rune('0'+protocol)), func(t *testing.T) {
+				_, addr := serveCache(t, backend.newCache(t), "tcp", "127.0.0.1:0", backend.opts...)
+				client := redis.NewClient(&redis.Options{Addr: addr, Protocol: protocol})
+				defer client.Close()
+				c := ecacheredis.NewCache(client)
+				ctx := context.Background()
+
+				require.NoError(t, c.Set(ctx, "key", "value", time.Minute))
+				val := c.Get(ctx, "key")
+				require.NoError(t, val.Err)
+				assert.Equal(t, "value", val.Val)
+				assert.Equal(t, errs.ErrKeyNotExist, c.Get(ctx, "missing").Err)
+
+				// 没有设置有效期的 key 永不过期
+				require.NoError(t, c.Set(ctx, "forever", "value", 0))
+				val = c.Get(ctx, "forever")
+				require.NoError(t, val.Err)
+				assert.Equal(t, "value", val.Val)
+
+				ok, err := c.SetNX(ctx, "key", "other", time.Minute)
+				require.NoError(t, err)
+				assert.False(t, ok)
+				ok, err = c.SetNX(ctx, "nx", "value", 0)
+				require.NoError(t, err)
+				assert.True(t, ok)
+
+				val = c.GetSet(ctx, "key", "new")
+				require.NoError(t, val.Err)
+				assert.Equal(t, "value", val.Val)
+				assert.Equal(t, errs.ErrKeyNotExist, c.GetSet(ctx, "getset", "new").Err)
+				// GETSET 写入的数字和 SET 一样可以自增
+				val = c.GetSet(ctx, "getset", "5")
+				require.NoError(t, val.Err)
+				assert.Equal(t, "new", val.Val)
+				n, err := c.IncrBy(ctx, "getset", 1)
+				require.NoError(t, err)
+				assert.Equal(t, int64(6), n)
+
+				n, err = c.Delete(ctx, "key", "nx", "missing")
+				require.NoError(t, err)
+				assert.Equal(t, int64(2), n)
+			})
+		}
+	}
+}
+
+// TestServer_collections 列表、集合和数字在各个内存缓存里面的语义并不一致，只在默认的后端上测试
+func TestServer_collections(t *testing.T) {
+	for _, protocol := range []int{2, 3} {
+		t.Run("resp"+string(rune('0'+protocol)), func(t *testing.T) {
+			_, addr := startServer(t, "tcp", "127.0.0.1:0")
+			client := redis.NewClient(&redis.Options{Addr: addr, Protocol: protocol})
+			defer client.Close()
+			c := ecacheredis.NewCache(client)
+			ctx := context.Background()
+
+			n, err := c.LPush(ctx, "list", "a", "b")
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+			val := c.LPop(ctx, "list")
+			require.NoError(t, val.Err)
+			assert.Equal(t, "b", val.Val)
+			// 列表不能用 GET 读取
+			assert.Error(t, c.Get(ctx, "list").Err)
+
+			n, err = c.SAdd(ctx, "set", "a", "b", "a")
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+			n, err = c.SRem(ctx, "set", "a", "c")
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+			n, err = c.SRem(ctx, "missing", "a")
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), n)
+
+			require.NoError(t, c.Set(ctx, "num", 10, 0))
+			n, err = c.IncrBy(ctx, "num", 5)
+			require.NoError(t, err)
+			assert.Equal(t, int64(15), n)
+			n, err = c.DecrBy(ctx, "num", 20)
+			require.NoError(t, err)
+			assert.Equal(t, int64(-5), n)
+			f, err := c.IncrByFloat(ctx, "num", 1.5)
+			require.NoError(t, err)
+			assert.Equal(t, -3.5, f)
+			assert.Equal(t, "-3.5", c.Get(ctx, "num").Val)
+			_, err = c.IncrBy(ctx, "num", 1)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestServer_expire(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			_, addr := serveCache(t, backend.newCache(t), "tcp", "127.0.0.1:0", backend.opts...)
+			client := redis.NewClient(&redis.Options{Addr: addr})
+			defer client.Close()
+			ctx := context.Background()
+
+			require.NoError(t, client.Set(ctx, "key", "value", 0).Err())
+			assert.Equal(t, time.Duration(-1), client.TTL(ctx, "key").Val())
+			assert.Equal(t, time.Duration(-2), client.TTL(ctx, "missing").Val())
+
+			assert.True(t, client.Expire(ctx, "key", 100*time.Second).Val())
+			assert.Equal(t, 100*time.Second, client.TTL(ctx, "key").Val())
+			assert.False(t, client.Expire(ctx, "missing", time.Second).Val())
+
+			require.NoError(t, client.Set(ctx, "key", "value", 10*time.Second).Err())
+			assert.Equal(t, 10*time.Second, client.TTL(ctx, "key").Val())
+			require.NoError(t, client.Set(ctx, "key", "value", 0).Err())
+			assert.Equal(t, time.Duration(-1), client.TTL(ctx, "key").Val())
+
+			require.NoError(t, client.Set(ctx, "short", "value", 50*time.Millisecond).Err())
+			time.Sleep(100 * time.Millisecond)
+			assert.Equal(t, redis.Nil, client.Get(ctx, "short").Err())
+
+			assert.True(t, client.Expire(ctx, "key", -1).Val())
+			assert.Equal(t, redis.Nil, client.Get(ctx, "key").Err())
+		})
+	}
+}
+
+func TestServer_expireList(t *testing.T) {
+	_, addr := startServer(t, "tcp", "127.0.0.1:0")
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	ctx := context.Background()
+
+	// 有效期保留列表本身
+	require.NoError(t, client.LPush(ctx, "list", "a").Err())
+	assert.True(t, client.Expire(ctx, "list", time.Minute).Val())
+	assert.Equal(t, "a", client.LPop(ctx, "list").Val())
+}
+
+// roundTrip 把 input 一次性发给服务器，读取 n 行回复
+func roundTrip(t *testing.T, nc net.Conn, input string, n int) []string {
+	_, err := nc.Write([]byte(input))
+	require.NoError(t, err)
+	r := bufio.NewReader(nc)
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		res = append(res, strings.TrimSuffix(line, "\r\n"))
+	}
+	return res
+}
+
+func TestServer_raw(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "pipeline",
+			input: "SET key 1\r\nINCR key\r\nGET key\r\nDEL key\r\nGET key\r\n",
+			want:  []string{"+OK", ":2", "$1", "2", ":1", "$-1"},
+		},
+		{
+			name:  "ping",
+			input: "PING\r\n*2\r\n$4\r\nping\r\n$2\r\nhi\r\n",
+			want:  []string{"+PONG", "$2", "hi"},
+		},
+		{
+			name:  "set options",
+			input: "SET key v NX\r\nSET key v NX\r\nSET key v EX 0\r\nSET key v XX\r\nSET key v EX a\r\n",
+			want:  []string{"+OK", "$-1", "-" + errInvalidTime, "-" + errSyntax, "-" + errNotInteger},
+		},
+		{
+			name: "expire time out of range",
+			input: "SET key v EX 10000000000\r\nSET key v PX 10000000000000\r\nSET key v\r\n" +
+				"EXPIRE key 10000000000\r\nGET key\r\n",
+			want: []string{
+				"-" + errInvalidTime, "-" + errInvalidTime, "+OK",
+				"-" + errExpireTime, "$1", "v",
+			},
+		},
+		{
+			name:  "errors",
+			input: "UNKNOWN\r\nGET\r\nINCRBY key a\r\nINCRBYFLOAT key a\r\nSELECT 1\r\n",
+			want: []string{
+				"-ERR unknown command 'UNKNOWN'",
+				"-ERR wrong number of arguments for 'get' command",
+				"-" + errNotInteger,
+				"-" + errNotFloat,
+				"-ERR DB index is out of range",
+			},
+		},
+		{
+			name:  "hello",
+			input: "HELLO 3\r\nGET missing\r\nHELLO 4\r\n",
+			want: []string{
+				"%7", "$6", "server", "$6", "ecache", "$7", "version", "$5", "1.0.0",
+				"$5", "proto", ":3", "$2", "id", ":1", "$4", "mode", "$10", "standalone",
+				"$4", "role", "$6", "master", "$7", "modules", "*0",
+				"_", "-NOPROTO unsupported protocol version",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, addr := startServer(t, "tcp", "127.0.0.1:0")
+			nc, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer nc.Close()
+			assert.Equal(t, tc.want, roundTrip(t, nc, tc.input, len(tc.want)))
+		})
+	}
+}
+
+func TestServer_quit(t *testing.T) {
+	_, addr := startServer(t, "tcp", "127.0.0.1:0")
+	nc, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer nc.Close()
+	assert.Equal(t, []string{"+OK"}, roundTrip(t, nc, "QUIT\r\nPING\r\n", 1))
+	_, err = nc.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServer_protocolError(t *testing.T) {
+	_, addr := startServer(t, "tcp", "127.0.0.1:0")
+	nc, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer nc.Close()
+	assert.Equal(t, []string{"-ERR Protocol error"}, roundTrip(t, nc, "*1\r\n:1\r\n", 1))
+	_, err = nc.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServer_unix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ecache.sock")
+	startServer(t, "unix", path)
+	client := redis.NewClient(&redis.Options{Network: "unix", Addr: path})
+	defer client.Close()
+	assert.Equal(t, "PONG", client.Ping(context.Background()).Val())
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewServer(newCache(t))
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ln)
+	}()
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer nc.Close()
+	assert.Equal(t, []string{"+PONG"}, roundTrip(t, nc, "PING\r\n", 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+	assert.Equal(t, ErrServerClosed, <-done)
+	// 空闲的连接被断开
+	_, err = nc.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	_, err = net.Dial("tcp", ln.Addr().String())
+	assert.Error(t, err)
+	assert.Equal(t, ErrServerClosed, s.Serve(ln))
+}
+
+// blockingCache Get 阻塞到 release 被关闭
+type blockingCache struct {
+	ecache.Cache
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCache) Get(ctx context.Context, key string) ecache.Value {
+	close(c.started)
+	<-c.release
+	return c.Cache.Get(ctx, key)
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	c := &blockingCache{Cache: newCache(t), started: make(chan struct{}), release: make(chan struct{})}
+	defer close(c.release)
+	s := NewServer(c)
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer nc.Close()
+	_, err = nc.Write([]byte("GET key\r\n"))
+	require.NoError(t, err)
+	<-c.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+	// 被强制断开
+	_, err = nc.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+// racingCache 第一次 Get 之后马上写入新的值，模拟 EXPIRE 读出和写回之间的并发写入
+type racingCache struct {
+	*lru.Cache
+	once sync.Once
+}
+
+func (c *racingCache) Get(ctx context.Context, key string) ecache.Value {
+	val := c.Cache.Get(ctx, key)
+	c.once.Do(func() {
+		_ = c.Cache.Set(ctx, key, "racing", time.Hour)
+	})
+	return val
+}
+
+func TestServer_expireConcurrentSet(t *testing.T) {
+	c := &racingCache{Cache: lru.NewCache(16)}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	_, addr := serveCache(t, c, "tcp", "127.0.0.1:0")
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	ctx := context.Background()
+
+	require.NoError(t, c.Cache.Set(ctx, "key", "value", time.Hour))
+	assert.True(t, client.Expire(ctx, "key", 100*time.Second).Val())
+	// 并发写入的值没有被覆盖
+	assert.Equal(t, "racing", client.Get(ctx, "key").Val())
+	assert.Equal(t, 100*time.Second, client.TTL(ctx, "key").Val())
+}
+
+func TestServer_ttlUnknown(t *testing.T) {
+	c := newCache(t)
+	_, addr := serveCache(t, c, "tcp", "127.0.0.1:0")
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	ctx := context.Background()
+
+	// 直接写入后端的有效期服务器并不知道
+	require.NoError(t, c.Set(ctx, "key", "value", time.Minute))
+	assert.Equal(t, time.Duration(-1), client.TTL(ctx, "key").Val())
+}
@@ -0,0 +1,270 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ecache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ecodeclub/ecache/internal/hashring"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+// ErrNoShard ShardedCache 里面还没有任何分片
+var ErrNoShard = errors.New("ecache: 没有可用的分片")
+
+var _ Cache = (*ShardedCache)(nil)
+
+// ShardedCache 在客户端用一致性哈希把 key 分配到多个独立的缓存上，例如多个没有组成集群的 Redis
+// 增加或者删除分片的时候只有一小部分 key 会被重新分配，被重新分配的 key 在新的分片上相当于没有命中
+type ShardedCache struct {
+	mu         sync.RWMutex
+	shards     map[string]Cache
+	weights    map[string]int
+	ring       *hashring.Ring
+	replicas   int
+	rendezvous bool
+	// names 和 nameWeights 是 rendezvous 模式下按照名字排序的分片和它们的权重
+	names       []string
+	nameWeights []int
+}
+
+func NewShardedCache(opts ...option.Option[ShardedCache]) *ShardedCache {
+	res := &ShardedCache{
+		shards:   make(map[string]Cache),
+		weights:  make(map[string]int),
+		replicas: 160,
+	}
+	option.Apply(res, opts...)
+	res.ring = hashring.New(res.replicas)
+	return res
+}
+
+// WithShardReplicas 权重为 1 的分片在一致性哈希环上的虚拟结点数，默认是 160
+func WithShardReplicas(n int) option.Option[ShardedCache] {
+	return func(c *ShardedCache) {
+		c.replicas = n
+	}
+}
+
+// WithRendezvous 使用 rendezvous 哈希代替一致性哈希环
+// 分布更加均匀，也不需要虚拟结点，但是每次查找的开销和分片的数量成正比，适合分片数量不多的场景
+func WithRendezvous() option.Option[ShardedCache] {
+	return func(c *ShardedCache) {
+		c.rendezvous = true
+	}
+}
+
+// AddShard 加入分片，weight 越大分配到的 key 越多，同名的分片会被替换
+func (c *ShardedCache) AddShard(name string, cache Cache, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shards[name] = cache
+	c.weights[name] = weight
+	c.ring.Set(name, weight)
+	c.rebuild()
+}
+
+// RemoveShard 删除分片，分片里面的数据不会被迁移
+func (c *ShardedCache) RemoveShard(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.shards, name)
+	delete(c.weights, name)
+	c.ring.Remove(name)
+	c.rebuild()
+}
+
+// rebuild 分片变化之后重新生成 rendezvous 模式使用的有序分片列表
+func (c *ShardedCache) rebuild() {
+	if !c.rendezvous {
+		return
+	}
+	c.names = c.ring.Nodes()
+	c.nameWeights = make([]int, len(c.names))
+	for i, name := range c.names {
+		c.nameWeights[i] = c.weights[name]
+	}
+}
+
+// locate 返回负责 key 的分片的名字
+func (c *ShardedCache) locate(key string) (string, bool) {
+	if !c.rendezvous {
+		return c.ring.Get(key)
+	}
+	i := hashring.Rendezvous(key, c.names, c.nameWeights)
+	if i < 0 {
+		return "", false
+	}
+	return c.names[i], true
+}
+
+func (c *ShardedCache) shard(key string) (Cache, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	name, ok := c.locate(key)
+	if !ok {
+		return nil, ErrNoShard
+	}
+	return c.shards[name], nil
+}
+
+func (c *ShardedCache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
+	cache, err := c.shard(key)
+	if err != nil {
+		return err
+	}
+	return cache.Set(ctx, key, val, expiration)
+}
+
+func (c *ShardedCache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	cache, err := c.shard(key)
+	if err != nil {
+		return false, err
+	}
+	return cache.SetNX(ctx, key, val, expiration)
+}
+
+func (c *ShardedCache) Get(ctx context.Context, key string) (val Value) {
+	cache, err := c.shard(key)
+	if err != nil {
+		val.Err = err
+		return
+	}
+	return cache.Get(ctx, key)
+}
+
+func (c *ShardedCache) GetSet(ctx context.Context, key string, val string) (result Value) {
+	cache, err := c.shard(key)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	return cache.GetSet(ctx, key, val)
+}
+
+// Delete 按照分片拆分 key，并发删除之后汇总删除的数量
+// 部分分片出错的时候，返回其它分片删除的数量以及所有的错误
+func (c *ShardedCache) Delete(ctx context.Context, key ...string) (int64, error) {
+	type group struct {
+		cache Cache
+		keys  []string
+	}
+	groups := make(map[string]*group)
+	c.mu.RLock()
+	for _, k := range key {
+		name, ok := c.locate(k)
+		if !ok {
+			c.mu.RUnlock()
+			return 0, ErrNoShard
+		}
+		g, ok := groups[name]
+		if !ok {
+			g = &group{cache: c.shards[name]}
+			groups[name] = g
+		}
+		g.keys = append(g.keys, k)
+	}
+	c.mu.RUnlock()
+	if len(groups) == 1 {
+		for _, g := range groups {
+			return g.cache.Delete(ctx, g.keys...)
+		}
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		n    int64
+		errs []error
+	)
+	for _, g := range groups {
+		wg.Add(1)
+		go func(g *group) {
+			defer wg.Done()
+			cnt, err := g.cache.Delete(ctx, g.keys...)
+			mu.Lock()
+			defer mu.Unlock()
+			n += cnt
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(g)
+	}
+	wg.Wait()
+	return n, errors.Join(errs...)
+}
+
+func (c *ShardedCache) LPush(ctx context.Context, key string, val ...any) (int64, error) {
+	cache, err := c.shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cache.LPush(ctx, key, val...)
+}
+
+func (c *ShardedCache) LPop(ctx context.Context, key string) (val Value) {
+	cache, err := c.shard(key)
+	if err != nil {
+		val.Err = err
+		return
+	}
+	return cache.LPop(ctx, key)
+}
+
+func (c *ShardedCache) SAdd(ctx context.Context, key string, members ...any) (int64, error) {
+	cache, err := c.shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cache.SAdd(ctx, key, members...)
+}
+
+func (c *ShardedCache) SRem(ctx context.Context, key string, members ...any) (int64, error) {
+	cache, err := c.shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cache.SRem(ctx, key, members...)
+}
+
+func (c *ShardedCache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	cache, err := c.shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cache.IncrBy(ctx, key, value)
+}
+
+func (c *ShardedCache) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
+	cache, err := c.shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cache.DecrBy(ctx, key, value)
+}
+
+func (c *ShardedCache) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
+	cache, err := c.shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return cache.IncrByFloat(ctx, key, value)
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ecache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ekit"
+	"github.com/ecodeclub/ekit/bean/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestShardedCache_noShard(t *testing.T) {
+	c := NewShardedCache()
+	ctx := context.Background()
+	assert.Equal(t, ErrNoShard, c.Set(ctx, "key", "value", time.Minute))
+	assert.Equal(t, ErrNoShard, c.Get(ctx, "key").Err)
+	_, err := c.Delete(ctx, "key")
+	assert.Equal(t, ErrNoShard, err)
+
+	mock := NewMockCache(gomock.NewController(t))
+	c.AddShard("a", mock, 1)
+	c.RemoveShard("a")
+	_, err = c.IncrBy(ctx, "key", 1)
+	assert.Equal(t, ErrNoShard, err)
+}
+
+func TestShardedCache_route(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []option.Option[ShardedCache]
+	}{
+		{name: "ring"},
+		{name: "rendezvous", opts: []option.Option[ShardedCache]{WithRendezvous()}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			c := NewShardedCache(tc.opts...)
+			// 每个分片的 Get 返回分片自己的名字
+			for _, name := range []string{"a", "b", "c"} {
+				mock := NewMockCache(ctrl)
+				mock.EXPECT().Get(gomock.Any(), gomock.Any()).
+					Return(Value{AnyValue: ekit.AnyValue{Val: name}}).AnyTimes()
+				c.AddShard(name, mock, 1)
+			}
+			ctx := context.Background()
+			counts := make(map[any]int)
+			for i := 0; i < 3000; i++ {
+				key := "key" + strconv.Itoa(i)
+				name, ok := c.locate(key)
+				require.True(t, ok)
+				val := c.Get(ctx, key)
+				assert.Equal(t, name, val.Val)
+				counts[val.Val]++
+			}
+			for _, cnt := range counts {
+				assert.InDelta(t, 1000, cnt, 300)
+			}
+		})
+	}
+}
+
+func TestShardedCache_addRemove(t *testing.T) {
+	for _, opts := range [][]option.Option[ShardedCache]{nil, {WithRendezvous()}} {
+		c := NewShardedCache(opts...)
+		ctrl := gomock.NewController(t)
+		c.AddShard("a", NewMockCache(ctrl), 1)
+		c.AddShard("b", NewMockCache(ctrl), 1)
+		locate := func() map[string]string {
+			res := make(map[string]string)
+			for i := 0; i < 3000; i++ {
+				key := "key" + strconv.Itoa(i)
+				res[key], _ = c.locate(key)
+			}
+			return res
+		}
+		before := locate()
+		// 权重为 2 的新分片分到大约一半的 key，其它的 key 不动
+		c.AddShard("c", NewMockCache(ctrl), 2)
+		after := locate()
+		moved := 0
+		for key, name := range after {
+			if name != before[key] {
+				assert.Equal(t, "c", name)
+				moved++
+			}
+		}
+		assert.InDelta(t, 1500, moved, 300)
+		c.RemoveShard("c")
+		assert.Equal(t, before, locate())
+	}
+}
+
+func TestShardedCache_Delete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	c := NewShardedCache()
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	failed := errors.New("failed")
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		mock := NewMockCache(ctrl)
+		mock.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, keys ...string) (int64, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				received[name] = keys
+				if name == "c" {
+					return 1, failed
+				}
+				return int64(len(keys)), nil
+			}).MaxTimes(1)
+		c.AddShard(name, mock, 1)
+	}
+	var keys []string
+	for i := 0; i < 30; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	n, err := c.Delete(context.Background(), keys...)
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, int64(30-len(received["c"])+1), n)
+
+	// 每个 key 都只发给了负责它的分片
+	var all []string
+	for name, ks := range received {
+		for _, k := range ks {
+			owner, _ := c.locate(k)
+			assert.Equal(t, name, owner)
+		}
+		all = append(all, ks...)
+	}
+	sort.Strings(all)
+	sort.Strings(keys)
+	assert.Equal(t, keys, all)
+}
+
+func TestShardedCache_forward(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mock := NewMockCache(ctrl)
+	c := NewShardedCache()
+	c.AddShard("a", mock, 1)
+	ctx := context.Background()
+
+	mock.EXPECT().Set(ctx, "key", "value", time.Minute).Return(nil)
+	assert.NoError(t, c.Set(ctx, "key", "value", time.Minute))
+	mock.EXPECT().SetNX(ctx, "key", "value", time.Minute).Return(true, nil)
+	ok, err := c.SetNX(ctx, "key", "value", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	mock.EXPECT().GetSet(ctx, "key", "value").Return(Value{AnyValue: ekit.AnyValue{Err: errs.ErrKeyNotExist}})
+	assert.Equal(t, errs.ErrKeyNotExist, c.GetSet(ctx, "key", "value").Err)
+	mock.EXPECT().Delete(ctx, "key").Return(int64(1), nil)
+	n, err := c.Delete(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	mock.EXPECT().LPush(ctx, "key", "a").Return(int64(1), nil)
+	n, err = c.LPush(ctx, "key", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	mock.EXPECT().LPop(ctx, "key").Return(Value{AnyValue: ekit.AnyValue{Val: "a"}})
+	assert.Equal(t, "a", c.LPop(ctx, "key").Val)
+	mock.EXPECT().SAdd(ctx, "key", "a").Return(int64(1), nil)
+	n, err = c.SAdd(ctx, "key", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	mock.EXPECT().SRem(ctx, "key", "a").Return(int64(1), nil)
+	n, err = c.SRem(ctx, "key", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	mock.EXPECT().IncrBy(ctx, "key", int64(2)).Return(int64(2), nil)
+	n, err = c.IncrBy(ctx, "key", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	mock.EXPECT().DecrBy(ctx, "key", int64(2)).Return(int64(0), nil)
+	n, err = c.DecrBy(ctx, "key", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	mock.EXPECT().IncrByFloat(ctx, "key", 1.5).Return(1.5, nil)
+	f, err := c.IncrByFloat(ctx, "key", 1.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, f)
+}
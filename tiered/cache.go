@@ -0,0 +1,309 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tiered 把多个 ecache.Cache 组合成多级缓存，例如 内存 → 磁盘 → Redis
+package tiered
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ekit/bean/option"
+)
+
+var _ ecache.Cache = (*Cache)(nil)
+
+// Tier 多级缓存中的一层
+type Tier struct {
+	// Name 只用于统计数据
+	Name  string
+	Cache ecache.Cache
+	// MaxTTL 写入这一层的有效期上限，永不过期的值在这一层也会在 MaxTTL 之后过期，0 表示不限制
+	MaxTTL time.Duration
+}
+
+// WritePolicy 写操作写入哪些层
+type WritePolicy uint8
+
+const (
+	// WriteThrough 写入所有的层，先写最后一层
+	WriteThrough WritePolicy = iota
+	// WriteTop 只写第一层，后面的层只读
+	WriteTop
+	// WriteAround 只写最后一层，并且删除前面的层里面的旧值，等到读取的时候再提升上来
+	WriteAround
+)
+
+// TierStats 一层的命中统计
+type TierStats struct {
+	Name   string
+	Hits   int64
+	Misses int64
+}
+
+type tierStats struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// Cache 多级缓存，tiers[0] 是最快的一层，最后一层通常是数据最全的一层
+//
+// Get 从第一层开始逐层查找，在第 i 层命中之后把值写回前面的层。
+// 除了 WriteTop 以外，最后一层是权威的一层：SetNX、GetSet、列表、集合和计数器这些需要读取旧值的操作都在最后一层执行，
+// WriteThrough 把 SetNX 和 GetSet 的结果写入前面的层，其余的操作只是让前面的层失效
+type Cache struct {
+	tiers      []Tier
+	stats      []tierStats
+	policy     WritePolicy
+	promote    bool
+	promoteTTL time.Duration
+}
+
+// NewCache tiers 按照从快到慢的顺序排列，至少要有一层
+func NewCache(tiers []Tier, opts ...option.Option[Cache]) *Cache {
+	if len(tiers) == 0 {
+		panic("ecache: 多级缓存至少要有一层")
+	}
+	res := &Cache{
+		tiers:      tiers,
+		stats:      make([]tierStats, len(tiers)),
+		promote:    true,
+		promoteTTL: time.Minute,
+	}
+	option.Apply(res, opts...)
+	return res
+}
+
+// WithWritePolicy 设置写策略，默认是 WriteThrough
+func WithWritePolicy(policy WritePolicy) option.Option[Cache] {
+	return func(c *Cache) {
+		c.policy = policy
+	}
+}
+
+// WithPromotion 设置在后面的层命中之后是否写回前面的层，默认开启
+func WithPromotion(promote bool) option.Option[Cache] {
+	return func(c *Cache) {
+		c.promote = promote
+	}
+}
+
+// WithPromoteTTL 写回前面的层的值的有效期，默认一分钟，同样受到每一层 MaxTTL 的限制
+// ecache.Cache 没有办法读取剩余的有效期，所以写回的值可能比原本的值活得更久
+func WithPromoteTTL(ttl time.Duration) option.Option[Cache] {
+	return func(c *Cache) {
+		c.promoteTTL = ttl
+	}
+}
+
+// Stats 返回每一层的命中统计
+func (c *Cache) Stats() []TierStats {
+	res := make([]TierStats, len(c.tiers))
+	for i, tier := range c.tiers {
+		res[i] = TierStats{
+			Name:   tier.Name,
+			Hits:   c.stats[i].hits.Load(),
+			Misses: c.stats[i].misses.Load(),
+		}
+	}
+	return res
+}
+
+// ttl 用 tier 的 MaxTTL 限制有效期
+func ttl(tier Tier, expiration time.Duration) time.Duration {
+	if tier.MaxTTL > 0 && (expiration == 0 || expiration > tier.MaxTTL) {
+		return tier.MaxTTL
+	}
+	return expiration
+}
+
+// primary 权威的一层的下标
+func (c *Cache) primary() int {
+	if c.policy == WriteTop {
+		return 0
+	}
+	return len(c.tiers) - 1
+}
+
+// others 权威的一层以外的层
+func (c *Cache) others() []Tier {
+	if c.policy == WriteTop {
+		return nil
+	}
+	return c.tiers[:len(c.tiers)-1]
+}
+
+// propagate 权威的一层写入成功之后，WriteThrough 把值写入前面的层，WriteAround 让前面的层失效
+func (c *Cache) propagate(ctx context.Context, key string, val any, expiration time.Duration) error {
+	if c.policy == WriteAround {
+		return c.invalidate(ctx, key)
+	}
+	others := c.others()
+	for i := len(others) - 1; i >= 0; i-- {
+		if err := others[i].Cache.Set(ctx, key, val, ttl(others[i], expiration)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invalidate 删除权威的一层以外的层里面的 key
+func (c *Cache) invalidate(ctx context.Context, key string) error {
+	for _, tier := range c.others() {
+		if _, err := tier.Cache.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
+	p := c.primary()
+	if err := c.tiers[p].Cache.Set(ctx, key, val, ttl(c.tiers[p], expiration)); err != nil {
+		return err
+	}
+	return c.propagate(ctx, key, val, expiration)
+}
+
+func (c *Cache) SetNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	p := c.primary()
+	ok, err := c.tiers[p].Cache.SetNX(ctx, key, val, ttl(c.tiers[p], expiration))
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, c.propagate(ctx, key, val, expiration)
+}
+
+// Get 逐层查找，前面的层出错的时候继续查找后面的层
+// 所有的层都没有找到的时候，如果有层出错就返回最后一个错误，否则返回 errs.ErrKeyNotExist
+func (c *Cache) Get(ctx context.Context, key string) (val ecache.Value) {
+	var lastErr error
+	for i, tier := range c.tiers {
+		val = tier.Cache.Get(ctx, key)
+		if val.Err == nil {
+			c.stats[i].hits.Add(1)
+			if c.promote {
+				c.promoteTo(ctx, i, key, val.Val)
+			}
+			return
+		}
+		c.stats[i].misses.Add(1)
+		if !errors.Is(val.Err, errs.ErrKeyNotExist) {
+			lastErr = val.Err
+		}
+	}
+	if lastErr != nil {
+		val.Err = lastErr
+		return
+	}
+	val.Err = errs.ErrKeyNotExist
+	return
+}
+
+// promoteTo 把在第 hit 层命中的值写回前面的层，写回失败不影响读取的结果
+func (c *Cache) promoteTo(ctx context.Context, hit int, key string, val any) {
+	for i := hit - 1; i >= 0; i-- {
+		_ = c.tiers[i].Cache.Set(ctx, key, val, ttl(c.tiers[i], c.promoteTTL))
+	}
+}
+
+func (c *Cache) GetSet(ctx context.Context, key string, val string) ecache.Value {
+	res := c.tiers[c.primary()].Cache.GetSet(ctx, key, val)
+	if res.Err != nil && !errors.Is(res.Err, errs.ErrKeyNotExist) {
+		return res
+	}
+	if err := c.propagate(ctx, key, val, 0); err != nil {
+		res.Err = err
+	}
+	return res
+}
+
+// Delete 从所有的层里面删除，返回权威的一层删除的数量
+func (c *Cache) Delete(ctx context.Context, key ...string) (int64, error) {
+	var res int64
+	p := c.primary()
+	for i := len(c.tiers) - 1; i >= 0; i-- {
+		n, err := c.tiers[i].Cache.Delete(ctx, key...)
+		if err != nil {
+			return res, err
+		}
+		if i == p {
+			res = n
+		}
+	}
+	return res, nil
+}
+
+func (c *Cache) LPush(ctx context.Context, key string, val ...any) (int64, error) {
+	n, err := c.tiers[c.primary()].Cache.LPush(ctx, key, val...)
+	if err != nil {
+		return n, err
+	}
+	return n, c.invalidate(ctx, key)
+}
+
+func (c *Cache) LPop(ctx context.Context, key string) ecache.Value {
+	res := c.tiers[c.primary()].Cache.LPop(ctx, key)
+	if res.Err != nil {
+		return res
+	}
+	if err := c.invalidate(ctx, key); err != nil {
+		res.Err = err
+	}
+	return res
+}
+
+func (c *Cache) SAdd(ctx context.Context, key string, members ...any) (int64, error) {
+	n, err := c.tiers[c.primary()].Cache.SAdd(ctx, key, members...)
+	if err != nil {
+		return n, err
+	}
+	return n, c.invalidate(ctx, key)
+}
+
+func (c *Cache) SRem(ctx context.Context, key string, members ...any) (int64, error) {
+	n, err := c.tiers[c.primary()].Cache.SRem(ctx, key, members...)
+	if err != nil {
+		return n, err
+	}
+	return n, c.invalidate(ctx, key)
+}
+
+func (c *Cache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	n, err := c.tiers[c.primary()].Cache.IncrBy(ctx, key, value)
+	if err != nil {
+		return n, err
+	}
+	return n, c.invalidate(ctx, key)
+}
+
+func (c *Cache) DecrBy(ctx context.Context, key string, value int64) (int64, error) {
+	n, err := c.tiers[c.primary()].Cache.DecrBy(ctx, key, value)
+	if err != nil {
+		return n, err
+	}
+	return n, c.invalidate(ctx, key)
+}
+
+func (c *Cache) IncrByFloat(ctx context.Context, key string, value float64) (float64, error) {
+	n, err := c.tiers[c.primary()].Cache.IncrByFloat(ctx, key, value)
+	if err != nil {
+		return n, err
+	}
+	return n, c.invalidate(ctx, key)
+}
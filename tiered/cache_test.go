@@ -0,0 +1,226 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tiered
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ecache"
+	"github.com/ecodeclub/ecache/internal/errs"
+	"github.com/ecodeclub/ecache/memory/priority"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTiers(t *testing.T, n int) []Tier {
+	tiers := make([]Tier, n)
+	for i := range tiers {
+		c, err := priority.NewRBTreePriorityCache()
+		require.NoError(t, err)
+		tiers[i] = Tier{Name: string(rune('a' + i)), Cache: c}
+	}
+	return tiers
+}
+
+func exist(c ecache.Cache, key string) bool {
+	return c.Get(context.Background(), key).Err == nil
+}
+
+func TestCache_Set(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy WritePolicy
+		want   []bool
+	}{
+		{name: "write through", policy: WriteThrough, want: []bool{true, true, true}},
+		{name: "write top", policy: WriteTop, want: []bool{true, false, false}},
+		{name: "write around", policy: WriteAround, want: []bool{false, false, true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tiers := newTiers(t, 3)
+			ctx := context.Background()
+			// 前面的层里面的旧值
+			require.NoError(t, tiers[0].Cache.Set(ctx, "key", "old", time.Minute))
+			c := NewCache(tiers, WithWritePolicy(tc.policy), WithPromotion(false))
+			require.NoError(t, c.Set(ctx, "key", "value", time.Minute))
+			for i, tier := range tiers {
+				val := tier.Cache.Get(ctx, "key")
+				if !tc.want[i] {
+					assert.False(t, val.Err == nil && val.Val == "value", "tier %d", i)
+					continue
+				}
+				require.NoError(t, val.Err, "tier %d", i)
+				assert.Equal(t, "value", val.Val)
+			}
+			assert.Equal(t, "value", c.Get(ctx, "key").Val)
+		})
+	}
+}
+
+func TestCache_Get(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTiers(t, 3)
+	require.NoError(t, tiers[2].Cache.Set(ctx, "key", "value", time.Minute))
+	c := NewCache(tiers)
+
+	val := c.Get(ctx, "key")
+	require.NoError(t, val.Err)
+	assert.Equal(t, "value", val.Val)
+	// 命中之后写回前面的层
+	assert.True(t, exist(tiers[0].Cache, "key"))
+	assert.True(t, exist(tiers[1].Cache, "key"))
+
+	val = c.Get(ctx, "key")
+	require.NoError(t, val.Err)
+	val = c.Get(ctx, "missing")
+	assert.Equal(t, errs.ErrKeyNotExist, val.Err)
+
+	assert.Equal(t, []TierStats{
+		{Name: "a", Hits: 1, Misses: 2},
+		{Name: "b", Hits: 0, Misses: 2},
+		{Name: "c", Hits: 1, Misses: 1},
+	}, c.Stats())
+}
+
+func TestCache_GetWithoutPromotion(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTiers(t, 2)
+	require.NoError(t, tiers[1].Cache.Set(ctx, "key", "value", time.Minute))
+	c := NewCache(tiers, WithPromotion(false))
+	assert.Equal(t, "value", c.Get(ctx, "key").Val)
+	assert.False(t, exist(tiers[0].Cache, "key"))
+}
+
+func TestCache_GetTierError(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTiers(t, 2)
+	broken := errors.New("broken")
+	tiers[0].Cache = errCache{Cache: tiers[0].Cache, err: broken}
+	c := NewCache(tiers)
+
+	// 出错的层被跳过
+	require.NoError(t, tiers[1].Cache.Set(ctx, "key", "value", time.Minute))
+	assert.Equal(t, "value", c.Get(ctx, "key").Val)
+	// 所有的层都没有命中的时候返回错误
+	assert.Equal(t, broken, c.Get(ctx, "missing").Err)
+}
+
+// errCache Get 总是返回 err
+type errCache struct {
+	ecache.Cache
+	err error
+}
+
+func (c errCache) Get(ctx context.Context, key string) ecache.Value {
+	val := c.Cache.Get(ctx, key)
+	val.Err = c.err
+	return val
+}
+
+func TestCache_MaxTTL(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTiers(t, 2)
+	tiers[0].MaxTTL = 50 * time.Millisecond
+	c := NewCache(tiers)
+	require.NoError(t, c.Set(ctx, "key", "value", 0))
+	assert.True(t, exist(tiers[0].Cache, "key"))
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, exist(tiers[0].Cache, "key"))
+	assert.True(t, exist(tiers[1].Cache, "key"))
+}
+
+func TestCache_SetNX(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTiers(t, 2)
+	c := NewCache(tiers)
+	ok, err := c.SetNX(ctx, "key", "value", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, exist(tiers[0].Cache, "key"))
+
+	ok, err = c.SetNX(ctx, "key", "other", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "value", tiers[0].Cache.Get(ctx, "key").Val)
+}
+
+func TestCache_GetSet(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTiers(t, 2)
+	c := NewCache(tiers, WithWritePolicy(WriteAround))
+	require.NoError(t, tiers[0].Cache.Set(ctx, "key", "stale", time.Minute))
+	require.NoError(t, tiers[1].Cache.Set(ctx, "key", "old", time.Minute))
+
+	val := c.GetSet(ctx, "key", "new")
+	require.NoError(t, val.Err)
+	assert.Equal(t, "old", val.Val)
+	assert.False(t, exist(tiers[0].Cache, "key"))
+	assert.Equal(t, "new", c.Get(ctx, "key").Val)
+}
+
+func TestCache_Delete(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTiers(t, 2)
+	c := NewCache(tiers)
+	require.NoError(t, c.Set(ctx, "key", "value", time.Minute))
+	require.NoError(t, tiers[0].Cache.Set(ctx, "top", "value", time.Minute))
+
+	n, err := c.Delete(ctx, "key", "top")
+	require.NoError(t, err)
+	// 只统计权威的一层
+	assert.Equal(t, int64(1), n)
+	assert.False(t, exist(tiers[0].Cache, "key"))
+	assert.False(t, exist(tiers[0].Cache, "top"))
+	assert.False(t, exist(tiers[1].Cache, "key"))
+}
+
+func TestCache_Mutation(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTiers(t, 2)
+	c := NewCache(tiers)
+
+	require.NoError(t, c.Set(ctx, "num", int64(1), time.Minute))
+	n, err := c.IncrBy(ctx, "num", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	// 前面的层失效，读取的时候拿到最新的值
+	assert.False(t, exist(tiers[0].Cache, "num"))
+	assert.Equal(t, int64(3), c.Get(ctx, "num").Val)
+
+	n, err = c.DecrBy(ctx, "num", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	f, err := c.IncrByFloat(ctx, "num", 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+
+	n, err = c.SAdd(ctx, "set", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = c.SRem(ctx, "set", "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = c.LPush(ctx, "list", "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	val := c.LPop(ctx, "list")
+	require.NoError(t, val.Err)
+	assert.False(t, exist(tiers[1].Cache, "list"))
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConflict 可以用 errors.Is 判断 CompareAndSwap 和 SetIfVersion 是否因为值已经被修改而失败
+var ErrConflict = errors.New("ecache: 值已经被修改")
+
+// ConflictError CompareAndSwap 和 SetIfVersion 的条件不满足
+type ConflictError struct {
+	Key string
+	// Version key 当前的版本号，只有 SetIfVersion 返回的时候有意义
+	Version int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("ecache: key %s 的值已经被修改，当前版本 %d", e.Key, e.Version)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// VersionedValue 带有版本号的值
+type VersionedValue struct {
+	Value
+	// Version 版本号只用来判断是否相等，0 表示 key 不存在
+	Version int64
+}
+
+// CASCache 支持乐观并发控制的缓存，用来实现不会丢失更新的 读取-修改-写入
+type CASCache interface {
+	// CompareAndSwap key 当前的值等于 oldVal 的时候写入 newVal，有效期为 0 表示永不过期
+	// key 不存在的时候返回 errs.ErrKeyNotExist，值不相等的时候返回 *ConflictError
+	CompareAndSwap(ctx context.Context, key string, oldVal, newVal any, expiration time.Duration) error
+	// GetWithVersion 返回值和它的版本号
+	GetWithVersion(ctx context.Context, key string) VersionedValue
+	// SetIfVersion key 当前的版本号等于 version 的时候写入 val，返回新的版本号，否则返回 *ConflictError
+	// version 为 0 的时候要求 key 不存在。
+	// 通过其它方法修改值之后版本号也会变化，所以读到版本号之后被修改过的值会写入失败。
+	// 注意 Redis 的实现通过值的 SHA1 判断值有没有被其它命令修改过，改成别的值之后又改回原来的值（A→B→A）版本号不会变化
+	SetIfVersion(ctx context.Context, key string, val any, version int64, expiration time.Duration) (int64, error)
+}
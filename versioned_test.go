@@ -0,0 +1,35 @@
+// Copyright 2023 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ecache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConflictError(t *testing.T) {
+	var err error = &ConflictError{Key: "key", Version: 3}
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.True(t, errors.Is(fmt.Errorf("更新用户: %w", err), ErrConflict))
+	assert.False(t, errors.Is(errors.New("other"), ErrConflict))
+
+	var conflict *ConflictError
+	assert.True(t, errors.As(fmt.Errorf("更新用户: %w", err), &conflict))
+	assert.Equal(t, int64(3), conflict.Version)
+	assert.Equal(t, "ecache: key key 的值已经被修改，当前版本 3", err.Error())
+}